@@ -5,8 +5,11 @@ import (
 	"log"
 	"net/http"
 	"ticket-sys/internal/config"
+	"ticket-sys/internal/database"
+	"ticket-sys/internal/events"
 	"ticket-sys/internal/handlers"
 	"ticket-sys/internal/middleware"
+	"ticket-sys/internal/models"
 
 	_ "ticket-sys/cmd/docs"
 
@@ -46,6 +49,63 @@ func main() {
 	}
 	defer conn.Close(context.Background())
 
+	// Apply pending schema migrations
+	if err := database.Migrate(context.Background(), conn); err != nil {
+		log.Fatalf("Failed to migrate the database: %v", err)
+	}
+
+	// Every handler sends notifications through the same mailbox
+	handlers.SetMailSettings(handlers.MailSettings{
+		Server:       cfg.Mail.Server,
+		User:         cfg.Mail.User,
+		Password:     cfg.Mail.Password,
+		Sender:       cfg.Mail.Sender,
+		DashboardURL: cfg.Mail.DashboardURL,
+	})
+	if cfg.Mail.User == "" {
+		log.Println("SMTP_USER is not set, email notifications are disabled")
+	}
+
+	// Background jobs get their own connection as pgx.Conn is not safe for
+	// concurrent use
+	jobConn, err := pgx.Connect(context.Background(), cfg.Database.URL)
+	if err != nil {
+		log.Fatalf("Failed to connect to the database: %v", err)
+	}
+	defer jobConn.Close(context.Background())
+
+	jobHandler := handlers.NewAuthHandler(jobConn, []byte(cfg.JWT.Secret))
+	jobHandler.SetTicketRetention(cfg.Jobs.TicketRetention)
+	go jobHandler.RunJobs(context.Background(), cfg.Jobs.Interval)
+
+	// Webhook deliveries are posted from another connection so a slow
+	// receiver does not hold up the jobs
+	webhookConn, err := pgx.Connect(context.Background(), cfg.Database.URL)
+	if err != nil {
+		log.Fatalf("Failed to connect to the database: %v", err)
+	}
+	defer webhookConn.Close(context.Background())
+
+	webhookHandler := handlers.NewAuthHandler(webhookConn, []byte(cfg.JWT.Secret))
+	go webhookHandler.RunWebhookDeliveries(context.Background(), cfg.Webhooks.Interval)
+
+	// Emailed requests are picked up from the maildir the mail server
+	// delivers the gateway mailbox into
+	if cfg.MailGateway.Maildir != "" {
+		mailConn, err := pgx.Connect(context.Background(), cfg.Database.URL)
+		if err != nil {
+			log.Fatalf("Failed to connect to the database: %v", err)
+		}
+		defer mailConn.Close(context.Background())
+
+		mailHandler := handlers.NewAuthHandler(mailConn, []byte(cfg.JWT.Secret))
+		go mailHandler.RunMailGateway(context.Background(), cfg.MailGateway.Maildir, cfg.MailGateway.Interval, cfg.MailGateway.Organisation, cfg.MailGateway.AuthservID, models.TicketCreate{
+			RequestType:  cfg.MailGateway.RequestType,
+			TaskPriority: cfg.MailGateway.Priority,
+			AssignedTo:   cfg.MailGateway.AssignedTo,
+		})
+	}
+
 	// Set Gin mode
 	if cfg.Environment == "production" {
 		gin.SetMode(gin.ReleaseMode)
@@ -72,7 +132,8 @@ func main() {
 
 	config := cors.DefaultConfig()
 	config.AllowOrigins = []string{"*"}
-	config.AllowHeaders = []string{"Authorization", "Origin", "Content-Type", "Accept"}
+	config.AllowHeaders = []string{"Authorization", "Origin", "Content-Type", "Accept", "If-Match", "If-None-Match"}
+	config.ExposeHeaders = []string{"ETag"}
 
 	r.Use(cors.New(config))
 
@@ -85,30 +146,162 @@ func main() {
 	// Initialize handlers with JWT configuration
 	authHandler := handlers.NewAuthHandler(conn, []byte(cfg.JWT.Secret))
 
+	// Live ticket streams are fed by Postgres LISTEN/NOTIFY
+	hub := events.NewHub(cfg.Database.URL)
+	go hub.Run(context.Background())
+	authHandler.SetEventHub(hub)
+	authHandler.SetBoardOrigins(cfg.Board.AllowedOrigins)
+
 	// Public routes access
 	public := r.Group("/api/v1")
 	{
 		public.POST("/register", authHandler.Register)
 		public.POST("/login", authHandler.Login)
+		public.POST("/login/mfa", authHandler.LoginMFA)
 		public.POST("/refresh-token", authHandler.RefreshToken)
+		public.POST("/verify-email", authHandler.VerifyEmail)
+	}
+
+	// Routes still open to users whose role requires two-factor
+	// authentication they have not set up yet
+	enrollment := r.Group("/api/v1")
+	enrollment.Use(middleware.AuthMiddleware([]byte(cfg.JWT.Secret)))
+	{
+		enrollment.POST("/logout", authHandler.Logout)
+		enrollment.GET("/me", authHandler.GetMe)
+		enrollment.POST("/me/mfa/enroll", authHandler.EnrollMFA)
+		enrollment.POST("/me/mfa/confirm", authHandler.ConfirmMFA)
 	}
 
 	// Protected routes with JWT middleware
 	protected := r.Group("/api/v1")
-	protected.Use(middleware.AuthMiddleware([]byte(cfg.JWT.Secret)))
+	protected.Use(middleware.AuthMiddleware([]byte(cfg.JWT.Secret)), middleware.RequireMFAEnrolled())
 	{
 
-		protected.POST("/logout", authHandler.Logout)
 		protected.GET("/profile", getUserProfile)
+		protected.PATCH("/me", authHandler.UpdateMe)
+		protected.POST("/me/password", authHandler.ChangePassword)
+		protected.POST("/me/email", authHandler.ChangeEmail)
+		protected.POST("/me/mfa/disable", authHandler.DisableMFA)
+		protected.POST("/me/mfa/recovery-codes", authHandler.RegenerateRecoveryCodes)
 		protected.POST("/tickets", authHandler.CreateTicket)
 		protected.GET("/tickets", authHandler.GetTickets)
-		protected.GET("/tickets/:id", authHandler.GetTicket)
-		protected.PATCH("/tickets/:id", authHandler.UpdateTicket)
-		protected.PATCH("/tickets/:id/pending", authHandler.UpdatePendingTicket)
-		protected.PATCH("/tickets/:id/completed", authHandler.UpdateCompletedTicket)
-		protected.DELETE("/tickets/:id", authHandler.DeleteTicket)
+		protected.GET("/tickets/stream", authHandler.StreamTickets)
+		protected.POST("/tickets/board/tickets", authHandler.CreateBoardTicket)
+		protected.GET("/tickets/export", authHandler.ExportTickets)
+		protected.POST("/tickets/bulk", authHandler.BulkUpdateTickets)
+		protected.POST("/tickets/import", authHandler.ImportTickets)
+		protected.GET("/tickets/:id", authHandler.RequireTenant("ticket"), authHandler.GetTicket)
+		protected.PATCH("/tickets/:id", authHandler.RequireTenant("ticket"), authHandler.UpdateTicket)
+		protected.PATCH("/tickets/:id/pending", authHandler.RequireTenant("ticket"), authHandler.UpdatePendingTicket)
+		protected.PATCH("/tickets/:id/completed", authHandler.RequireTenant("ticket"), authHandler.UpdateCompletedTicket)
+		protected.DELETE("/tickets/:id", authHandler.RequireTenant("ticket"), authHandler.DeleteTicket)
+		protected.POST("/tickets/:id/assign", authHandler.RequireTenant("ticket"), authHandler.AssignTicket)
+		protected.POST("/tickets/:id/queue", authHandler.RequireTenant("ticket"), authHandler.QueueTicket)
+		protected.POST("/tickets/:id/claim", authHandler.RequireTenant("ticket"), authHandler.ClaimTicket)
+		protected.GET("/tickets/:id/assignments", authHandler.RequireTenant("ticket"), authHandler.GetTicketAssignments)
+		protected.GET("/tickets/:id/watchers", authHandler.RequireTenant("ticket"), authHandler.GetTicketWatchers)
+		protected.GET("/tickets/:id/comments", authHandler.RequireTenant("ticket"), authHandler.GetTicketComments)
+		protected.POST("/tickets/:id/comments", authHandler.RequireTenant("ticket"), authHandler.CreateTicketComment)
+		protected.GET("/subscriptions", authHandler.GetSubscriptions)
+		protected.POST("/subscriptions", authHandler.CreateSubscription)
+		protected.DELETE("/subscriptions/:id", authHandler.RequireTenant("subscription"), authHandler.DeleteSubscription)
+		protected.GET("/notification-preferences", authHandler.GetNotificationPreferences)
+		protected.PUT("/notification-preferences", authHandler.UpdateNotificationPreferences)
 		protected.GET("/users", authHandler.GetUsers)
-		protected.GET("/users/:id", authHandler.GetUser)
+		protected.GET("/users/workload", authHandler.GetUserWorkload)
+		protected.GET("/shifts", authHandler.GetStaffShifts)
+		protected.GET("/shifts/current", authHandler.GetCurrentShifts)
+		protected.GET("/teams", authHandler.GetTeams)
+		protected.GET("/teams/:id", authHandler.RequireTenant("team"), authHandler.GetTeam)
+		protected.GET("/teams/:id/queue", authHandler.RequireTenant("team"), authHandler.GetTeamQueue)
+		protected.GET("/users/:id", authHandler.RequireTenant("user"), authHandler.GetUser)
+		protected.GET("/accommodations", authHandler.GetAccommodations)
+		protected.GET("/accommodations/:id", authHandler.RequireTenant("accommodation"), authHandler.GetAccommodation)
+		protected.GET("/accommodations/:id/rooms", authHandler.RequireTenant("accommodation"), authHandler.GetAccommodationRooms)
+		protected.GET("/accommodations/:id/locations", authHandler.RequireTenant("accommodation"), authHandler.GetAccommodationLocations)
+		protected.GET("/catalogs", authHandler.GetCatalogs)
+		protected.GET("/sla-policies", authHandler.GetSLAPolicies)
+		protected.GET("/organisation", authHandler.GetOrganisation)
+	}
+
+	// Browsers cannot set headers on WebSocket requests, so the dispatcher
+	// board also accepts a single-use ticket in place of the token
+	board := r.Group("/api/v1")
+	board.Use(authHandler.BoardTicketAuth(), middleware.AuthMiddleware([]byte(cfg.JWT.Secret)), middleware.RequireMFAEnrolled())
+	{
+		board.GET("/tickets/board", authHandler.TicketBoard)
+	}
+
+	// Admin-only routes
+	admin := protected.Group("")
+	admin.Use(middleware.RequireRole("admin"))
+	{
+		admin.PATCH("/organisation", authHandler.UpdateOrganisation)
+		admin.POST("/users", authHandler.CreateUser)
+		admin.GET("/invitations", authHandler.GetInvitations)
+		admin.POST("/invitations", authHandler.CreateInvitation)
+		admin.DELETE("/invitations/:id", authHandler.DeleteInvitation)
+		admin.PATCH("/users/:id", authHandler.RequireTenant("user"), authHandler.UpdateUser)
+		admin.DELETE("/users/:id", authHandler.RequireTenant("user"), authHandler.DeleteUser)
+		admin.POST("/users/:id/deactivate", authHandler.RequireTenant("user"), authHandler.DeactivateUser)
+		admin.POST("/users/:id/activate", authHandler.RequireTenant("user"), authHandler.ActivateUser)
+		admin.DELETE("/users/:id/mfa", authHandler.RequireTenant("user"), authHandler.ResetUserMFA)
+		admin.PUT("/users/:id/supervisor", authHandler.RequireTenant("user"), authHandler.SetUserSupervisor)
+		admin.GET("/schedules", authHandler.GetTicketSchedules)
+		admin.POST("/schedules", authHandler.CreateTicketSchedule)
+		admin.GET("/schedules/:id", authHandler.RequireTenant("schedule"), authHandler.GetTicketSchedule)
+		admin.PATCH("/schedules/:id", authHandler.RequireTenant("schedule"), authHandler.UpdateTicketSchedule)
+		admin.DELETE("/schedules/:id", authHandler.RequireTenant("schedule"), authHandler.DeleteTicketSchedule)
+		admin.GET("/tickets/trash", authHandler.GetTicketTrash)
+		admin.POST("/tickets/:id/restore", authHandler.RequireTenant("ticket"), authHandler.RestoreTicket)
+		admin.GET("/webhooks", authHandler.GetWebhooks)
+		admin.POST("/webhooks", authHandler.CreateWebhook)
+		admin.GET("/webhooks/:id", authHandler.RequireTenant("webhook"), authHandler.GetWebhook)
+		admin.PATCH("/webhooks/:id", authHandler.RequireTenant("webhook"), authHandler.UpdateWebhook)
+		admin.DELETE("/webhooks/:id", authHandler.RequireTenant("webhook"), authHandler.DeleteWebhook)
+		admin.GET("/webhooks/:id/deliveries", authHandler.RequireTenant("webhook"), authHandler.GetWebhookDeliveries)
+		admin.POST("/webhooks/:id/test", authHandler.RequireTenant("webhook"), authHandler.TestWebhook)
+		admin.GET("/assignment-rules", authHandler.GetAssignmentRules)
+		admin.POST("/assignment-rules", authHandler.CreateAssignmentRule)
+		admin.POST("/assignment-rules/dry-run", authHandler.DryRunAssignmentRules)
+		admin.GET("/assignment-rules/:id", authHandler.RequireTenant("assignment_rule"), authHandler.GetAssignmentRule)
+		admin.PATCH("/assignment-rules/:id", authHandler.RequireTenant("assignment_rule"), authHandler.UpdateAssignmentRule)
+		admin.DELETE("/assignment-rules/:id", authHandler.RequireTenant("assignment_rule"), authHandler.DeleteAssignmentRule)
+		admin.POST("/shifts", authHandler.CreateStaffShift)
+		admin.PATCH("/shifts/:id", authHandler.RequireTenant("shift"), authHandler.UpdateStaffShift)
+		admin.DELETE("/shifts/:id", authHandler.RequireTenant("shift"), authHandler.DeleteStaffShift)
+		admin.POST("/teams", authHandler.CreateTeam)
+		admin.PATCH("/teams/:id", authHandler.RequireTenant("team"), authHandler.UpdateTeam)
+		admin.DELETE("/teams/:id", authHandler.RequireTenant("team"), authHandler.DeleteTeam)
+		admin.POST("/accommodations", authHandler.CreateAccommodation)
+		admin.PATCH("/accommodations/:id", authHandler.RequireTenant("accommodation"), authHandler.UpdateAccommodation)
+		admin.DELETE("/accommodations/:id", authHandler.RequireTenant("accommodation"), authHandler.DeleteAccommodation)
+		admin.POST("/accommodations/:id/rooms", authHandler.RequireTenant("accommodation"), authHandler.CreateAccommodationRoom)
+		admin.DELETE("/accommodations/:id/rooms/:room_id", authHandler.RequireTenant("accommodation"), authHandler.DeleteAccommodationRoom)
+		admin.POST("/accommodations/:id/locations", authHandler.RequireTenant("accommodation"), authHandler.CreateAccommodationLocation)
+		admin.DELETE("/accommodations/:id/locations/:location_id", authHandler.RequireTenant("accommodation"), authHandler.DeleteAccommodationLocation)
+		admin.GET("/reports/ticket-counts", authHandler.GetTicketCountReport)
+		admin.GET("/reports/completion-times", authHandler.GetCompletionTimeReport)
+		admin.GET("/reports/sla-breaches", authHandler.GetSLABreachReport)
+		admin.GET("/reports/backlog-age", authHandler.GetBacklogAgeReport)
+	}
+
+	// Routes for admins of the host organisation, which manage what every
+	// organisation shares
+	host := admin.Group("")
+	host.Use(authHandler.RequireHostOrganisation())
+	{
+		host.GET("/organisations", authHandler.GetOrganisations)
+		host.POST("/organisations", authHandler.CreateOrganisation)
+		host.POST("/catalogs/request-types", authHandler.CreateRequestType)
+		host.PATCH("/catalogs/request-types/:id", authHandler.UpdateRequestType)
+		host.DELETE("/catalogs/request-types/:id", authHandler.DeleteRequestType)
+		host.POST("/catalogs/priorities", authHandler.CreatePriority)
+		host.PATCH("/catalogs/priorities/:id", authHandler.UpdatePriority)
+		host.DELETE("/catalogs/priorities/:id", authHandler.DeletePriority)
+		host.PUT("/sla-policies/:priority_id", authHandler.SetSLAPolicy)
+		host.DELETE("/sla-policies/:priority_id", authHandler.DeleteSLAPolicy)
 	}
 
 	// Swagger UI route
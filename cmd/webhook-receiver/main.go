@@ -0,0 +1,57 @@
+// Command webhook-receiver is a local stand-in for a webhook endpoint. It
+// verifies each delivery's signature and logs the payload, so webhooks can
+// be tried without a real integration:
+//
+//	go run ./cmd/webhook-receiver -addr :9100 -secret <webhook secret>
+//
+// and register http://localhost:9100/ as the webhook URL.
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+func main() {
+	addr := flag.String("addr", ":9100", "listen address")
+	secret := flag.String("secret", "", "webhook secret used to verify signatures")
+	status := flag.Int("status", http.StatusNoContent, "status code to answer with, to try retries")
+	flag.Parse()
+
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		verified := "unchecked"
+		if *secret != "" {
+			mac := hmac.New(sha256.New, []byte(*secret))
+			mac.Write([]byte(r.Header.Get("X-Webhook-Timestamp") + "."))
+			mac.Write(body)
+			expected := hex.EncodeToString(mac.Sum(nil))
+			signature := strings.TrimPrefix(r.Header.Get("X-Webhook-Signature"), "sha256=")
+
+			if !hmac.Equal([]byte(signature), []byte(expected)) {
+				log.Printf("delivery %s: invalid signature", r.Header.Get("X-Webhook-Delivery"))
+				http.Error(w, "invalid signature", http.StatusUnauthorized)
+				return
+			}
+			verified = "valid"
+		}
+
+		log.Printf("delivery %s event=%s signature=%s\n%s",
+			r.Header.Get("X-Webhook-Delivery"), r.Header.Get("X-Webhook-Event"), verified, body)
+		w.WriteHeader(*status)
+	})
+
+	log.Printf("webhook receiver listening on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, nil))
+}
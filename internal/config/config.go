@@ -2,7 +2,10 @@ package config
 
 import (
 	"fmt"
+	"log"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -30,6 +33,46 @@ type Config struct {
 		RefreshExpiry time.Duration
 	}
 
+	Board struct {
+		// AllowedOrigins are the browser origins, e.g. the dashboard's,
+		// that may open the dispatcher board WebSocket
+		AllowedOrigins []string
+	}
+
+	Jobs struct {
+		Interval time.Duration
+		// TicketRetention is how long deleted tickets stay in the trash
+		TicketRetention time.Duration
+	}
+
+	Webhooks struct {
+		Interval time.Duration
+	}
+
+	// Mail is the SMTP account notifications are sent through
+	Mail struct {
+		Server       string
+		User         string
+		Password     string
+		Sender       string
+		DashboardURL string
+	}
+
+	MailGateway struct {
+		Maildir     string
+		Interval    time.Duration
+		RequestType string
+		Priority    string
+		AssignedTo  int
+		// Organisation is the slug of the organisation emailed tickets
+		// are filed in
+		Organisation string
+		// AuthservID names the receiving mail server in the
+		// Authentication-Results headers it adds. Only senders it
+		// authenticated are matched to staff accounts.
+		AuthservID string
+	}
+
 	Environment string
 }
 
@@ -56,6 +99,60 @@ func Load() (*Config, error) {
 	cfg.JWT.TokenExpiry = time.Minute       // 24 hours
 	cfg.JWT.RefreshExpiry = time.Hour * 168 // 7 days
 
+	// Dispatcher board config
+	for _, origin := range strings.Split(getEnv("BOARD_ALLOWED_ORIGINS", "http://192.168.1.57:9000"), ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			cfg.Board.AllowedOrigins = append(cfg.Board.AllowedOrigins, origin)
+		}
+	}
+
+	// Background jobs config
+	interval, err := getInterval("JOBS_INTERVAL", time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Jobs.Interval = interval
+
+	retention, err := time.ParseDuration(getEnv("TICKET_RETENTION", "720h"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid TICKET_RETENTION: %w", err)
+	}
+	cfg.Jobs.TicketRetention = retention
+
+	// Webhook delivery config
+	webhookInterval, err := getInterval("WEBHOOK_INTERVAL", 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Webhooks.Interval = webhookInterval
+
+	// Mail config; the SMTP credentials only ever come from the environment
+	cfg.Mail.Server = getEnv("SMTP_SERVER", "smtp.office365.com:587")
+	cfg.Mail.User = getEnv("SMTP_USER", "")
+	cfg.Mail.Password = getEnv("SMTP_PASSWORD", "")
+	cfg.Mail.Sender = getEnv("MAIL_SENDER", "")
+	cfg.Mail.DashboardURL = getEnv("DASHBOARD_URL", "http://192.168.1.57:9000/dashboard")
+
+	// Email-to-ticket gateway config; the gateway is off without a maildir
+	cfg.MailGateway.Maildir = getEnv("MAIL_GATEWAY_MAILDIR", "")
+	mailInterval, err := getInterval("MAIL_GATEWAY_INTERVAL", 30*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	cfg.MailGateway.Interval = mailInterval
+	cfg.MailGateway.RequestType = getEnv("MAIL_GATEWAY_REQUEST_TYPE", "Other")
+	cfg.MailGateway.Priority = getEnv("MAIL_GATEWAY_PRIORITY", "Medium")
+	cfg.MailGateway.Organisation = getEnv("MAIL_GATEWAY_ORGANISATION", "default")
+	cfg.MailGateway.AuthservID = getEnv("MAIL_GATEWAY_AUTHSERV_ID", "")
+	// Without an assignee, emailed tickets are left to the assignment rules
+	if value := getEnv("MAIL_GATEWAY_ASSIGNEE", ""); value != "" {
+		assignee, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("MAIL_GATEWAY_ASSIGNEE must be a user ID: %w", err)
+		}
+		cfg.MailGateway.AssignedTo = assignee
+	}
+
 	cfg.Environment = getEnv("ENV", "production")
 
 	return cfg, nil
@@ -68,6 +165,20 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// getInterval reads how often a background loop runs. Tickers cannot run on
+// a zero or negative interval, so those fall back to the default.
+func getInterval(key string, defaultValue time.Duration) (time.Duration, error) {
+	interval, err := time.ParseDuration(getEnv(key, defaultValue.String()))
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	if interval <= 0 {
+		log.Printf("%s must be positive, using %s", key, defaultValue)
+		return defaultValue, nil
+	}
+	return interval, nil
+}
+
 func (c *Config) GetDSN() string {
 	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
 		c.Database.Host,
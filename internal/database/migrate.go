@@ -0,0 +1,67 @@
+package database
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+
+	"github.com/jackc/pgx/v5"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// Migrate applies any pending SQL migrations in filename order.
+// Applied migrations are recorded in schema_migration so each file runs once.
+func Migrate(ctx context.Context, conn *pgx.Conn) error {
+	_, err := conn.Exec(ctx, `
+        CREATE TABLE IF NOT EXISTS schema_migration (
+            name TEXT PRIMARY KEY,
+            applied_date TIMESTAMPTZ NOT NULL DEFAULT now()
+        )`)
+	if err != nil {
+		return fmt.Errorf("create schema_migration: %w", err)
+	}
+
+	names, err := fs.Glob(migrations, "migrations/*.sql")
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		var applied bool
+		err := conn.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM schema_migration WHERE name = $1)", name).Scan(&applied)
+		if err != nil {
+			return fmt.Errorf("check migration %s: %w", name, err)
+		}
+		if applied {
+			continue
+		}
+
+		script, err := migrations.ReadFile(name)
+		if err != nil {
+			return err
+		}
+
+		tx, err := conn.Begin(ctx)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, string(script)); err != nil {
+			tx.Rollback(ctx)
+			return fmt.Errorf("apply migration %s: %w", name, err)
+		}
+		if _, err := tx.Exec(ctx, "INSERT INTO schema_migration (name) VALUES ($1)", name); err != nil {
+			tx.Rollback(ctx)
+			return fmt.Errorf("record migration %s: %w", name, err)
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,80 @@
+-- Accommodations, rooms and named locations become first-class entities.
+-- The free-text columns on ticket are kept and backfilled so existing
+-- clients keep working while they move over to the ID references.
+
+CREATE TABLE IF NOT EXISTS accommodation (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    type TEXT NOT NULL DEFAULT '',
+    address TEXT NOT NULL DEFAULT '',
+    created_date TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS accommodation_name_key
+    ON accommodation (lower(btrim(name)));
+
+CREATE TABLE IF NOT EXISTS accommodation_room (
+    id SERIAL PRIMARY KEY,
+    accommodation_id INT NOT NULL REFERENCES accommodation (id) ON DELETE CASCADE,
+    room_number INT NOT NULL,
+    name TEXT NOT NULL DEFAULT '',
+    UNIQUE (accommodation_id, room_number)
+);
+
+CREATE TABLE IF NOT EXISTS accommodation_location (
+    id SERIAL PRIMARY KEY,
+    accommodation_id INT NOT NULL REFERENCES accommodation (id) ON DELETE CASCADE,
+    name TEXT NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS accommodation_location_name_key
+    ON accommodation_location (accommodation_id, lower(btrim(name)));
+
+ALTER TABLE ticket
+    ADD COLUMN IF NOT EXISTS accommodation_id INT REFERENCES accommodation (id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS room_id INT REFERENCES accommodation_room (id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS location_id INT REFERENCES accommodation_location (id) ON DELETE SET NULL;
+
+-- Backfill entities from the text already on tickets, newest spelling wins.
+INSERT INTO accommodation (name, type)
+SELECT DISTINCT ON (lower(btrim(accommodation_name)))
+       btrim(accommodation_name), btrim(coalesce(accommodation_type, ''))
+FROM ticket
+WHERE btrim(coalesce(accommodation_name, '')) <> ''
+ORDER BY lower(btrim(accommodation_name)), creation_date DESC
+ON CONFLICT DO NOTHING;
+
+UPDATE ticket t
+SET accommodation_id = a.id
+FROM accommodation a
+WHERE t.accommodation_id IS NULL
+  AND lower(btrim(t.accommodation_name)) = lower(btrim(a.name));
+
+INSERT INTO accommodation_room (accommodation_id, room_number)
+SELECT DISTINCT accommodation_id, accommodation_room_number
+FROM ticket
+WHERE accommodation_id IS NOT NULL AND accommodation_room_number > 0
+ON CONFLICT DO NOTHING;
+
+UPDATE ticket t
+SET room_id = r.id
+FROM accommodation_room r
+WHERE t.room_id IS NULL
+  AND r.accommodation_id = t.accommodation_id
+  AND r.room_number = t.accommodation_room_number;
+
+INSERT INTO accommodation_location (accommodation_id, name)
+SELECT DISTINCT ON (accommodation_id, lower(btrim(accommodation_specific_location)))
+       accommodation_id, btrim(accommodation_specific_location)
+FROM ticket
+WHERE accommodation_id IS NOT NULL
+  AND btrim(coalesce(accommodation_specific_location, '')) <> ''
+ORDER BY accommodation_id, lower(btrim(accommodation_specific_location)), creation_date DESC
+ON CONFLICT DO NOTHING;
+
+UPDATE ticket t
+SET location_id = l.id
+FROM accommodation_location l
+WHERE t.location_id IS NULL
+  AND l.accommodation_id = t.accommodation_id
+  AND lower(btrim(l.name)) = lower(btrim(t.accommodation_specific_location));
@@ -0,0 +1,60 @@
+-- Staff roles and admin-managed catalogs for request types and priorities.
+
+ALTER TABLE staff_user
+    ADD COLUMN IF NOT EXISTS role TEXT NOT NULL DEFAULT 'staff';
+
+-- Someone has to be able to manage the catalogs: promote the first
+-- registered account so an existing install is never left without an admin.
+UPDATE staff_user
+SET role = 'admin'
+WHERE id = (SELECT min(id) FROM staff_user)
+  AND NOT EXISTS (SELECT 1 FROM staff_user WHERE role = 'admin');
+
+CREATE TABLE IF NOT EXISTS request_type (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    sort_order INT NOT NULL DEFAULT 0,
+    active BOOLEAN NOT NULL DEFAULT TRUE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS request_type_name_key
+    ON request_type (lower(btrim(name)));
+
+CREATE TABLE IF NOT EXISTS task_priority (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    sort_order INT NOT NULL DEFAULT 0,
+    colour TEXT NOT NULL DEFAULT '',
+    default_sla_minutes INT,
+    active BOOLEAN NOT NULL DEFAULT TRUE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS task_priority_name_key
+    ON task_priority (lower(btrim(name)));
+
+-- Seed the catalogs with every value already used on tickets...
+INSERT INTO request_type (name)
+SELECT DISTINCT ON (lower(btrim(request_type))) btrim(request_type)
+FROM ticket
+WHERE btrim(coalesce(request_type, '')) <> ''
+ORDER BY lower(btrim(request_type))
+ON CONFLICT DO NOTHING;
+
+INSERT INTO task_priority (name)
+SELECT DISTINCT ON (lower(btrim(task_priority))) btrim(task_priority)
+FROM ticket
+WHERE btrim(coalesce(task_priority, '')) <> ''
+ORDER BY lower(btrim(task_priority))
+ON CONFLICT DO NOTHING;
+
+-- ...or with sensible defaults on a fresh install.
+INSERT INTO request_type (name, sort_order)
+SELECT name, sort_order
+FROM (VALUES ('Plumbing', 1), ('Electrical', 2), ('Housekeeping', 3), ('Maintenance', 4), ('Other', 5)) AS d (name, sort_order)
+WHERE NOT EXISTS (SELECT 1 FROM request_type);
+
+INSERT INTO task_priority (name, sort_order, colour, default_sla_minutes)
+SELECT name, sort_order, colour, default_sla_minutes
+FROM (VALUES ('Low', 1, '#4caf50', 4320), ('Medium', 2, '#ff9800', 1440), ('High', 3, '#f44336', 240)) AS d (name, sort_order, colour, default_sla_minutes)
+WHERE NOT EXISTS (SELECT 1 FROM task_priority);
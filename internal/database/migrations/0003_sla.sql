@@ -0,0 +1,41 @@
+-- Per-priority SLA policies and the ticket deadlines the escalation job
+-- watches. alert_level is 0 (on track), 1 (deadline approaching) or
+-- 2 (deadline breached).
+
+ALTER TABLE staff_user
+    ADD COLUMN IF NOT EXISTS supervisor_id INT REFERENCES staff_user (id) ON DELETE SET NULL;
+
+CREATE TABLE IF NOT EXISTS sla_policy (
+    id SERIAL PRIMARY KEY,
+    priority_id INT NOT NULL UNIQUE REFERENCES task_priority (id) ON DELETE CASCADE,
+    response_minutes INT NOT NULL CHECK (response_minutes > 0),
+    resolution_minutes INT NOT NULL CHECK (resolution_minutes > 0),
+    warning_percent INT NOT NULL DEFAULT 75 CHECK (warning_percent BETWEEN 1 AND 99)
+);
+
+-- Effective targets per priority; the catalog default SLA covers
+-- resolution when no explicit policy exists.
+CREATE OR REPLACE VIEW sla_target AS
+SELECT p.name AS priority,
+       sp.response_minutes,
+       COALESCE(sp.resolution_minutes, p.default_sla_minutes) AS resolution_minutes,
+       COALESCE(sp.warning_percent, 75) AS warning_percent
+FROM task_priority p
+LEFT JOIN sla_policy sp ON sp.priority_id = p.id;
+
+ALTER TABLE ticket
+    ADD COLUMN IF NOT EXISTS response_due_at TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS due_at TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS responded_at TIMESTAMPTZ;
+
+-- We don't know when older tickets were first picked up, so treat anything
+-- already past "Assigned" as responded on creation.
+UPDATE ticket
+SET responded_at = creation_date
+WHERE responded_at IS NULL AND task_status <> 'Assigned';
+
+UPDATE ticket t
+SET response_due_at = t.creation_date + make_interval(mins => s.response_minutes),
+    due_at = t.creation_date + make_interval(mins => s.resolution_minutes)
+FROM sla_target s
+WHERE lower(btrim(s.priority)) = lower(btrim(t.task_priority));
@@ -0,0 +1,23 @@
+-- Recurring ticket schedules for preventive maintenance. template holds a
+-- TicketCreate payload; the job creates a ticket from it at next_run_at.
+
+CREATE TABLE IF NOT EXISTS ticket_schedule (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    recurrence TEXT NOT NULL,
+    timezone TEXT NOT NULL DEFAULT 'Asia/Tokyo',
+    starts_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    template JSONB NOT NULL,
+    assigned_to INT NOT NULL REFERENCES staff_user (id),
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    next_run_at TIMESTAMPTZ,
+    last_run_at TIMESTAMPTZ,
+    last_ticket_id INT REFERENCES ticket (id) ON DELETE SET NULL,
+    created_date TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS ticket_schedule_next_run_idx
+    ON ticket_schedule (next_run_at) WHERE active;
+
+ALTER TABLE ticket
+    ADD COLUMN IF NOT EXISTS schedule_id INT REFERENCES ticket_schedule (id) ON DELETE SET NULL;
@@ -0,0 +1,23 @@
+-- Reassignment history and supporting assignees. ticket.assigned_to stays
+-- the lead assignee; ticket_assignee lists anyone working alongside them.
+
+CREATE TABLE IF NOT EXISTS ticket_assignee (
+    ticket_id INT NOT NULL REFERENCES ticket (id) ON DELETE CASCADE,
+    user_id INT NOT NULL REFERENCES staff_user (id) ON DELETE CASCADE,
+    added_date TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (ticket_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS ticket_assignee_user_idx ON ticket_assignee (user_id);
+
+CREATE TABLE IF NOT EXISTS ticket_assignment (
+    id SERIAL PRIMARY KEY,
+    ticket_id INT NOT NULL REFERENCES ticket (id) ON DELETE CASCADE,
+    from_user_id INT REFERENCES staff_user (id) ON DELETE SET NULL,
+    to_user_id INT REFERENCES staff_user (id) ON DELETE SET NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    assigned_by INT REFERENCES staff_user (id) ON DELETE SET NULL,
+    created_date TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS ticket_assignment_ticket_idx ON ticket_assignment (ticket_id);
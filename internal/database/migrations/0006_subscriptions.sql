@@ -0,0 +1,31 @@
+-- Watchers: users subscribe to a ticket, an accommodation or a request
+-- type, and choose which notification events they want. Events without a
+-- preference row are delivered.
+
+CREATE TABLE IF NOT EXISTS subscription (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES staff_user (id) ON DELETE CASCADE,
+    ticket_id INT REFERENCES ticket (id) ON DELETE CASCADE,
+    accommodation_id INT REFERENCES accommodation (id) ON DELETE CASCADE,
+    request_type_id INT REFERENCES request_type (id) ON DELETE CASCADE,
+    created_date TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CHECK (num_nonnulls(ticket_id, accommodation_id, request_type_id) = 1)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS subscription_ticket_key
+    ON subscription (user_id, ticket_id) WHERE ticket_id IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS subscription_accommodation_key
+    ON subscription (user_id, accommodation_id) WHERE accommodation_id IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS subscription_request_type_key
+    ON subscription (user_id, request_type_id) WHERE request_type_id IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS subscription_ticket_idx ON subscription (ticket_id);
+CREATE INDEX IF NOT EXISTS subscription_accommodation_idx ON subscription (accommodation_id);
+CREATE INDEX IF NOT EXISTS subscription_request_type_idx ON subscription (request_type_id);
+
+CREATE TABLE IF NOT EXISTS notification_preference (
+    user_id INT NOT NULL REFERENCES staff_user (id) ON DELETE CASCADE,
+    event TEXT NOT NULL,
+    enabled BOOLEAN NOT NULL,
+    PRIMARY KEY (user_id, event)
+);
@@ -0,0 +1,52 @@
+-- Ticket change feed. A trigger records every ticket change in ticket_event
+-- and announces it on the ticket_events channel, so each server instance
+-- can push it to its stream clients. Changes that only move SLA deadlines
+-- are not recorded.
+
+CREATE TABLE IF NOT EXISTS ticket_event (
+    id BIGSERIAL PRIMARY KEY,
+    ticket_id INT NOT NULL,
+    event TEXT NOT NULL,
+    assigned_to INT,
+    accommodation_id INT,
+    data JSONB NOT NULL,
+    created_date TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS ticket_event_created_idx ON ticket_event (created_date);
+
+CREATE OR REPLACE FUNCTION record_ticket_event() RETURNS trigger AS $$
+DECLARE
+    t ticket;
+    kind TEXT;
+    event_id BIGINT;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        t := OLD;
+        kind := 'deleted';
+    ELSE
+        t := NEW;
+        IF TG_OP = 'INSERT' THEN
+            kind := 'created';
+        ELSIF NEW.task_status IS DISTINCT FROM OLD.task_status THEN
+            kind := 'status_changed';
+        ELSIF to_jsonb(NEW) - 'response_due_at' - 'due_at' = to_jsonb(OLD) - 'response_due_at' - 'due_at' THEN
+            RETURN NULL;
+        ELSE
+            kind := 'updated';
+        END IF;
+    END IF;
+
+    INSERT INTO ticket_event (ticket_id, event, assigned_to, accommodation_id, data)
+    VALUES (t.id, kind, t.assigned_to, t.accommodation_id, to_jsonb(t) - 'image')
+    RETURNING id INTO event_id;
+
+    PERFORM pg_notify('ticket_events', event_id::text);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS ticket_event_trigger ON ticket;
+CREATE TRIGGER ticket_event_trigger
+    AFTER INSERT OR UPDATE OR DELETE ON ticket
+    FOR EACH ROW EXECUTE FUNCTION record_ticket_event();
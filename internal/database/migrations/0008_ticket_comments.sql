@@ -0,0 +1,35 @@
+-- Ticket comments. author_name is kept with the comment so comments from
+-- people without an account, or from since-deleted users, still show who
+-- wrote them. New comments are recorded in the ticket change feed.
+
+CREATE TABLE IF NOT EXISTS ticket_comment (
+    id SERIAL PRIMARY KEY,
+    ticket_id INT NOT NULL REFERENCES ticket (id) ON DELETE CASCADE,
+    author_id INT REFERENCES staff_user (id) ON DELETE SET NULL,
+    author_name TEXT NOT NULL,
+    body TEXT NOT NULL,
+    source TEXT NOT NULL DEFAULT 'app',
+    created_date TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS ticket_comment_ticket_idx ON ticket_comment (ticket_id, created_date);
+
+CREATE OR REPLACE FUNCTION record_ticket_comment_event() RETURNS trigger AS $$
+DECLARE
+    event_id BIGINT;
+BEGIN
+    INSERT INTO ticket_event (ticket_id, event, assigned_to, accommodation_id, data)
+    SELECT t.id, 'commented', t.assigned_to, t.accommodation_id, to_jsonb(NEW)
+    FROM ticket t
+    WHERE t.id = NEW.ticket_id
+    RETURNING id INTO event_id;
+
+    PERFORM pg_notify('ticket_events', event_id::text);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS ticket_comment_event_trigger ON ticket_comment;
+CREATE TRIGGER ticket_comment_event_trigger
+    AFTER INSERT ON ticket_comment
+    FOR EACH ROW EXECUTE FUNCTION record_ticket_comment_event();
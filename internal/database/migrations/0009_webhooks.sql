@@ -0,0 +1,52 @@
+-- Outgoing webhooks. Every recorded ticket event is queued for each active
+-- webhook whose event filter matches (an empty filter matches everything);
+-- the delivery worker posts queued payloads, retrying with backoff.
+
+CREATE TABLE IF NOT EXISTS webhook (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    url TEXT NOT NULL,
+    secret TEXT NOT NULL,
+    events TEXT[] NOT NULL DEFAULT '{}',
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_date TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS webhook_delivery (
+    id BIGSERIAL PRIMARY KEY,
+    webhook_id INT NOT NULL REFERENCES webhook (id) ON DELETE CASCADE,
+    event TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'delivered', 'failed')),
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_status_code INT,
+    last_error TEXT,
+    created_date TIMESTAMPTZ NOT NULL DEFAULT now(),
+    delivered_date TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS webhook_delivery_pending_idx
+    ON webhook_delivery (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS webhook_delivery_webhook_idx
+    ON webhook_delivery (webhook_id, created_date DESC);
+
+CREATE OR REPLACE FUNCTION queue_webhook_deliveries() RETURNS trigger AS $$
+BEGIN
+    INSERT INTO webhook_delivery (webhook_id, event, payload)
+    SELECT w.id, NEW.event, jsonb_build_object(
+        'id', NEW.id,
+        'event', NEW.event,
+        'ticket_id', NEW.ticket_id,
+        'data', NEW.data,
+        'created_date', NEW.created_date)
+    FROM webhook w
+    WHERE w.active AND (cardinality(w.events) = 0 OR NEW.event = ANY (w.events));
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS webhook_delivery_trigger ON ticket_event;
+CREATE TRIGGER webhook_delivery_trigger
+    AFTER INSERT ON ticket_event
+    FOR EACH ROW EXECUTE FUNCTION queue_webhook_deliveries();
@@ -0,0 +1,15 @@
+-- Email-to-ticket gateway. reporter_email remembers who emailed a ticket in
+-- so their replies can be threaded onto it; inbound_email records every
+-- message handled, so a message picked up twice is not handled twice.
+
+ALTER TABLE ticket
+    ADD COLUMN IF NOT EXISTS reporter_email TEXT;
+
+CREATE TABLE IF NOT EXISTS inbound_email (
+    message_id TEXT PRIMARY KEY,
+    from_address TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    ticket_id INT REFERENCES ticket (id) ON DELETE SET NULL,
+    comment_id INT REFERENCES ticket_comment (id) ON DELETE SET NULL,
+    received_date TIMESTAMPTZ NOT NULL DEFAULT now()
+);
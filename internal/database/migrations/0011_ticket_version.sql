@@ -0,0 +1,23 @@
+-- Optimistic concurrency for tickets. version goes up with every edit, so a
+-- client can tell whether the ticket it read is still current (ETag and
+-- If-Match). SLA bookkeeping is not an edit and leaves the version alone.
+
+ALTER TABLE ticket
+    ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;
+
+CREATE OR REPLACE FUNCTION bump_ticket_version() RETURNS trigger AS $$
+BEGIN
+    -- Writers may also bump the version themselves, e.g. when only the
+    -- supporting assignees of a ticket change
+    IF to_jsonb(NEW) - 'version' - 'alert_level' - 'response_due_at' - 'due_at'
+        IS DISTINCT FROM to_jsonb(OLD) - 'version' - 'alert_level' - 'response_due_at' - 'due_at' THEN
+        NEW.version := OLD.version + 1;
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS ticket_version_trigger ON ticket;
+CREATE TRIGGER ticket_version_trigger
+    BEFORE UPDATE ON ticket
+    FOR EACH ROW EXECUTE FUNCTION bump_ticket_version();
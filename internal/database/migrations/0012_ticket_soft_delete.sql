@@ -0,0 +1,48 @@
+-- Soft delete for tickets. Deleting a ticket moves it to the trash, from
+-- which an admin can restore it until the retention job purges it for
+-- good. The change feed records moving to and from the trash as deleted
+-- and restored; the final purge of a trashed ticket is not announced again.
+
+ALTER TABLE ticket
+    ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS deleted_by INT REFERENCES staff_user (id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS ticket_deleted_idx ON ticket (deleted_at) WHERE deleted_at IS NOT NULL;
+
+CREATE OR REPLACE FUNCTION record_ticket_event() RETURNS trigger AS $$
+DECLARE
+    t ticket;
+    kind TEXT;
+    event_id BIGINT;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        IF OLD.deleted_at IS NOT NULL THEN
+            RETURN NULL;
+        END IF;
+        t := OLD;
+        kind := 'deleted';
+    ELSE
+        t := NEW;
+        IF TG_OP = 'INSERT' THEN
+            kind := 'created';
+        ELSIF NEW.deleted_at IS NOT NULL AND OLD.deleted_at IS NULL THEN
+            kind := 'deleted';
+        ELSIF NEW.deleted_at IS NULL AND OLD.deleted_at IS NOT NULL THEN
+            kind := 'restored';
+        ELSIF NEW.task_status IS DISTINCT FROM OLD.task_status THEN
+            kind := 'status_changed';
+        ELSIF to_jsonb(NEW) - 'response_due_at' - 'due_at' = to_jsonb(OLD) - 'response_due_at' - 'due_at' THEN
+            RETURN NULL;
+        ELSE
+            kind := 'updated';
+        END IF;
+    END IF;
+
+    INSERT INTO ticket_event (ticket_id, event, assigned_to, accommodation_id, data)
+    VALUES (t.id, kind, t.assigned_to, t.accommodation_id, to_jsonb(t) - 'image')
+    RETURNING id INTO event_id;
+
+    PERFORM pg_notify('ticket_events', event_id::text);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,27 @@
+-- Auto-assignment rules, tried in position order when a ticket is created
+-- without an assignee. Unset conditions match anything; the time window is
+-- local to timezone and wraps past midnight when time_from > time_to. A
+-- rule names one assignee or picks from a pool, round-robin or by load.
+
+CREATE TABLE IF NOT EXISTS assignment_rule (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    position INT NOT NULL DEFAULT 0,
+    accommodation_id INT REFERENCES accommodation (id) ON DELETE CASCADE,
+    request_type TEXT,
+    task_priority TEXT,
+    time_from TIME,
+    time_to TIME,
+    timezone TEXT NOT NULL DEFAULT 'Asia/Tokyo',
+    strategy TEXT NOT NULL CHECK (strategy IN ('user', 'round_robin', 'least_loaded')),
+    assigned_to INT REFERENCES staff_user (id) ON DELETE CASCADE,
+    pool INT[] NOT NULL DEFAULT '{}',
+    last_assigned_to INT,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_date TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CHECK ((time_from IS NULL) = (time_to IS NULL)),
+    CHECK (strategy <> 'user' OR assigned_to IS NOT NULL)
+);
+
+CREATE INDEX IF NOT EXISTS assignment_rule_position_idx
+    ON assignment_rule (position, id) WHERE active;
@@ -0,0 +1,29 @@
+-- Staff shifts and on-call duty. Staff with no shifts at all are not on a
+-- rotation and always count as on duty; everyone else only during their
+-- shifts. An on-call shift optionally covers a single accommodation.
+-- Urgent priorities page whoever is on call as well as the assignee.
+
+CREATE TABLE IF NOT EXISTS staff_shift (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES staff_user (id) ON DELETE CASCADE,
+    starts_at TIMESTAMPTZ NOT NULL,
+    ends_at TIMESTAMPTZ NOT NULL,
+    on_call BOOLEAN NOT NULL DEFAULT FALSE,
+    accommodation_id INT REFERENCES accommodation (id) ON DELETE SET NULL,
+    note TEXT NOT NULL DEFAULT '',
+    created_date TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CHECK (ends_at > starts_at)
+);
+
+CREATE INDEX IF NOT EXISTS staff_shift_user_idx
+    ON staff_shift (user_id, starts_at);
+CREATE INDEX IF NOT EXISTS staff_shift_time_idx
+    ON staff_shift (starts_at, ends_at);
+
+ALTER TABLE task_priority
+    ADD COLUMN IF NOT EXISTS urgent BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE task_priority
+SET urgent = TRUE
+WHERE lower(btrim(name)) IN ('urgent', 'critical', 'high')
+  AND NOT EXISTS (SELECT 1 FROM task_priority WHERE urgent);
@@ -0,0 +1,30 @@
+-- Teams of staff (maintenance, housekeeping, IT) and team queues. A ticket
+-- queued to a team has no assignee until one of the members claims it;
+-- until then the whole team hears about it.
+
+CREATE TABLE IF NOT EXISTS team (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    created_date TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS team_name_idx ON team (lower(btrim(name)));
+
+CREATE TABLE IF NOT EXISTS team_member (
+    team_id INT NOT NULL REFERENCES team (id) ON DELETE CASCADE,
+    user_id INT NOT NULL REFERENCES staff_user (id) ON DELETE CASCADE,
+    added_date TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (team_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS team_member_user_idx ON team_member (user_id);
+
+ALTER TABLE ticket
+    ADD COLUMN IF NOT EXISTS team_id INT REFERENCES team (id) ON DELETE SET NULL;
+
+ALTER TABLE ticket
+    ALTER COLUMN assigned_to DROP NOT NULL;
+
+CREATE INDEX IF NOT EXISTS ticket_team_queue_idx
+    ON ticket (team_id, creation_date) WHERE assigned_to IS NULL AND deleted_at IS NULL;
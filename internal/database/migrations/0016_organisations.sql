@@ -0,0 +1,148 @@
+-- Organisations (companies or regions) sharing one install. Users,
+-- tickets, accommodations and each organisation's own configuration carry
+-- org_id; rows that hang off those (rooms, comments, shifts, deliveries...)
+-- belong to the organisation of their parent. The request type and
+-- priority catalogs and SLA targets stay shared. Existing data becomes the
+-- first organisation. Its mail sender and dashboard are left blank, so they
+-- follow the server's configuration until an admin sets them.
+
+CREATE TABLE IF NOT EXISTS organisation (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    slug TEXT NOT NULL UNIQUE CHECK (slug ~ '^[a-z0-9][a-z0-9-]*$'),
+    mail_sender TEXT NOT NULL DEFAULT '',
+    timezone TEXT NOT NULL DEFAULT 'Asia/Tokyo',
+    dashboard_url TEXT NOT NULL DEFAULT '',
+    brand_name TEXT NOT NULL DEFAULT 'Ticketing Management System',
+    brand_colour TEXT NOT NULL DEFAULT '',
+    logo_url TEXT NOT NULL DEFAULT '',
+    created_date TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+INSERT INTO organisation (name, slug)
+SELECT 'Default', 'default'
+WHERE NOT EXISTS (SELECT 1 FROM organisation);
+
+ALTER TABLE staff_user
+    ADD COLUMN IF NOT EXISTS org_id INT REFERENCES organisation (id);
+
+ALTER TABLE ticket
+    ADD COLUMN IF NOT EXISTS org_id INT REFERENCES organisation (id);
+
+ALTER TABLE accommodation
+    ADD COLUMN IF NOT EXISTS org_id INT REFERENCES organisation (id);
+
+ALTER TABLE team
+    ADD COLUMN IF NOT EXISTS org_id INT REFERENCES organisation (id);
+
+ALTER TABLE webhook
+    ADD COLUMN IF NOT EXISTS org_id INT REFERENCES organisation (id);
+
+ALTER TABLE ticket_schedule
+    ADD COLUMN IF NOT EXISTS org_id INT REFERENCES organisation (id);
+
+ALTER TABLE assignment_rule
+    ADD COLUMN IF NOT EXISTS org_id INT REFERENCES organisation (id);
+
+UPDATE staff_user SET org_id = (SELECT min(id) FROM organisation) WHERE org_id IS NULL;
+UPDATE ticket SET org_id = (SELECT min(id) FROM organisation) WHERE org_id IS NULL;
+UPDATE accommodation SET org_id = (SELECT min(id) FROM organisation) WHERE org_id IS NULL;
+UPDATE team SET org_id = (SELECT min(id) FROM organisation) WHERE org_id IS NULL;
+UPDATE webhook SET org_id = (SELECT min(id) FROM organisation) WHERE org_id IS NULL;
+UPDATE ticket_schedule SET org_id = (SELECT min(id) FROM organisation) WHERE org_id IS NULL;
+UPDATE assignment_rule SET org_id = (SELECT min(id) FROM organisation) WHERE org_id IS NULL;
+
+ALTER TABLE staff_user ALTER COLUMN org_id SET NOT NULL;
+ALTER TABLE ticket ALTER COLUMN org_id SET NOT NULL;
+ALTER TABLE accommodation ALTER COLUMN org_id SET NOT NULL;
+ALTER TABLE team ALTER COLUMN org_id SET NOT NULL;
+ALTER TABLE webhook ALTER COLUMN org_id SET NOT NULL;
+ALTER TABLE ticket_schedule ALTER COLUMN org_id SET NOT NULL;
+ALTER TABLE assignment_rule ALTER COLUMN org_id SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS staff_user_org_idx ON staff_user (org_id);
+CREATE INDEX IF NOT EXISTS ticket_org_idx ON ticket (org_id);
+CREATE INDEX IF NOT EXISTS accommodation_org_idx ON accommodation (org_id);
+CREATE INDEX IF NOT EXISTS team_org_idx ON team (org_id);
+CREATE INDEX IF NOT EXISTS webhook_org_idx ON webhook (org_id);
+CREATE INDEX IF NOT EXISTS ticket_schedule_org_idx ON ticket_schedule (org_id);
+CREATE INDEX IF NOT EXISTS assignment_rule_org_idx ON assignment_rule (org_id);
+
+-- Names only need to be unique within an organisation
+DROP INDEX IF EXISTS accommodation_name_key;
+CREATE UNIQUE INDEX IF NOT EXISTS accommodation_org_name_key
+    ON accommodation (org_id, lower(btrim(name)));
+DROP INDEX IF EXISTS team_name_idx;
+CREATE UNIQUE INDEX IF NOT EXISTS team_org_name_key
+    ON team (org_id, lower(btrim(name)));
+
+-- The change feed and webhooks follow the organisation of the ticket
+ALTER TABLE ticket_event
+    ADD COLUMN IF NOT EXISTS org_id INT;
+
+UPDATE ticket_event e
+SET org_id = t.org_id
+FROM ticket t
+WHERE e.org_id IS NULL AND t.id = e.ticket_id;
+
+CREATE OR REPLACE FUNCTION record_ticket_event() RETURNS trigger AS $$
+DECLARE
+    t ticket;
+    kind TEXT;
+    event_id BIGINT;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        t := OLD;
+        kind := 'deleted';
+    ELSE
+        t := NEW;
+        IF TG_OP = 'INSERT' THEN
+            kind := 'created';
+        ELSIF NEW.task_status IS DISTINCT FROM OLD.task_status THEN
+            kind := 'status_changed';
+        ELSIF to_jsonb(NEW) - 'response_due_at' - 'due_at' = to_jsonb(OLD) - 'response_due_at' - 'due_at' THEN
+            RETURN NULL;
+        ELSE
+            kind := 'updated';
+        END IF;
+    END IF;
+
+    INSERT INTO ticket_event (ticket_id, event, assigned_to, accommodation_id, data, org_id)
+    VALUES (t.id, kind, t.assigned_to, t.accommodation_id, to_jsonb(t) - 'image', t.org_id)
+    RETURNING id INTO event_id;
+
+    PERFORM pg_notify('ticket_events', event_id::text);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION record_ticket_comment_event() RETURNS trigger AS $$
+DECLARE
+    event_id BIGINT;
+BEGIN
+    INSERT INTO ticket_event (ticket_id, event, assigned_to, accommodation_id, data, org_id)
+    SELECT t.id, 'commented', t.assigned_to, t.accommodation_id, to_jsonb(NEW), t.org_id
+    FROM ticket t
+    WHERE t.id = NEW.ticket_id
+    RETURNING id INTO event_id;
+
+    PERFORM pg_notify('ticket_events', event_id::text);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION queue_webhook_deliveries() RETURNS trigger AS $$
+BEGIN
+    INSERT INTO webhook_delivery (webhook_id, event, payload)
+    SELECT w.id, NEW.event, jsonb_build_object(
+        'id', NEW.id,
+        'event', NEW.event,
+        'ticket_id', NEW.ticket_id,
+        'data', NEW.data,
+        'created_date', NEW.created_date)
+    FROM webhook w
+    WHERE w.active AND w.org_id = NEW.org_id
+      AND (cardinality(w.events) = 0 OR NEW.event = ANY (w.events));
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
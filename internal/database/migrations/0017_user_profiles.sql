@@ -0,0 +1,16 @@
+-- Self-service profiles. Language and timezone left NULL follow the
+-- organisation. A new email address only replaces the old one once the
+-- link mailed to it is followed; only the hash of that link's token is kept.
+
+ALTER TABLE staff_user
+    ADD COLUMN IF NOT EXISTS phone_number TEXT,
+    ADD COLUMN IF NOT EXISTS language TEXT,
+    ADD COLUMN IF NOT EXISTS timezone TEXT;
+
+CREATE TABLE IF NOT EXISTS email_change (
+    user_id INT PRIMARY KEY REFERENCES staff_user (id) ON DELETE CASCADE,
+    email TEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_date TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -0,0 +1,10 @@
+-- Deactivated staff can neither log in nor refresh their tokens, are never
+-- on duty and cannot be given new work. They keep their history, unlike
+-- deleted users.
+
+ALTER TABLE staff_user
+    ADD COLUMN IF NOT EXISTS active BOOLEAN NOT NULL DEFAULT TRUE,
+    ADD COLUMN IF NOT EXISTS deactivated_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS staff_user_org_name_idx
+    ON staff_user (org_id, first_name, last_name, id);
@@ -0,0 +1,25 @@
+-- Optional TOTP (RFC 6238) two-factor authentication. mfa_secret is set
+-- when enrollment starts and mfa_enabled once a code from it is confirmed.
+-- mfa_last_step is the last time step accepted, so a code cannot be
+-- replayed; repeated failures lock verification for a while. Recovery
+-- codes are kept hashed and work once each. Organisations may require
+-- two-factor authentication for some roles.
+
+ALTER TABLE staff_user
+    ADD COLUMN IF NOT EXISTS mfa_secret TEXT,
+    ADD COLUMN IF NOT EXISTS mfa_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN IF NOT EXISTS mfa_last_step BIGINT,
+    ADD COLUMN IF NOT EXISTS mfa_failures INT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS mfa_failed_at TIMESTAMPTZ;
+
+CREATE TABLE IF NOT EXISTS mfa_recovery_code (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES staff_user (id) ON DELETE CASCADE,
+    code_hash TEXT NOT NULL,
+    used_at TIMESTAMPTZ,
+    created_date TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (user_id, code_hash)
+);
+
+ALTER TABLE organisation
+    ADD COLUMN IF NOT EXISTS mfa_required_roles TEXT[] NOT NULL DEFAULT '{}';
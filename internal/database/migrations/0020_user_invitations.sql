@@ -0,0 +1,17 @@
+-- Public registration only joins an organisation through an invitation an
+-- admin of it sent. The invitation fixes the address, organisation and
+-- role; only the hash of its token is kept, and it is deleted once used.
+
+CREATE TABLE IF NOT EXISTS user_invitation (
+    id SERIAL PRIMARY KEY,
+    org_id INT NOT NULL REFERENCES organisation (id) ON DELETE CASCADE,
+    email TEXT NOT NULL,
+    role TEXT NOT NULL DEFAULT 'staff' CHECK (role IN ('admin', 'staff')),
+    token_hash TEXT NOT NULL UNIQUE,
+    invited_by INT REFERENCES staff_user (id) ON DELETE SET NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_date TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS user_invitation_org_email_key
+    ON user_invitation (org_id, lower(email));
@@ -0,0 +1,11 @@
+-- The first organisation used to be seeded with a personal mailbox and a
+-- LAN dashboard address. Where they were never changed, clear them so the
+-- organisation follows the server's configuration instead.
+
+UPDATE organisation
+SET mail_sender = ''
+WHERE slug = 'default' AND mail_sender = 'rmdejesus@skijapan.com';
+
+UPDATE organisation
+SET dashboard_url = ''
+WHERE slug = 'default' AND dashboard_url = 'http://192.168.1.57:9000/dashboard';
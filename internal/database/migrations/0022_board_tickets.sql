@@ -0,0 +1,11 @@
+-- Board tickets stand in for a token while a browser opens the dispatcher
+-- board. Keeping them here lets any instance redeem them; only the hash of
+-- the ticket is kept, and it is deleted once used.
+
+CREATE TABLE IF NOT EXISTS board_ticket (
+    ticket_hash TEXT PRIMARY KEY,
+    token TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS board_ticket_expires_at_idx ON board_ticket (expires_at);
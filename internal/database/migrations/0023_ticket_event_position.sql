@@ -0,0 +1,31 @@
+-- Event IDs are taken when a change is made, so a transaction that commits
+-- late can record an event below one streams have already sent. Each event
+-- therefore also gets a position when its transaction commits: a deferred
+-- trigger takes the next position under a lock held until the commit, so
+-- positions follow commit order and streams resume by position.
+
+ALTER TABLE ticket_event
+    ADD COLUMN IF NOT EXISTS position BIGINT;
+
+UPDATE ticket_event SET position = id WHERE position IS NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS ticket_event_position_key ON ticket_event (position);
+
+CREATE SEQUENCE IF NOT EXISTS ticket_event_position_seq;
+SELECT setval('ticket_event_position_seq', GREATEST((SELECT max(position) FROM ticket_event), 0) + 1, false);
+
+CREATE OR REPLACE FUNCTION position_ticket_event() RETURNS trigger AS $$
+BEGIN
+    -- Released when the transaction ends, so whoever takes the next
+    -- position has to wait for this commit
+    PERFORM pg_advisory_xact_lock(hashtext('ticket_event_position'));
+    UPDATE ticket_event SET position = nextval('ticket_event_position_seq') WHERE id = NEW.id;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS ticket_event_position_trigger ON ticket_event;
+CREATE CONSTRAINT TRIGGER ticket_event_position_trigger
+    AFTER INSERT ON ticket_event
+    DEFERRABLE INITIALLY DEFERRED
+    FOR EACH ROW EXECUTE FUNCTION position_ticket_event();
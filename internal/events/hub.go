@@ -0,0 +1,214 @@
+// Package events fans ticket changes out to live clients. Changes are
+// recorded by a database trigger and announced with NOTIFY, so every server
+// instance sees every change whichever instance made it. Presence, who is
+// viewing which ticket, travels between instances the same way.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// channel is the NOTIFY channel the ticket_event trigger announces on
+const channel = "ticket_events"
+
+// maxReplay bounds how many missed events a reconnecting client receives
+const maxReplay = 1000
+
+// subscriberBuffer is how many events a slow client may fall behind before
+// it is disconnected and has to resume with Last-Event-ID
+const subscriberBuffer = 64
+
+// Event is one recorded ticket change, or a presence update. Data holds
+// the ticket row for ticket changes, the comment for "commented" events and
+// the viewer list for presence updates. Position orders ticket changes by
+// when they were committed, which their IDs do not.
+type Event struct {
+	ID              int64           `json:"id"`
+	Position        int64           `json:"position"`
+	Type            string          `json:"type"`
+	TicketID        int             `json:"ticket_id"`
+	AssignedTo      *int            `json:"assigned_to"`
+	AccommodationID *int            `json:"accommodation_id"`
+	OrgID           *int            `json:"org_id"`
+	Data            json.RawMessage `json:"data"`
+	CreatedDate     string          `json:"created_date"`
+}
+
+const eventColumns = `id, position, event, ticket_id, assigned_to, accommodation_id, org_id, data, created_date::text`
+
+func scanEvent(row pgx.Row, event *Event) error {
+	return row.Scan(
+		&event.ID,
+		&event.Position,
+		&event.Type,
+		&event.TicketID,
+		&event.AssignedTo,
+		&event.AccommodationID,
+		&event.OrgID,
+		&event.Data,
+		&event.CreatedDate)
+}
+
+// Hub listens for ticket changes and broadcasts them to subscribers
+type Hub struct {
+	url string
+
+	mu          sync.Mutex
+	subscribers map[chan Event]struct{}
+	presence    map[int]map[string]presenceEntry
+
+	// query serves replays; the listening connection is kept busy waiting
+	queryMu sync.Mutex
+	query   *pgx.Conn
+}
+
+// NewHub creates a hub for the database at url. Call Run to start it.
+func NewHub(url string) *Hub {
+	return &Hub{
+		url:         url,
+		subscribers: map[chan Event]struct{}{},
+		presence:    map[int]map[string]presenceEntry{},
+	}
+}
+
+// Run listens for changes until ctx is cancelled, reconnecting after
+// connection failures
+func (h *Hub) Run(ctx context.Context) {
+	go h.expirePresence(ctx)
+
+	for {
+		err := h.listen(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("ticket event listener: %v", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+func (h *Hub) listen(ctx context.Context) error {
+	conn, err := pgx.Connect(ctx, h.url)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+channel+"; LISTEN "+presenceChannel); err != nil {
+		return err
+	}
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		if notification.Channel == presenceChannel {
+			h.handlePresence(notification.Payload)
+			continue
+		}
+
+		id, err := strconv.ParseInt(notification.Payload, 10, 64)
+		if err != nil {
+			continue
+		}
+
+		var event Event
+		err = scanEvent(conn.QueryRow(ctx, "SELECT "+eventColumns+" FROM ticket_event WHERE id = $1", id), &event)
+		if err != nil {
+			log.Printf("ticket event %d: %v", id, err)
+			continue
+		}
+		h.broadcast(event)
+	}
+}
+
+func (h *Hub) broadcast(event Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.broadcastLocked(event)
+}
+
+// broadcastLocked sends event to every subscriber. h.mu must be held.
+func (h *Hub) broadcastLocked(event Event) {
+	for ch := range h.subscribers {
+		select {
+		case ch <- event:
+		default:
+			// Too far behind; the client resumes from its last event
+			delete(h.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscribe returns a channel receiving every new event, and a function
+// to stop receiving. The channel is closed if the subscriber falls behind.
+func (h *Hub) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+
+	h.mu.Lock()
+	h.subscribers[ch] = struct{}{}
+	h.mu.Unlock()
+
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if _, ok := h.subscribers[ch]; ok {
+			delete(h.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Since returns the recorded events after position, in commit order, for
+// clients resuming with Last-Event-ID
+func (h *Hub) Since(ctx context.Context, position int64) ([]Event, error) {
+	h.queryMu.Lock()
+	defer h.queryMu.Unlock()
+
+	conn, err := h.queryConn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := conn.Query(ctx, "SELECT "+eventColumns+" FROM ticket_event WHERE position > $1 ORDER BY position LIMIT $2", position, maxReplay)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []Event
+	for rows.Next() {
+		var event Event
+		if err := scanEvent(rows, &event); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// queryConn returns the connection for queries, reconnecting if needed.
+// queryMu must be held.
+func (h *Hub) queryConn(ctx context.Context) (*pgx.Conn, error) {
+	if h.query == nil || h.query.IsClosed() {
+		conn, err := pgx.Connect(ctx, h.url)
+		if err != nil {
+			return nil, err
+		}
+		h.query = conn
+	}
+	return h.query, nil
+}
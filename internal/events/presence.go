@@ -0,0 +1,178 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"slices"
+	"strings"
+	"time"
+)
+
+// presenceChannel carries viewers joining and leaving tickets
+const presenceChannel = "ticket_presence"
+
+// TypePresence is the type of events announcing a ticket's viewers. They
+// are not recorded and have no ID.
+const TypePresence = "presence"
+
+// PresenceInterval is how often a viewer must re-announce itself; viewers
+// silent for presenceTTL, e.g. on a crashed instance, are dropped
+const PresenceInterval = 30 * time.Second
+
+const presenceTTL = 5 * PresenceInterval / 2
+
+// Viewer is a user looking at a ticket
+type Viewer struct {
+	UserID int    `json:"user_id"`
+	Name   string `json:"name"`
+}
+
+type presenceEntry struct {
+	viewer  Viewer
+	orgID   int
+	expires time.Time
+}
+
+type presenceNotice struct {
+	Session  string `json:"session"`
+	TicketID int    `json:"ticket_id"`
+	OrgID    int    `json:"org_id"`
+	Viewer   Viewer `json:"viewer"`
+	Viewing  bool   `json:"viewing"`
+}
+
+// Announce tells every instance that session, a connection of viewer,
+// started (viewing) or stopped looking at a ticket of organisation orgID
+func (h *Hub) Announce(ctx context.Context, session string, orgID, ticketID int, viewer Viewer, viewing bool) error {
+	payload, err := json.Marshal(presenceNotice{
+		Session:  session,
+		TicketID: ticketID,
+		OrgID:    orgID,
+		Viewer:   viewer,
+		Viewing:  viewing,
+	})
+	if err != nil {
+		return err
+	}
+
+	h.queryMu.Lock()
+	defer h.queryMu.Unlock()
+
+	conn, err := h.queryConn(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = conn.Exec(ctx, "SELECT pg_notify($1, $2)", presenceChannel, string(payload))
+	return err
+}
+
+// Viewers lists the users viewing a ticket, by name
+func (h *Hub) Viewers(ticketID int) []Viewer {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.viewersLocked(ticketID)
+}
+
+func (h *Hub) viewersLocked(ticketID int) []Viewer {
+	viewers := []Viewer{}
+	for _, entry := range h.presence[ticketID] {
+		if !slices.ContainsFunc(viewers, func(v Viewer) bool { return v.UserID == entry.viewer.UserID }) {
+			viewers = append(viewers, entry.viewer)
+		}
+	}
+	slices.SortFunc(viewers, func(a, b Viewer) int {
+		if c := strings.Compare(a.Name, b.Name); c != 0 {
+			return c
+		}
+		return a.UserID - b.UserID
+	})
+	return viewers
+}
+
+func (h *Hub) handlePresence(payload string) {
+	var notice presenceNotice
+	if err := json.Unmarshal([]byte(payload), &notice); err != nil {
+		log.Printf("ticket presence: %v", err)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	before := h.viewersLocked(notice.TicketID)
+	orgID := h.presenceOrgLocked(notice.TicketID, notice.OrgID)
+
+	sessions := h.presence[notice.TicketID]
+	if notice.Viewing {
+		if sessions == nil {
+			sessions = map[string]presenceEntry{}
+			h.presence[notice.TicketID] = sessions
+		}
+		sessions[notice.Session] = presenceEntry{viewer: notice.Viewer, orgID: notice.OrgID, expires: time.Now().Add(presenceTTL)}
+	} else {
+		delete(sessions, notice.Session)
+		if len(sessions) == 0 {
+			delete(h.presence, notice.TicketID)
+		}
+	}
+
+	h.presenceChangedLocked(orgID, notice.TicketID, before)
+}
+
+// presenceOrgLocked is the organisation of a ticket's viewers, or fallback
+// when nobody is viewing it. h.mu must be held.
+func (h *Hub) presenceOrgLocked(ticketID, fallback int) int {
+	for _, entry := range h.presence[ticketID] {
+		return entry.orgID
+	}
+	return fallback
+}
+
+// expirePresence drops viewers that stopped re-announcing themselves
+func (h *Hub) expirePresence(ctx context.Context) {
+	ticker := time.NewTicker(PresenceInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		now := time.Now()
+		h.mu.Lock()
+		for ticketID, sessions := range h.presence {
+			before := h.viewersLocked(ticketID)
+			orgID := h.presenceOrgLocked(ticketID, 0)
+			for session, entry := range sessions {
+				if now.After(entry.expires) {
+					delete(sessions, session)
+				}
+			}
+			if len(sessions) == 0 {
+				delete(h.presence, ticketID)
+			}
+			h.presenceChangedLocked(orgID, ticketID, before)
+		}
+		h.mu.Unlock()
+	}
+}
+
+// presenceChangedLocked broadcasts a ticket's viewers to its organisation
+// if they differ from before. h.mu must be held.
+func (h *Hub) presenceChangedLocked(orgID, ticketID int, before []Viewer) {
+	after := h.viewersLocked(ticketID)
+	if slices.Equal(before, after) {
+		return
+	}
+
+	data, _ := json.Marshal(after)
+	h.broadcastLocked(Event{
+		Type:     TypePresence,
+		TicketID: ticketID,
+		OrgID:    &orgID,
+		Data:     data,
+	})
+}
@@ -0,0 +1,698 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"ticket-sys/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+var errInvalidAccommodation = errors.New("invalid accommodation")
+
+// Create accommodation
+// @Summary Create New Accommodation
+// @Description Create a new accommodation
+// @ID create-accommodation
+// @Produce json
+// @Success 201 "Successful response"
+// @Failure 400 "Invalid input format"
+// @Failure 409 "Accommodation already exists"
+// @Router /accommodations [post]
+// @Security Bearer
+func (h *AuthHandler) CreateAccommodation(c *gin.Context) {
+	var accommodation models.AccommodationCreate
+
+	if err := c.ShouldBindJSON(&accommodation); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid input format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	var id int
+	err := h.db.QueryRow(context.Background(), `
+        INSERT INTO accommodation (name, type, address, org_id)
+        VALUES ($1, $2, $3, $4)
+        RETURNING id`,
+		strings.TrimSpace(accommodation.Name),
+		strings.TrimSpace(accommodation.Type),
+		strings.TrimSpace(accommodation.Address),
+		currentOrgID(c),
+	).Scan(&id)
+
+	if isUniqueViolation(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Accommodation already exists"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Accommodation creation failed"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":          "Accommodation created successfully",
+		"accommodation_id": id,
+	})
+}
+
+// Get all accommodations
+// @Summary Get All Accommodations
+// @Description List all accommodations
+// @ID get-accommodations
+// @Produce json
+// @Success 200 "Successful response"
+// @Failure 500 "Database error"
+// @Router /accommodations [get]
+// @Security Bearer
+func (h *AuthHandler) GetAccommodations(c *gin.Context) {
+	accommodations := []models.Accommodation{}
+
+	rows, err := h.db.Query(context.Background(), "SELECT id, name, type, address, created_date::text FROM accommodation WHERE org_id = $1 ORDER BY name", currentOrgID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	for rows.Next() {
+		var accommodation models.Accommodation
+
+		err := rows.Scan(
+			&accommodation.ID,
+			&accommodation.Name,
+			&accommodation.Type,
+			&accommodation.Address,
+			&accommodation.CreatedDate)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Process failed"})
+			return
+		}
+
+		accommodations = append(accommodations, accommodation)
+	}
+
+	if err = rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Accommodation iteration failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, accommodations)
+}
+
+// Get single accommodation
+// @Summary Get an Accommodation
+// @Description Get single accommodation with its rooms and locations
+// @ID get-accommodation
+// @Produce json
+// @Param id path int true "Accommodation ID"
+// @Success 200 "Successful response"
+// @Failure 400 "Invalid accommodation ID"
+// @Failure 404 "Accommodation not found"
+// @Router /accommodations/{id} [get]
+// @Security Bearer
+func (h *AuthHandler) GetAccommodation(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid accommodation ID"})
+		return
+	}
+
+	var accommodation models.Accommodation
+	err = h.db.QueryRow(context.Background(), `
+        SELECT id, name, type, address, created_date::text
+        FROM accommodation
+        WHERE id = $1 AND org_id = $2`,
+		id, currentOrgID(c),
+	).Scan(
+		&accommodation.ID,
+		&accommodation.Name,
+		&accommodation.Type,
+		&accommodation.Address,
+		&accommodation.CreatedDate)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Accommodation not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if accommodation.Rooms, err = h.accommodationRooms(context.Background(), id, currentOrgID(c)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if accommodation.Locations, err = h.accommodationLocations(context.Background(), id, currentOrgID(c)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, accommodation)
+}
+
+// Update an accommodation
+// @Summary Update an Accommodation
+// @Description Update single accommodation
+// @ID update-accommodation
+// @Produce json
+// @Param id path int true "Accommodation ID"
+// @Success 200 "Successful response"
+// @Failure 400 "Invalid accommodation ID"
+// @Failure 404 "Accommodation not found"
+// @Failure 409 "Accommodation already exists"
+// @Router /accommodations/{id} [patch]
+// @Security Bearer
+func (h *AuthHandler) UpdateAccommodation(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid accommodation ID"})
+		return
+	}
+
+	var update models.AccommodationUpdate
+	if err := c.ShouldBindJSON(&update); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid accommodation data"})
+		return
+	}
+
+	var accommodation models.Accommodation
+	err = h.db.QueryRow(context.Background(), `
+        UPDATE accommodation
+        SET name = COALESCE(NULLIF($2, ''), name),
+            type = COALESCE(NULLIF($3, ''), type),
+            address = COALESCE(NULLIF($4, ''), address)
+        WHERE id = $1 AND org_id = $5
+        RETURNING id, name, type, address, created_date::text`,
+		id,
+		strings.TrimSpace(update.Name),
+		strings.TrimSpace(update.Type),
+		strings.TrimSpace(update.Address),
+		currentOrgID(c),
+	).Scan(
+		&accommodation.ID,
+		&accommodation.Name,
+		&accommodation.Type,
+		&accommodation.Address,
+		&accommodation.CreatedDate)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Accommodation not found"})
+		return
+	}
+	if isUniqueViolation(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Accommodation already exists"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, accommodation)
+}
+
+// Delete an accommodation
+// @Summary Delete an Accommodation
+// @Description Delete single accommodation; tickets keep their text fields
+// @ID delete-accommodation
+// @Produce json
+// @Param id path int true "Accommodation ID"
+// @Success 200 "Successful response"
+// @Failure 400 "Invalid accommodation ID"
+// @Failure 404 "Accommodation not found"
+// @Router /accommodations/{id} [delete]
+// @Security Bearer
+func (h *AuthHandler) DeleteAccommodation(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid accommodation ID"})
+		return
+	}
+
+	result, err := h.db.Exec(context.Background(), "DELETE FROM accommodation WHERE id = $1 AND org_id = $2", id, currentOrgID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if result.RowsAffected() == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Accommodation not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"id": id})
+}
+
+// Get accommodation rooms
+// @Summary Get Accommodation Rooms
+// @Description List the rooms of an accommodation
+// @ID get-accommodation-rooms
+// @Produce json
+// @Param id path int true "Accommodation ID"
+// @Success 200 "Successful response"
+// @Failure 400 "Invalid accommodation ID"
+// @Router /accommodations/{id}/rooms [get]
+// @Security Bearer
+func (h *AuthHandler) GetAccommodationRooms(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid accommodation ID"})
+		return
+	}
+
+	rooms, err := h.accommodationRooms(context.Background(), id, currentOrgID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, rooms)
+}
+
+// Create accommodation room
+// @Summary Create Accommodation Room
+// @Description Add a room to an accommodation
+// @ID create-accommodation-room
+// @Produce json
+// @Param id path int true "Accommodation ID"
+// @Success 201 "Successful response"
+// @Failure 400 "Invalid input format"
+// @Failure 404 "Accommodation not found"
+// @Failure 409 "Room already exists"
+// @Router /accommodations/{id}/rooms [post]
+// @Security Bearer
+func (h *AuthHandler) CreateAccommodationRoom(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid accommodation ID"})
+		return
+	}
+
+	var room models.AccommodationRoomCreate
+	if err := c.ShouldBindJSON(&room); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid input format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	var roomID int
+	err = h.db.QueryRow(context.Background(), `
+        INSERT INTO accommodation_room (accommodation_id, room_number, name)
+        SELECT id, $2, $3 FROM accommodation WHERE id = $1 AND org_id = $4
+        RETURNING id`,
+		id, room.RoomNumber, strings.TrimSpace(room.Name), currentOrgID(c),
+	).Scan(&roomID)
+
+	if errors.Is(err, pgx.ErrNoRows) || isForeignKeyViolation(err) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Accommodation not found"})
+		return
+	}
+	if isUniqueViolation(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Room already exists"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Room creation failed"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Room created successfully",
+		"room_id": roomID,
+	})
+}
+
+// Delete accommodation room
+// @Summary Delete Accommodation Room
+// @Description Remove a room from an accommodation
+// @ID delete-accommodation-room
+// @Produce json
+// @Param id path int true "Accommodation ID"
+// @Param room_id path int true "Room ID"
+// @Success 200 "Successful response"
+// @Failure 400 "Invalid room ID"
+// @Failure 404 "Room not found"
+// @Router /accommodations/{id}/rooms/{room_id} [delete]
+// @Security Bearer
+func (h *AuthHandler) DeleteAccommodationRoom(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid accommodation ID"})
+		return
+	}
+	roomID, err := strconv.Atoi(c.Param("room_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid room ID"})
+		return
+	}
+
+	result, err := h.db.Exec(context.Background(), `
+        DELETE FROM accommodation_room
+        WHERE id = $1 AND accommodation_id = (SELECT id FROM accommodation WHERE id = $2 AND org_id = $3)`,
+		roomID, id, currentOrgID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if result.RowsAffected() == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"id": roomID})
+}
+
+// Get accommodation locations
+// @Summary Get Accommodation Locations
+// @Description List the named locations of an accommodation
+// @ID get-accommodation-locations
+// @Produce json
+// @Param id path int true "Accommodation ID"
+// @Success 200 "Successful response"
+// @Failure 400 "Invalid accommodation ID"
+// @Router /accommodations/{id}/locations [get]
+// @Security Bearer
+func (h *AuthHandler) GetAccommodationLocations(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid accommodation ID"})
+		return
+	}
+
+	locations, err := h.accommodationLocations(context.Background(), id, currentOrgID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, locations)
+}
+
+// Create accommodation location
+// @Summary Create Accommodation Location
+// @Description Add a named location to an accommodation
+// @ID create-accommodation-location
+// @Produce json
+// @Param id path int true "Accommodation ID"
+// @Success 201 "Successful response"
+// @Failure 400 "Invalid input format"
+// @Failure 404 "Accommodation not found"
+// @Failure 409 "Location already exists"
+// @Router /accommodations/{id}/locations [post]
+// @Security Bearer
+func (h *AuthHandler) CreateAccommodationLocation(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid accommodation ID"})
+		return
+	}
+
+	var location models.AccommodationLocationCreate
+	if err := c.ShouldBindJSON(&location); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid input format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	var locationID int
+	err = h.db.QueryRow(context.Background(), `
+        INSERT INTO accommodation_location (accommodation_id, name)
+        SELECT id, $2 FROM accommodation WHERE id = $1 AND org_id = $3
+        RETURNING id`,
+		id, strings.TrimSpace(location.Name), currentOrgID(c),
+	).Scan(&locationID)
+
+	if errors.Is(err, pgx.ErrNoRows) || isForeignKeyViolation(err) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Accommodation not found"})
+		return
+	}
+	if isUniqueViolation(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Location already exists"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Location creation failed"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":     "Location created successfully",
+		"location_id": locationID,
+	})
+}
+
+// Delete accommodation location
+// @Summary Delete Accommodation Location
+// @Description Remove a named location from an accommodation
+// @ID delete-accommodation-location
+// @Produce json
+// @Param id path int true "Accommodation ID"
+// @Param location_id path int true "Location ID"
+// @Success 200 "Successful response"
+// @Failure 400 "Invalid location ID"
+// @Failure 404 "Location not found"
+// @Router /accommodations/{id}/locations/{location_id} [delete]
+// @Security Bearer
+func (h *AuthHandler) DeleteAccommodationLocation(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid accommodation ID"})
+		return
+	}
+	locationID, err := strconv.Atoi(c.Param("location_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid location ID"})
+		return
+	}
+
+	result, err := h.db.Exec(context.Background(), `
+        DELETE FROM accommodation_location
+        WHERE id = $1 AND accommodation_id = (SELECT id FROM accommodation WHERE id = $2 AND org_id = $3)`,
+		locationID, id, currentOrgID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if result.RowsAffected() == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Location not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"id": locationID})
+}
+
+func (h *AuthHandler) accommodationRooms(ctx context.Context, accommodationID, orgID int) ([]models.AccommodationRoom, error) {
+	rooms := []models.AccommodationRoom{}
+
+	rows, err := h.db.Query(ctx, `
+        SELECT id, accommodation_id, room_number, name
+        FROM accommodation_room
+        WHERE accommodation_id = (SELECT id FROM accommodation WHERE id = $1 AND org_id = $2)
+        ORDER BY room_number`,
+		accommodationID, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var room models.AccommodationRoom
+		if err := rows.Scan(&room.ID, &room.AccommodationID, &room.RoomNumber, &room.Name); err != nil {
+			return nil, err
+		}
+		rooms = append(rooms, room)
+	}
+
+	return rooms, rows.Err()
+}
+
+func (h *AuthHandler) accommodationLocations(ctx context.Context, accommodationID, orgID int) ([]models.AccommodationLocation, error) {
+	locations := []models.AccommodationLocation{}
+
+	rows, err := h.db.Query(ctx, `
+        SELECT id, accommodation_id, name
+        FROM accommodation_location
+        WHERE accommodation_id = (SELECT id FROM accommodation WHERE id = $1 AND org_id = $2)
+        ORDER BY name`,
+		accommodationID, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var location models.AccommodationLocation
+		if err := rows.Scan(&location.ID, &location.AccommodationID, &location.Name); err != nil {
+			return nil, err
+		}
+		locations = append(locations, location)
+	}
+
+	return locations, rows.Err()
+}
+
+// ticketAccommodation holds the accommodation fields shared by ticket
+// create and update requests, in both their text and ID forms
+type ticketAccommodation struct {
+	Name            string
+	Type            string
+	Location        string
+	RoomNumber      int
+	AccommodationID *int
+	RoomID          *int
+	LocationID      *int
+	// OrgID is the organisation of the ticket; accommodations of other
+	// organisations are treated as unknown
+	OrgID int
+}
+
+// resolveAccommodation reconciles the text and ID forms of a ticket's
+// accommodation. IDs win and overwrite the text so legacy readers stay
+// correct; text alone is matched case-insensitively to link the entities.
+func (h *AuthHandler) resolveAccommodation(ctx context.Context, a *ticketAccommodation) error {
+	if a.AccommodationID != nil {
+		var name, accommodationType string
+		err := h.db.QueryRow(ctx, "SELECT name, type FROM accommodation WHERE id = $1 AND org_id = $2", *a.AccommodationID, a.OrgID).Scan(&name, &accommodationType)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("%w: accommodation %d not found", errInvalidAccommodation, *a.AccommodationID)
+		}
+		if err != nil {
+			return err
+		}
+		a.Name = name
+		if accommodationType != "" {
+			a.Type = accommodationType
+		}
+	} else if name := strings.TrimSpace(a.Name); name != "" {
+		var id int
+		err := h.db.QueryRow(ctx, "SELECT id FROM accommodation WHERE lower(btrim(name)) = lower($1) AND org_id = $2", name, a.OrgID).Scan(&id)
+		if err == nil {
+			a.AccommodationID = &id
+		} else if !errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+	}
+
+	if a.RoomID != nil {
+		if a.AccommodationID == nil {
+			return fmt.Errorf("%w: room_id requires an accommodation", errInvalidAccommodation)
+		}
+		err := h.db.QueryRow(ctx, "SELECT room_number FROM accommodation_room WHERE id = $1 AND accommodation_id = $2", *a.RoomID, *a.AccommodationID).Scan(&a.RoomNumber)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("%w: room %d does not belong to accommodation %d", errInvalidAccommodation, *a.RoomID, *a.AccommodationID)
+		}
+		if err != nil {
+			return err
+		}
+	} else if a.AccommodationID != nil && a.RoomNumber > 0 {
+		var id int
+		err := h.db.QueryRow(ctx, "SELECT id FROM accommodation_room WHERE accommodation_id = $1 AND room_number = $2", *a.AccommodationID, a.RoomNumber).Scan(&id)
+		if err == nil {
+			a.RoomID = &id
+		} else if !errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+	}
+
+	if a.LocationID != nil {
+		if a.AccommodationID == nil {
+			return fmt.Errorf("%w: location_id requires an accommodation", errInvalidAccommodation)
+		}
+		err := h.db.QueryRow(ctx, "SELECT name FROM accommodation_location WHERE id = $1 AND accommodation_id = $2", *a.LocationID, *a.AccommodationID).Scan(&a.Location)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("%w: location %d does not belong to accommodation %d", errInvalidAccommodation, *a.LocationID, *a.AccommodationID)
+		}
+		if err != nil {
+			return err
+		}
+	} else if location := strings.TrimSpace(a.Location); a.AccommodationID != nil && location != "" {
+		var id int
+		err := h.db.QueryRow(ctx, "SELECT id FROM accommodation_location WHERE accommodation_id = $1 AND lower(btrim(name)) = lower($2)", *a.AccommodationID, location).Scan(&id)
+		if err == nil {
+			a.LocationID = &id
+		} else if !errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// resolveTicketAccommodation resolves the accommodation of a new ticket and
+// checks that the text fields clients still rely on are filled in
+func (h *AuthHandler) resolveTicketAccommodation(ctx context.Context, ticket *models.TicketCreate) error {
+	a := ticketAccommodation{
+		Name:            ticket.AccommodationName,
+		Type:            ticket.AccommodationType,
+		Location:        ticket.AccommodationSpecificLocation,
+		RoomNumber:      ticket.AccommodationRoomNumber,
+		AccommodationID: ticket.AccommodationID,
+		RoomID:          ticket.RoomID,
+		LocationID:      ticket.LocationID,
+		OrgID:           ticket.OrgID,
+	}
+	if err := h.resolveAccommodation(ctx, &a); err != nil {
+		return err
+	}
+
+	if a.Name == "" || a.Type == "" || a.Location == "" {
+		return fmt.Errorf("%w: accommodation name, type and specific location are required", errInvalidAccommodation)
+	}
+
+	ticket.AccommodationName = a.Name
+	ticket.AccommodationType = a.Type
+	ticket.AccommodationSpecificLocation = a.Location
+	ticket.AccommodationRoomNumber = a.RoomNumber
+	ticket.AccommodationID = a.AccommodationID
+	ticket.RoomID = a.RoomID
+	ticket.LocationID = a.LocationID
+	return nil
+}
+
+// resolveTicketUpdateAccommodation resolves any accommodation fields present
+// on an update of a ticket of orgID; fields left out of the request stay
+// untouched. A new accommodation replaces the room and location IDs along
+// with its own, so none are left pointing into the old one.
+func (h *AuthHandler) resolveTicketUpdateAccommodation(ctx context.Context, orgID int, ticketUpdate *models.TicketUpdate) error {
+	if ticketUpdate.AccommodationID == nil && ticketUpdate.AccommodationName == "" {
+		if ticketUpdate.RoomID != nil || ticketUpdate.LocationID != nil {
+			return fmt.Errorf("%w: room_id and location_id require accommodation_id", errInvalidAccommodation)
+		}
+		return nil
+	}
+
+	a := ticketAccommodation{
+		Name:            ticketUpdate.AccommodationName,
+		Type:            ticketUpdate.AccommodationType,
+		Location:        ticketUpdate.AccommodationSpecificLocation,
+		RoomNumber:      ticketUpdate.AccommodationRoomNumber,
+		AccommodationID: ticketUpdate.AccommodationID,
+		RoomID:          ticketUpdate.RoomID,
+		LocationID:      ticketUpdate.LocationID,
+		OrgID:           orgID,
+	}
+	if err := h.resolveAccommodation(ctx, &a); err != nil {
+		return err
+	}
+
+	ticketUpdate.AccommodationName = a.Name
+	ticketUpdate.AccommodationType = a.Type
+	ticketUpdate.AccommodationSpecificLocation = a.Location
+	ticketUpdate.AccommodationRoomNumber = a.RoomNumber
+	ticketUpdate.AccommodationID = a.AccommodationID
+	ticketUpdate.RoomID = a.RoomID
+	ticketUpdate.LocationID = a.LocationID
+	ticketUpdate.AccommodationChanged = true
+	return nil
+}
@@ -0,0 +1,343 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"ticket-sys/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	errAssignmentUnchanged = errors.New("ticket is already assigned to this user")
+	errAssignmentConflict  = errors.New("ticket was reassigned by someone else")
+	errAssigneeNotFound    = errors.New("assignee not found")
+)
+
+// Assign a ticket
+// @Summary Assign a Ticket
+// @Description Reassign a ticket and notify both the previous and the new assignees
+// @ID assign-ticket
+// @Produce json
+// @Param id path int true "Ticket ID"
+// @Param If-Match header string true "ETag of the ticket version being changed, or * to skip the check"
+// @Success 200 "Successful response"
+// @Failure 400 "Invalid input format"
+// @Failure 404 "Ticket not found"
+// @Failure 412 "Ticket was changed by someone else"
+// @Failure 428 "If-Match header required"
+// @Failure 500 "Database error"
+// @Router /tickets/{id}/assign [post]
+// @Security Bearer
+func (h *AuthHandler) AssignTicket(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ticket ID"})
+		return
+	}
+
+	var assign models.TicketAssign
+	if err := c.ShouldBindJSON(&assign); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid input format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	version, ok := h.requireIfMatch(c, id)
+	if !ok {
+		return
+	}
+
+	var assignedBy *int
+	if userID, ok := currentUserID(c); ok {
+		assignedBy = &userID
+	}
+
+	updatedTicket, err := h.assignTicket(context.Background(), id, currentOrgID(c), assign, assignedBy, nil, version)
+	switch {
+	case errors.Is(err, errTicketNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ticket not found"})
+	case errors.Is(err, errVersionConflict):
+		h.preconditionFailed(c, id)
+	case errors.Is(err, errAssignmentUnchanged):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ticket is already assigned to this user"})
+	case errors.Is(err, errAssigneeNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Assignee not found"})
+	case errors.Is(err, errMailer):
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Mailer error"})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+	default:
+		c.Header("ETag", ticketETag(updatedTicket.Version))
+		c.JSON(http.StatusOK, updatedTicket)
+	}
+}
+
+// Get ticket assignment history
+// @Summary Get Ticket Assignments
+// @Description List the assignment history of a ticket
+// @ID get-ticket-assignments
+// @Produce json
+// @Param id path int true "Ticket ID"
+// @Success 200 "Successful response"
+// @Failure 400 "Invalid ticket ID"
+// @Failure 500 "Database error"
+// @Router /tickets/{id}/assignments [get]
+// @Security Bearer
+func (h *AuthHandler) GetTicketAssignments(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ticket ID"})
+		return
+	}
+
+	assignments := []models.TicketAssignment{}
+
+	rows, err := h.db.Query(context.Background(), `
+        SELECT id, ticket_id, from_user_id, to_user_id, reason, assigned_by, created_date::text
+        FROM ticket_assignment
+        WHERE ticket_id = $1 AND ticket_id IN (SELECT id FROM ticket WHERE org_id = $2)
+        ORDER BY created_date, id`,
+		id, currentOrgID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	for rows.Next() {
+		var assignment models.TicketAssignment
+		err := rows.Scan(
+			&assignment.ID,
+			&assignment.TicketID,
+			&assignment.FromUserID,
+			&assignment.ToUserID,
+			&assignment.Reason,
+			&assignment.AssignedBy,
+			&assignment.CreatedDate)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Process failed"})
+			return
+		}
+		assignments = append(assignments, assignment)
+	}
+
+	if err = rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Assignment iteration failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, assignments)
+}
+
+// assignTicket changes the lead and supporting assignees of a ticket of
+// organisation orgID, records the change and notifies everyone affected.
+// When expected is set the change only applies if it is still the lead
+// assignee, and when version is set only to that ticket version. A mailer
+// failure is returned as errMailer along with the saved ticket.
+func (h *AuthHandler) assignTicket(ctx context.Context, id, orgID int, assign models.TicketAssign, assignedBy, expected, version *int) (*models.Ticket, error) {
+	// The lead assignee is never also a supporting assignee
+	var assignees []int
+	if assign.Assignees != nil {
+		assignees = []int{}
+		for _, userID := range *assign.Assignees {
+			if userID != assign.AssignedTo && !slices.Contains(assignees, userID) {
+				assignees = append(assignees, userID)
+			}
+		}
+	}
+
+	tx, err := h.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var previous, currentVersion int
+	var previousAssignees []int
+	err = tx.QueryRow(ctx, "SELECT COALESCE(assigned_to, 0), version, "+ticketAssigneesExpr+" FROM ticket WHERE id = $1 AND org_id = $2 AND deleted_at IS NULL FOR UPDATE", id, orgID).Scan(&previous, &currentVersion, &previousAssignees)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, errTicketNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if version != nil && currentVersion != *version {
+		return nil, errVersionConflict
+	}
+	if expected != nil && previous != *expected {
+		return nil, errAssignmentConflict
+	}
+	if err := checkOrgUsers(ctx, tx, orgID, append([]int{assign.AssignedTo}, assignees...)...); err != nil {
+		if errors.Is(err, errOtherOrganisation) {
+			return nil, errAssigneeNotFound
+		}
+		return nil, err
+	}
+
+	if assignees == nil {
+		// Only the lead changes; a new lead stops being a supporting assignee
+		assignees = []int{}
+		for _, userID := range previousAssignees {
+			if userID != assign.AssignedTo {
+				assignees = append(assignees, userID)
+			}
+		}
+	}
+
+	var added, removed []int
+	for _, userID := range assignees {
+		if !slices.Contains(previousAssignees, userID) {
+			added = append(added, userID)
+		}
+	}
+	for _, userID := range previousAssignees {
+		if !slices.Contains(assignees, userID) && userID != assign.AssignedTo {
+			removed = append(removed, userID)
+		}
+	}
+
+	if previous == assign.AssignedTo && len(added) == 0 && len(removed) == 0 {
+		return nil, errAssignmentUnchanged
+	}
+
+	// Supporting assignees live outside the ticket row, so the version is
+	// bumped here for changes that only touch them
+	_, err = tx.Exec(ctx, "UPDATE ticket SET assigned_to = $2, version = version + 1 WHERE id = $1 AND org_id = $3", id, assign.AssignedTo, orgID)
+	if err == nil {
+		_, err = tx.Exec(ctx, "DELETE FROM ticket_assignee WHERE ticket_id = $1 AND user_id <> ALL($2)", id, assignees)
+	}
+	if err == nil && len(added) > 0 {
+		_, err = tx.Exec(ctx, `
+            INSERT INTO ticket_assignee (ticket_id, user_id)
+            SELECT $1, unnest($2::int[])
+            ON CONFLICT DO NOTHING`,
+			id, added)
+	}
+	if err == nil {
+		_, err = tx.Exec(ctx, `
+            INSERT INTO ticket_assignment (ticket_id, from_user_id, to_user_id, reason, assigned_by)
+            VALUES ($1, NULLIF($2, 0), $3, $4, $5)`,
+			id, previous, assign.AssignedTo, assign.Reason, assignedBy)
+	}
+
+	if isForeignKeyViolation(err) {
+		return nil, errAssigneeNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	var updatedTicket models.Ticket
+	err = scanTicket(h.db.QueryRow(ctx, "SELECT "+ticketColumns+" FROM ticket WHERE id = $1 AND org_id = $2", id, orgID), &updatedTicket)
+	if err != nil {
+		return nil, err
+	}
+
+	mailErr := h.sendAssignmentMails(ctx, &updatedTicket, previous, added, removed, assign.Reason)
+
+	exclude := append([]int{previous, assign.AssignedTo}, append(added, removed...)...)
+	if assignedBy != nil {
+		exclude = append(exclude, *assignedBy)
+	}
+	message := ""
+	if assign.Reason != "" {
+		message = "Reason: " + assign.Reason
+	}
+	h.notifyWatchers(ctx, eventTicketAssigned, &updatedTicket, "Ticket #"+strconv.Itoa(id)+" Reassigned", "A ticket has been reassigned", message, exclude...)
+
+	return &updatedTicket, mailErr
+}
+
+// recordReassignment logs a lead assignee change made through UpdateTicket
+// and lets the previous assignee know the ticket was taken away
+func (h *AuthHandler) recordReassignment(ctx context.Context, ticket *models.Ticket, previous int, assignedBy *int) error {
+	_, err := h.db.Exec(ctx, `
+        INSERT INTO ticket_assignment (ticket_id, from_user_id, to_user_id, assigned_by)
+        VALUES ($1, NULLIF($2, 0), $3, $4)`,
+		ticket.ID, previous, ticket.AssignedTo, assignedBy)
+	if err != nil {
+		return err
+	}
+
+	// The new assignee already hears about it through the update email
+	leadName, _, err := h.userContact(ctx, ticket.AssignedTo)
+	if err != nil {
+		return err
+	}
+	_, email, err := h.userContact(ctx, previous)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	org := h.organisation(ctx, ticket.OrgID)
+	subject := "Ticket #" + strconv.Itoa(ticket.ID) + " Has Been Reassigned"
+	if err := sendMail(org, []string{email}, subject, ticketMailBody(org, "A ticket has been reassigned to "+leadName, "", ticket, leadName)); err != nil {
+		return errMailer
+	}
+	return nil
+}
+
+// sendAssignmentMails notifies everyone affected by an assignment change:
+// the previous and new lead assignees, and supporting assignees who were
+// added or removed. Every email is attempted; the first failure is returned.
+func (h *AuthHandler) sendAssignmentMails(ctx context.Context, ticket *models.Ticket, previous int, added, removed []int, reason string) error {
+	leadName, leadEmail, err := h.userContact(ctx, ticket.AssignedTo)
+	if err != nil {
+		return err
+	}
+
+	message := ""
+	if reason != "" {
+		message = "Reason: " + reason
+	}
+	id := strconv.Itoa(ticket.ID)
+
+	type mail struct {
+		userID  int
+		email   string
+		subject string
+		heading string
+	}
+	var mails []mail
+
+	if previous != ticket.AssignedTo {
+		mails = append(mails,
+			mail{userID: ticket.AssignedTo, email: leadEmail, subject: "Ticket #" + id + " Has Been Assigned To You", heading: "A ticket has been assigned to you"},
+			mail{userID: previous, subject: "Ticket #" + id + " Has Been Reassigned", heading: "A ticket has been reassigned to " + leadName})
+	}
+	for _, userID := range added {
+		mails = append(mails, mail{userID: userID, subject: "Ticket #" + id + " Has Been Assigned To You", heading: "You have been added to a ticket"})
+	}
+	for _, userID := range removed {
+		mails = append(mails, mail{userID: userID, subject: "Ticket #" + id + " Has Been Reassigned", heading: "You have been removed from a ticket"})
+	}
+
+	org := h.organisation(ctx, ticket.OrgID)
+	var firstErr error
+	for _, m := range mails {
+		if m.email == "" {
+			if _, m.email, err = h.userContact(ctx, m.userID); err != nil {
+				// The user may since have been removed
+				continue
+			}
+		}
+		if err := sendMail(org, []string{m.email}, m.subject, ticketMailBody(org, m.heading, message, ticket, leadName)); err != nil && firstErr == nil {
+			firstErr = errMailer
+		}
+	}
+
+	return firstErr
+}
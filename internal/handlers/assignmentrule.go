@@ -0,0 +1,663 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"ticket-sys/internal/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	errInvalidAssignmentRule = errors.New("invalid assignment rule")
+	// errNoAssignee reports a ticket created without assigned_to that no
+	// assignment rule could assign
+	errNoAssignee = errors.New("assigned_to is required: no assignment rule matched and nobody is on call")
+)
+
+const assignmentRuleColumns = `id, name, position, accommodation_id, request_type, task_priority, to_char(time_from, 'HH24:MI'), to_char(time_to, 'HH24:MI'), timezone, strategy, assigned_to, pool, active, created_date::text`
+
+// assignmentRuleTimeLayout is how rule time windows are written
+const assignmentRuleTimeLayout = "15:04"
+
+// Create assignment rule
+// @Summary Create Assignment Rule
+// @Description Add a rule that assigns new tickets created without assigned_to. Rules are tried by position; the first that matches and can name an assignee wins.
+// @ID create-assignment-rule
+// @Produce json
+// @Success 201 "Successful response"
+// @Failure 400 "Invalid input format"
+// @Router /assignment-rules [post]
+// @Security Bearer
+func (h *AuthHandler) CreateAssignmentRule(c *gin.Context) {
+	var input models.AssignmentRuleCreate
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid input format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	rule := models.AssignmentRule{
+		Name:            strings.TrimSpace(input.Name),
+		Position:        input.Position,
+		AccommodationID: input.AccommodationID,
+		RequestType:     input.RequestType,
+		TaskPriority:    input.TaskPriority,
+		TimeFrom:        input.TimeFrom,
+		TimeTo:          input.TimeTo,
+		Timezone:        input.Timezone,
+		Strategy:        input.Strategy,
+		AssignedTo:      input.AssignedTo,
+		Pool:            input.Pool,
+		Active:          input.Active == nil || *input.Active,
+	}
+	ctx := context.Background()
+	if rule.Timezone == "" {
+		rule.Timezone = h.organisation(ctx, currentOrgID(c)).Timezone
+	}
+
+	if err := h.validateAssignmentRule(ctx, currentOrgID(c), &rule); err != nil {
+		if errors.Is(err, errInvalidAssignmentRule) || errors.Is(err, errInvalidCatalog) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	var created models.AssignmentRule
+	err := scanAssignmentRule(h.db.QueryRow(ctx, `
+        INSERT INTO assignment_rule (name, position, accommodation_id, request_type, task_priority, time_from, time_to, timezone, strategy, assigned_to, pool, active, org_id)
+        VALUES ($1, $2, $3, $4, $5, $6::time, $7::time, $8, $9, $10, $11, $12, $13)
+        RETURNING `+assignmentRuleColumns,
+		rule.Name,
+		rule.Position,
+		rule.AccommodationID,
+		rule.RequestType,
+		rule.TaskPriority,
+		rule.TimeFrom,
+		rule.TimeTo,
+		rule.Timezone,
+		rule.Strategy,
+		rule.AssignedTo,
+		rule.Pool,
+		rule.Active,
+		currentOrgID(c),
+	), &created)
+	if isForeignKeyViolation(err) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Accommodation or assignee not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Assignment rule creation failed"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, created)
+}
+
+// Get assignment rules
+// @Summary Get Assignment Rules
+// @Description List the assignment rules in the order they are tried
+// @ID get-assignment-rules
+// @Produce json
+// @Success 200 "Successful response"
+// @Failure 500 "Database error"
+// @Router /assignment-rules [get]
+// @Security Bearer
+func (h *AuthHandler) GetAssignmentRules(c *gin.Context) {
+	rules, err := h.assignmentRules(context.Background(), currentOrgID(c), false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, rules)
+}
+
+// Get assignment rule
+// @Summary Get Assignment Rule
+// @Description Get single assignment rule
+// @ID get-assignment-rule
+// @Produce json
+// @Param id path int true "Assignment rule ID"
+// @Success 200 "Successful response"
+// @Failure 400 "Invalid assignment rule ID"
+// @Failure 404 "Assignment rule not found"
+// @Router /assignment-rules/{id} [get]
+// @Security Bearer
+func (h *AuthHandler) GetAssignmentRule(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid assignment rule ID"})
+		return
+	}
+
+	var rule models.AssignmentRule
+	err = scanAssignmentRule(h.db.QueryRow(context.Background(), "SELECT "+assignmentRuleColumns+" FROM assignment_rule WHERE id = $1 AND org_id = $2", id, currentOrgID(c)), &rule)
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Assignment rule not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, rule)
+}
+
+// Update assignment rule
+// @Summary Update Assignment Rule
+// @Description Update an assignment rule
+// @ID update-assignment-rule
+// @Produce json
+// @Param id path int true "Assignment rule ID"
+// @Success 200 "Successful response"
+// @Failure 400 "Invalid assignment rule data"
+// @Failure 404 "Assignment rule not found"
+// @Router /assignment-rules/{id} [patch]
+// @Security Bearer
+func (h *AuthHandler) UpdateAssignmentRule(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid assignment rule ID"})
+		return
+	}
+
+	var update models.AssignmentRuleUpdate
+	if err := c.ShouldBindJSON(&update); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid assignment rule data", "details": err.Error()})
+		return
+	}
+
+	ctx := context.Background()
+	var rule models.AssignmentRule
+	err = scanAssignmentRule(h.db.QueryRow(ctx, "SELECT "+assignmentRuleColumns+" FROM assignment_rule WHERE id = $1 AND org_id = $2", id, currentOrgID(c)), &rule)
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Assignment rule not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if update.Name != nil {
+		rule.Name = strings.TrimSpace(*update.Name)
+	}
+	if update.Position != nil {
+		rule.Position = *update.Position
+	}
+	if update.AccommodationID != nil {
+		rule.AccommodationID = update.AccommodationID
+		if *update.AccommodationID == 0 {
+			rule.AccommodationID = nil
+		}
+	}
+	if update.RequestType != nil {
+		rule.RequestType = update.RequestType
+	}
+	if update.TaskPriority != nil {
+		rule.TaskPriority = update.TaskPriority
+	}
+	if update.TimeFrom != nil {
+		rule.TimeFrom = update.TimeFrom
+	}
+	if update.TimeTo != nil {
+		rule.TimeTo = update.TimeTo
+	}
+	if update.Timezone != nil {
+		rule.Timezone = *update.Timezone
+	}
+	if update.Strategy != nil {
+		rule.Strategy = *update.Strategy
+	}
+	if update.AssignedTo != nil {
+		rule.AssignedTo = update.AssignedTo
+	}
+	if update.Pool != nil {
+		rule.Pool = *update.Pool
+	}
+	if update.Active != nil {
+		rule.Active = *update.Active
+	}
+
+	if err := h.validateAssignmentRule(ctx, currentOrgID(c), &rule); err != nil {
+		if errors.Is(err, errInvalidAssignmentRule) || errors.Is(err, errInvalidCatalog) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	var updated models.AssignmentRule
+	err = scanAssignmentRule(h.db.QueryRow(ctx, `
+        UPDATE assignment_rule
+        SET name = $2, position = $3, accommodation_id = $4, request_type = $5, task_priority = $6,
+            time_from = $7::time, time_to = $8::time, timezone = $9, strategy = $10, assigned_to = $11,
+            pool = $12, active = $13
+        WHERE id = $1 AND org_id = $14
+        RETURNING `+assignmentRuleColumns,
+		id,
+		rule.Name,
+		rule.Position,
+		rule.AccommodationID,
+		rule.RequestType,
+		rule.TaskPriority,
+		rule.TimeFrom,
+		rule.TimeTo,
+		rule.Timezone,
+		rule.Strategy,
+		rule.AssignedTo,
+		rule.Pool,
+		rule.Active,
+		currentOrgID(c),
+	), &updated)
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Assignment rule not found"})
+		return
+	}
+	if isForeignKeyViolation(err) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Accommodation or assignee not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, updated)
+}
+
+// Delete assignment rule
+// @Summary Delete Assignment Rule
+// @Description Delete an assignment rule
+// @ID delete-assignment-rule
+// @Produce json
+// @Param id path int true "Assignment rule ID"
+// @Success 200 "Successful response"
+// @Failure 400 "Invalid assignment rule ID"
+// @Failure 404 "Assignment rule not found"
+// @Router /assignment-rules/{id} [delete]
+// @Security Bearer
+func (h *AuthHandler) DeleteAssignmentRule(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid assignment rule ID"})
+		return
+	}
+
+	result, err := h.db.Exec(context.Background(), "DELETE FROM assignment_rule WHERE id = $1 AND org_id = $2", id, currentOrgID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if result.RowsAffected() == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Assignment rule not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"id": id})
+}
+
+// Dry-run assignment rules
+// @Summary Dry-run Assignment Rules
+// @Description Show who a ticket would be assigned to and why, rule by rule, without assigning anything or advancing round-robin pools
+// @ID dry-run-assignment-rules
+// @Produce json
+// @Success 200 "Successful response"
+// @Failure 400 "Invalid input format"
+// @Failure 500 "Database error"
+// @Router /assignment-rules/dry-run [post]
+// @Security Bearer
+func (h *AuthHandler) DryRunAssignmentRules(c *gin.Context) {
+	var check models.AssignmentCheck
+	if err := c.ShouldBindJSON(&check); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid input format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	ctx := context.Background()
+	check.OrgID = currentOrgID(c)
+	if check.AccommodationID == nil && strings.TrimSpace(check.AccommodationName) != "" {
+		var id int
+		err := h.db.QueryRow(ctx, "SELECT id FROM accommodation WHERE lower(btrim(name)) = lower(btrim($1)) AND org_id = $2", check.AccommodationName, check.OrgID).Scan(&id)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if err == nil {
+			check.AccommodationID = &id
+		}
+	}
+
+	explanation, err := h.autoAssign(ctx, check, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, explanation)
+}
+
+// autoAssign tries the active rules in order on a ticket and explains the
+// outcome, falling back to whoever is on call. AssignedTo is nil when
+// nobody could be found. Round-robin pools only move on when advance is
+// set.
+func (h *AuthHandler) autoAssign(ctx context.Context, check models.AssignmentCheck, advance bool) (*models.AssignmentExplanation, error) {
+	rules, err := h.assignmentRules(ctx, check.OrgID, true)
+	if err != nil {
+		return nil, err
+	}
+
+	at := time.Now()
+	if check.At != nil {
+		at = *check.At
+	}
+
+	explanation := &models.AssignmentExplanation{Steps: []models.AssignmentStep{}}
+	for _, rule := range rules {
+		step := models.AssignmentStep{RuleID: rule.ID, Name: rule.Name}
+		if reason := assignmentRuleMismatch(&rule, &check, at); reason != "" {
+			step.Reason = reason
+			explanation.Steps = append(explanation.Steps, step)
+			continue
+		}
+
+		assignee, reason, err := h.assignmentRuleAssignee(ctx, &rule, at, advance)
+		if err != nil {
+			return nil, err
+		}
+		step.Reason = reason
+		if assignee == nil {
+			explanation.Steps = append(explanation.Steps, step)
+			continue
+		}
+
+		step.Matched = true
+		explanation.Steps = append(explanation.Steps, step)
+		explanation.RuleID = &rule.ID
+		explanation.RuleName = rule.Name
+		explanation.AssignedTo = assignee
+		break
+	}
+
+	// Without a rule the ticket goes to whoever is on call
+	if explanation.AssignedTo == nil {
+		userID, err := onCallStaff(ctx, h.db, check.OrgID, check.AccommodationID, at)
+		if err != nil {
+			return nil, err
+		}
+		if userID != 0 {
+			explanation.AssignedTo = &userID
+			explanation.Steps = append(explanation.Steps, models.AssignmentStep{
+				Name:    "on call",
+				Matched: true,
+				Reason:  fmt.Sprintf("no rule assigned the ticket; user %d is on call", userID),
+			})
+		}
+	}
+
+	return explanation, nil
+}
+
+// applyAssignmentRules assigns a new ticket by the rules, failing with
+// errNoAssignee when none can
+func (h *AuthHandler) applyAssignmentRules(ctx context.Context, ticket *models.TicketCreate, advance bool) error {
+	explanation, err := h.autoAssign(ctx, models.AssignmentCheck{
+		AccommodationID: ticket.AccommodationID,
+		RequestType:     ticket.RequestType,
+		TaskPriority:    ticket.TaskPriority,
+		OrgID:           ticket.OrgID,
+	}, advance)
+	if err != nil {
+		return err
+	}
+	if explanation.AssignedTo == nil {
+		return errNoAssignee
+	}
+	ticket.AssignedTo = *explanation.AssignedTo
+	return nil
+}
+
+// assignmentRuleMismatch returns why a rule does not apply to a ticket, or
+// "" when it does
+func assignmentRuleMismatch(rule *models.AssignmentRule, check *models.AssignmentCheck, at time.Time) string {
+	if rule.AccommodationID != nil && (check.AccommodationID == nil || *check.AccommodationID != *rule.AccommodationID) {
+		return "accommodation does not match"
+	}
+	if rule.RequestType != nil && !strings.EqualFold(strings.TrimSpace(*rule.RequestType), strings.TrimSpace(check.RequestType)) {
+		return "request type does not match"
+	}
+	if rule.TaskPriority != nil && !strings.EqualFold(strings.TrimSpace(*rule.TaskPriority), strings.TrimSpace(check.TaskPriority)) {
+		return "priority does not match"
+	}
+	if rule.TimeFrom != nil && rule.TimeTo != nil {
+		loc, err := time.LoadLocation(rule.Timezone)
+		if err != nil {
+			return "invalid timezone " + rule.Timezone
+		}
+		from, _ := time.Parse(assignmentRuleTimeLayout, *rule.TimeFrom)
+		to, _ := time.Parse(assignmentRuleTimeLayout, *rule.TimeTo)
+		local := at.In(loc)
+		minute := local.Hour()*60 + local.Minute()
+		start := from.Hour()*60 + from.Minute()
+		end := to.Hour()*60 + to.Minute()
+
+		inside := true
+		switch {
+		case start < end:
+			inside = minute >= start && minute < end
+		case start > end:
+			// The window wraps past midnight
+			inside = minute >= start || minute < end
+		}
+		if !inside {
+			return fmt.Sprintf("%s is outside %s-%s", local.Format(assignmentRuleTimeLayout), *rule.TimeFrom, *rule.TimeTo)
+		}
+	}
+	return ""
+}
+
+// assignmentRuleAssignee picks the assignee of a matching rule and says
+// how. It returns nil when the rule's user or everyone in its pool is off
+// duty at the given time.
+func (h *AuthHandler) assignmentRuleAssignee(ctx context.Context, rule *models.AssignmentRule, at time.Time, advance bool) (*int, string, error) {
+	var assignee *int
+	var err error
+
+	// Pools only pick staff who are on duty when the ticket comes in
+	onDuty := staffOnDutySQL("s.id", "$2")
+
+	switch rule.Strategy {
+	case "user":
+		available, err := staffOnDuty(ctx, h.db, *rule.AssignedTo, at)
+		if err != nil {
+			return nil, "", err
+		}
+		if !available {
+			return nil, fmt.Sprintf("matched, but user %d is off duty", *rule.AssignedTo), nil
+		}
+		return rule.AssignedTo, "matched; assigns user " + strconv.Itoa(*rule.AssignedTo), nil
+	case "round_robin":
+		// The next pool member after the last one picked, wrapping around.
+		// Updating in place serializes concurrent picks on the row lock.
+		next := `COALESCE(
+            (SELECT min(s.id) FROM staff_user s WHERE s.id = ANY (r.pool) AND ` + onDuty + ` AND s.id > COALESCE(r.last_assigned_to, 0)),
+            (SELECT min(s.id) FROM staff_user s WHERE s.id = ANY (r.pool) AND ` + onDuty + `))`
+		if advance {
+			// A pool with nobody on duty keeps its place and returns no row
+			err = h.db.QueryRow(ctx, "UPDATE assignment_rule r SET last_assigned_to = "+next+" WHERE r.id = $1 AND "+next+" IS NOT NULL RETURNING r.last_assigned_to", rule.ID, at).Scan(&assignee)
+		} else {
+			err = h.db.QueryRow(ctx, "SELECT "+next+" FROM assignment_rule r WHERE r.id = $1", rule.ID, at).Scan(&assignee)
+		}
+		if errors.Is(err, pgx.ErrNoRows) {
+			err = nil
+		}
+	case "least_loaded":
+		err = h.db.QueryRow(ctx, `
+            SELECT s.id
+            FROM staff_user s
+            WHERE s.id = ANY ($1) AND `+onDuty+`
+            ORDER BY (SELECT count(*) FROM ticket t
+                      WHERE t.assigned_to = s.id AND t.deleted_at IS NULL AND t.task_status <> 'Completed'), s.id
+            LIMIT 1`,
+			rule.Pool, at).Scan(&assignee)
+		if errors.Is(err, pgx.ErrNoRows) {
+			err = nil
+		}
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	if assignee == nil {
+		return nil, "matched, but nobody in its pool is on duty", nil
+	}
+	return assignee, fmt.Sprintf("matched; %s pool picks user %d", strings.ReplaceAll(rule.Strategy, "_", "-"), *assignee), nil
+}
+
+// assignmentRules lists the rules of orgID in the order they are tried
+func (h *AuthHandler) assignmentRules(ctx context.Context, orgID int, activeOnly bool) ([]models.AssignmentRule, error) {
+	rows, err := h.db.Query(ctx, "SELECT "+assignmentRuleColumns+" FROM assignment_rule WHERE org_id = $2 AND (active OR NOT $1) ORDER BY position, id", activeOnly, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []models.AssignmentRule{}
+	for rows.Next() {
+		var rule models.AssignmentRule
+		if err := scanAssignmentRule(rows, &rule); err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+// validateAssignmentRule checks a rule of orgID before it is stored,
+// normalising empty conditions to unset and catalog values to their
+// catalog spelling
+func (h *AuthHandler) validateAssignmentRule(ctx context.Context, orgID int, rule *models.AssignmentRule) error {
+	if rule.Name == "" {
+		return fmt.Errorf("%w: name is required", errInvalidAssignmentRule)
+	}
+	if _, err := time.LoadLocation(rule.Timezone); err != nil {
+		return fmt.Errorf("%w: unknown timezone %q", errInvalidAssignmentRule, rule.Timezone)
+	}
+
+	for _, value := range []**string{&rule.RequestType, &rule.TaskPriority, &rule.TimeFrom, &rule.TimeTo} {
+		if *value != nil && strings.TrimSpace(**value) == "" {
+			*value = nil
+		}
+	}
+	if (rule.TimeFrom == nil) != (rule.TimeTo == nil) {
+		return fmt.Errorf("%w: time_from and time_to go together", errInvalidAssignmentRule)
+	}
+	for _, value := range []*string{rule.TimeFrom, rule.TimeTo} {
+		if value == nil {
+			continue
+		}
+		if _, err := time.Parse(assignmentRuleTimeLayout, *value); err != nil {
+			return fmt.Errorf("%w: times must be HH:MM, got %q", errInvalidAssignmentRule, *value)
+		}
+	}
+
+	var requestType, priority string
+	if rule.RequestType != nil {
+		requestType = *rule.RequestType
+	}
+	if rule.TaskPriority != nil {
+		priority = *rule.TaskPriority
+	}
+	if err := h.validateCatalogValues(ctx, &requestType, &priority); err != nil {
+		return err
+	}
+	if rule.RequestType != nil {
+		rule.RequestType = &requestType
+	}
+	if rule.TaskPriority != nil {
+		rule.TaskPriority = &priority
+	}
+
+	if err := checkOrgAccommodation(ctx, h.db, orgID, rule.AccommodationID); err != nil {
+		if errors.Is(err, errOtherOrganisation) {
+			return fmt.Errorf("%w: accommodation not found", errInvalidAssignmentRule)
+		}
+		return err
+	}
+
+	rule.Pool = uniqueInts(rule.Pool)
+	switch rule.Strategy {
+	case "user":
+		if rule.AssignedTo == nil {
+			return fmt.Errorf("%w: assigned_to is required for the user strategy", errInvalidAssignmentRule)
+		}
+		if err := checkOrgUsers(ctx, h.db, orgID, *rule.AssignedTo); err != nil {
+			if errors.Is(err, errOtherOrganisation) {
+				return fmt.Errorf("%w: assignee not found", errInvalidAssignmentRule)
+			}
+			return err
+		}
+		rule.Pool = []int{}
+	case "round_robin", "least_loaded":
+		if len(rule.Pool) == 0 {
+			return fmt.Errorf("%w: pool is required for the %s strategy", errInvalidAssignmentRule, rule.Strategy)
+		}
+		var known int
+		if err := h.db.QueryRow(ctx, "SELECT count(*) FROM staff_user WHERE id = ANY ($1) AND org_id = $2", rule.Pool, orgID).Scan(&known); err != nil {
+			return err
+		}
+		if known != len(rule.Pool) {
+			return fmt.Errorf("%w: pool contains unknown users", errInvalidAssignmentRule)
+		}
+		rule.AssignedTo = nil
+	}
+	return nil
+}
+
+// uniqueInts returns values without duplicates, keeping the first of each
+func uniqueInts(values []int) []int {
+	unique := []int{}
+	seen := map[int]bool{}
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
+
+func scanAssignmentRule(row pgx.Row, rule *models.AssignmentRule) error {
+	return row.Scan(
+		&rule.ID,
+		&rule.Name,
+		&rule.Position,
+		&rule.AccommodationID,
+		&rule.RequestType,
+		&rule.TaskPriority,
+		&rule.TimeFrom,
+		&rule.TimeTo,
+		&rule.Timezone,
+		&rule.Strategy,
+		&rule.AssignedTo,
+		&rule.Pool,
+		&rule.Active,
+		&rule.CreatedDate,
+	)
+}
@@ -2,9 +2,13 @@ package handlers
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
+	"ticket-sys/internal/events"
 	"ticket-sys/internal/models"
 	"ticket-sys/internal/utils"
 	"time"
@@ -20,6 +24,12 @@ type AuthHandler struct {
 	// Add token expiration configuration
 	tokenExpiration        time.Duration
 	refreshTokenExpiration time.Duration
+	// hub feeds the live ticket streams; nil when they are disabled
+	hub *events.Hub
+	// ticketRetention is how long deleted tickets are kept; zero keeps them
+	ticketRetention time.Duration
+	// boardOrigins are the browser origins the dispatcher board accepts
+	boardOrigins []string
 }
 
 // NewAuthHandler creates a new authentication handler
@@ -41,13 +51,20 @@ func NewAuthHandler(db *pgx.Conn, jwtSecret []byte) *AuthHandler {
 	}
 }
 
+// SetEventHub enables the live ticket streams, fed by hub
+func (h *AuthHandler) SetEventHub(hub *events.Hub) {
+	h.hub = hub
+}
+
 // Register handles user registration
 // @Summary Create New User
-// @Description Create a new user
+// @Description Create a new user from an invitation. The organisation and role are the invitation's, and email must be the address it was sent to. Each invitation registers one user.
 // @ID create-user
 // @Produce json
-// @Success 200 "Successful response"
-// @Failure 400 "Invalid input format"
+// @Param user body models.UserRegister true "User and invitation token"
+// @Success 201 "Successful response"
+// @Failure 400 "Invalid input format, or invalid or expired invitation"
+// @Failure 409 "Email already registered"
 // @Router /register [post]
 func (h *AuthHandler) Register(c *gin.Context) {
 	var user models.UserRegister
@@ -67,19 +84,6 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
-	// Check if user already exists
-	var exists bool
-	err := h.db.QueryRow(context.Background(), "SELECT EXISTS(SELECT 1 FROM staff_user WHERE email = $1)",
-		user.Email).Scan(&exists)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
-		return
-	}
-	if exists {
-		c.JSON(http.StatusConflict, gin.H{"error": "Email already registered"})
-		return
-	}
-
 	// Hash password
 	hashedPassword, err := utils.HashPassword(user.Password)
 	if err != nil {
@@ -88,27 +92,49 @@ func (h *AuthHandler) Register(c *gin.Context) {
 	}
 
 	// Insert user with transaction
-	tx, err := h.db.Begin(context.Background())
+	ctx := context.Background()
+	tx, err := h.db.Begin(ctx)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction start failed"})
 		return
 	}
+	defer tx.Rollback(ctx)
+
+	// Use up the invitation; it stays if registration fails
+	var orgID int
+	var role string
+	err = tx.QueryRow(ctx, `
+        DELETE FROM user_invitation
+        WHERE token_hash = $1 AND lower(email) = lower($2) AND expires_at > now()
+        RETURNING org_id, role`,
+		invitationTokenHash(strings.TrimSpace(user.InvitationToken)), user.Email,
+	).Scan(&orgID, &role)
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired invitation"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
 
 	var id int
-	err = tx.QueryRow(context.Background(), `
-        INSERT INTO staff_user 
-        VALUES (DEFAULT, $1, $2, $3, $4) 
+	err = tx.QueryRow(ctx, `
+        INSERT INTO staff_user (first_name, last_name, email, password, role, org_id)
+        VALUES ($1, $2, $3, $4, $5, $6)
         RETURNING id`,
-		user.FirstName, user.LastName, user.Email, hashedPassword,
+		strings.TrimSpace(user.FirstName), strings.TrimSpace(user.LastName), user.Email, hashedPassword, role, orgID,
 	).Scan(&id)
-
+	if isUniqueViolation(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email already registered"})
+		return
+	}
 	if err != nil {
-		tx.Rollback(context.Background())
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "User creation failed"})
 		return
 	}
 
-	if err = tx.Commit(context.Background()); err != nil {
+	if err = tx.Commit(ctx); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction commit failed"})
 		return
 	}
@@ -119,41 +145,77 @@ func (h *AuthHandler) Register(c *gin.Context) {
 	})
 }
 
+// userFilterSQL narrows staff_user to a page of GetUsers: the
+// organisation, search text, role and active flag are $1 to $4
+const userFilterSQL = `WHERE org_id = $1
+          AND ($2 = '' OR strpos(lower(first_name || ' ' || last_name || ' ' || email), lower($2)) > 0)
+          AND ($3 = '' OR role = $3)
+          AND ($4::boolean IS NULL OR active = $4)`
+
 // Get Users
 // @Summary Get All Users
-// @Description Get All Users
+// @Description List the users of the caller's organisation by name, a page at a time. q matches names and email addresses; role and active narrow the list.
 // @ID get-users
 // @Produce json
+// @Param q query string false "Search names and email addresses"
+// @Param role query string false "admin or staff"
+// @Param active query bool false "Only active or only deactivated users"
+// @Param page query int false "Page number, from 1"
+// @Param page_size query int false "Users per page, 50 by default and at most 200"
 // @Success 200 "Successful response"
-// @Failure 400 "Database error"
+// @Failure 400 "Invalid filter"
+// @Failure 500 "Database error"
 // @Router /users [get]
+// @Security Bearer
 func (h *AuthHandler) GetUsers(c *gin.Context) {
-	var users []models.User
+	var filter models.UserFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid filter", "details": err.Error()})
+		return
+	}
+	if filter.Page == 0 {
+		filter.Page = 1
+	}
+	if filter.PageSize == 0 {
+		filter.PageSize = defaultUserPageSize
+	}
 
-	rows, err := h.db.Query(context.Background(), "SELECT * FROM staff_user")
+	page := models.UserPage{Users: []models.User{}, Page: filter.Page, PageSize: filter.PageSize}
 
+	rows, err := h.db.Query(context.Background(), `
+        SELECT `+userColumns+`, count(*) OVER ()
+        FROM staff_user
+        `+userFilterSQL+`
+        ORDER BY first_name, last_name, id
+        LIMIT $5 OFFSET $6`,
+		currentOrgID(c), strings.TrimSpace(filter.Query), filter.Role, filter.Active,
+		filter.PageSize, (filter.Page-1)*filter.PageSize)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
 	}
+	defer rows.Close()
 
 	for rows.Next() {
 		var user models.User
-
 		err := rows.Scan(
 			&user.ID,
 			&user.FirstName,
 			&user.LastName,
 			&user.Email,
-			&user.Password,
+			&user.Role,
+			&user.OrgID,
+			&user.Active,
+			&user.DeactivatedAt,
+			&user.MFAEnabled,
+			&page.Total,
 		)
-
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Process failed"})
 			return
 		}
 
-		users = append(users, user)
+		page.Users = append(page.Users, user)
 	}
 
 	if err = rows.Err(); err != nil {
@@ -161,8 +223,18 @@ func (h *AuthHandler) GetUsers(c *gin.Context) {
 		return
 	}
 
-	// Return ticket list
-	c.JSON(http.StatusOK, users)
+	// Past the last page there is no row to carry the count
+	if len(page.Users) == 0 && filter.Page > 1 {
+		err := h.db.QueryRow(context.Background(), "SELECT count(*) FROM staff_user "+userFilterSQL,
+			currentOrgID(c), strings.TrimSpace(filter.Query), filter.Role, filter.Active,
+		).Scan(&page.Total)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, page)
 }
 
 // Get User
@@ -170,9 +242,12 @@ func (h *AuthHandler) GetUsers(c *gin.Context) {
 // @Description Get Single User
 // @ID get-user
 // @Produce json
+// @Param id path int true "User ID"
 // @Success 200 "Successful response"
-// @Failure 400 "Database error"
-// @Router /users [get]
+// @Failure 400 "Invalid User ID"
+// @Failure 404 "User not found"
+// @Router /users/{id} [get]
+// @Security Bearer
 func (h *AuthHandler) GetUser(c *gin.Context) {
 	var user models.User
 
@@ -184,18 +259,11 @@ func (h *AuthHandler) GetUser(c *gin.Context) {
 		return
 	}
 
-	dbErr := h.db.QueryRow(context.Background(), `
-        SELECT * 
-        FROM staff_user 
-        WHERE id = $1`,
-		id,
-	).Scan(
-		&user.ID,
-		&user.FirstName,
-		&user.LastName,
-		&user.Email,
-		&user.Password)
-
+	dbErr := scanUser(h.db.QueryRow(context.Background(), "SELECT "+userColumns+" FROM staff_user WHERE id = $1 AND org_id = $2", id, currentOrgID(c)), &user)
+	if errors.Is(dbErr, pgx.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
 	if dbErr != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
@@ -207,13 +275,14 @@ func (h *AuthHandler) GetUser(c *gin.Context) {
 
 // Login handles user authentication and JWT generation
 // @Summary Login User
-// @Description Log a user in
+// @Description Log a user in. Users with two-factor authentication get mfa_required and a short-lived mfa_token instead of tokens, to exchange with a code at POST /login/mfa. When mfa_enrollment_required is set the tokens only reach the /me/mfa routes until two-factor authentication is set up.
 // @ID login-user
 // @Produce json
 // @Param user_login body models.UserLogin true "User Login"
 // @Success 200 "Successful response"
 // @Failure 400 "Invalid login data"
 // @Failure 401 "Unauthorized user"
+// @Failure 403 "Account deactivated"
 // @Router /login [post]
 func (h *AuthHandler) Login(c *gin.Context) {
 	var login models.UserLogin
@@ -222,78 +291,54 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	// Get user from database
+	// Get user from database; the hash is kept apart from the user
 	var user models.User
+	var passwordHash string
+	var mfaEnabled bool
 	err := h.db.QueryRow(c, `
-        SELECT id, first_name, last_name, password
+        SELECT id, first_name, last_name, role, org_id, active, password, mfa_enabled
         FROM staff_user 
         WHERE email = $1`,
 		login.Email,
-	).Scan(&user.ID, &user.FirstName, &user.LastName, &user.Password)
+	).Scan(&user.ID, &user.FirstName, &user.LastName, &user.Role, &user.OrgID, &user.Active, &passwordHash, &mfaEnabled)
 
-	if err != nil {
+	if errors.Is(err, pgx.ErrNoRows) {
 		// Don't specify whether email or password was wrong
-		log.Fatal("Failed to load config:", err)
-		c.JSON(http.StatusUnauthorized, gin.H{"error": err})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Login process failed"})
 		return
 	}
-	// if err != nil {
-	// 	c.JSON(http.StatusInternalServerError, gin.H{"error": "Login process failed"})
-	// 	return
-	// }
 
 	// Verify password
-	if !utils.CheckPasswordHash(login.Password, user.Password) {
+	if !utils.CheckPasswordHash(login.Password, passwordHash) {
 		// Use same message as above for security
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password"})
 		return
 	}
+	h.upgradePasswordHash(c, user.ID, login.Password, passwordHash)
 
-	// Generate JWT with claims
-	now := time.Now()
-	claims := jwt.MapClaims{
-		"user_id":    user.ID,
-		"first_name": user.FirstName,
-		"last_name":  user.LastName,
-		"iat":        now.Unix(),
-		"exp":        now.Add(h.tokenExpiration).Unix(),
-	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(h.jwtSecret)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Token generation failed"})
+	// Only told once the password is right, so it reveals nothing new
+	if !user.Active {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account deactivated"})
 		return
 	}
 
-	refreshClaims := jwt.MapClaims{
-		"user_id":    user.ID,
-		"first_name": user.FirstName,
-		"last_name":  user.LastName,
-		"iat":        now.Unix(),
-		"exp":        now.Add(h.refreshTokenExpiration).Unix(),
-	}
-
-	refreshTokenString, err := jwt.NewWithClaims(jwt.SigningMethodHS256, refreshClaims).SignedString(h.jwtSecret)
-
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Refresh Token generation failed"})
+	// With two-factor authentication the tokens wait for a code at
+	// POST /login/mfa
+	if mfaEnabled {
+		h.respondWithMFAChallenge(c, user.ID)
 		return
 	}
 
-	// Return token with expiration
-	c.JSON(http.StatusOK, gin.H{
-		"token":                tokenString,
-		"refresh_token":        refreshTokenString,
-		"expires_in":           h.tokenExpiration.Seconds(),
-		"refersh_token_expiry": h.refreshTokenExpiration.Seconds(),
-		"token_type":           "Bearer",
-	})
+	h.respondWithTokens(c, user.ID)
 }
 
 // RefreshToken generates a new token for valid users
 // @Summary Refresh a Token
-// @Description Refresh token for re-authentication
+// @Description Trade a refresh token for a new access and refresh token. The user's current role and name are used, and deactivated users are refused.
 // @ID refresh-token
 // @Produce json
 // @Success 200 "Successful response"
@@ -315,55 +360,121 @@ func (h *AuthHandler) RefreshToken(c *gin.Context) {
 	}
 
 	refreshClaims := jwt.MapClaims{}
-	refreshToken, err := jwt.ParseWithClaims(refreshTokenString.RefreshToken, refreshClaims, func(token *jwt.Token) (interface{}, error) {
+	_, err := jwt.ParseWithClaims(refreshTokenString.RefreshToken, refreshClaims, func(token *jwt.Token) (interface{}, error) {
 		return []byte(h.jwtSecret), nil
 	})
 
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Claims"})
+		return
 	}
 
-	// Generate new token
+	// Access and challenge tokens cannot be traded for new tokens
+	if refreshClaims["purpose"] != "refresh" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid Claims"})
+		return
+	}
+
+	userID, _ := refreshClaims["user_id"].(float64)
+	h.respondWithTokens(c, int(userID))
+}
+
+// respondWithTokens answers with a new access and refresh token for a
+// user. The user is read afresh, so name and role changes show up and
+// deactivated users are turned away; the refresh token therefore carries
+// nothing but the user. Users whose role requires two-factor
+// authentication they have not set up get tokens that only reach the
+// enrollment routes.
+func (h *AuthHandler) respondWithTokens(c *gin.Context, userID int) {
+	var user models.User
+	var mfaEnrollment bool
+	err := h.db.QueryRow(context.Background(), `
+        SELECT u.id, u.first_name, u.last_name, u.role, u.org_id, u.active,
+               NOT u.mfa_enabled AND u.role = ANY (o.mfa_required_roles)
+        FROM staff_user u
+        JOIN organisation o ON o.id = u.org_id
+        WHERE u.id = $1`,
+		userID,
+	).Scan(&user.ID, &user.FirstName, &user.LastName, &user.Role, &user.OrgID, &user.Active, &mfaEnrollment)
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid Claims"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !user.Active {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Account deactivated"})
+		return
+	}
+
+	// Generate JWT with claims
 	now := time.Now()
 	claims := jwt.MapClaims{
-		"user_id":    refreshToken.Claims.(jwt.MapClaims)["user_id"],
-		"first_name": refreshToken.Claims.(jwt.MapClaims)["first_name"],
-		"last_name":  refreshToken.Claims.(jwt.MapClaims)["last_name"],
+		"user_id":    user.ID,
+		"first_name": user.FirstName,
+		"last_name":  user.LastName,
+		"role":       user.Role,
+		"org_id":     user.OrgID,
+		"purpose":    "access",
 		"iat":        now.Unix(),
 		"exp":        now.Add(h.tokenExpiration).Unix(),
 	}
+	if mfaEnrollment {
+		claims["mfa_enrollment"] = true
+	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	tokenString, err := token.SignedString(h.jwtSecret)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Token refresh failed"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Token generation failed"})
 		return
 	}
 
-	newRefreshClaims := jwt.MapClaims{
-		"user_id":    refreshToken.Claims.(jwt.MapClaims)["user_id"],
-		"first_name": refreshToken.Claims.(jwt.MapClaims)["first_name"],
-		"last_name":  refreshToken.Claims.(jwt.MapClaims)["last_name"],
-		"iat":        now.Unix(),
-		"exp":        now.Add(h.refreshTokenExpiration).Unix(),
+	refreshClaims := jwt.MapClaims{
+		"user_id": user.ID,
+		"purpose": "refresh",
+		"iat":     now.Unix(),
+		"exp":     now.Add(h.refreshTokenExpiration).Unix(),
 	}
 
-	newRefreshToken, tokenErr := jwt.NewWithClaims(jwt.SigningMethodHS256, newRefreshClaims).SignedString(h.jwtSecret)
+	refreshTokenString, err := jwt.NewWithClaims(jwt.SigningMethodHS256, refreshClaims).SignedString(h.jwtSecret)
 
-	if tokenErr != nil {
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Refresh Token generation failed"})
 		return
 	}
 
+	// Return token with expiration
 	c.JSON(http.StatusOK, gin.H{
-		"token":                tokenString,
-		"refresh_token":        newRefreshToken,
-		"expires_in":           h.tokenExpiration.Seconds(),
-		"refersh_token_expiry": h.refreshTokenExpiration.Seconds(),
-		"token_type":           "Bearer",
+		"token":                   tokenString,
+		"refresh_token":           refreshTokenString,
+		"expires_in":              h.tokenExpiration.Seconds(),
+		"refersh_token_expiry":    h.refreshTokenExpiration.Seconds(),
+		"token_type":              "Bearer",
+		"mfa_enrollment_required": mfaEnrollment,
 	})
 }
 
+// upgradePasswordHash stores a fresh hash of a user's password, just
+// checked against hash, when hash is of an older algorithm or strength.
+// Failures are only logged, as the old hash still works.
+func (h *AuthHandler) upgradePasswordHash(ctx context.Context, userID int, password, hash string) {
+	if !utils.NeedsRehash(hash) {
+		return
+	}
+	upgraded, err := utils.HashPassword(password)
+	if err != nil {
+		log.Printf("password rehash for user %d: %v", userID, err)
+		return
+	}
+	// Leave the hash alone if the password was changed meanwhile
+	if _, err := h.db.Exec(ctx, "UPDATE staff_user SET password = $2 WHERE id = $1 AND password = $3", userID, upgraded, hash); err != nil {
+		log.Printf("password rehash for user %d: %v", userID, err)
+	}
+}
+
 // Logout endpoint (optional - useful for client-side cleanup)
 func (h *AuthHandler) Logout(c *gin.Context) {
 	// Since JWT is stateless, server-side logout isn't needed
@@ -373,3 +484,25 @@ func (h *AuthHandler) Logout(c *gin.Context) {
 		"instructions": "Please remove the token from your client storage",
 	})
 }
+
+// currentUserID returns the id of the user authenticated by AuthMiddleware
+func currentUserID(c *gin.Context) (int, bool) {
+	value, _ := c.Get("user_id")
+	id, ok := value.(float64)
+	return int(id), ok
+}
+
+// currentOrgID returns the organisation of the user authenticated by
+// AuthMiddleware, which every query the request makes is scoped to
+func currentOrgID(c *gin.Context) int {
+	value, _ := c.Get("org_id")
+	id, _ := value.(float64)
+	return int(id)
+}
+
+// currentUserName returns the full name carried by the user's token
+func currentUserName(c *gin.Context) string {
+	firstName, _ := c.Get("first_name")
+	lastName, _ := c.Get("last_name")
+	return strings.TrimSpace(fmt.Sprint(firstName) + " " + fmt.Sprint(lastName))
+}
@@ -0,0 +1,507 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"ticket-sys/internal/events"
+	"ticket-sys/internal/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"golang.org/x/net/websocket"
+)
+
+// ticketStatuses are the statuses a ticket moves through
+var ticketStatuses = []string{"Assigned", "Pending", "Completed"}
+
+var (
+	errInvalidStatus  = errors.New("invalid status")
+	errStatusConflict = errors.New("ticket status was changed by someone else")
+)
+
+// boardFrame is a message sent to dispatcher board clients. Type is event
+// (a ticket change), presence, ack (a command succeeded) or error.
+type boardFrame struct {
+	Type     string                `json:"type"`
+	Ref      string                `json:"ref,omitempty"`
+	Code     string                `json:"code,omitempty"`
+	Error    string                `json:"error,omitempty"`
+	TicketID int                   `json:"ticket_id,omitempty"`
+	Event    *events.Event         `json:"event,omitempty"`
+	Viewers  json.RawMessage       `json:"viewers,omitempty"`
+	Ticket   *models.Ticket        `json:"ticket,omitempty"`
+	Comment  *models.TicketComment `json:"comment,omitempty"`
+}
+
+// boardSession is one dispatcher board connection. Its handler works on
+// a database connection of its own, as pgx.Conn is not safe for concurrent
+// use and a board outlives the request that opened it.
+type boardSession struct {
+	h      *AuthHandler
+	ws     *websocket.Conn
+	id     string
+	orgID  int
+	viewer events.Viewer
+
+	writeMu sync.Mutex
+
+	viewingMu sync.Mutex
+	viewing   []int
+}
+
+// boardTicketExpiry is how long a board ticket can be used for
+const boardTicketExpiry = 30 * time.Second
+
+// errBoardOrigin turns away board connections from pages of other sites
+var errBoardOrigin = errors.New("origin not allowed")
+
+// SetBoardOrigins sets the browser origins, such as the dashboard's, that
+// may open the dispatcher board
+func (h *AuthHandler) SetBoardOrigins(origins []string) {
+	h.boardOrigins = origins
+}
+
+// Create board ticket
+// @Summary Create Dispatcher Board Ticket
+// @Description Issue a ticket for opening the dispatcher board from a browser, which cannot set the Authorization header on WebSocket requests. It works once, within 30 seconds, and stands for the caller's token.
+// @ID create-board-ticket
+// @Produce json
+// @Success 201 "Successful response"
+// @Failure 401 "Unauthorized"
+// @Failure 500 "Internal server error"
+// @Router /tickets/board/tickets [post]
+// @Security Bearer
+func (h *AuthHandler) CreateBoardTicket(c *gin.Context) {
+	token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
+		return
+	}
+
+	raw := make([]byte, 32)
+	rand.Read(raw)
+	ticket := hex.EncodeToString(raw)
+
+	ctx := c.Request.Context()
+	if _, err := h.db.Exec(ctx, "DELETE FROM board_ticket WHERE expires_at <= now()"); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if _, err := h.db.Exec(ctx,
+		"INSERT INTO board_ticket (ticket_hash, token, expires_at) VALUES ($1, $2, $3)",
+		boardTicketHash(ticket), token, time.Now().Add(boardTicketExpiry),
+	); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"ticket":     ticket,
+		"expires_in": int(boardTicketExpiry.Seconds()),
+	})
+}
+
+// BoardTicketAuth redeems the single-use ticket in the ticket query
+// parameter for the token it was issued for. It must run before
+// AuthMiddleware, which then checks the token as usual.
+func (h *AuthHandler) BoardTicketAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ticket := c.Query("ticket")
+		if ticket == "" || c.GetHeader("Authorization") != "" {
+			c.Next()
+			return
+		}
+
+		// Deleting it whether or not it has expired makes it single use
+		var token string
+		var expiresAt time.Time
+		err := h.db.QueryRow(c.Request.Context(),
+			"DELETE FROM board_ticket WHERE ticket_hash = $1 RETURNING token, expires_at",
+			boardTicketHash(ticket),
+		).Scan(&token, &expiresAt)
+		if errors.Is(err, pgx.ErrNoRows) || (err == nil && time.Now().After(expiresAt)) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired board ticket"})
+			c.Abort()
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			c.Abort()
+			return
+		}
+		c.Request.Header.Set("Authorization", "Bearer "+token)
+		c.Next()
+	}
+}
+
+// boardTicketHash is what is stored for a board ticket
+func boardTicketHash(ticket string) string {
+	sum := sha256.Sum256([]byte(ticket))
+	return hex.EncodeToString(sum[:])
+}
+
+// boardOriginAllowed reports whether a page from origin may open the board
+func (h *AuthHandler) boardOriginAllowed(origin *url.URL) bool {
+	for _, allowed := range h.boardOrigins {
+		if strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin.Scheme+"://"+origin.Host) {
+			return true
+		}
+	}
+	return false
+}
+
+// Dispatcher board
+// @Summary Dispatcher Board WebSocket
+// @Description WebSocket streaming ticket changes and viewer presence, and accepting view, leave, assign, status and comment commands. Browsers pass a ticket from POST /tickets/board/tickets instead of the Authorization header, and must be on an allowed origin. The connection closes when the token expires.
+// @ID ticket-board
+// @Param ticket query string false "Board ticket when the Authorization header cannot be set"
+// @Success 101 "Switching protocols"
+// @Failure 401 "Unauthorized"
+// @Failure 403 "Origin not allowed"
+// @Failure 503 "Event stream or database unavailable"
+// @Router /tickets/board [get]
+// @Security Bearer
+func (h *AuthHandler) TicketBoard(c *gin.Context) {
+	if h.hub == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Event stream unavailable"})
+		return
+	}
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+		return
+	}
+
+	var expires time.Time
+	if exp, ok := c.Value("token_exp").(float64); ok {
+		expires = time.Unix(int64(exp), 0)
+	}
+
+	// The board runs for as long as the socket is open, so it gets its own
+	// connection rather than sharing h.db with every other request
+	conn, err := pgx.ConnectConfig(c.Request.Context(), h.db.Config())
+	if err != nil {
+		log.Printf("board database: %v", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database unavailable"})
+		return
+	}
+	defer conn.Close(context.Background())
+	board := *h
+	board.db = conn
+
+	var id [16]byte
+	rand.Read(id[:])
+
+	session := &boardSession{
+		h:      &board,
+		id:     hex.EncodeToString(id[:]),
+		orgID:  currentOrgID(c),
+		viewer: events.Viewer{UserID: userID, Name: currentUserName(c)},
+	}
+
+	server := websocket.Server{
+		// Browsers send the token of whoever is signed in, whichever page
+		// opens the socket, so only allowed origins get in. Other clients
+		// send no Origin and are authenticated by their token alone.
+		Handshake: func(config *websocket.Config, req *http.Request) error {
+			origin, err := websocket.Origin(config, req)
+			if err != nil {
+				return err
+			}
+			if origin != nil && !h.boardOriginAllowed(origin) {
+				return errBoardOrigin
+			}
+			config.Origin = origin
+			return nil
+		},
+		Handler: func(ws *websocket.Conn) {
+			session.ws = ws
+			session.serve(expires)
+		},
+	}
+	server.ServeHTTP(c.Writer, c.Request)
+}
+
+func (s *boardSession) serve(expires time.Time) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	live, unsubscribe := s.h.hub.Subscribe()
+	defer unsubscribe()
+
+	// Leave every ticket still open when the connection goes away
+	defer func() {
+		s.viewingMu.Lock()
+		viewing := s.viewing
+		s.viewing = nil
+		s.viewingMu.Unlock()
+		for _, ticketID := range viewing {
+			if err := s.h.hub.Announce(context.Background(), s.id, s.orgID, ticketID, s.viewer, false); err != nil {
+				log.Printf("board presence: %v", err)
+			}
+		}
+	}()
+
+	go s.push(ctx, live, expires)
+
+	for {
+		var command models.BoardCommand
+		if err := websocket.JSON.Receive(s.ws, &command); err != nil {
+			var syntaxErr *json.SyntaxError
+			if errors.As(err, &syntaxErr) {
+				s.send(boardFrame{Type: "error", Code: "invalid_command", Error: "Invalid JSON"})
+				continue
+			}
+			return
+		}
+		s.handle(ctx, command)
+	}
+}
+
+// push forwards hub events to the client and keeps its presence alive
+// until ctx is cancelled or the token expires
+func (s *boardSession) push(ctx context.Context, live <-chan events.Event, expires time.Time) {
+	presence := time.NewTicker(events.PresenceInterval)
+	defer presence.Stop()
+
+	var expired <-chan time.Time
+	if !expires.IsZero() {
+		timer := time.NewTimer(time.Until(expires))
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-live:
+			if !ok {
+				// Fell behind; the client reconnects and reloads the board
+				s.send(boardFrame{Type: "error", Code: "lagging", Error: "Too many pending events, please reconnect"})
+				s.ws.Close()
+				return
+			}
+			if event.OrgID == nil || *event.OrgID != s.orgID {
+				continue
+			}
+			if event.Type == events.TypePresence {
+				s.send(boardFrame{Type: "presence", TicketID: event.TicketID, Viewers: event.Data})
+			} else {
+				s.send(boardFrame{Type: "event", TicketID: event.TicketID, Event: &event})
+			}
+		case <-presence.C:
+			s.viewingMu.Lock()
+			viewing := slices.Clone(s.viewing)
+			s.viewingMu.Unlock()
+			for _, ticketID := range viewing {
+				if err := s.h.hub.Announce(ctx, s.id, s.orgID, ticketID, s.viewer, true); err != nil {
+					log.Printf("board presence: %v", err)
+				}
+			}
+		case <-expired:
+			s.send(boardFrame{Type: "error", Code: "token_expired", Error: "Token expired"})
+			s.ws.Close()
+			return
+		}
+	}
+}
+
+func (s *boardSession) send(frame boardFrame) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	if err := websocket.JSON.Send(s.ws, frame); err != nil {
+		s.ws.Close()
+	}
+}
+
+// fail reports a failed command, with the ticket as it now stands when
+// the command lost a race
+func (s *boardSession) fail(ctx context.Context, command models.BoardCommand, code, message string) {
+	frame := boardFrame{Type: "error", Ref: command.Ref, Code: code, Error: message, TicketID: command.TicketID}
+	if code == "conflict" {
+		var ticket models.Ticket
+		if err := scanTicket(s.h.db.QueryRow(ctx, "SELECT "+ticketColumns+" FROM ticket WHERE id = $1 AND org_id = $2", command.TicketID, s.orgID), &ticket); err == nil {
+			frame.Ticket = &ticket
+		}
+	}
+	s.send(frame)
+}
+
+func (s *boardSession) handle(ctx context.Context, command models.BoardCommand) {
+	if command.TicketID <= 0 {
+		s.fail(ctx, command, "invalid_command", "ticket_id is required")
+		return
+	}
+	userID := s.viewer.UserID
+
+	// Tickets of other organisations are reported as missing
+	var ours bool
+	if err := s.h.db.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM ticket WHERE id = $1 AND org_id = $2)", command.TicketID, s.orgID).Scan(&ours); err != nil {
+		s.fail(ctx, command, "server_error", "Database error")
+		return
+	}
+	if !ours {
+		s.fail(ctx, command, "not_found", "Ticket not found")
+		return
+	}
+
+	switch command.Type {
+	case "view":
+		s.viewingMu.Lock()
+		if !slices.Contains(s.viewing, command.TicketID) {
+			s.viewing = append(s.viewing, command.TicketID)
+		}
+		s.viewingMu.Unlock()
+
+		if err := s.h.hub.Announce(ctx, s.id, s.orgID, command.TicketID, s.viewer, true); err != nil {
+			s.fail(ctx, command, "server_error", "Presence unavailable")
+			return
+		}
+		viewers, _ := json.Marshal(s.h.hub.Viewers(command.TicketID))
+		s.send(boardFrame{Type: "ack", Ref: command.Ref, TicketID: command.TicketID, Viewers: viewers})
+
+	case "leave":
+		s.viewingMu.Lock()
+		s.viewing = slices.DeleteFunc(s.viewing, func(id int) bool { return id == command.TicketID })
+		s.viewingMu.Unlock()
+
+		if err := s.h.hub.Announce(ctx, s.id, s.orgID, command.TicketID, s.viewer, false); err != nil {
+			s.fail(ctx, command, "server_error", "Presence unavailable")
+			return
+		}
+		s.send(boardFrame{Type: "ack", Ref: command.Ref, TicketID: command.TicketID})
+
+	case "assign":
+		if command.AssignedTo <= 0 || (command.FromAssignedTo == nil && command.Version == nil) {
+			s.fail(ctx, command, "invalid_command", "assigned_to and version or from_assigned_to are required")
+			return
+		}
+		assign := models.TicketAssign{AssignedTo: command.AssignedTo, Reason: command.Reason}
+		ticket, err := s.h.assignTicket(ctx, command.TicketID, s.orgID, assign, &userID, command.FromAssignedTo, command.Version)
+		switch {
+		case errors.Is(err, errTicketNotFound):
+			s.fail(ctx, command, "not_found", "Ticket not found")
+		case errors.Is(err, errVersionConflict):
+			s.fail(ctx, command, "conflict", "Ticket was changed by someone else")
+		case errors.Is(err, errAssignmentConflict):
+			s.fail(ctx, command, "conflict", "Ticket was reassigned by someone else")
+		case errors.Is(err, errAssignmentUnchanged), errors.Is(err, errAssigneeNotFound):
+			s.fail(ctx, command, "invalid_command", err.Error())
+		case err != nil && !errors.Is(err, errMailer):
+			s.fail(ctx, command, "server_error", "Database error")
+		default:
+			s.send(boardFrame{Type: "ack", Ref: command.Ref, TicketID: command.TicketID, Ticket: ticket})
+		}
+
+	case "status":
+		if command.Status == "" || (command.FromStatus == nil && command.Version == nil) {
+			s.fail(ctx, command, "invalid_command", "status and version or from_status are required")
+			return
+		}
+		ticket, err := s.h.changeTicketStatus(ctx, command.TicketID, s.orgID, command.Status, command.FromStatus, command.Version, &userID)
+		switch {
+		case errors.Is(err, errTicketNotFound):
+			s.fail(ctx, command, "not_found", "Ticket not found")
+		case errors.Is(err, errVersionConflict):
+			s.fail(ctx, command, "conflict", "Ticket was changed by someone else")
+		case errors.Is(err, errStatusConflict):
+			s.fail(ctx, command, "conflict", "Ticket status was changed by someone else")
+		case errors.Is(err, errInvalidStatus):
+			s.fail(ctx, command, "invalid_command", err.Error())
+		case err != nil:
+			s.fail(ctx, command, "server_error", "Database error")
+		default:
+			s.send(boardFrame{Type: "ack", Ref: command.Ref, TicketID: command.TicketID, Ticket: ticket})
+		}
+
+	case "comment":
+		if strings.TrimSpace(command.Body) == "" {
+			s.fail(ctx, command, "invalid_command", "body is required")
+			return
+		}
+		comment, err := s.h.addComment(ctx, command.TicketID, s.orgID, &userID, s.viewer.Name, command.Body, "app")
+		switch {
+		case errors.Is(err, errTicketNotFound):
+			s.fail(ctx, command, "not_found", "Ticket not found")
+		case err != nil:
+			s.fail(ctx, command, "server_error", "Database error")
+		default:
+			s.send(boardFrame{Type: "ack", Ref: command.Ref, TicketID: command.TicketID, Comment: &comment})
+		}
+
+	default:
+		s.fail(ctx, command, "invalid_command", "Unknown command "+command.Type)
+	}
+}
+
+// changeTicketStatus moves a ticket of organisation orgID to status, then
+// notifies the assignee and watchers. When from is set it fails with
+// errStatusConflict if the ticket is no longer in that status, and when
+// version is set with errVersionConflict if the ticket has changed since.
+func (h *AuthHandler) changeTicketStatus(ctx context.Context, id, orgID int, status string, from *string, version, actor *int) (*models.Ticket, error) {
+	if !slices.Contains(ticketStatuses, status) {
+		return nil, fmt.Errorf("%w %q", errInvalidStatus, status)
+	}
+
+	// Same bookkeeping as patchUserRecord: leaving "Assigned" is the SLA
+	// response and "Completed" stamps the completion date
+	var ticket models.Ticket
+	err := scanTicket(h.db.QueryRow(ctx, `
+        UPDATE ticket
+        SET task_status = $2,
+            responded_at = CASE WHEN $2 <> 'Assigned' THEN COALESCE(responded_at, now()) ELSE responded_at END,
+            completion_date = CASE WHEN $2 = 'Completed' THEN COALESCE(completion_date, now()) ELSE completion_date END
+        WHERE id = $1 AND org_id = $5 AND deleted_at IS NULL AND ($3::text IS NULL OR task_status = $3) AND ($4::int IS NULL OR version = $4)
+        RETURNING `+ticketColumns,
+		id, status, from, version, orgID,
+	), &ticket)
+	if errors.Is(err, pgx.ErrNoRows) {
+		var currentStatus string
+		var currentVersion int
+		err := h.db.QueryRow(ctx, "SELECT task_status, version FROM ticket WHERE id = $1 AND org_id = $2 AND deleted_at IS NULL", id, orgID).Scan(&currentStatus, &currentVersion)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errTicketNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		if version != nil && currentVersion != *version {
+			return nil, errVersionConflict
+		}
+		return nil, errStatusConflict
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	subject := fmt.Sprintf("Ticket #%d Updated To %s", ticket.ID, status)
+	heading := "A ticket status has been updated to " + strings.ToLower(status)
+
+	exclude := []int{}
+	if actor != nil {
+		exclude = append(exclude, *actor)
+	}
+	if actor == nil || *actor != ticket.AssignedTo {
+		if err := h.sendTicketMail(ctx, ticket.AssignedTo, eventStatusChanged, subject, heading, "", &ticket); err != nil {
+			log.Printf("status notification for ticket #%d: %v", ticket.ID, err)
+		}
+		exclude = append(exclude, ticket.AssignedTo)
+	}
+	h.notifyWatchers(ctx, eventStatusChanged, &ticket, subject, heading, "", exclude...)
+
+	return &ticket, nil
+}
@@ -0,0 +1,488 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"ticket-sys/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// maxBulkTickets bounds how many tickets one bulk operation may touch
+const maxBulkTickets = 500
+
+// bulkChange is a ticket changed by a bulk operation and the users to tell
+type bulkChange struct {
+	ticket     models.Ticket
+	recipients map[int]string
+}
+
+// Bulk ticket operation
+// @Summary Bulk Update Tickets
+// @Description Set the status or priority of, reassign or delete many tickets at once, chosen by IDs or a filter. Tickets chosen by IDs each need their version in versions, or 428 lists the ones missing; with a filter versions are optional and only checked for the tickets they name. In atomic mode (the default) any failure rolls everything back and the report is returned with 409; best_effort applies what it can. Everyone affected gets one email listing their tickets.
+// @ID bulk-update-tickets
+// @Produce json
+// @Success 200 "Successful response"
+// @Failure 400 "Invalid input format"
+// @Failure 409 "Atomic operation rolled back"
+// @Failure 428 "Versions required"
+// @Failure 500 "Database error"
+// @Router /tickets/bulk [post]
+// @Security Bearer
+func (h *AuthHandler) BulkUpdateTickets(c *gin.Context) {
+	var bulk models.TicketBulk
+	if err := c.ShouldBindJSON(&bulk); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid input format",
+			"details": err.Error(),
+		})
+		return
+	}
+	if bulk.Mode == "" {
+		bulk.Mode = "atomic"
+	}
+	bulk.OrgID = currentOrgID(c)
+
+	ctx := context.Background()
+
+	switch bulk.Operation {
+	case "status":
+		if !slices.Contains(ticketStatuses, bulk.Status) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%v %q", errInvalidStatus, bulk.Status)})
+			return
+		}
+	case "priority":
+		if strings.TrimSpace(bulk.Priority) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "priority is required"})
+			return
+		}
+		var requestType string
+		if err := h.validateCatalogValues(ctx, &requestType, &bulk.Priority); err != nil {
+			if errors.Is(err, errInvalidCatalog) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+	case "reassign":
+		var exists bool
+		if err := h.db.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM staff_user WHERE id = $1 AND org_id = $2 AND active)", bulk.AssignedTo, bulk.OrgID).Scan(&exists); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if !exists {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Assignee not found"})
+			return
+		}
+	}
+
+	ids, err := h.bulkTicketIDs(ctx, &bulk)
+	if err != nil {
+		var inputErr bulkInputError
+		if errors.As(err, &inputErr) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	// Tickets picked by ID were seen by the client, so like a single
+	// ticket change each needs the version it was seen at
+	if bulk.Filter == nil {
+		missing := []int{}
+		for _, id := range ids {
+			if _, ok := bulk.Versions[id]; !ok {
+				missing = append(missing, id)
+			}
+		}
+		if len(missing) > 0 {
+			c.JSON(http.StatusPreconditionRequired, gin.H{
+				"error":       "versions required for every ticket",
+				"missing_ids": missing,
+			})
+			return
+		}
+	}
+
+	var actor *int
+	if userID, ok := currentUserID(c); ok {
+		actor = &userID
+	}
+
+	report, changes, err := h.runBulk(ctx, &bulk, ids, actor)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	h.sendBulkNotifications(&bulk, changes, actor, currentUserName(c))
+
+	if !report.Committed {
+		c.JSON(http.StatusConflict, report)
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// bulkInputError is a problem with how a bulk operation chose its tickets
+type bulkInputError string
+
+func (e bulkInputError) Error() string { return string(e) }
+
+// bulkTicketIDs returns the tickets a bulk operation applies to, in order
+// and without duplicates
+func (h *AuthHandler) bulkTicketIDs(ctx context.Context, bulk *models.TicketBulk) ([]int, error) {
+	if (len(bulk.IDs) == 0) == (bulk.Filter == nil) {
+		return nil, bulkInputError("exactly one of ids or filter is required")
+	}
+
+	if bulk.Filter == nil {
+		ids := []int{}
+		for _, id := range bulk.IDs {
+			if !slices.Contains(ids, id) {
+				ids = append(ids, id)
+			}
+		}
+		if len(ids) > maxBulkTickets {
+			return nil, bulkInputError(fmt.Sprintf("at most %d tickets can be changed at once", maxBulkTickets))
+		}
+		return ids, nil
+	}
+
+	if *bulk.Filter == (models.TicketFilter{}) {
+		// An empty filter would select every ticket
+		return nil, bulkInputError("filter must set at least one field")
+	}
+
+	filter := *bulk.Filter
+	filter.OrgID = bulk.OrgID
+	where, args, err := ticketFilterSQL(filter, nil)
+	if err != nil {
+		return nil, bulkInputError(err.Error())
+	}
+	args = append(args, maxBulkTickets+1)
+	rows, err := h.db.Query(ctx, "SELECT id FROM ticket "+where+" ORDER BY id LIMIT $"+strconv.Itoa(len(args)), args...)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) > maxBulkTickets {
+		return nil, bulkInputError(fmt.Sprintf("filter matches more than %d tickets", maxBulkTickets))
+	}
+	return ids, nil
+}
+
+// runBulk applies a bulk operation to every ticket, in one transaction in
+// atomic mode or one transaction per ticket in best_effort mode. It only
+// fails outright when the database cannot be reached; ticket failures are
+// reported per item.
+func (h *AuthHandler) runBulk(ctx context.Context, bulk *models.TicketBulk, ids []int, actor *int) (*models.TicketBulkReport, []bulkChange, error) {
+	report := &models.TicketBulkReport{
+		Operation: bulk.Operation,
+		Mode:      bulk.Mode,
+		Results:   []models.TicketBulkResult{},
+	}
+	var changes []bulkChange
+
+	if bulk.Mode == "best_effort" {
+		for _, id := range ids {
+			tx, err := h.db.Begin(ctx)
+			if err != nil {
+				return nil, nil, err
+			}
+			change, result := h.bulkApply(ctx, tx, bulk, id, actor)
+			if result.Status == "ok" {
+				if err := tx.Commit(ctx); err != nil {
+					result = models.TicketBulkResult{TicketID: id, Status: "failed", Error: "Database error"}
+					change = nil
+				}
+			} else {
+				tx.Rollback(ctx)
+			}
+			if change != nil {
+				changes = append(changes, *change)
+			}
+			report.Results = append(report.Results, result)
+		}
+		report.Committed = true
+		countBulkResults(report)
+		return report, changes, nil
+	}
+
+	tx, err := h.db.Begin(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	failed := false
+	for _, id := range ids {
+		if failed {
+			report.Results = append(report.Results, models.TicketBulkResult{TicketID: id, Status: "rolled_back"})
+			continue
+		}
+		change, result := h.bulkApply(ctx, tx, bulk, id, actor)
+		if result.Status != "ok" && result.Status != "unchanged" {
+			failed = true
+		}
+		if change != nil {
+			changes = append(changes, *change)
+		}
+		report.Results = append(report.Results, result)
+	}
+
+	if !failed {
+		if err := tx.Commit(ctx); err != nil {
+			failed = true
+		}
+	}
+	if failed {
+		// Nothing was saved, so nobody is notified
+		for i, result := range report.Results {
+			if result.Status == "ok" {
+				report.Results[i] = models.TicketBulkResult{TicketID: result.TicketID, Status: "rolled_back"}
+			}
+		}
+		changes = nil
+	}
+
+	report.Committed = !failed
+	countBulkResults(report)
+	return report, changes, nil
+}
+
+func countBulkResults(report *models.TicketBulkReport) {
+	for _, result := range report.Results {
+		switch result.Status {
+		case "ok", "unchanged":
+			report.Succeeded++
+		default:
+			report.Failed++
+		}
+	}
+}
+
+// bulkApply applies a bulk operation to one ticket within tx, returning
+// the change to notify about when the ticket was changed
+func (h *AuthHandler) bulkApply(ctx context.Context, tx pgx.Tx, bulk *models.TicketBulk, id int, actor *int) (*bulkChange, models.TicketBulkResult) {
+	result := models.TicketBulkResult{TicketID: id}
+	failed := func(err error) (*bulkChange, models.TicketBulkResult) {
+		log.Printf("bulk %s of ticket #%d: %v", bulk.Operation, id, err)
+		result.Status, result.Error = "failed", "Database error"
+		return nil, result
+	}
+
+	var before models.Ticket
+	err := scanTicket(tx.QueryRow(ctx, "SELECT "+ticketColumns+" FROM ticket WHERE id = $1 AND org_id = $2 AND deleted_at IS NULL FOR UPDATE", id, bulk.OrgID), &before)
+	if errors.Is(err, pgx.ErrNoRows) {
+		result.Status, result.Error = "not_found", "Ticket not found"
+		return nil, result
+	}
+	if err != nil {
+		return failed(err)
+	}
+	if version, ok := bulk.Versions[id]; ok && version != before.Version {
+		result.Status, result.Error, result.Version = "conflict", "Ticket was changed by someone else", &before.Version
+		return nil, result
+	}
+
+	event := eventTicketUpdated
+	var previous []int
+
+	switch bulk.Operation {
+	case "status":
+		if before.TaskStatus == bulk.Status {
+			result.Status, result.Version = "unchanged", &before.Version
+			return nil, result
+		}
+		event = eventStatusChanged
+		// Same bookkeeping as changeTicketStatus
+		_, err = tx.Exec(ctx, `
+            UPDATE ticket
+            SET task_status = $2,
+                responded_at = CASE WHEN $2 <> 'Assigned' THEN COALESCE(responded_at, now()) ELSE responded_at END,
+                completion_date = CASE WHEN $2 = 'Completed' THEN COALESCE(completion_date, now()) ELSE completion_date END
+            WHERE id = $1`,
+			id, bulk.Status)
+
+	case "priority":
+		if strings.EqualFold(before.TaskPriority, bulk.Priority) {
+			result.Status, result.Version = "unchanged", &before.Version
+			return nil, result
+		}
+		_, err = tx.Exec(ctx, "UPDATE ticket SET task_priority = $2 WHERE id = $1", id, bulk.Priority)
+		if err == nil {
+			err = applySLA(ctx, tx, id)
+		}
+
+	case "reassign":
+		if before.AssignedTo == bulk.AssignedTo {
+			result.Status, result.Version = "unchanged", &before.Version
+			return nil, result
+		}
+		event = eventTicketAssigned
+		previous = []int{before.AssignedTo}
+		_, err = tx.Exec(ctx, "UPDATE ticket SET assigned_to = $2 WHERE id = $1", id, bulk.AssignedTo)
+		if err == nil {
+			// The new lead stops being a supporting assignee
+			_, err = tx.Exec(ctx, "DELETE FROM ticket_assignee WHERE ticket_id = $1 AND user_id = $2", id, bulk.AssignedTo)
+		}
+		if err == nil {
+			_, err = tx.Exec(ctx, `
+                INSERT INTO ticket_assignment (ticket_id, from_user_id, to_user_id, reason, assigned_by)
+                VALUES ($1, NULLIF($2, 0), $3, $4, $5)`,
+				id, before.AssignedTo, bulk.AssignedTo, bulk.Reason, actor)
+		}
+
+	case "delete":
+		// Deleted tickets go to the trash, like DeleteTicket
+		_, err = tx.Exec(ctx, "UPDATE ticket SET deleted_at = now(), deleted_by = $2 WHERE id = $1", id, actor)
+	}
+	if err != nil {
+		return failed(err)
+	}
+
+	var after models.Ticket
+	if err := scanTicket(tx.QueryRow(ctx, "SELECT "+ticketColumns+" FROM ticket WHERE id = $1", id), &after); err != nil {
+		return failed(err)
+	}
+	recipients, err := bulkRecipients(ctx, tx, id, event, previous)
+	if err != nil {
+		return failed(err)
+	}
+
+	result.Status, result.Version = "ok", &after.Version
+	return &bulkChange{ticket: after, recipients: recipients}, result
+}
+
+// bulkRecipients returns the email addresses, by user, of everyone to tell
+// about a change to a ticket: its assignee, its watchers and the users in
+// also, less those who opted out of event
+func bulkRecipients(ctx context.Context, db dbExecutor, ticketID int, event string, also []int) (map[int]string, error) {
+	if also == nil {
+		also = []int{}
+	}
+
+	rows, err := db.Query(ctx, `
+        SELECT DISTINCT u.id, u.email
+        FROM (`+ticketWatchersSQL+`
+            UNION ALL
+            SELECT assigned_to, 'assignee' FROM ticket WHERE id = $1
+            UNION ALL
+            SELECT unnest($2::int[]), 'previous_assignee') w
+        JOIN staff_user u ON u.id = w.user_id
+        WHERE NOT EXISTS (
+            SELECT 1 FROM notification_preference p
+            WHERE p.user_id = u.id AND p.event = $3 AND NOT p.enabled)`,
+		ticketID, also, event)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	recipients := map[int]string{}
+	for rows.Next() {
+		var userID int
+		var email string
+		if err := rows.Scan(&userID, &email); err != nil {
+			return nil, err
+		}
+		recipients[userID] = email
+	}
+	return recipients, rows.Err()
+}
+
+// sendBulkNotifications sends everyone affected by a bulk operation one
+// email listing their tickets, rather than one email per ticket. Failures
+// are logged.
+func (h *AuthHandler) sendBulkNotifications(bulk *models.TicketBulk, changes []bulkChange, actor *int, actorName string) {
+	if len(changes) == 0 {
+		return
+	}
+
+	var subject, heading string
+	switch bulk.Operation {
+	case "status":
+		subject = "Tickets Updated To " + bulk.Status
+		heading = "Tickets have been updated to " + strings.ToLower(bulk.Status)
+	case "priority":
+		subject = "Ticket Priority Changed To " + bulk.Priority
+		heading = "Tickets have been changed to " + bulk.Priority + " priority"
+	case "reassign":
+		subject = "Tickets Reassigned"
+		heading = "Tickets have been reassigned"
+		if name, _, err := h.userContact(context.Background(), bulk.AssignedTo); err == nil {
+			heading += " to " + name
+		}
+	case "delete":
+		subject = "Tickets Deleted"
+		heading = "Tickets have been deleted"
+	}
+	if actorName != "" {
+		heading += " by " + actorName
+	}
+	message := ""
+	if bulk.Reason != "" {
+		message = "Reason: " + bulk.Reason
+	}
+
+	tickets := map[string][]models.Ticket{}
+	for _, change := range changes {
+		for userID, email := range change.recipients {
+			if actor != nil && userID == *actor {
+				continue
+			}
+			tickets[email] = append(tickets[email], change.ticket)
+		}
+	}
+
+	for email, list := range tickets {
+		org := h.organisation(context.Background(), list[0].OrgID)
+		mailSubject := fmt.Sprintf("%s (%d)", subject, len(list))
+		if err := sendMail(org, []string{email}, mailSubject, bulkMailBody(org, heading, message, list)); err != nil {
+			log.Printf("bulk %s notification: %v", bulk.Operation, fmt.Errorf("%w: %v", errMailer, err))
+		}
+	}
+}
+
+// bulkMailBody renders the ticket list of a consolidated notification,
+// branded and linked for org. heading and message are plain text and,
+// like the tickets, are escaped here.
+func bulkMailBody(org *models.Organisation, heading, message string, tickets []models.Ticket) string {
+	var items strings.Builder
+	for _, ticket := range tickets {
+		location := ticket.AccommodationName
+		if ticket.AccommodationRoomNumber != 0 {
+			location += " room " + strconv.Itoa(ticket.AccommodationRoomNumber)
+		}
+		items.WriteString(`
+				<li style="padding-bottom:20px;">
+					<strong>#` + strconv.Itoa(ticket.ID) + ` ` + html.EscapeString(ticket.RequestDetail) + `</strong><br>
+					` + html.EscapeString(location) + ` &middot; ` + html.EscapeString(ticket.TaskStatus) + ` &middot; ` + html.EscapeString(ticket.TaskPriority) + `
+				</li>`)
+	}
+
+	return `
+		<html>
+		<body>
+			` + mailBranding(org) + `
+			<h1 style="` + mailHeadingStyle(org) + `">` + html.EscapeString(heading) + `</h1>
+			<p>` + html.EscapeString(message) + `</p>
+			<ul style="list-style-type:none;">` + items.String() + `
+			</ul>
+			` + mailDashboardLink(org) + `
+	`
+}
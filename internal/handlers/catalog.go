@@ -0,0 +1,479 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"ticket-sys/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+var errInvalidCatalog = errors.New("invalid catalog value")
+
+// Get catalogs
+// @Summary Get Ticket Catalogs
+// @Description List request types and priorities for ticket form dropdowns
+// @ID get-catalogs
+// @Produce json
+// @Param include_inactive query bool false "Include inactive entries"
+// @Success 200 "Successful response"
+// @Failure 500 "Database error"
+// @Router /catalogs [get]
+// @Security Bearer
+func (h *AuthHandler) GetCatalogs(c *gin.Context) {
+	includeInactive := c.Query("include_inactive") == "true"
+
+	requestTypes, err := h.requestTypes(context.Background(), includeInactive)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	priorities, err := h.taskPriorities(context.Background(), includeInactive)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Catalogs{
+		RequestTypes: requestTypes,
+		Priorities:   priorities,
+	})
+}
+
+// Create request type
+// @Summary Create Request Type
+// @Description Add a request type to the catalog
+// @ID create-request-type
+// @Produce json
+// @Success 201 "Successful response"
+// @Failure 400 "Invalid input format"
+// @Failure 409 "Request type already exists"
+// @Router /catalogs/request-types [post]
+// @Security Bearer
+func (h *AuthHandler) CreateRequestType(c *gin.Context) {
+	var requestType models.RequestTypeCreate
+
+	if err := c.ShouldBindJSON(&requestType); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid input format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	var id int
+	err := h.db.QueryRow(context.Background(), `
+        INSERT INTO request_type (name, description, sort_order)
+        VALUES ($1, $2, $3)
+        RETURNING id`,
+		strings.TrimSpace(requestType.Name), requestType.Description, requestType.SortOrder,
+	).Scan(&id)
+
+	if isUniqueViolation(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Request type already exists"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Request type creation failed"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":         "Request type created successfully",
+		"request_type_id": id,
+	})
+}
+
+// Update request type
+// @Summary Update Request Type
+// @Description Update a request type catalog entry; a new name is carried over to the tickets, assignment rules and schedules using the old one
+// @ID update-request-type
+// @Produce json
+// @Param id path int true "Request Type ID"
+// @Success 200 "Successful response"
+// @Failure 400 "Invalid request type ID"
+// @Failure 404 "Request type not found"
+// @Failure 409 "Request type already exists"
+// @Router /catalogs/request-types/{id} [patch]
+// @Security Bearer
+func (h *AuthHandler) UpdateRequestType(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request type ID"})
+		return
+	}
+
+	var update models.RequestTypeUpdate
+	if err := c.ShouldBindJSON(&update); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request type data"})
+		return
+	}
+
+	// Tickets name their request type, so a rename is applied to them in
+	// the same transaction
+	ctx := context.Background()
+	tx, err := h.db.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction start failed"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var oldName string
+	err = tx.QueryRow(ctx, "SELECT name FROM request_type WHERE id = $1 FOR UPDATE", id).Scan(&oldName)
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Request type not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	var requestType models.RequestType
+	err = tx.QueryRow(ctx, `
+        UPDATE request_type
+        SET name = COALESCE(btrim($2), name),
+            description = COALESCE($3, description),
+            sort_order = COALESCE($4, sort_order),
+            active = COALESCE($5, active)
+        WHERE id = $1
+        RETURNING id, name, description, sort_order, active`,
+		id, update.Name, update.Description, update.SortOrder, update.Active,
+	).Scan(
+		&requestType.ID,
+		&requestType.Name,
+		&requestType.Description,
+		&requestType.SortOrder,
+		&requestType.Active)
+
+	if isUniqueViolation(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Request type already exists"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if err := renameCatalogValue(ctx, tx, "request_type", oldName, requestType.Name); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if err = tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction commit failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, requestType)
+}
+
+// Delete request type
+// @Summary Delete Request Type
+// @Description Remove a request type from the catalog; existing tickets keep their value
+// @ID delete-request-type
+// @Produce json
+// @Param id path int true "Request Type ID"
+// @Success 200 "Successful response"
+// @Failure 400 "Invalid request type ID"
+// @Failure 404 "Request type not found"
+// @Router /catalogs/request-types/{id} [delete]
+// @Security Bearer
+func (h *AuthHandler) DeleteRequestType(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request type ID"})
+		return
+	}
+
+	result, err := h.db.Exec(context.Background(), "DELETE FROM request_type WHERE id = $1", id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if result.RowsAffected() == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Request type not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"id": id})
+}
+
+// Create priority
+// @Summary Create Priority
+// @Description Add a priority to the catalog
+// @ID create-priority
+// @Produce json
+// @Success 201 "Successful response"
+// @Failure 400 "Invalid input format"
+// @Failure 409 "Priority already exists"
+// @Router /catalogs/priorities [post]
+// @Security Bearer
+func (h *AuthHandler) CreatePriority(c *gin.Context) {
+	var priority models.TaskPriorityCreate
+
+	if err := c.ShouldBindJSON(&priority); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid input format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	var id int
+	err := h.db.QueryRow(context.Background(), `
+        INSERT INTO task_priority (name, sort_order, colour, default_sla_minutes, urgent)
+        VALUES ($1, $2, $3, $4, $5)
+        RETURNING id`,
+		strings.TrimSpace(priority.Name), priority.SortOrder, priority.Colour, priority.DefaultSLAMinutes, priority.Urgent,
+	).Scan(&id)
+
+	if isUniqueViolation(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Priority already exists"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Priority creation failed"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":     "Priority created successfully",
+		"priority_id": id,
+	})
+}
+
+// Update priority
+// @Summary Update Priority
+// @Description Update a priority catalog entry; a new name is carried over to the tickets, assignment rules and schedules using the old one
+// @ID update-priority
+// @Produce json
+// @Param id path int true "Priority ID"
+// @Success 200 "Successful response"
+// @Failure 400 "Invalid priority ID"
+// @Failure 404 "Priority not found"
+// @Failure 409 "Priority already exists"
+// @Router /catalogs/priorities/{id} [patch]
+// @Security Bearer
+func (h *AuthHandler) UpdatePriority(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid priority ID"})
+		return
+	}
+
+	var update models.TaskPriorityUpdate
+	if err := c.ShouldBindJSON(&update); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid priority data"})
+		return
+	}
+
+	// Tickets and their SLA targets go by the priority name, so a rename is
+	// applied to them in the same transaction
+	ctx := context.Background()
+	tx, err := h.db.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction start failed"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var oldName string
+	err = tx.QueryRow(ctx, "SELECT name FROM task_priority WHERE id = $1 FOR UPDATE", id).Scan(&oldName)
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Priority not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	var priority models.TaskPriority
+	err = tx.QueryRow(ctx, `
+        UPDATE task_priority
+        SET name = COALESCE(btrim($2), name),
+            sort_order = COALESCE($3, sort_order),
+            colour = COALESCE($4, colour),
+            default_sla_minutes = COALESCE($5, default_sla_minutes),
+            active = COALESCE($6, active),
+            urgent = COALESCE($7, urgent)
+        WHERE id = $1
+        RETURNING id, name, sort_order, colour, default_sla_minutes, urgent, active`,
+		id, update.Name, update.SortOrder, update.Colour, update.DefaultSLAMinutes, update.Active, update.Urgent,
+	).Scan(
+		&priority.ID,
+		&priority.Name,
+		&priority.SortOrder,
+		&priority.Colour,
+		&priority.DefaultSLAMinutes,
+		&priority.Urgent,
+		&priority.Active)
+
+	if isUniqueViolation(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Priority already exists"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if err := renameCatalogValue(ctx, tx, "task_priority", oldName, priority.Name); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if err = tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction commit failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, priority)
+}
+
+// Delete priority
+// @Summary Delete Priority
+// @Description Remove a priority from the catalog; existing tickets keep their value
+// @ID delete-priority
+// @Produce json
+// @Param id path int true "Priority ID"
+// @Success 200 "Successful response"
+// @Failure 400 "Invalid priority ID"
+// @Failure 404 "Priority not found"
+// @Router /catalogs/priorities/{id} [delete]
+// @Security Bearer
+func (h *AuthHandler) DeletePriority(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid priority ID"})
+		return
+	}
+
+	result, err := h.db.Exec(context.Background(), "DELETE FROM task_priority WHERE id = $1", id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if result.RowsAffected() == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Priority not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"id": id})
+}
+
+func (h *AuthHandler) requestTypes(ctx context.Context, includeInactive bool) ([]models.RequestType, error) {
+	requestTypes := []models.RequestType{}
+
+	rows, err := h.db.Query(ctx, `
+        SELECT id, name, description, sort_order, active
+        FROM request_type
+        WHERE active OR $1
+        ORDER BY sort_order, name`,
+		includeInactive)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var requestType models.RequestType
+		err := rows.Scan(
+			&requestType.ID,
+			&requestType.Name,
+			&requestType.Description,
+			&requestType.SortOrder,
+			&requestType.Active)
+		if err != nil {
+			return nil, err
+		}
+		requestTypes = append(requestTypes, requestType)
+	}
+
+	return requestTypes, rows.Err()
+}
+
+func (h *AuthHandler) taskPriorities(ctx context.Context, includeInactive bool) ([]models.TaskPriority, error) {
+	priorities := []models.TaskPriority{}
+
+	rows, err := h.db.Query(ctx, `
+        SELECT id, name, sort_order, colour, default_sla_minutes, urgent, active
+        FROM task_priority
+        WHERE active OR $1
+        ORDER BY sort_order, name`,
+		includeInactive)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var priority models.TaskPriority
+		err := rows.Scan(
+			&priority.ID,
+			&priority.Name,
+			&priority.SortOrder,
+			&priority.Colour,
+			&priority.DefaultSLAMinutes,
+			&priority.Urgent,
+			&priority.Active)
+		if err != nil {
+			return nil, err
+		}
+		priorities = append(priorities, priority)
+	}
+
+	return priorities, rows.Err()
+}
+
+// validateCatalogValues checks a request type and priority against the active
+// catalogs, rewriting them to the catalog spelling. Empty values are skipped
+// so partial updates can leave them out.
+func (h *AuthHandler) validateCatalogValues(ctx context.Context, requestType, priority *string) error {
+	if name := strings.TrimSpace(*requestType); name != "" {
+		err := h.db.QueryRow(ctx, "SELECT name FROM request_type WHERE active AND lower(btrim(name)) = lower($1)", name).Scan(requestType)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("%w: unknown request type %q", errInvalidCatalog, name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if name := strings.TrimSpace(*priority); name != "" {
+		err := h.db.QueryRow(ctx, "SELECT name FROM task_priority WHERE active AND lower(btrim(name)) = lower($1)", name).Scan(priority)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("%w: unknown priority %q", errInvalidCatalog, name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// renameCatalogValue carries a catalog entry renamed from oldName to
+// newName over to the tickets, assignment rules and schedule templates that
+// name it. column is request_type or task_priority, which they all share.
+func renameCatalogValue(ctx context.Context, tx pgx.Tx, column, oldName, newName string) error {
+	if oldName == newName {
+		return nil
+	}
+	for _, query := range []string{
+		"UPDATE ticket SET " + column + " = $2 WHERE lower(btrim(" + column + ")) = lower(btrim($1))",
+		"UPDATE assignment_rule SET " + column + " = $2 WHERE lower(btrim(" + column + ")) = lower(btrim($1))",
+		"UPDATE ticket_schedule SET template = jsonb_set(template, '{" + column + "}', to_jsonb($2::text)) WHERE lower(btrim(template->>'" + column + "')) = lower(btrim($1))",
+	} {
+		if _, err := tx.Exec(ctx, query, oldName, newName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
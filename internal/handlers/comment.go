@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"ticket-sys/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+var errTicketNotFound = errors.New("ticket not found")
+
+// commentColumns is the ticket_comment column list read by scanComment
+const commentColumns = `id, ticket_id, author_id, author_name, body, source, created_date::text`
+
+// Get ticket comments
+// @Summary Get Ticket Comments
+// @Description List the comments on a ticket, oldest first
+// @ID get-ticket-comments
+// @Produce json
+// @Param id path int true "Ticket ID"
+// @Success 200 "Successful response"
+// @Failure 400 "Invalid ticket ID"
+// @Failure 500 "Database error"
+// @Router /tickets/{id}/comments [get]
+// @Security Bearer
+func (h *AuthHandler) GetTicketComments(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ticket ID"})
+		return
+	}
+
+	comments := []models.TicketComment{}
+
+	rows, err := h.db.Query(context.Background(), "SELECT "+commentColumns+" FROM ticket_comment WHERE ticket_id = $1 AND ticket_id IN (SELECT id FROM ticket WHERE org_id = $2) ORDER BY created_date, id", id, currentOrgID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	for rows.Next() {
+		var comment models.TicketComment
+		if err := scanComment(rows, &comment); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Process failed"})
+			return
+		}
+		comments = append(comments, comment)
+	}
+
+	if err = rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Comment iteration failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, comments)
+}
+
+// Comment on a ticket
+// @Summary Create Ticket Comment
+// @Description Comment on a ticket and notify its assignee and watchers
+// @ID create-ticket-comment
+// @Produce json
+// @Param id path int true "Ticket ID"
+// @Success 201 "Successful response"
+// @Failure 400 "Invalid input format"
+// @Failure 404 "Ticket not found"
+// @Router /tickets/{id}/comments [post]
+// @Security Bearer
+func (h *AuthHandler) CreateTicketComment(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ticket ID"})
+		return
+	}
+
+	var comment models.TicketCommentCreate
+	if err := c.ShouldBindJSON(&comment); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid input format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	var authorID *int
+	if userID, ok := currentUserID(c); ok {
+		authorID = &userID
+	}
+
+	created, err := h.addComment(context.Background(), id, currentOrgID(c), authorID, currentUserName(c), comment.Body, "app")
+	if errors.Is(err, errTicketNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ticket not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, created)
+}
+
+// scanComment scans a row selected with commentColumns into comment
+func scanComment(row pgx.Row, comment *models.TicketComment) error {
+	return row.Scan(
+		&comment.ID,
+		&comment.TicketID,
+		&comment.AuthorID,
+		&comment.AuthorName,
+		&comment.Body,
+		&comment.Source,
+		&comment.CreatedDate)
+}
+
+// addComment stores a comment on a ticket of organisation orgID and
+// notifies the ticket's assignee and watchers, except the author. source
+// records where the comment came from.
+func (h *AuthHandler) addComment(ctx context.Context, ticketID, orgID int, authorID *int, authorName, body, source string) (models.TicketComment, error) {
+	var comment models.TicketComment
+	err := scanComment(h.db.QueryRow(ctx, `
+        INSERT INTO ticket_comment (ticket_id, author_id, author_name, body, source)
+        SELECT $1, $2, $3, $4, $5
+        WHERE EXISTS (SELECT 1 FROM ticket WHERE id = $1 AND org_id = $6 AND deleted_at IS NULL)
+        RETURNING `+commentColumns,
+		ticketID, authorID, authorName, strings.TrimSpace(body), source, orgID,
+	), &comment)
+	if errors.Is(err, pgx.ErrNoRows) || isForeignKeyViolation(err) {
+		return comment, errTicketNotFound
+	}
+	if err != nil {
+		return comment, err
+	}
+
+	var ticket models.Ticket
+	if err := scanTicket(h.db.QueryRow(ctx, "SELECT "+ticketColumns+" FROM ticket WHERE id = $1 AND org_id = $2", ticketID, orgID), &ticket); err != nil {
+		log.Printf("comment notification for ticket #%d: %v", ticketID, err)
+		return comment, nil
+	}
+
+	subject := "New Comment On Ticket #" + strconv.Itoa(ticketID)
+	heading := authorName + " commented on a ticket"
+	message := comment.Body
+
+	exclude := []int{}
+	if authorID != nil {
+		exclude = append(exclude, *authorID)
+	}
+	if authorID == nil || *authorID != ticket.AssignedTo {
+		if err := h.sendTicketMail(ctx, ticket.AssignedTo, eventCommentAdded, subject, heading, message, &ticket); err != nil {
+			log.Printf("comment notification for ticket #%d: %v", ticketID, err)
+		}
+		exclude = append(exclude, ticket.AssignedTo)
+	}
+	h.notifyWatchers(ctx, eventCommentAdded, &ticket, subject, heading, message, exclude...)
+
+	return comment, nil
+}
+
+// sendTicketMail emails one user about a ticket unless they opted out of
+// event or were deactivated
+func (h *AuthHandler) sendTicketMail(ctx context.Context, userID int, event, subject, heading, message string, ticket *models.Ticket) error {
+	var email string
+	var enabled bool
+	err := h.db.QueryRow(ctx, `
+        SELECT u.email, NOT EXISTS (
+            SELECT 1 FROM notification_preference p
+            WHERE p.user_id = u.id AND p.event = $2 AND NOT p.enabled)
+        FROM staff_user u
+        WHERE u.id = $1 AND u.active`,
+		userID, event,
+	).Scan(&email, &enabled)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && !enabled) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	leadName, _, err := h.userContact(ctx, ticket.AssignedTo)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+
+	org := h.organisation(ctx, ticket.OrgID)
+	if err := sendMail(org, []string{email}, subject, ticketMailBody(org, heading, message, ticket, leadName)); err != nil {
+		return fmt.Errorf("%w: %v", errMailer, err)
+	}
+	return nil
+}
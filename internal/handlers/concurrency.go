@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"ticket-sys/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errVersionConflict marks a change made against a stale ticket version
+var errVersionConflict = errors.New("ticket was changed by someone else")
+
+// ticketETag returns the entity tag of a ticket version
+func ticketETag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// errIfMatchRequired marks a change sent without an If-Match header
+var errIfMatchRequired = errors.New("If-Match header required")
+
+// ifMatchVersion reads the ticket version a request expects from its
+// If-Match header. It returns nil for "*", which changes whatever version
+// is current. It fails with errIfMatchRequired when the header is absent,
+// and with errVersionConflict when it names no usable version, which can
+// never match.
+func ifMatchVersion(c *gin.Context) (*int, error) {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == "" {
+		return nil, errIfMatchRequired
+	}
+	if header == "*" {
+		return nil, nil
+	}
+
+	// Weak tags are accepted too; the version is the whole validator
+	tag := strings.TrimPrefix(header, "W/")
+	if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return nil, errVersionConflict
+	}
+	v, err := strconv.Atoi(tag[1 : len(tag)-1])
+	if err != nil {
+		return nil, errVersionConflict
+	}
+	return &v, nil
+}
+
+// requireIfMatch reads If-Match like ifMatchVersion, answering 428 itself
+// when the header is missing and 412 when it cannot match, with the
+// current ETag either way. It reports whether the handler should go on.
+func (h *AuthHandler) requireIfMatch(c *gin.Context, id int) (*int, bool) {
+	version, err := ifMatchVersion(c)
+	if errors.Is(err, errIfMatchRequired) {
+		h.preconditionRequired(c, id)
+		return nil, false
+	}
+	if err != nil {
+		h.preconditionFailed(c, id)
+		return nil, false
+	}
+	return version, true
+}
+
+// preconditionRequired answers 428 to a change that does not say which
+// ticket version it was made against, so it cannot overwrite someone
+// else's change unnoticed
+func (h *AuthHandler) preconditionRequired(c *gin.Context, id int) {
+	var version int
+	err := h.db.QueryRow(context.Background(), "SELECT version FROM ticket WHERE id = $1 AND org_id = $2", id, currentOrgID(c)).Scan(&version)
+	if err == nil {
+		c.Header("ETag", ticketETag(version))
+	}
+	c.JSON(http.StatusPreconditionRequired, gin.H{"error": "If-Match header required"})
+}
+
+// preconditionFailed answers 412 with the ticket as it now stands, so the
+// client can show what changed and retry
+func (h *AuthHandler) preconditionFailed(c *gin.Context, id int) {
+	var ticket models.Ticket
+	err := scanTicket(h.db.QueryRow(context.Background(), "SELECT "+ticketColumns+" FROM ticket WHERE id = $1 AND org_id = $2", id, currentOrgID(c)), &ticket)
+	if err != nil {
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": "Ticket was changed by someone else"})
+		return
+	}
+	c.Header("ETag", ticketETag(ticket.Version))
+	c.JSON(http.StatusPreconditionFailed, gin.H{
+		"error":  "Ticket was changed by someone else",
+		"ticket": ticket,
+	})
+}
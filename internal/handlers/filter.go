@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"strconv"
+	"strings"
+	"ticket-sys/internal/models"
+	"time"
+)
+
+// ticketFilterError reports an unusable ticket filter, which is the
+// client's fault rather than the database's
+type ticketFilterError string
+
+func (e ticketFilterError) Error() string { return string(e) }
+
+// ticketFilterSQL turns a filter into a WHERE clause over the ticket
+// table, appending its parameters to args. Trashed tickets and tickets of
+// other organisations than f.OrgID are always left out.
+func ticketFilterSQL(f models.TicketFilter, args []any) (string, []any, error) {
+	conditions := []string{"ticket.deleted_at IS NULL"}
+	add := func(condition string, value any) {
+		args = append(args, value)
+		conditions = append(conditions, strings.ReplaceAll(condition, "$?", "$"+strconv.Itoa(len(args))))
+	}
+
+	add("ticket.org_id = $?", f.OrgID)
+
+	if f.TaskStatus != "" {
+		add("ticket.task_status = $?", f.TaskStatus)
+	}
+	if f.TaskPriority != "" {
+		add("lower(btrim(ticket.task_priority)) = lower(btrim($?))", f.TaskPriority)
+	}
+	if f.RequestType != "" {
+		add("lower(btrim(ticket.request_type)) = lower(btrim($?))", f.RequestType)
+	}
+	if f.AssignedTo != nil {
+		add("ticket.assigned_to = $?", *f.AssignedTo)
+	}
+	if f.AccommodationID != nil {
+		add("ticket.accommodation_id = $?", *f.AccommodationID)
+	}
+	if f.TeamID != nil {
+		add("ticket.team_id = $?", *f.TeamID)
+	}
+
+	createdBefore, err := parseFilterDate(f.CreatedBefore)
+	if err != nil {
+		return "", nil, ticketFilterError("invalid created_before: " + err.Error())
+	}
+	if createdBefore != nil {
+		add("ticket.creation_date < $?", *createdBefore)
+	}
+	createdAfter, err := parseFilterDate(f.CreatedAfter)
+	if err != nil {
+		return "", nil, ticketFilterError("invalid created_after: " + err.Error())
+	}
+	if createdAfter != nil {
+		add("ticket.creation_date >= $?", *createdAfter)
+	}
+
+	return "WHERE " + strings.Join(conditions, " AND "), args, nil
+}
+
+// parseFilterDate accepts RFC 3339 times or plain dates
+func parseFilterDate(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
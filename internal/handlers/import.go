@@ -0,0 +1,437 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"ticket-sys/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// maxImportRows bounds how many rows one import may contain
+	maxImportRows = 2000
+	// maxImportBytes bounds the size of an import upload
+	maxImportBytes = 10 << 20
+	// importBatchSize is how many tickets are stored per transaction
+	importBatchSize = 100
+)
+
+// importFields sets each TicketCreate field a CSV column can fill
+var importFields = map[string]func(ticket *models.TicketCreate, value string) error{
+	"reported_by":        func(t *models.TicketCreate, v string) error { t.ReportedBy = v; return nil },
+	"accommodation_name": func(t *models.TicketCreate, v string) error { t.AccommodationName = v; return nil },
+	"accommodation_room_number": func(t *models.TicketCreate, v string) error {
+		return parseImportInt(v, &t.AccommodationRoomNumber)
+	},
+	"accommodation_specific_location": func(t *models.TicketCreate, v string) error { t.AccommodationSpecificLocation = v; return nil },
+	"accommodation_type":              func(t *models.TicketCreate, v string) error { t.AccommodationType = v; return nil },
+	"request_type":                    func(t *models.TicketCreate, v string) error { t.RequestType = v; return nil },
+	"request_detail":                  func(t *models.TicketCreate, v string) error { t.RequestDetail = v; return nil },
+	"task_priority":                   func(t *models.TicketCreate, v string) error { t.TaskPriority = v; return nil },
+	// assigned_to is resolved separately since it may be an email address
+	"assigned_to":      func(t *models.TicketCreate, v string) error { return nil },
+	"note":             func(t *models.TicketCreate, v string) error { t.Note = v; return nil },
+	"accommodation_id": func(t *models.TicketCreate, v string) error { return parseImportID(v, &t.AccommodationID) },
+	"room_id":          func(t *models.TicketCreate, v string) error { return parseImportID(v, &t.RoomID) },
+	"location_id":      func(t *models.TicketCreate, v string) error { return parseImportID(v, &t.LocationID) },
+}
+
+// importTicket is a validated row waiting to be stored
+type importTicket struct {
+	row    int
+	ticket models.TicketCreate
+}
+
+// Import tickets
+// @Summary Import Tickets
+// @Description Create tickets from a CSV file, e.g. a new property's backlog. Every row is validated like a new ticket; with dry_run nothing is created and the per-row errors are returned. Valid rows are stored in batches and each assignee gets one email listing their new tickets.
+// @ID import-tickets
+// @Accept multipart/form-data
+// @Produce json
+// @Param file formData file true "CSV file with a header row"
+// @Param mapping formData string false "JSON object of ticket field to CSV column, e.g. {\"request_detail\":\"Issue\"}; defaults to matching headers"
+// @Param defaults formData string false "JSON object of values for fields the file leaves empty"
+// @Param dry_run formData bool false "Validate only"
+// @Success 200 "Import report"
+// @Failure 400 "Invalid file or mapping"
+// @Failure 500 "Database error"
+// @Router /tickets/import [post]
+// @Security Bearer
+func (h *AuthHandler) ImportTickets(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportBytes)
+
+	var options models.TicketImport
+	if err := c.ShouldBind(&options); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input format", "details": err.Error()})
+		return
+	}
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "CSV file is required", "details": err.Error()})
+		return
+	}
+
+	mapping := map[string]string{}
+	defaults := map[string]string{}
+	if options.Mapping != "" {
+		if err := json.Unmarshal([]byte(options.Mapping), &mapping); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid mapping", "details": err.Error()})
+			return
+		}
+	}
+	if options.Defaults != "" {
+		if err := json.Unmarshal([]byte(options.Defaults), &defaults); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid defaults", "details": err.Error()})
+			return
+		}
+	}
+	for field := range mapping {
+		if _, ok := importFields[field]; !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("cannot import field %q", field)})
+			return
+		}
+	}
+	for field := range defaults {
+		if _, ok := importFields[field]; !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("cannot import field %q", field)})
+			return
+		}
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid file", "details": err.Error()})
+		return
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid CSV", "details": err.Error()})
+		return
+	}
+	if len(header) > 0 {
+		// Spreadsheet programs often save a byte order mark
+		header[0] = strings.TrimPrefix(header[0], "\uFEFF")
+	}
+
+	columns, err := importColumns(header, mapping)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := context.Background()
+	report := models.TicketImportReport{DryRun: options.DryRun, Rows: []models.TicketImportRow{}}
+	var valid []importTicket
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid CSV", "details": err.Error()})
+			return
+		}
+		line, _ := reader.FieldPos(0)
+		if isBlankRecord(record) {
+			continue
+		}
+		if report.Total++; report.Total > maxImportRows {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("at most %d rows can be imported at once", maxImportRows)})
+			return
+		}
+
+		ticket, problems, err := h.importRow(ctx, currentOrgID(c), record, columns, defaults, options.DryRun)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if len(problems) > 0 {
+			report.Invalid++
+			report.Rows = append(report.Rows, models.TicketImportRow{Row: line, Status: "invalid", Errors: problems})
+			continue
+		}
+		report.Valid++
+		valid = append(valid, importTicket{row: line, ticket: *ticket})
+	}
+
+	if options.DryRun {
+		for _, item := range valid {
+			report.Rows = append(report.Rows, models.TicketImportRow{Row: item.row, Status: "valid"})
+		}
+	} else {
+		h.storeImport(ctx, valid, &report)
+	}
+	sort.Slice(report.Rows, func(i, j int) bool { return report.Rows[i].Row < report.Rows[j].Row })
+
+	c.JSON(http.StatusOK, report)
+}
+
+// importColumns returns the CSV column index of each mapped field. Without
+// a mapping, headers naming a field are used.
+func importColumns(header []string, mapping map[string]string) (map[string]int, error) {
+	index := map[string]int{}
+	for i, name := range header {
+		index[strings.TrimSpace(name)] = i
+	}
+
+	columns := map[string]int{}
+	if len(mapping) == 0 {
+		for field := range importFields {
+			if i, ok := index[field]; ok {
+				columns[field] = i
+			}
+		}
+		if len(columns) == 0 {
+			return nil, errors.New("no column matches a ticket field; send a mapping")
+		}
+		return columns, nil
+	}
+
+	for field, column := range mapping {
+		i, ok := index[strings.TrimSpace(column)]
+		if !ok {
+			return nil, fmt.Errorf("column %q not found", column)
+		}
+		columns[field] = i
+	}
+	return columns, nil
+}
+
+// importRow builds and validates the ticket of one CSV row the way
+// CreateTicket would, leaving round-robin pools alone on a dry run.
+// Problems with the row are returned as messages; err is only set when
+// the database fails.
+func (h *AuthHandler) importRow(ctx context.Context, orgID int, record []string, columns map[string]int, defaults map[string]string, dryRun bool) (*models.TicketCreate, []string, error) {
+	values := map[string]string{}
+	for field, value := range defaults {
+		values[field] = strings.TrimSpace(value)
+	}
+	for field, i := range columns {
+		if i < len(record) && strings.TrimSpace(record[i]) != "" {
+			values[field] = strings.TrimSpace(record[i])
+		}
+	}
+
+	ticket := models.TicketCreate{OrgID: orgID}
+	var problems []string
+	for field, value := range values {
+		if err := importFields[field](&ticket, value); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", field, err))
+		}
+	}
+
+	if value := values["assigned_to"]; value != "" {
+		id, err := h.importAssignee(ctx, orgID, value)
+		if err != nil {
+			return nil, nil, err
+		}
+		if id == 0 {
+			problems = append(problems, fmt.Sprintf("assigned_to: no staff member %q", value))
+		}
+		ticket.AssignedTo = id
+	}
+
+	if err := binding.Validator.ValidateStruct(&ticket); err != nil {
+		var fieldErrs validator.ValidationErrors
+		if !errors.As(err, &fieldErrs) {
+			return nil, nil, err
+		}
+		for _, fieldErr := range fieldErrs {
+			name := importFieldName(fieldErr.StructField())
+			if fieldErr.Tag() == "required" {
+				problems = append(problems, name+" is required")
+			} else {
+				problems = append(problems, fmt.Sprintf("%s failed %s", name, fieldErr.Tag()))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return nil, problems, nil
+	}
+
+	if err := h.validateCatalogValues(ctx, &ticket.RequestType, &ticket.TaskPriority); err != nil {
+		if errors.Is(err, errInvalidCatalog) {
+			return nil, []string{err.Error()}, nil
+		}
+		return nil, nil, err
+	}
+	if err := h.resolveTicketAccommodation(ctx, &ticket); err != nil {
+		if errors.Is(err, errInvalidAccommodation) {
+			return nil, []string{err.Error()}, nil
+		}
+		return nil, nil, err
+	}
+	if ticket.AssignedTo == 0 {
+		if err := h.applyAssignmentRules(ctx, &ticket, !dryRun); err != nil {
+			if errors.Is(err, errNoAssignee) {
+				return nil, []string{err.Error()}, nil
+			}
+			return nil, nil, err
+		}
+	}
+
+	return &ticket, nil, nil
+}
+
+// importAssignee resolves the ID or email address of a staff user of
+// orgID, returning 0 when nobody matches
+func (h *AuthHandler) importAssignee(ctx context.Context, orgID int, value string) (int, error) {
+	var id int
+	var err error
+	if n, convErr := strconv.Atoi(value); convErr == nil {
+		err = h.db.QueryRow(ctx, "SELECT id FROM staff_user WHERE id = $1 AND org_id = $2 AND active", n, orgID).Scan(&id)
+	} else {
+		err = h.db.QueryRow(ctx, "SELECT id FROM staff_user WHERE lower(email) = lower($1) AND org_id = $2 AND active", value, orgID).Scan(&id)
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
+	return id, err
+}
+
+// storeImport creates the validated tickets in batches, so a failing batch
+// leaves the others in place, then sends each assignee one email listing
+// their new tickets instead of one per ticket
+func (h *AuthHandler) storeImport(ctx context.Context, tickets []importTicket, report *models.TicketImportReport) {
+	var created []int
+	for start := 0; start < len(tickets); start += importBatchSize {
+		batch := tickets[start:min(start+importBatchSize, len(tickets))]
+
+		ids, err := h.storeImportBatch(ctx, batch)
+		if err != nil {
+			log.Printf("ticket import: %v", err)
+			for _, item := range batch {
+				report.Failed++
+				report.Rows = append(report.Rows, models.TicketImportRow{Row: item.row, Status: "failed", Errors: []string{"Ticket creation failed"}})
+			}
+			continue
+		}
+		for i, item := range batch {
+			report.Created++
+			report.Rows = append(report.Rows, models.TicketImportRow{Row: item.row, Status: "created", TicketID: &ids[i]})
+		}
+		created = append(created, ids...)
+	}
+
+	h.sendImportNotifications(ctx, created)
+}
+
+// storeImportBatch creates a batch of tickets in one transaction
+func (h *AuthHandler) storeImportBatch(ctx context.Context, batch []importTicket) ([]int, error) {
+	tx, err := h.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	ids := make([]int, len(batch))
+	for i := range batch {
+		if ids[i], err = insertTicket(ctx, tx, &batch[i].ticket); err != nil {
+			return nil, err
+		}
+	}
+	return ids, tx.Commit(ctx)
+}
+
+// sendImportNotifications emails each assignee of imported tickets once.
+// Failures are logged.
+func (h *AuthHandler) sendImportNotifications(ctx context.Context, ids []int) {
+	if len(ids) == 0 {
+		return
+	}
+
+	rows, err := h.db.Query(ctx, "SELECT "+ticketColumns+" FROM ticket WHERE id = ANY($1) ORDER BY id", ids)
+	if err != nil {
+		log.Printf("ticket import notification: %v", err)
+		return
+	}
+	byAssignee := map[int][]models.Ticket{}
+	for rows.Next() {
+		var ticket models.Ticket
+		if err := scanTicket(rows, &ticket); err != nil {
+			rows.Close()
+			log.Printf("ticket import notification: %v", err)
+			return
+		}
+		byAssignee[ticket.AssignedTo] = append(byAssignee[ticket.AssignedTo], ticket)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		log.Printf("ticket import notification: %v", err)
+		return
+	}
+
+	for userID, tickets := range byAssignee {
+		_, email, err := h.userContact(ctx, userID)
+		if err != nil {
+			log.Printf("ticket import notification: %v", err)
+			continue
+		}
+		org := h.organisation(ctx, tickets[0].OrgID)
+		subject := fmt.Sprintf("Tickets Assigned To You (%d)", len(tickets))
+		if err := sendMail(org, []string{email}, subject, bulkMailBody(org, "Tickets have been assigned to you", "", tickets)); err != nil {
+			log.Printf("ticket import notification: %v", fmt.Errorf("%w: %v", errMailer, err))
+		}
+	}
+}
+
+// importFieldName returns the JSON name of a TicketCreate field
+func importFieldName(structField string) string {
+	field, ok := reflect.TypeOf(models.TicketCreate{}).FieldByName(structField)
+	if !ok {
+		return structField
+	}
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	return name
+}
+
+// parseImportInt parses a whole number cell
+func parseImportInt(value string, target *int) error {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("%q is not a number", value)
+	}
+	*target = n
+	return nil
+}
+
+// parseImportID parses an optional ID cell
+func parseImportID(value string, target **int) error {
+	var n int
+	if err := parseImportInt(value, &n); err != nil {
+		return err
+	}
+	*target = &n
+	return nil
+}
+
+// isBlankRecord reports whether every cell of a CSV record is empty, as
+// trailing spreadsheet rows often are
+func isBlankRecord(record []string) bool {
+	for _, value := range record {
+		if strings.TrimSpace(value) != "" {
+			return false
+		}
+	}
+	return true
+}
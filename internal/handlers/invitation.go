@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strconv"
+	"ticket-sys/internal/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// invitationExpiry is how long an invitation to register works
+const invitationExpiry = 7 * 24 * time.Hour
+
+const invitationColumns = `id, org_id, email, role, invited_by, expires_at::text, created_date::text`
+
+// Invite user
+// @Summary Invite User
+// @Description Email someone a link to register in the caller's organisation with the given role, staff by default. Inviting an address again replaces its earlier invitation.
+// @ID invite-user
+// @Produce json
+// @Param invitation body models.UserInvite true "Invitation"
+// @Success 201 "Successful response"
+// @Failure 400 "Invalid input format"
+// @Failure 409 "Email already registered"
+// @Router /invitations [post]
+// @Security Bearer
+func (h *AuthHandler) CreateInvitation(c *gin.Context) {
+	var input models.UserInvite
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid input format",
+			"details": err.Error(),
+		})
+		return
+	}
+	if err := input.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.Role == "" {
+		input.Role = "staff"
+	}
+
+	var invitedBy *int
+	if userID, ok := currentUserID(c); ok {
+		invitedBy = &userID
+	}
+
+	ctx := context.Background()
+	var exists bool
+	if err := h.db.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM staff_user WHERE lower(email) = lower($1))", input.Email).Scan(&exists); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if exists {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email already registered"})
+		return
+	}
+
+	raw := make([]byte, 32)
+	rand.Read(raw)
+	token := hex.EncodeToString(raw)
+
+	// The invitation is only kept once its email is on its way
+	tx, err := h.db.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction start failed"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var invitation models.Invitation
+	err = scanInvitation(tx.QueryRow(ctx, `
+        INSERT INTO user_invitation (org_id, email, role, token_hash, invited_by, expires_at)
+        VALUES ($1, $2, $3, $4, $5, $6)
+        ON CONFLICT (org_id, lower(email)) DO UPDATE
+        SET email = EXCLUDED.email, role = EXCLUDED.role, token_hash = EXCLUDED.token_hash,
+            invited_by = EXCLUDED.invited_by, expires_at = EXCLUDED.expires_at, created_date = now()
+        RETURNING `+invitationColumns,
+		currentOrgID(c), input.Email, input.Role, invitationTokenHash(token), invitedBy,
+		time.Now().Add(invitationExpiry)), &invitation)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	org := h.organisation(ctx, currentOrgID(c))
+	link := org.DashboardURL + "/register?token=" + url.QueryEscape(token)
+	body := `
+		<html>
+		<body>
+			` + mailBranding(org) + `
+			<h1 style="` + mailHeadingStyle(org) + `">You are invited to ` + html.EscapeString(org.BrandName) + `</h1>
+			<p>` + html.EscapeString(currentUserName(c)) + ` invited you to join ` + html.EscapeString(org.Name) + `.
+			Follow the link below within ` + fmt.Sprint(invitationExpiry.Hours()/24) + ` days to create your account with this email address.</p>
+			<p>Invitation code: ` + token + `</p>
+			<a href="` + html.EscapeString(link) + `">Create Account</a>
+		</body>
+		</html>
+	`
+	if err := sendMail(org, []string{input.Email}, "You Are Invited to "+org.BrandName, body); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Mailer error"})
+		return
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction commit failed"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, invitation)
+}
+
+// Get invitations
+// @Summary Get Invitations
+// @Description List the caller's organisation's invitations that have not been used yet, expired ones included
+// @ID get-invitations
+// @Produce json
+// @Success 200 "Successful response"
+// @Router /invitations [get]
+// @Security Bearer
+func (h *AuthHandler) GetInvitations(c *gin.Context) {
+	rows, err := h.db.Query(context.Background(), "SELECT "+invitationColumns+" FROM user_invitation WHERE org_id = $1 ORDER BY created_date DESC", currentOrgID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	invitations := []models.Invitation{}
+	for rows.Next() {
+		var invitation models.Invitation
+		if err := scanInvitation(rows, &invitation); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Process failed"})
+			return
+		}
+		invitations = append(invitations, invitation)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invitation iteration failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, invitations)
+}
+
+// Delete invitation
+// @Summary Delete Invitation
+// @Description Withdraw an invitation so its link no longer works
+// @ID delete-invitation
+// @Produce json
+// @Param id path int true "Invitation ID"
+// @Success 200 "Successful response"
+// @Failure 400 "Invalid Invitation ID"
+// @Failure 404 "Invitation not found"
+// @Router /invitations/{id} [delete]
+// @Security Bearer
+func (h *AuthHandler) DeleteInvitation(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Invitation ID"})
+		return
+	}
+
+	tag, err := h.db.Exec(context.Background(), "DELETE FROM user_invitation WHERE id = $1 AND org_id = $2", id, currentOrgID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invitation not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Invitation deleted"})
+}
+
+// invitationTokenHash is what is stored for an invitation token, so a
+// leaked table cannot be used to register
+func invitationTokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// scanInvitation scans a row selected with invitationColumns
+func scanInvitation(row pgx.Row, invitation *models.Invitation) error {
+	return row.Scan(
+		&invitation.ID,
+		&invitation.OrgID,
+		&invitation.Email,
+		&invitation.Role,
+		&invitation.InvitedBy,
+		&invitation.ExpiresAt,
+		&invitation.CreatedDate,
+	)
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// RunJobs runs the periodic background jobs every interval until ctx is
+// cancelled. The handler should own a connection that serves nothing else,
+// as jobs run outside the request cycle.
+func (h *AuthHandler) RunJobs(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		h.runJobs(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (h *AuthHandler) runJobs(ctx context.Context) {
+	jobs := []struct {
+		name string
+		run  func(context.Context) error
+	}{
+		{"SLA escalation", h.escalateTickets},
+		{"ticket schedules", h.generateScheduledTickets},
+		{"ticket event pruning", h.pruneTicketEvents},
+		{"webhook delivery pruning", h.pruneWebhookDeliveries},
+		{"deleted ticket purge", h.purgeDeletedTickets},
+	}
+
+	for _, job := range jobs {
+		if err := job.run(ctx); err != nil {
+			log.Printf("%s job failed: %v", job.name, err)
+		}
+	}
+}
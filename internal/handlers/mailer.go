@@ -1,9 +1,14 @@
 package handlers
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"html"
 	"net/smtp"
+	"strconv"
+	"strings"
+	"ticket-sys/internal/models"
 )
 
 type loginAuth struct {
@@ -14,6 +19,9 @@ var _ = smtp.Auth(loginAuth{})
 
 var ErrUnknown = errors.New("unknown from server")
 
+// errMailer marks a notification that could not be delivered
+var errMailer = errors.New("mailer error")
+
 func (s loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
 	return "LOGIN", []byte(s.username), nil
 }
@@ -35,3 +43,137 @@ func (s loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
 func Auth(username, password string) smtp.Auth {
 	return loginAuth{username: username, password: password}
 }
+
+// MailSettings is the ticketing mailbox notifications are sent through and
+// the defaults organisations fall back to
+type MailSettings struct {
+	// Server is the SMTP server as host:port
+	Server   string
+	User     string
+	Password string
+	// Sender is the mailbox address; the SMTP user when blank
+	Sender       string
+	DashboardURL string
+}
+
+// mailSettings is set once at startup, before any handler runs
+var mailSettings MailSettings
+
+// SetMailSettings configures the mailbox every handler sends mail through
+func SetMailSettings(settings MailSettings) {
+	if settings.Sender == "" {
+		settings.Sender = settings.User
+	}
+	mailSettings = settings
+}
+
+// sendMail sends an HTML email from the ticketing mailbox. Only the
+// mailbox may send as itself, so the address org has configured is where
+// replies go, not the sender.
+func sendMail(org *models.Organisation, to []string, subject, body string) error {
+	if mailSettings.Server == "" || mailSettings.User == "" {
+		return fmt.Errorf("%w: no SMTP account configured", errMailer)
+	}
+	auth := Auth(mailSettings.User, mailSettings.Password)
+
+	headers := "From:" + mailSettings.Sender + "\r\n"
+	if org.MailSender != "" && !strings.EqualFold(org.MailSender, mailSettings.Sender) {
+		headers += "Reply-To:" + headerValue(org.MailSender) + "\r\n"
+	}
+	headers += "Subject:" + headerValue(subject) + "\r\n"
+
+	mailBody := []byte(headers + "MIME-version: 1.0;\r\nContent-Type: text/html; charset=\"UTF-8\";\r\n\r\n" + body)
+	return smtp.SendMail(mailSettings.Server, auth, mailSettings.Sender, to, mailBody)
+}
+
+// headerValue keeps text taken from tickets and settings on its own header
+// line
+func headerValue(value string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(value)
+}
+
+// userContact returns a staff user's full name and email address
+func (h *AuthHandler) userContact(ctx context.Context, id int) (string, string, error) {
+	var firstName, lastName, email string
+	err := h.db.QueryRow(ctx, "SELECT first_name, last_name, email FROM staff_user WHERE id = $1", id).Scan(&firstName, &lastName, &email)
+	if err != nil {
+		return "", "", err
+	}
+	return firstName + " " + lastName, email, nil
+}
+
+// mailBranding renders org's logo, if it has one, above a notification
+func mailBranding(org *models.Organisation) string {
+	if org.LogoURL == "" {
+		return ""
+	}
+	return `<img src="` + html.EscapeString(org.LogoURL) + `" alt="` + html.EscapeString(org.BrandName) + `" style="max-height:60px;">`
+}
+
+// mailHeadingStyle colours notification headings with org's brand colour
+func mailHeadingStyle(org *models.Organisation) string {
+	if org.BrandColour == "" {
+		return "font-weight:700;"
+	}
+	return "font-weight:700;color:" + html.EscapeString(org.BrandColour) + ";"
+}
+
+// mailDashboardLink links a notification to org's dashboard
+func mailDashboardLink(org *models.Organisation) string {
+	return `<a href="` + html.EscapeString(org.DashboardURL) + `">Go To ` + html.EscapeString(org.BrandName) + `</a>`
+}
+
+// ticketMailBody renders the ticket summary used by notification emails,
+// branded and linked for org. message, when set, is shown under the
+// heading. Every argument is plain text: tickets can come from outside by
+// email, so all of it is escaped here.
+func ticketMailBody(org *models.Organisation, heading, message string, ticket *models.Ticket, assigneeName string) string {
+	var accomm_room_no string
+	if ticket.AccommodationRoomNumber != 0 {
+		accomm_room_no = strconv.Itoa(ticket.AccommodationRoomNumber)
+	}
+	if message == "" {
+		message = "Please see ticket information or visit the link below."
+	}
+
+	return `
+		<html>
+		<body>
+			` + mailBranding(org) + `
+			<h1 style="` + mailHeadingStyle(org) + `">` + html.EscapeString(heading) + `</h1>
+			<p>` + html.EscapeString(message) + `</p>
+			<ul style="list-style-type:none;">
+			<li style="padding-bottom:5px;">
+					<h2 style="font-weight:700;padding-bottom:0px;">#` + strconv.Itoa(ticket.ID) + ` ` + html.EscapeString(ticket.RequestDetail) + `</h2>` +
+		`</li>
+				<li style="padding-bottom:20px;">
+					Reported By: ` + html.EscapeString(ticket.ReportedBy) +
+		`</li>
+				<li style="padding-bottom:20px;">
+					Assigned To: ` + html.EscapeString(assigneeName) +
+		`</li>
+				<li style="padding-bottom:20px;">
+					Accommodation Name: ` + html.EscapeString(ticket.AccommodationName) +
+		`</li>
+				<li style="padding-bottom:20px;">
+					Accommodation Room Number: ` + accomm_room_no +
+		`</li>
+				<li style="padding-bottom:20px;">
+					Specific Location: ` + html.EscapeString(ticket.AccommodationSpecificLocation) +
+		`</li>
+				<li style="padding-bottom:20px;">
+					Accommodation Type: ` + html.EscapeString(ticket.AccommodationType) +
+		`</li>
+				<li style="padding-bottom:20px;">
+					Requst Type: ` + html.EscapeString(ticket.RequestType) +
+		`</li>
+				<li style="padding-bottom:20px;">
+					Task Priority: ` + html.EscapeString(ticket.TaskPriority) +
+		`</li>
+				<li style="padding-bottom:30px;">
+					Notes: ` + html.EscapeString(ticket.Note) +
+		`</li>
+			</ul>
+			` + mailDashboardLink(org) + `
+	`
+}
@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"ticket-sys/internal/inbound"
+	"ticket-sys/internal/models"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// emailRoomNumber finds a room number in an emailed request, e.g. "room 12"
+var emailRoomNumber = regexp.MustCompile(`(?i)\broom\s*(?:no\.?|number|#)?\s*(\d{1,6})\b`)
+
+// emailUnknown fills the accommodation fields of an emailed ticket that
+// could not be matched to an accommodation
+const emailUnknown = "Unknown (email)"
+
+// RunMailGateway turns the messages delivered to maildir into tickets of
+// the organisation with slug every interval until ctx is cancelled.
+// authservID is the receiving server whose Authentication-Results are
+// trusted. defaults supplies the request type, priority and assignee of
+// emailed tickets. Like RunJobs, the handler should own its connection.
+func (h *AuthHandler) RunMailGateway(ctx context.Context, maildir string, interval time.Duration, slug, authservID string, defaults models.TicketCreate) {
+	orgID, err := resolveOrganisation(ctx, h.db, slug)
+	if err != nil {
+		log.Printf("mail gateway: organisation %q: %v", slug, err)
+		return
+	}
+	defaults.OrgID = orgID
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		err := inbound.Maildir(maildir).Poll(func(name string, msg *inbound.Message) error {
+			return h.handleInboundEmail(ctx, name, msg, msg.SenderAuthenticated(authservID), defaults)
+		})
+		if err != nil {
+			log.Printf("mail gateway: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// handleInboundEmail files one message: a reply naming a ticket in its
+// subject, e.g. "Re: Ticket #123", becomes a comment on that ticket, any
+// other message a new ticket. authenticated tells whether the sender's
+// address can be trusted.
+func (h *AuthHandler) handleInboundEmail(ctx context.Context, name string, msg *inbound.Message, authenticated bool, defaults models.TicketCreate) error {
+	org := h.organisation(ctx, defaults.OrgID)
+	if msg.AutoReply || strings.EqualFold(msg.FromAddress, mailSettings.Sender) || strings.EqualFold(msg.FromAddress, org.MailSender) {
+		log.Printf("mail gateway: ignored automatic message %s from %s", name, msg.FromAddress)
+		return nil
+	}
+
+	messageID := msg.MessageID
+	if messageID == "" {
+		messageID = "maildir:" + name
+	}
+
+	// Claim the message first so one picked up twice is filed once
+	var claimed bool
+	err := h.db.QueryRow(ctx, `
+        INSERT INTO inbound_email (message_id, from_address, subject)
+        VALUES ($1, $2, $3)
+        ON CONFLICT DO NOTHING
+        RETURNING true`,
+		messageID, msg.FromAddress, msg.Subject,
+	).Scan(&claimed)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	ticketID, commentID, err := h.fileInboundEmail(ctx, msg, authenticated, defaults)
+	if err != nil {
+		// Release the claim so the message is retried
+		h.db.Exec(ctx, "DELETE FROM inbound_email WHERE message_id = $1", messageID)
+		return err
+	}
+
+	_, err = h.db.Exec(ctx, "UPDATE inbound_email SET ticket_id = $2, comment_id = $3 WHERE message_id = $1", messageID, ticketID, commentID)
+	return err
+}
+
+// fileInboundEmail stores a message as a comment or a new ticket, returning
+// the ticket and, for replies, the comment
+func (h *AuthHandler) fileInboundEmail(ctx context.Context, msg *inbound.Message, authenticated bool, defaults models.TicketCreate) (int, *int, error) {
+	// Authenticated senders with an account are known by their staff name.
+	// Anyone can put a staff address in From, so other mail is filed as
+	// coming from outside whatever it claims.
+	var senderID *int
+	senderName := msg.FromName
+	if authenticated {
+		var id int
+		var firstName, lastName string
+		err := h.db.QueryRow(ctx, "SELECT id, first_name, last_name FROM staff_user WHERE lower(email) = $1 AND org_id = $2", msg.FromAddress, defaults.OrgID).Scan(&id, &firstName, &lastName)
+		if err == nil {
+			senderID = &id
+			senderName = strings.TrimSpace(firstName + " " + lastName)
+		} else if !errors.Is(err, pgx.ErrNoRows) {
+			return 0, nil, err
+		}
+	}
+	if senderName == "" {
+		senderName = msg.FromAddress
+	}
+
+	if ticketID, ok := inbound.TicketReference(msg.Subject); ok {
+		// Only staff and whoever emailed the ticket in may reply to it
+		var allowed bool
+		err := h.db.QueryRow(ctx, "SELECT $2::bool OR lower(reporter_email) = $3 FROM ticket WHERE id = $1 AND org_id = $4 AND deleted_at IS NULL", ticketID, senderID != nil, msg.FromAddress, defaults.OrgID).Scan(&allowed)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return 0, nil, err
+		}
+
+		if err == nil && allowed {
+			body := inbound.StripQuoted(msg.Text)
+			if names := attachmentNames(msg.Attachments); names != "" {
+				body = strings.TrimSpace(body + "\n\n[Attachments not stored: " + names + "]")
+			}
+			if body == "" {
+				return ticketID, nil, nil
+			}
+
+			comment, err := h.addComment(ctx, ticketID, defaults.OrgID, senderID, senderName, body, "email")
+			if err != nil {
+				return 0, nil, err
+			}
+			return ticketID, &comment.ID, nil
+		}
+		log.Printf("mail gateway: %s cannot reply to ticket #%d, opening a new ticket", msg.FromAddress, ticketID)
+	}
+
+	ticket := defaults
+	ticket.ReportedBy = senderName
+	ticket.CreatedBy = senderID
+	ticket.RequestDetail = msg.Subject
+	if msg.Text != "" {
+		ticket.RequestDetail = strings.TrimSpace(msg.Subject + "\n\n" + msg.Text)
+	}
+	if ticket.RequestDetail == "" {
+		ticket.RequestDetail = "(no subject)"
+	}
+
+	// The ticket keeps one image; other attachments are listed in the note
+	var skipped []inbound.Attachment
+	for _, attachment := range msg.Attachments {
+		if ticket.Image == nil && attachment.IsImage() {
+			ticket.Image = attachment.Data
+			continue
+		}
+		skipped = append(skipped, attachment)
+	}
+	ticket.Note = "Emailed by " + msg.FromAddress
+	if names := attachmentNames(skipped); names != "" {
+		ticket.Note += "\nAttachments not stored: " + names
+	}
+
+	if err := h.matchEmailAccommodation(ctx, &ticket, msg.Subject+"\n"+msg.Text); err != nil {
+		return 0, nil, err
+	}
+
+	ticketID, err := h.createTicket(ctx, &ticket)
+	if err != nil && !errors.Is(err, errMailer) {
+		return 0, nil, err
+	}
+	if err != nil {
+		log.Printf("mail gateway ticket #%d: %v", ticketID, err)
+	}
+
+	if _, err := h.db.Exec(ctx, "UPDATE ticket SET reporter_email = $2 WHERE id = $1 AND org_id = $3", ticketID, msg.FromAddress, defaults.OrgID); err != nil {
+		return 0, nil, err
+	}
+
+	// Tell the sender which ticket to reply to
+	subject := "Ticket #" + strconv.Itoa(ticketID) + ": " + msg.Subject
+	body := `<p>Thank you, we have received your request and opened Ticket #` + strconv.Itoa(ticketID) + `.</p>
+		<p>Reply to this email, keeping "Ticket #` + strconv.Itoa(ticketID) + `" in the subject, to add to your request.</p>
+		<blockquote>` + html.EscapeString(ticket.RequestDetail) + `</blockquote>`
+	if err := sendMail(h.organisation(ctx, ticket.OrgID), []string{msg.FromAddress}, subject, body); err != nil {
+		log.Printf("mail gateway ticket #%d acknowledgement: %v", ticketID, fmt.Errorf("%w: %v", errMailer, err))
+	}
+
+	return ticketID, nil, nil
+}
+
+// matchEmailAccommodation links an emailed ticket to the accommodation and
+// room named in the message, if any. Unmatched fields are marked unknown
+// for the dispatcher to fill in.
+func (h *AuthHandler) matchEmailAccommodation(ctx context.Context, ticket *models.TicketCreate, text string) error {
+	var id int
+	err := h.db.QueryRow(ctx, `
+        SELECT id FROM accommodation
+        WHERE org_id = $2 AND length(btrim(name)) >= 3 AND position(lower(btrim(name)) IN lower($1)) > 0
+        ORDER BY length(btrim(name)) DESC
+        LIMIT 1`,
+		text, ticket.OrgID,
+	).Scan(&id)
+	if err == nil {
+		ticket.AccommodationID = &id
+	} else if !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+
+	if match := emailRoomNumber.FindStringSubmatch(text); match != nil {
+		ticket.AccommodationRoomNumber, _ = strconv.Atoi(match[1])
+	}
+
+	// A matched accommodation replaces the name and type when the ticket
+	// is created
+	ticket.AccommodationName = emailUnknown
+	ticket.AccommodationType = emailUnknown
+	ticket.AccommodationSpecificLocation = emailUnknown
+	return nil
+}
+
+// attachmentNames lists attachment file names for notes and comments
+func attachmentNames(attachments []inbound.Attachment) string {
+	names := make([]string, len(attachments))
+	for i, attachment := range attachments {
+		names[i] = attachment.Filename
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,582 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"ticket-sys/internal/models"
+	"ticket-sys/internal/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// mfaChallengeExpiry is how long a login waits for its second factor
+	mfaChallengeExpiry = 5 * time.Minute
+	// After mfaMaxFailures wrong codes, codes are refused until
+	// mfaLockout has passed since the last failure
+	mfaMaxFailures = 5
+	mfaLockout     = 15 * time.Minute
+	// recoveryCodeCount is how many recovery codes a user is given
+	recoveryCodeCount = 10
+)
+
+var (
+	errMFANotSetUp  = errors.New("two-factor authentication is not set up")
+	errMFAInvalid   = errors.New("invalid code")
+	errMFALocked    = errors.New("too many invalid codes")
+	recoveryEncoder = base32.StdEncoding.WithPadding(base32.NoPadding)
+)
+
+// Complete MFA login
+// @Summary Complete Login With Two-Factor Authentication
+// @Description Exchange the mfa_token from POST /login and a code from the user's authenticator app, or one of their recovery codes, for tokens. After 5 invalid codes, codes are refused for 15 minutes.
+// @ID login-mfa
+// @Produce json
+// @Param mfa body models.MFALogin true "Challenge token and code"
+// @Success 200 "Successful response"
+// @Failure 400 "Invalid input format"
+// @Failure 401 "Invalid or expired MFA token, or invalid code"
+// @Failure 429 "Too many invalid codes"
+// @Router /login/mfa [post]
+func (h *AuthHandler) LoginMFA(c *gin.Context) {
+	var input models.MFALogin
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid input format",
+			"details": err.Error(),
+		})
+		return
+	}
+	if (input.Code == "") == (input.RecoveryCode == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Exactly one of code or recovery_code is required"})
+		return
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(input.MFAToken, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, jwt.ErrSignatureInvalid
+		}
+		return h.jwtSecret, nil
+	})
+	userID, ok := claims["user_id"].(float64)
+	if err != nil || !ok || claims["purpose"] != "mfa" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA token"})
+		return
+	}
+
+	err = h.checkSecondFactor(context.Background(), int(userID), input.Code, input.RecoveryCode, false)
+	if err != nil {
+		secondFactorFailed(c, err)
+		return
+	}
+
+	h.respondWithTokens(c, int(userID))
+}
+
+// Enroll in MFA
+// @Summary Start Two-Factor Authentication Enrollment
+// @Description Create a new TOTP secret for the current user. Add it to an authenticator app, usually by showing provisioning_uri as a QR code, then confirm with a code at POST /me/mfa/confirm. Starting again replaces an unconfirmed secret.
+// @ID enroll-mfa
+// @Produce json
+// @Param enroll body models.MFAEnroll true "Current password"
+// @Success 200 "Successful response"
+// @Failure 400 "Invalid input format"
+// @Failure 403 "Current password is incorrect"
+// @Failure 409 "Two-factor authentication is already enabled"
+// @Router /me/mfa/enroll [post]
+// @Security Bearer
+func (h *AuthHandler) EnrollMFA(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+		return
+	}
+
+	var input models.MFAEnroll
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid input format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	ctx := context.Background()
+	if !h.checkCurrentPassword(c, ctx, userID, input.CurrentPassword) {
+		return
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Secret generation failed"})
+		return
+	}
+
+	var email string
+	err = h.db.QueryRow(ctx, `
+        UPDATE staff_user
+        SET mfa_secret = $2, mfa_last_step = NULL
+        WHERE id = $1 AND NOT mfa_enabled
+        RETURNING email`,
+		userID, secret,
+	).Scan(&email)
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	org := h.organisation(ctx, currentOrgID(c))
+	c.JSON(http.StatusOK, models.MFAEnrollment{
+		Secret:          secret,
+		ProvisioningURI: utils.TOTPProvisioningURI(org.BrandName, email, secret),
+	})
+}
+
+// Confirm MFA
+// @Summary Confirm Two-Factor Authentication
+// @Description Turn two-factor authentication on with a code from the secret POST /me/mfa/enroll gave, and receive recovery codes, shown only this once. Tokens issued while enrollment was required stay limited until refreshed.
+// @ID confirm-mfa
+// @Produce json
+// @Param code body models.MFACode true "Code from the authenticator app"
+// @Success 200 "Successful response"
+// @Failure 400 "Enrollment not started"
+// @Failure 401 "Invalid code"
+// @Failure 409 "Two-factor authentication is already enabled"
+// @Failure 429 "Too many invalid codes"
+// @Router /me/mfa/confirm [post]
+// @Security Bearer
+func (h *AuthHandler) ConfirmMFA(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+		return
+	}
+
+	var input models.MFACode
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid input format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	ctx := context.Background()
+	var enabled bool
+	if err := h.db.QueryRow(ctx, "SELECT mfa_enabled FROM staff_user WHERE id = $1", userID).Scan(&enabled); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if enabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	if err := h.checkSecondFactor(ctx, userID, input.Code, "", true); err != nil {
+		secondFactorFailed(c, err)
+		return
+	}
+
+	tx, err := h.db.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction start failed"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, "UPDATE staff_user SET mfa_enabled = TRUE WHERE id = $1", userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	codes, err := replaceRecoveryCodes(ctx, tx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction commit failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.MFARecoveryCodes{RecoveryCodes: codes})
+}
+
+// Disable MFA
+// @Summary Disable Two-Factor Authentication
+// @Description Turn two-factor authentication off for the current user, with their password and a code or recovery code. Not allowed when the organisation requires it for the user's role.
+// @ID disable-mfa
+// @Produce json
+// @Param disable body models.MFADisable true "Current password and code"
+// @Success 200 "Successful response"
+// @Failure 400 "Invalid input format"
+// @Failure 401 "Invalid code"
+// @Failure 403 "Current password is incorrect, or required for this role"
+// @Failure 429 "Too many invalid codes"
+// @Router /me/mfa/disable [post]
+// @Security Bearer
+func (h *AuthHandler) DisableMFA(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+		return
+	}
+
+	var input models.MFADisable
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid input format",
+			"details": err.Error(),
+		})
+		return
+	}
+	if (input.Code == "") == (input.RecoveryCode == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Exactly one of code or recovery_code is required"})
+		return
+	}
+
+	ctx := context.Background()
+	if !h.checkCurrentPassword(c, ctx, userID, input.CurrentPassword) {
+		return
+	}
+
+	var enabled, required bool
+	err := h.db.QueryRow(ctx, `
+        SELECT u.mfa_enabled, u.role = ANY (o.mfa_required_roles)
+        FROM staff_user u
+        JOIN organisation o ON o.id = u.org_id
+        WHERE u.id = $1`,
+		userID,
+	).Scan(&enabled, &required)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !enabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+	if required {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Two-factor authentication is required for your role"})
+		return
+	}
+
+	if err := h.checkSecondFactor(ctx, userID, input.Code, input.RecoveryCode, false); err != nil {
+		secondFactorFailed(c, err)
+		return
+	}
+
+	if err := clearMFA(ctx, h.db, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// Regenerate recovery codes
+// @Summary Regenerate Recovery Codes
+// @Description Replace the current user's recovery codes, for example when they have run low. A code from the authenticator app is required. The new codes are shown only this once.
+// @ID regenerate-recovery-codes
+// @Produce json
+// @Param code body models.MFACode true "Code from the authenticator app"
+// @Success 200 "Successful response"
+// @Failure 401 "Invalid code"
+// @Failure 409 "Two-factor authentication is not enabled"
+// @Failure 429 "Too many invalid codes"
+// @Router /me/mfa/recovery-codes [post]
+// @Security Bearer
+func (h *AuthHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+		return
+	}
+
+	var input models.MFACode
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid input format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	ctx := context.Background()
+	var enabled bool
+	if err := h.db.QueryRow(ctx, "SELECT mfa_enabled FROM staff_user WHERE id = $1", userID).Scan(&enabled); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !enabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+
+	if err := h.checkSecondFactor(ctx, userID, input.Code, "", false); err != nil {
+		secondFactorFailed(c, err)
+		return
+	}
+
+	tx, err := h.db.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction start failed"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	codes, err := replaceRecoveryCodes(ctx, tx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction commit failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.MFARecoveryCodes{RecoveryCodes: codes})
+}
+
+// Reset user MFA
+// @Summary Reset Two-Factor Authentication
+// @Description Turn a user's two-factor authentication off, for example when they lost their device and recovery codes. If their role requires it they set it up again at their next login.
+// @ID reset-user-mfa
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 "Successful response"
+// @Failure 400 "Invalid User ID"
+// @Failure 404 "User not found"
+// @Router /users/{id}/mfa [delete]
+// @Security Bearer
+func (h *AuthHandler) ResetUserMFA(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid User ID"})
+		return
+	}
+
+	ctx := context.Background()
+	tx, err := h.db.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction start failed"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	// Only users of the caller's organisation can be reset
+	var user models.User
+	err = scanUser(tx.QueryRow(ctx, "SELECT "+userColumns+" FROM staff_user WHERE id = $1 AND org_id = $2 FOR UPDATE", id, currentOrgID(c)), &user)
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if err := clearMFA(ctx, tx, id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if err = tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction commit failed"})
+		return
+	}
+
+	user.MFAEnabled = false
+	c.JSON(http.StatusOK, user)
+}
+
+// respondWithMFAChallenge answers a correct password with a short-lived
+// token that POST /login/mfa exchanges, together with a code, for real
+// tokens. Its purpose claim keeps it from being used as either.
+func (h *AuthHandler) respondWithMFAChallenge(c *gin.Context, userID int) {
+	now := time.Now()
+	challenge, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id": userID,
+		"purpose": "mfa",
+		"iat":     now.Unix(),
+		"exp":     now.Add(mfaChallengeExpiry).Unix(),
+	}).SignedString(h.jwtSecret)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Token generation failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"mfa_required": true,
+		"mfa_token":    challenge,
+		"expires_in":   mfaChallengeExpiry.Seconds(),
+	})
+}
+
+// checkSecondFactor checks a TOTP code, or else a recovery code, of a
+// user. Accepted codes are used up: the TOTP step cannot be replayed and
+// the recovery code cannot be used again. Failures are counted, and once
+// there are too many every code fails with errMFALocked for a while.
+// While enrolling, codes are checked against the unconfirmed secret;
+// otherwise two-factor authentication must be enabled.
+func (h *AuthHandler) checkSecondFactor(ctx context.Context, userID int, code, recoveryCode string, enrolling bool) error {
+	var secret *string
+	var lastStep *int64
+	var enabled, active, locked bool
+	err := h.db.QueryRow(ctx, `
+        SELECT mfa_secret, mfa_enabled, mfa_last_step, active,
+               mfa_failures >= $2 AND mfa_failed_at > now() - $3::interval
+        FROM staff_user
+        WHERE id = $1`,
+		userID, mfaMaxFailures, mfaLockout.String(),
+	).Scan(&secret, &enabled, &lastStep, &active, &locked)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return errMFANotSetUp
+	}
+	if err != nil {
+		return err
+	}
+	if secret == nil || !active || enabled == enrolling {
+		return errMFANotSetUp
+	}
+	if locked {
+		return errMFALocked
+	}
+
+	accepted := false
+	switch {
+	case code != "":
+		last := int64(-1)
+		if lastStep != nil {
+			last = *lastStep
+		}
+		if step, ok := utils.VerifyTOTP(*secret, code, time.Now(), last); ok {
+			// Only one request may use a step, however close they come
+			tag, err := h.db.Exec(ctx, `
+                UPDATE staff_user
+                SET mfa_last_step = $2, mfa_failures = 0, mfa_failed_at = NULL
+                WHERE id = $1 AND COALESCE(mfa_last_step, -1) < $2`,
+				userID, step)
+			if err != nil {
+				return err
+			}
+			accepted = tag.RowsAffected() == 1
+		}
+	case recoveryCode != "":
+		if accepted, err = useRecoveryCode(ctx, h.db, userID, recoveryCode); err != nil {
+			return err
+		}
+		if accepted {
+			if _, err := h.db.Exec(ctx, "UPDATE staff_user SET mfa_failures = 0, mfa_failed_at = NULL WHERE id = $1", userID); err != nil {
+				return err
+			}
+		}
+	}
+	if accepted {
+		return nil
+	}
+
+	// Failures older than the lockout start the count again
+	_, err = h.db.Exec(ctx, `
+        UPDATE staff_user
+        SET mfa_failures = CASE WHEN mfa_failed_at > now() - $2::interval THEN mfa_failures + 1 ELSE 1 END,
+            mfa_failed_at = now()
+        WHERE id = $1`,
+		userID, mfaLockout.String())
+	if err != nil {
+		return err
+	}
+	return errMFAInvalid
+}
+
+// secondFactorFailed answers for a failed checkSecondFactor
+func secondFactorFailed(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errMFANotSetUp):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not set up"})
+	case errors.Is(err, errMFAInvalid):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid code"})
+	case errors.Is(err, errMFALocked):
+		c.Header("Retry-After", strconv.Itoa(int(mfaLockout.Seconds())))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many invalid codes, please try again later"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+	}
+}
+
+// replaceRecoveryCodes gives a user new recovery codes, dropping the old
+// ones. Only their hashes are stored.
+func replaceRecoveryCodes(ctx context.Context, db dbExecutor, userID int) ([]string, error) {
+	if _, err := db.Exec(ctx, "DELETE FROM mfa_recovery_code WHERE user_id = $1", userID); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	for range recoveryCodeCount {
+		raw := make([]byte, 10)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		encoded := strings.ToLower(recoveryEncoder.EncodeToString(raw))
+		code := encoded[:5] + "-" + encoded[5:10]
+
+		_, err := db.Exec(ctx, "INSERT INTO mfa_recovery_code (user_id, code_hash) VALUES ($1, $2)", userID, recoveryCodeHash(code))
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// useRecoveryCode marks an unused recovery code of a user as used,
+// reporting whether there was one
+func useRecoveryCode(ctx context.Context, db dbExecutor, userID int, code string) (bool, error) {
+	tag, err := db.Exec(ctx, `
+        UPDATE mfa_recovery_code
+        SET used_at = now()
+        WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`,
+		userID, recoveryCodeHash(code))
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// recoveryCodeHash is what is stored for a recovery code. Case, spaces and
+// dashes are ignored, as people type codes back in many ways.
+func recoveryCodeHash(code string) string {
+	normalised := strings.NewReplacer("-", "", " ", "").Replace(strings.ToLower(strings.TrimSpace(code)))
+	sum := sha256.Sum256([]byte(normalised))
+	return hex.EncodeToString(sum[:])
+}
+
+// clearMFA turns a user's two-factor authentication off
+func clearMFA(ctx context.Context, db dbExecutor, userID int) error {
+	_, err := db.Exec(ctx, `
+        UPDATE staff_user
+        SET mfa_secret = NULL, mfa_enabled = FALSE, mfa_last_step = NULL,
+            mfa_failures = 0, mfa_failed_at = NULL
+        WHERE id = $1`,
+		userID)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(ctx, "DELETE FROM mfa_recovery_code WHERE user_id = $1", userID)
+	return err
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// recoveryCodeStore stands in for the mfa_recovery_code table, answering
+// the statements replaceRecoveryCodes and useRecoveryCode make
+type recoveryCodeStore struct {
+	// used maps the hashes of a user's codes to whether they were used
+	used map[string]bool
+}
+
+func (s *recoveryCodeStore) Exec(_ context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	switch {
+	case strings.HasPrefix(strings.TrimSpace(sql), "DELETE FROM mfa_recovery_code"):
+		s.used = map[string]bool{}
+		return pgconn.NewCommandTag("DELETE 0"), nil
+	case strings.HasPrefix(strings.TrimSpace(sql), "INSERT INTO mfa_recovery_code"):
+		s.used[args[1].(string)] = false
+		return pgconn.NewCommandTag("INSERT 0 1"), nil
+	case strings.HasPrefix(strings.TrimSpace(sql), "UPDATE mfa_recovery_code"):
+		hash := args[1].(string)
+		if used, ok := s.used[hash]; !ok || used {
+			return pgconn.NewCommandTag("UPDATE 0"), nil
+		}
+		s.used[hash] = true
+		return pgconn.NewCommandTag("UPDATE 1"), nil
+	}
+	return pgconn.CommandTag{}, errors.New("unexpected statement: " + sql)
+}
+
+func (s *recoveryCodeStore) Query(context.Context, string, ...any) (pgx.Rows, error) {
+	return nil, errors.New("unexpected query")
+}
+
+func (s *recoveryCodeStore) QueryRow(context.Context, string, ...any) pgx.Row {
+	return nil
+}
+
+func TestRecoveryCodeHash(t *testing.T) {
+	want := recoveryCodeHash("abcde-fghij")
+
+	for _, typed := range []string{"abcde-fghij", "ABCDE-FGHIJ", "abcdefghij", " abcde fghij ", "AbCdE - FgHiJ"} {
+		if got := recoveryCodeHash(typed); got != want {
+			t.Errorf("recoveryCodeHash(%q) = %s, want %s", typed, got, want)
+		}
+	}
+	if recoveryCodeHash("abcde-fghik") == want {
+		t.Error("different codes have the same hash")
+	}
+	if len(want) != 64 || strings.Contains(want, "abcde") {
+		t.Errorf("recoveryCodeHash gave %q, want a hex SHA-256", want)
+	}
+}
+
+func TestReplaceRecoveryCodes(t *testing.T) {
+	ctx := context.Background()
+	store := &recoveryCodeStore{used: map[string]bool{"old": false}}
+
+	codes, err := replaceRecoveryCodes(ctx, store, 1)
+	if err != nil {
+		t.Fatalf("replaceRecoveryCodes: %v", err)
+	}
+	if len(codes) != recoveryCodeCount {
+		t.Fatalf("got %d codes, want %d", len(codes), recoveryCodeCount)
+	}
+	if _, ok := store.used["old"]; ok {
+		t.Error("the old codes were kept")
+	}
+
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != 11 || code[5] != '-' {
+			t.Errorf("code %q is not of the form xxxxx-xxxxx", code)
+		}
+		if seen[code] {
+			t.Errorf("code %q was given twice", code)
+		}
+		seen[code] = true
+
+		// Only the hash is stored
+		if _, ok := store.used[code]; ok {
+			t.Errorf("code %q was stored as is", code)
+		}
+		if _, ok := store.used[recoveryCodeHash(code)]; !ok {
+			t.Errorf("hash of code %q was not stored", code)
+		}
+	}
+}
+
+func TestUseRecoveryCode(t *testing.T) {
+	ctx := context.Background()
+	store := &recoveryCodeStore{used: map[string]bool{}}
+
+	codes, err := replaceRecoveryCodes(ctx, store, 1)
+	if err != nil {
+		t.Fatalf("replaceRecoveryCodes: %v", err)
+	}
+
+	// Typed back in upper case and without the dash
+	typed := strings.ToUpper(strings.ReplaceAll(codes[0], "-", ""))
+	if ok, err := useRecoveryCode(ctx, store, 1, typed); err != nil || !ok {
+		t.Fatalf("useRecoveryCode(%q) = %v, %v, want true", typed, ok, err)
+	}
+	if ok, err := useRecoveryCode(ctx, store, 1, codes[0]); err != nil || ok {
+		t.Errorf("second useRecoveryCode(%q) = %v, %v, want false", codes[0], ok, err)
+	}
+	if ok, err := useRecoveryCode(ctx, store, 1, codes[1]); err != nil || !ok {
+		t.Errorf("useRecoveryCode(%q) after another was used = %v, %v, want true", codes[1], ok, err)
+	}
+	if ok, err := useRecoveryCode(ctx, store, 1, "aaaaa-aaaaa"); err != nil || ok {
+		t.Errorf("useRecoveryCode of an unknown code = %v, %v, want false", ok, err)
+	}
+}
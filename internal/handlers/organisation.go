@@ -0,0 +1,383 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"ticket-sys/internal/models"
+	"ticket-sys/internal/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// errOtherOrganisation marks a reference to a row owned by another
+// organisation, which is reported as if it did not exist
+var errOtherOrganisation = errors.New("not found in this organisation")
+
+const organisationColumns = `id, name, slug, mail_sender, timezone, dashboard_url, brand_name, brand_colour, logo_url, mfa_required_roles, created_date::text`
+
+var organisationSlug = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// tenantOwners finds the organisation owning a row, by the kind of row
+// RequireTenant is guarding
+var tenantOwners = map[string]struct {
+	sql      string
+	notFound string
+}{
+	"ticket":          {"SELECT org_id FROM ticket WHERE id = $1", "Ticket not found"},
+	"accommodation":   {"SELECT org_id FROM accommodation WHERE id = $1", "Accommodation not found"},
+	"user":            {"SELECT org_id FROM staff_user WHERE id = $1", "User not found"},
+	"team":            {"SELECT org_id FROM team WHERE id = $1", "Team not found"},
+	"webhook":         {"SELECT org_id FROM webhook WHERE id = $1", "Webhook not found"},
+	"schedule":        {"SELECT org_id FROM ticket_schedule WHERE id = $1", "Schedule not found"},
+	"assignment_rule": {"SELECT org_id FROM assignment_rule WHERE id = $1", "Assignment rule not found"},
+	"shift":           {"SELECT u.org_id FROM staff_shift s JOIN staff_user u ON u.id = s.user_id WHERE s.id = $1", "Shift not found"},
+	"subscription":    {"SELECT u.org_id FROM subscription s JOIN staff_user u ON u.id = s.user_id WHERE s.id = $1", "Subscription not found"},
+}
+
+// RequireTenant answers 404 for routes whose :id belongs to another
+// organisation than the caller's, so handlers looking rows up by ID stay
+// scoped. It must run after AuthMiddleware.
+func (h *AuthHandler) RequireTenant(kind string) gin.HandlerFunc {
+	owner, ok := tenantOwners[kind]
+	if !ok {
+		panic("handlers: unknown tenant kind " + kind)
+	}
+
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			// The handler reports the malformed ID
+			c.Next()
+			return
+		}
+
+		var orgID int
+		err = h.db.QueryRow(context.Background(), owner.sql, id).Scan(&orgID)
+		if errors.Is(err, pgx.ErrNoRows) || (err == nil && orgID != currentOrgID(c)) {
+			c.JSON(http.StatusNotFound, gin.H{"error": owner.notFound})
+			c.Abort()
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireHostOrganisation only lets through users of the first
+// organisation, which hosts the install and owns what every organisation
+// shares: the organisations themselves, the catalogs and the SLA policies.
+// It must run after AuthMiddleware.
+func (h *AuthHandler) RequireHostOrganisation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		host, err := h.isHostOrganisation(context.Background(), currentOrgID(c))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			c.Abort()
+			return
+		}
+		if !host {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// Get organisation
+// @Summary Get Organisation
+// @Description Get the caller's organisation and its settings
+// @ID get-organisation
+// @Produce json
+// @Success 200 "Successful response"
+// @Failure 500 "Database error"
+// @Router /organisation [get]
+// @Security Bearer
+func (h *AuthHandler) GetOrganisation(c *gin.Context) {
+	var org models.Organisation
+	err := scanOrganisation(h.db.QueryRow(context.Background(), "SELECT "+organisationColumns+" FROM organisation WHERE id = $1", currentOrgID(c)), &org)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, org)
+}
+
+// Update organisation
+// @Summary Update Organisation
+// @Description Change the caller's organisation name, mail sender, timezone, dashboard link, branding or the roles that must use two-factor authentication. Users of a newly required role must set it up at their next login or token refresh.
+// @ID update-organisation
+// @Produce json
+// @Success 200 "Successful response"
+// @Failure 400 "Invalid organisation data"
+// @Router /organisation [patch]
+// @Security Bearer
+func (h *AuthHandler) UpdateOrganisation(c *gin.Context) {
+	var update models.OrganisationUpdate
+	if err := c.ShouldBindJSON(&update); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid organisation data", "details": err.Error()})
+		return
+	}
+	if update.Timezone != nil {
+		if _, err := time.LoadLocation(*update.Timezone); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid timezone"})
+			return
+		}
+	}
+
+	var org models.Organisation
+	err := scanOrganisation(h.db.QueryRow(context.Background(), `
+        UPDATE organisation
+        SET name = COALESCE(btrim($2), name),
+            mail_sender = COALESCE($3, mail_sender),
+            timezone = COALESCE($4, timezone),
+            dashboard_url = COALESCE($5, dashboard_url),
+            brand_name = COALESCE($6, brand_name),
+            brand_colour = COALESCE($7, brand_colour),
+            logo_url = COALESCE($8, logo_url),
+            mfa_required_roles = COALESCE($9, mfa_required_roles)
+        WHERE id = $1
+        RETURNING `+organisationColumns,
+		currentOrgID(c), update.Name, update.MailSender, update.Timezone, update.DashboardURL,
+		update.BrandName, update.BrandColour, update.LogoURL, update.MFARequiredRoles), &org)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Organisation update failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, org)
+}
+
+// Get organisations
+// @Summary Get Organisations
+// @Description List every organisation. Only admins of the first organisation, which hosts the install, may do this.
+// @ID get-organisations
+// @Produce json
+// @Success 200 "Successful response"
+// @Failure 403 "Insufficient permissions"
+// @Router /organisations [get]
+// @Security Bearer
+func (h *AuthHandler) GetOrganisations(c *gin.Context) {
+	ctx := context.Background()
+
+	organisations := []models.Organisation{}
+	rows, err := h.db.Query(ctx, "SELECT "+organisationColumns+" FROM organisation ORDER BY id")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var org models.Organisation
+		if err := scanOrganisation(rows, &org); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Process failed"})
+			return
+		}
+		organisations = append(organisations, org)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Organisation iteration failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, organisations)
+}
+
+// Create organisation
+// @Summary Create Organisation
+// @Description Set up a new organisation together with its first admin. Only admins of the first organisation, which hosts the install, may do this.
+// @ID create-organisation
+// @Produce json
+// @Success 201 "Successful response"
+// @Failure 400 "Invalid input format"
+// @Failure 403 "Insufficient permissions"
+// @Failure 409 "Organisation already exists"
+// @Router /organisations [post]
+// @Security Bearer
+func (h *AuthHandler) CreateOrganisation(c *gin.Context) {
+	ctx := context.Background()
+
+	var input models.OrganisationCreate
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid input format",
+			"details": err.Error(),
+		})
+		return
+	}
+	if !organisationSlug.MatchString(input.Slug) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Slug may only hold lowercase letters, digits and dashes"})
+		return
+	}
+	if input.Timezone == "" {
+		input.Timezone = "Asia/Tokyo"
+	}
+	if _, err := time.LoadLocation(input.Timezone); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid timezone"})
+		return
+	}
+	if input.BrandName == "" {
+		input.BrandName = input.Name
+	}
+	if err := input.Admin.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	hashedPassword, err := utils.HashPassword(input.Admin.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Password processing failed"})
+		return
+	}
+
+	tx, err := h.db.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var org models.Organisation
+	err = scanOrganisation(tx.QueryRow(ctx, `
+        INSERT INTO organisation (name, slug, mail_sender, timezone, dashboard_url, brand_name, brand_colour, logo_url)
+        VALUES (btrim($1), $2, $3, $4, $5, $6, $7, $8)
+        RETURNING `+organisationColumns,
+		input.Name, input.Slug, input.MailSender, input.Timezone, input.DashboardURL,
+		input.BrandName, input.BrandColour, input.LogoURL), &org)
+	if isUniqueViolation(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Organisation already exists"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Organisation creation failed"})
+		return
+	}
+
+	_, err = tx.Exec(ctx, `
+        INSERT INTO staff_user (first_name, last_name, email, password, role, org_id)
+        VALUES ($1, $2, $3, $4, 'admin', $5)`,
+		input.Admin.FirstName, input.Admin.LastName, input.Admin.Email, hashedPassword, org.ID)
+	if isUniqueViolation(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email already registered"})
+		return
+	}
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Organisation creation failed"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, org)
+}
+
+// organisation returns the settings notifications and reports of orgID
+// follow. It never fails: settings left blank, or an organisation that
+// cannot be read, fall back to the mailbox and dashboard of the install.
+func (h *AuthHandler) organisation(ctx context.Context, orgID int) *models.Organisation {
+	org := &models.Organisation{ID: orgID}
+	err := scanOrganisation(h.db.QueryRow(ctx, "SELECT "+organisationColumns+" FROM organisation WHERE id = $1", orgID), org)
+	if err != nil {
+		org = &models.Organisation{ID: orgID}
+	}
+	if org.MailSender == "" {
+		org.MailSender = mailSettings.Sender
+	}
+	if org.DashboardURL == "" {
+		org.DashboardURL = mailSettings.DashboardURL
+	}
+	if org.BrandName == "" {
+		org.BrandName = "Ticketing Management System"
+	}
+	if _, err := time.LoadLocation(org.Timezone); org.Timezone == "" || err != nil {
+		org.Timezone = "Asia/Tokyo"
+	}
+	return org
+}
+
+// organisationLocation returns the timezone of org as a location
+func organisationLocation(org *models.Organisation) *time.Location {
+	loc, err := time.LoadLocation(org.Timezone)
+	if err != nil {
+		loc, _ = time.LoadLocation("Asia/Tokyo")
+	}
+	return loc
+}
+
+// resolveOrganisation finds the organisation with slug
+func resolveOrganisation(ctx context.Context, db dbExecutor, slug string) (int, error) {
+	var id int
+	err := db.QueryRow(ctx, "SELECT id FROM organisation WHERE slug = $1", slug).Scan(&id)
+	return id, err
+}
+
+// isHostOrganisation reports whether orgID is the first organisation, whose
+// admins manage the others
+func (h *AuthHandler) isHostOrganisation(ctx context.Context, orgID int) (bool, error) {
+	var host bool
+	err := h.db.QueryRow(ctx, "SELECT $1 = (SELECT min(id) FROM organisation)", orgID).Scan(&host)
+	return host, err
+}
+
+// checkOrgUsers fails with errOtherOrganisation unless every user in ids
+// belongs to orgID and is active. Unknown IDs are left for the foreign
+// keys to report.
+func checkOrgUsers(ctx context.Context, db dbExecutor, orgID int, ids ...int) error {
+	var foreign bool
+	err := db.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM staff_user WHERE id = ANY($1) AND (org_id <> $2 OR NOT active))", ids, orgID).Scan(&foreign)
+	if err != nil {
+		return err
+	}
+	if foreign {
+		return errOtherOrganisation
+	}
+	return nil
+}
+
+// checkOrgAccommodation fails with errOtherOrganisation when accommodation
+// id, if set, belongs to another organisation than orgID
+func checkOrgAccommodation(ctx context.Context, db dbExecutor, orgID int, id *int) error {
+	if id == nil {
+		return nil
+	}
+	var foreign bool
+	err := db.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM accommodation WHERE id = $1 AND org_id <> $2)", *id, orgID).Scan(&foreign)
+	if err != nil {
+		return err
+	}
+	if foreign {
+		return errOtherOrganisation
+	}
+	return nil
+}
+
+// scanOrganisation scans a row selected with organisationColumns
+func scanOrganisation(row pgx.Row, org *models.Organisation) error {
+	return row.Scan(
+		&org.ID,
+		&org.Name,
+		&org.Slug,
+		&org.MailSender,
+		&org.Timezone,
+		&org.DashboardURL,
+		&org.BrandName,
+		&org.BrandColour,
+		&org.LogoURL,
+		&org.MFARequiredRoles,
+		&org.CreatedDate,
+	)
+}
@@ -0,0 +1,433 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"ticket-sys/internal/models"
+	"ticket-sys/internal/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// emailChangeExpiry is how long the link verifying a new address works
+const emailChangeExpiry = 24 * time.Hour
+
+var (
+	phoneNumberFormat = regexp.MustCompile(`^\+?[0-9][0-9 ()\-]{4,19}$`)
+	languageFormat    = regexp.MustCompile(`^[a-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+)
+
+// Get profile
+// @Summary Get Profile
+// @Description Get the current user's profile, including an email address waiting to be verified and their notification preferences
+// @ID get-me
+// @Produce json
+// @Success 200 "Successful response"
+// @Failure 404 "User not found"
+// @Router /me [get]
+// @Security Bearer
+func (h *AuthHandler) GetMe(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+		return
+	}
+
+	profile, err := h.profile(context.Background(), userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, profile)
+}
+
+// Update profile
+// @Summary Update Profile
+// @Description Change the current user's name, phone number, language, timezone or notification preferences. An empty phone number, language or timezone clears it; language and timezone then follow the organisation. Names in tokens change on the next refresh.
+// @ID update-me
+// @Produce json
+// @Success 200 "Successful response"
+// @Failure 400 "Invalid profile data"
+// @Router /me [patch]
+// @Security Bearer
+func (h *AuthHandler) UpdateMe(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+		return
+	}
+
+	var update models.ProfileUpdate
+	if err := c.ShouldBindJSON(&update); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid input format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	for _, name := range []*string{update.FirstName, update.LastName} {
+		if name != nil {
+			*name = strings.TrimSpace(*name)
+			if *name == "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Names cannot be empty"})
+				return
+			}
+		}
+	}
+	for _, value := range []*string{update.PhoneNumber, update.Language, update.Timezone} {
+		if value != nil {
+			*value = strings.TrimSpace(*value)
+		}
+	}
+	if update.PhoneNumber != nil && *update.PhoneNumber != "" && !phoneNumberFormat.MatchString(*update.PhoneNumber) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid phone number"})
+		return
+	}
+	if update.Language != nil && *update.Language != "" && !languageFormat.MatchString(*update.Language) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid language, expected a code such as en or ja"})
+		return
+	}
+	if update.Timezone != nil && *update.Timezone != "" {
+		if _, err := time.LoadLocation(*update.Timezone); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid timezone"})
+			return
+		}
+	}
+	if event, ok := unknownNotificationEvent(update.NotificationPreferences); ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown event " + event})
+		return
+	}
+
+	ctx := context.Background()
+	tx, err := h.db.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction start failed"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	// A NULL argument keeps the column; an empty one clears it
+	tag, err := tx.Exec(ctx, `
+        UPDATE staff_user
+        SET first_name = COALESCE($2, first_name),
+            last_name = COALESCE($3, last_name),
+            phone_number = CASE WHEN $4::text IS NULL THEN phone_number ELSE NULLIF($4, '') END,
+            language = CASE WHEN $5::text IS NULL THEN language ELSE NULLIF($5, '') END,
+            timezone = CASE WHEN $6::text IS NULL THEN timezone ELSE NULLIF($6, '') END
+        WHERE id = $1`,
+		userID, update.FirstName, update.LastName, update.PhoneNumber, update.Language, update.Timezone)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if err := saveNotificationPreferences(ctx, tx, userID, update.NotificationPreferences); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction commit failed"})
+		return
+	}
+
+	profile, err := h.profile(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, profile)
+}
+
+// Change password
+// @Summary Change Password
+// @Description Change the current user's password. The current password must be given.
+// @ID change-my-password
+// @Produce json
+// @Param password body models.PasswordChange true "Current and new password"
+// @Success 200 "Successful response"
+// @Failure 400 "Invalid input format"
+// @Failure 403 "Current password is incorrect"
+// @Router /me/password [post]
+// @Security Bearer
+func (h *AuthHandler) ChangePassword(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+		return
+	}
+
+	var change models.PasswordChange
+	if err := c.ShouldBindJSON(&change); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid input format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	ctx := context.Background()
+	if !h.checkCurrentPassword(c, ctx, userID, change.CurrentPassword) {
+		return
+	}
+
+	hashedPassword, err := utils.HashPassword(change.NewPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Password processing failed"})
+		return
+	}
+
+	if _, err := h.db.Exec(ctx, "UPDATE staff_user SET password = $2 WHERE id = $1", userID, hashedPassword); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed successfully"})
+}
+
+// Change email
+// @Summary Change Email
+// @Description Start moving the current user to a new email address. The current password must be given. A verification link is mailed to the new address, which replaces the old one once verified at POST /verify-email; until then the old address stays in use. A later request replaces a pending one.
+// @ID change-my-email
+// @Produce json
+// @Param email body models.EmailChange true "New email and current password"
+// @Success 202 "Verification email sent"
+// @Failure 400 "Invalid input format"
+// @Failure 403 "Current password is incorrect"
+// @Failure 409 "Email already registered"
+// @Router /me/email [post]
+// @Security Bearer
+func (h *AuthHandler) ChangeEmail(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+		return
+	}
+
+	var change models.EmailChange
+	if err := c.ShouldBindJSON(&change); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid input format",
+			"details": err.Error(),
+		})
+		return
+	}
+	if err := change.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := context.Background()
+	if !h.checkCurrentPassword(c, ctx, userID, change.CurrentPassword) {
+		return
+	}
+
+	var exists bool
+	if err := h.db.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM staff_user WHERE email = $1)", change.Email).Scan(&exists); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if exists {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email already registered"})
+		return
+	}
+
+	raw := make([]byte, 32)
+	rand.Read(raw)
+	token := hex.EncodeToString(raw)
+
+	_, err := h.db.Exec(ctx, `
+        INSERT INTO email_change (user_id, email, token_hash, expires_at)
+        VALUES ($1, $2, $3, $4)
+        ON CONFLICT (user_id) DO UPDATE
+        SET email = EXCLUDED.email, token_hash = EXCLUDED.token_hash,
+            expires_at = EXCLUDED.expires_at, created_date = now()`,
+		userID, change.Email, emailChangeTokenHash(token), time.Now().Add(emailChangeExpiry))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	org := h.organisation(ctx, currentOrgID(c))
+	link := org.DashboardURL + "/verify-email?token=" + url.QueryEscape(token)
+	body := `
+		<html>
+		<body>
+			` + mailBranding(org) + `
+			<h1 style="` + mailHeadingStyle(org) + `">Please verify your new email address</h1>
+			<p>` + html.EscapeString(currentUserName(c)) + ` asked to use this address for their ` + html.EscapeString(org.BrandName) + ` account.
+			Follow the link below within ` + fmt.Sprint(emailChangeExpiry.Hours()) + ` hours to confirm. If this was not you, ignore this email and nothing will change.</p>
+			<p>Verification code: ` + token + `</p>
+			<a href="` + html.EscapeString(link) + `">Verify Email Address</a>
+		</body>
+		</html>
+	`
+	if err := sendMail(org, []string{change.Email}, "Verify Your New Email Address", body); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Mailer error"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":       "Verification email sent",
+		"pending_email": change.Email,
+	})
+}
+
+// Verify email
+// @Summary Verify Email
+// @Description Confirm an email change with the token mailed to the new address, which then becomes the address to log in with
+// @ID verify-email
+// @Produce json
+// @Param token body models.EmailVerify true "Verification token"
+// @Success 200 "Successful response"
+// @Failure 400 "Invalid or expired token"
+// @Failure 409 "Email already registered"
+// @Router /verify-email [post]
+func (h *AuthHandler) VerifyEmail(c *gin.Context) {
+	var verify models.EmailVerify
+	if err := c.ShouldBindJSON(&verify); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid input format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	ctx := context.Background()
+	tx, err := h.db.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction start failed"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var userID int
+	var email string
+	err = tx.QueryRow(ctx, `
+        DELETE FROM email_change
+        WHERE token_hash = $1 AND expires_at > now()
+        RETURNING user_id, email`,
+		emailChangeTokenHash(strings.TrimSpace(verify.Token)),
+	).Scan(&userID, &email)
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired token"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	// The address may have been registered since the change was asked for
+	var exists bool
+	if err := tx.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM staff_user WHERE email = $1 AND id <> $2)", email, userID).Scan(&exists); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if exists {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email already registered"})
+		return
+	}
+
+	_, err = tx.Exec(ctx, "UPDATE staff_user SET email = $2 WHERE id = $1", userID, email)
+	if isUniqueViolation(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email already registered"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction commit failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email changed successfully", "email": email})
+}
+
+// profile loads a user's own profile
+func (h *AuthHandler) profile(ctx context.Context, userID int) (*models.Profile, error) {
+	var profile models.Profile
+	err := h.db.QueryRow(ctx, `
+        SELECT u.id, u.first_name, u.last_name, u.email, ec.email, u.role, u.org_id,
+               u.phone_number, u.language, u.timezone,
+               u.mfa_enabled, u.role = ANY (o.mfa_required_roles)
+        FROM staff_user u
+        JOIN organisation o ON o.id = u.org_id
+        LEFT JOIN email_change ec ON ec.user_id = u.id AND ec.expires_at > now()
+        WHERE u.id = $1`,
+		userID,
+	).Scan(
+		&profile.ID,
+		&profile.FirstName,
+		&profile.LastName,
+		&profile.Email,
+		&profile.PendingEmail,
+		&profile.Role,
+		&profile.OrgID,
+		&profile.PhoneNumber,
+		&profile.Language,
+		&profile.Timezone,
+		&profile.MFAEnabled,
+		&profile.MFARequired)
+	if err != nil {
+		return nil, err
+	}
+
+	profile.NotificationPreferences, err = h.notificationPreferences(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+// checkCurrentPassword reports whether password is the user's current one,
+// answering the request itself when it is not
+func (h *AuthHandler) checkCurrentPassword(c *gin.Context, ctx context.Context, userID int, password string) bool {
+	var hash string
+	err := h.db.QueryRow(ctx, "SELECT password FROM staff_user WHERE id = $1", userID).Scan(&hash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return false
+	}
+	if !utils.CheckPasswordHash(password, hash) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Current password is incorrect"})
+		return false
+	}
+	return true
+}
+
+// emailChangeTokenHash is what is stored for an email change token, so a
+// leaked table cannot be used to take over accounts
+func emailChangeTokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,310 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"ticket-sys/internal/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// reportGroupExprs are the ticket columns reports can group by
+var reportGroupExprs = map[string]string{
+	"status":        "task_status",
+	"priority":      "btrim(task_priority)",
+	"request_type":  "btrim(request_type)",
+	"accommodation": "accommodation_name",
+}
+
+// backlogAges are the age buckets of the backlog report, in days
+var backlogAges = []int{0, 1, 3, 7, 14, 30}
+
+// reportDefaultDays is the range reports cover when from is left out
+const reportDefaultDays = 30
+
+// Ticket counts report
+// @Summary Ticket Counts Report
+// @Description Count tickets created per day, week or month, grouped by status, priority, request type or accommodation. Buckets follow days in the organisation's timezone.
+// @ID report-ticket-counts
+// @Produce json
+// @Param from query string false "Start time or date; 30 days before to by default"
+// @Param to query string false "End time or date; now by default"
+// @Param bucket query string false "day (default), week or month"
+// @Param group_by query string false "status (default), priority, request_type or accommodation"
+// @Success 200 "Successful response"
+// @Failure 400 "Invalid input format"
+// @Failure 500 "Database error"
+// @Router /reports/ticket-counts [get]
+// @Security Bearer
+func (h *AuthHandler) GetTicketCountReport(c *gin.Context) {
+	query, from, to, ok := bindReportQuery(c, true)
+	if !ok {
+		return
+	}
+	if query.Bucket == "" {
+		query.Bucket = "day"
+	}
+	if query.GroupBy == "" {
+		query.GroupBy = "status"
+	}
+
+	org := h.organisation(context.Background(), currentOrgID(c))
+	rows, err := h.db.Query(context.Background(), `
+        SELECT to_char(date_trunc($3, creation_date AT TIME ZONE $5), 'YYYY-MM-DD'),
+               COALESCE(`+reportGroupExprs[query.GroupBy]+`, ''), count(*)
+        FROM ticket
+        WHERE deleted_at IS NULL AND org_id = $4 AND creation_date >= $1 AND creation_date < $2
+        GROUP BY 1, 2
+        ORDER BY 1, 2`,
+		from, to, query.Bucket, org.ID, org.Timezone)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	report := models.TicketCountReport{
+		From:    from.Format(time.RFC3339),
+		To:      to.Format(time.RFC3339),
+		Bucket:  query.Bucket,
+		GroupBy: query.GroupBy,
+		Counts:  []models.TicketCount{},
+	}
+	for rows.Next() {
+		var count models.TicketCount
+		if err := rows.Scan(&count.Bucket, &count.Key, &count.Count); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Process failed"})
+			return
+		}
+		report.Counts = append(report.Counts, count)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Report iteration failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// Completion times report
+// @Summary Completion Times Report
+// @Description Mean and median hours from creation to completion per technician, for tickets completed in the range
+// @ID report-completion-times
+// @Produce json
+// @Param from query string false "Start time or date; 30 days before to by default"
+// @Param to query string false "End time or date; now by default"
+// @Success 200 "Successful response"
+// @Failure 400 "Invalid input format"
+// @Failure 500 "Database error"
+// @Router /reports/completion-times [get]
+// @Security Bearer
+func (h *AuthHandler) GetCompletionTimeReport(c *gin.Context) {
+	_, from, to, ok := bindReportQuery(c, true)
+	if !ok {
+		return
+	}
+
+	rows, err := h.db.Query(context.Background(), `
+        SELECT u.id, u.first_name || ' ' || u.last_name, count(*),
+               (avg(EXTRACT(EPOCH FROM t.completion_date - t.creation_date)) / 3600)::float8,
+               percentile_cont(0.5) WITHIN GROUP (ORDER BY EXTRACT(EPOCH FROM t.completion_date - t.creation_date)) / 3600
+        FROM ticket t
+        JOIN staff_user u ON u.id = t.assigned_to
+        WHERE t.deleted_at IS NULL AND t.org_id = $3 AND t.completion_date >= $1 AND t.completion_date < $2
+        GROUP BY u.id, u.first_name, u.last_name
+        ORDER BY u.first_name, u.last_name`,
+		from, to, currentOrgID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	technicians := []models.TechnicianCompletion{}
+	for rows.Next() {
+		var technician models.TechnicianCompletion
+		if err := rows.Scan(&technician.UserID, &technician.Name, &technician.Completed, &technician.MeanHours, &technician.MedianHours); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Process failed"})
+			return
+		}
+		technicians = append(technicians, technician)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Report iteration failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"from":        from.Format(time.RFC3339),
+		"to":          to.Format(time.RFC3339),
+		"technicians": technicians,
+	})
+}
+
+// SLA breach report
+// @Summary SLA Breach Report
+// @Description Share of tickets created in the range that missed their response or resolution target, overall and per priority. Tickets without an SLA are left out.
+// @ID report-sla-breaches
+// @Produce json
+// @Param from query string false "Start time or date; 30 days before to by default"
+// @Param to query string false "End time or date; now by default"
+// @Success 200 "Successful response"
+// @Failure 400 "Invalid input format"
+// @Failure 500 "Database error"
+// @Router /reports/sla-breaches [get]
+// @Security Bearer
+func (h *AuthHandler) GetSLABreachReport(c *gin.Context) {
+	_, from, to, ok := bindReportQuery(c, true)
+	if !ok {
+		return
+	}
+
+	// The empty-set grouping row carries the overall figures
+	rows, err := h.db.Query(context.Background(), `
+        SELECT btrim(task_priority), GROUPING(btrim(task_priority)) = 1,
+               count(*), count(*) FILTER (WHERE `+ticketBreachedExpr+`)
+        FROM ticket
+        WHERE deleted_at IS NULL AND org_id = $3 AND creation_date >= $1 AND creation_date < $2
+          AND (due_at IS NOT NULL OR response_due_at IS NOT NULL)
+        GROUP BY ROLLUP (btrim(task_priority))
+        ORDER BY 2, 1`,
+		from, to, currentOrgID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	report := models.SLABreachReport{
+		From:       from.Format(time.RFC3339),
+		To:         to.Format(time.RFC3339),
+		ByPriority: []models.SLABreachRate{},
+	}
+	for rows.Next() {
+		var priority *string
+		var overall bool
+		var rate models.SLABreachRate
+		if err := rows.Scan(&priority, &overall, &rate.Total, &rate.Breached); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Process failed"})
+			return
+		}
+		if rate.Total > 0 {
+			rate.BreachRate = float64(rate.Breached) / float64(rate.Total)
+		}
+		if overall {
+			report.Overall = rate
+			continue
+		}
+		if priority != nil {
+			rate.Priority = *priority
+		}
+		report.ByPriority = append(report.ByPriority, rate)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Report iteration failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// Backlog age report
+// @Summary Backlog Age Report
+// @Description Count open tickets by how many days ago they were created. from and to, when given, limit it to tickets created in that range.
+// @ID report-backlog-age
+// @Produce json
+// @Param from query string false "Start time or date"
+// @Param to query string false "End time or date"
+// @Success 200 "Successful response"
+// @Failure 400 "Invalid input format"
+// @Failure 500 "Database error"
+// @Router /reports/backlog-age [get]
+// @Security Bearer
+func (h *AuthHandler) GetBacklogAgeReport(c *gin.Context) {
+	_, from, to, ok := bindReportQuery(c, false)
+	if !ok {
+		return
+	}
+
+	// width_bucket numbers the buckets from 1; ages past the last bound
+	// land in the final, open-ended one
+	rows, err := h.db.Query(context.Background(), `
+        SELECT width_bucket(EXTRACT(EPOCH FROM now() - creation_date)::float8 / 86400, $3::int[]::float8[]), count(*)
+        FROM ticket
+        WHERE deleted_at IS NULL AND org_id = $4 AND task_status <> 'Completed'
+          AND creation_date >= $1 AND creation_date < $2
+        GROUP BY 1`,
+		from, to, backlogAges, currentOrgID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	ages := make([]models.BacklogAge, len(backlogAges))
+	for i, minDays := range backlogAges {
+		ages[i] = models.BacklogAge{MinDays: minDays}
+		if i+1 < len(backlogAges) {
+			maxDays := backlogAges[i+1]
+			ages[i].MaxDays = &maxDays
+			ages[i].Label = strconv.Itoa(minDays) + "-" + strconv.Itoa(maxDays) + " days"
+		} else {
+			ages[i].Label = strconv.Itoa(minDays) + "+ days"
+		}
+	}
+	for rows.Next() {
+		var bucket, count int
+		if err := rows.Scan(&bucket, &count); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Process failed"})
+			return
+		}
+		if bucket >= 1 && bucket <= len(ages) {
+			ages[bucket-1].Count += count
+		}
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Report iteration failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, ages)
+}
+
+// bindReportQuery reads the report query parameters and resolves the date
+// range, answering 400 itself when they are unusable. Without from, the
+// range starts reportDefaultDays before to when defaultFrom is set, or
+// covers all time otherwise.
+func bindReportQuery(c *gin.Context, defaultFrom bool) (models.ReportQuery, time.Time, time.Time, bool) {
+	var query models.ReportQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input format", "details": err.Error()})
+		return query, time.Time{}, time.Time{}, false
+	}
+
+	to := time.Now()
+	if parsed, err := parseFilterDate(query.To); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid to: " + err.Error()})
+		return query, time.Time{}, time.Time{}, false
+	} else if parsed != nil {
+		to = *parsed
+	}
+
+	from := time.Unix(0, 0)
+	if defaultFrom {
+		from = to.AddDate(0, 0, -reportDefaultDays)
+	}
+	if parsed, err := parseFilterDate(query.From); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from: " + err.Error()})
+		return query, time.Time{}, time.Time{}, false
+	} else if parsed != nil {
+		from = *parsed
+	}
+
+	if !from.Before(to) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to"})
+		return query, time.Time{}, time.Time{}, false
+	}
+	return query, from, to, true
+}
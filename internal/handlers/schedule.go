@@ -0,0 +1,464 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"ticket-sys/internal/models"
+	"ticket-sys/internal/recurrence"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/jackc/pgx/v5"
+)
+
+var errInvalidSchedule = errors.New("invalid schedule")
+
+// scheduleColumns is the ticket_schedule column list read by scanSchedule
+const scheduleColumns = `id, name, recurrence, timezone, starts_at::text, template, assigned_to, active, next_run_at::text, last_run_at::text, last_ticket_id, created_date::text`
+
+// Create ticket schedule
+// @Summary Create Ticket Schedule
+// @Description Create a recurring ticket schedule
+// @ID create-ticket-schedule
+// @Produce json
+// @Success 201 "Successful response"
+// @Failure 400 "Invalid input format"
+// @Router /schedules [post]
+// @Security Bearer
+func (h *AuthHandler) CreateTicketSchedule(c *gin.Context) {
+	var schedule models.TicketScheduleCreate
+
+	if err := c.ShouldBindJSON(&schedule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid input format",
+			"details": err.Error(),
+		})
+		return
+	}
+	if schedule.Timezone == "" {
+		schedule.Timezone = h.organisation(context.Background(), currentOrgID(c)).Timezone
+	}
+	startsAt := time.Now()
+	if schedule.StartsAt != nil {
+		startsAt = *schedule.StartsAt
+	}
+	active := schedule.Active == nil || *schedule.Active
+
+	template, nextRun, err := h.prepareSchedule(context.Background(), currentOrgID(c), schedule.Recurrence, schedule.Timezone, startsAt, schedule.Template, schedule.AssignedTo)
+	if errors.Is(err, errInvalidSchedule) || errors.Is(err, errInvalidCatalog) || errors.Is(err, errInvalidAccommodation) || errors.Is(err, errOtherOrganisation) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	var created models.TicketSchedule
+	err = scanSchedule(h.db.QueryRow(context.Background(), `
+        INSERT INTO ticket_schedule (name, recurrence, timezone, starts_at, template, assigned_to, active, next_run_at, org_id)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+        RETURNING `+scheduleColumns,
+		strings.TrimSpace(schedule.Name),
+		strings.TrimSpace(schedule.Recurrence),
+		schedule.Timezone,
+		startsAt,
+		template,
+		schedule.AssignedTo,
+		active,
+		nextRun,
+		currentOrgID(c),
+	), &created)
+
+	if isForeignKeyViolation(err) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Assignee not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Schedule creation failed"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, created)
+}
+
+// Get ticket schedules
+// @Summary Get Ticket Schedules
+// @Description List all recurring ticket schedules
+// @ID get-ticket-schedules
+// @Produce json
+// @Success 200 "Successful response"
+// @Failure 500 "Database error"
+// @Router /schedules [get]
+// @Security Bearer
+func (h *AuthHandler) GetTicketSchedules(c *gin.Context) {
+	schedules := []models.TicketSchedule{}
+
+	rows, err := h.db.Query(context.Background(), "SELECT "+scheduleColumns+" FROM ticket_schedule WHERE org_id = $1 ORDER BY name", currentOrgID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	for rows.Next() {
+		var schedule models.TicketSchedule
+		if err := scanSchedule(rows, &schedule); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Process failed"})
+			return
+		}
+		schedules = append(schedules, schedule)
+	}
+
+	if err = rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Schedule iteration failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, schedules)
+}
+
+// Get ticket schedule
+// @Summary Get Ticket Schedule
+// @Description Get single recurring ticket schedule
+// @ID get-ticket-schedule
+// @Produce json
+// @Param id path int true "Schedule ID"
+// @Success 200 "Successful response"
+// @Failure 400 "Invalid schedule ID"
+// @Failure 404 "Schedule not found"
+// @Router /schedules/{id} [get]
+// @Security Bearer
+func (h *AuthHandler) GetTicketSchedule(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid schedule ID"})
+		return
+	}
+
+	var schedule models.TicketSchedule
+	err = scanSchedule(h.db.QueryRow(context.Background(), "SELECT "+scheduleColumns+" FROM ticket_schedule WHERE id = $1 AND org_id = $2", id, currentOrgID(c)), &schedule)
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Schedule not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, schedule)
+}
+
+// Update ticket schedule
+// @Summary Update Ticket Schedule
+// @Description Update a recurring ticket schedule
+// @ID update-ticket-schedule
+// @Produce json
+// @Param id path int true "Schedule ID"
+// @Success 200 "Successful response"
+// @Failure 400 "Invalid schedule data"
+// @Failure 404 "Schedule not found"
+// @Router /schedules/{id} [patch]
+// @Security Bearer
+func (h *AuthHandler) UpdateTicketSchedule(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid schedule ID"})
+		return
+	}
+
+	var update models.TicketScheduleUpdate
+	if err := c.ShouldBindJSON(&update); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid schedule data"})
+		return
+	}
+
+	var current models.TicketSchedule
+	var startsAt time.Time
+	err = h.db.QueryRow(context.Background(), `
+        SELECT name, recurrence, timezone, starts_at, template, assigned_to, active
+        FROM ticket_schedule
+        WHERE id = $1 AND org_id = $2`,
+		id, currentOrgID(c),
+	).Scan(
+		&current.Name,
+		&current.Recurrence,
+		&current.Timezone,
+		&startsAt,
+		&current.Template,
+		&current.AssignedTo,
+		&current.Active)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Schedule not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if update.Name != nil {
+		current.Name = strings.TrimSpace(*update.Name)
+	}
+	if update.Recurrence != nil {
+		current.Recurrence = strings.TrimSpace(*update.Recurrence)
+	}
+	if update.Timezone != nil {
+		current.Timezone = *update.Timezone
+	}
+	if update.StartsAt != nil {
+		startsAt = *update.StartsAt
+	}
+	if len(update.Template) != 0 {
+		current.Template = update.Template
+	}
+	if update.AssignedTo != nil {
+		current.AssignedTo = *update.AssignedTo
+	}
+	if update.Active != nil {
+		current.Active = *update.Active
+	}
+
+	template, nextRun, err := h.prepareSchedule(context.Background(), currentOrgID(c), current.Recurrence, current.Timezone, startsAt, current.Template, current.AssignedTo)
+	if errors.Is(err, errInvalidSchedule) || errors.Is(err, errInvalidCatalog) || errors.Is(err, errInvalidAccommodation) || errors.Is(err, errOtherOrganisation) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	var updated models.TicketSchedule
+	err = scanSchedule(h.db.QueryRow(context.Background(), `
+        UPDATE ticket_schedule
+        SET name = $2, recurrence = $3, timezone = $4, starts_at = $5, template = $6,
+            assigned_to = $7, active = $8, next_run_at = $9
+        WHERE id = $1 AND org_id = $10
+        RETURNING `+scheduleColumns,
+		id,
+		current.Name,
+		current.Recurrence,
+		current.Timezone,
+		startsAt,
+		template,
+		current.AssignedTo,
+		current.Active,
+		nextRun,
+		currentOrgID(c),
+	), &updated)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Schedule not found"})
+		return
+	}
+	if isForeignKeyViolation(err) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Assignee not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, updated)
+}
+
+// Delete ticket schedule
+// @Summary Delete Ticket Schedule
+// @Description Delete a recurring ticket schedule; generated tickets are kept
+// @ID delete-ticket-schedule
+// @Produce json
+// @Param id path int true "Schedule ID"
+// @Success 200 "Successful response"
+// @Failure 400 "Invalid schedule ID"
+// @Failure 404 "Schedule not found"
+// @Router /schedules/{id} [delete]
+// @Security Bearer
+func (h *AuthHandler) DeleteTicketSchedule(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid schedule ID"})
+		return
+	}
+
+	result, err := h.db.Exec(context.Background(), "DELETE FROM ticket_schedule WHERE id = $1 AND org_id = $2", id, currentOrgID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if result.RowsAffected() == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Schedule not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"id": id})
+}
+
+// scanSchedule scans a row selected with scheduleColumns into schedule
+func scanSchedule(row pgx.Row, schedule *models.TicketSchedule) error {
+	return row.Scan(
+		&schedule.ID,
+		&schedule.Name,
+		&schedule.Recurrence,
+		&schedule.Timezone,
+		&schedule.StartsAt,
+		&schedule.Template,
+		&schedule.AssignedTo,
+		&schedule.Active,
+		&schedule.NextRunAt,
+		&schedule.LastRunAt,
+		&schedule.LastTicketID,
+		&schedule.CreatedDate)
+}
+
+// prepareSchedule validates the recurrence and ticket template of a
+// schedule of orgID. It returns the normalised template and the first run
+// after now.
+func (h *AuthHandler) prepareSchedule(ctx context.Context, orgID int, expr, timezone string, startsAt time.Time, template json.RawMessage, assignedTo int) ([]byte, time.Time, error) {
+	nextRun, err := nextScheduleRun(expr, timezone, startsAt, time.Now())
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	var ticket models.TicketCreate
+	if err := json.Unmarshal(template, &ticket); err != nil {
+		return nil, time.Time{}, fmt.Errorf("%w: template: %v", errInvalidSchedule, err)
+	}
+	ticket.AssignedTo = assignedTo
+	ticket.OrgID = orgID
+	if err := binding.Validator.ValidateStruct(&ticket); err != nil {
+		return nil, time.Time{}, fmt.Errorf("%w: template: %v", errInvalidSchedule, err)
+	}
+	if err := checkOrgUsers(ctx, h.db, orgID, assignedTo); err != nil {
+		return nil, time.Time{}, fmt.Errorf("%w: assigned_to", err)
+	}
+	if err := h.validateCatalogValues(ctx, &ticket.RequestType, &ticket.TaskPriority); err != nil {
+		return nil, time.Time{}, err
+	}
+	if err := h.resolveTicketAccommodation(ctx, &ticket); err != nil {
+		return nil, time.Time{}, err
+	}
+
+	normalised, err := json.Marshal(ticket)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return normalised, nextRun, nil
+}
+
+// nextScheduleRun returns the first occurrence of a schedule after t
+func nextScheduleRun(expr, timezone string, startsAt, t time.Time) (time.Time, error) {
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: unknown timezone %q", errInvalidSchedule, timezone)
+	}
+
+	schedule, err := recurrence.Parse(expr, startsAt, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %v", errInvalidSchedule, err)
+	}
+
+	next := schedule.Next(t)
+	if next.IsZero() {
+		return time.Time{}, fmt.Errorf("%w: recurrence has no future occurrences", errInvalidSchedule)
+	}
+	return next, nil
+}
+
+// generateScheduledTickets creates the tickets of every schedule that is
+// due. An occurrence is skipped while the schedule's previous ticket is
+// still open, so a backlog of identical jobs never builds up.
+func (h *AuthHandler) generateScheduledTickets(ctx context.Context) error {
+	type dueSchedule struct {
+		id         int
+		recurrence string
+		timezone   string
+		startsAt   time.Time
+		template   []byte
+		assignedTo int
+		orgID      int
+	}
+	var due []dueSchedule
+
+	rows, err := h.db.Query(ctx, `
+        SELECT id, recurrence, timezone, starts_at, template, assigned_to, org_id
+        FROM ticket_schedule
+        WHERE active AND next_run_at <= now()
+        ORDER BY next_run_at`)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var s dueSchedule
+		if err := rows.Scan(&s.id, &s.recurrence, &s.timezone, &s.startsAt, &s.template, &s.assignedTo, &s.orgID); err != nil {
+			rows.Close()
+			return err
+		}
+		due = append(due, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, s := range due {
+		// A schedule that can no longer run is parked rather than retried
+		var nextRun *time.Time
+		if next, err := nextScheduleRun(s.recurrence, s.timezone, s.startsAt, time.Now()); err != nil {
+			log.Printf("schedule %d has no next run: %v", s.id, err)
+		} else {
+			nextRun = &next
+		}
+
+		var open bool
+		err := h.db.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM ticket WHERE schedule_id = $1 AND task_status <> 'Completed' AND deleted_at IS NULL)", s.id).Scan(&open)
+		if err != nil {
+			return err
+		}
+		if open {
+			log.Printf("schedule %d skipped: previous ticket still open", s.id)
+			if _, err := h.db.Exec(ctx, "UPDATE ticket_schedule SET next_run_at = $2 WHERE id = $1", s.id, nextRun); err != nil {
+				return err
+			}
+			continue
+		}
+
+		var ticket models.TicketCreate
+		var ticketID *int
+		if err := json.Unmarshal(s.template, &ticket); err != nil {
+			log.Printf("schedule %d has an invalid template: %v", s.id, err)
+		} else {
+			ticket.AssignedTo = s.assignedTo
+			ticket.ScheduleID = &s.id
+			ticket.OrgID = s.orgID
+
+			id, err := h.createTicket(ctx, &ticket)
+			if id != 0 {
+				ticketID = &id
+			}
+			if err != nil {
+				log.Printf("schedule %d ticket creation: %v", s.id, err)
+			}
+		}
+
+		_, err = h.db.Exec(ctx, `
+            UPDATE ticket_schedule
+            SET next_run_at = $2, last_run_at = now(), last_ticket_id = COALESCE($3, last_ticket_id)
+            WHERE id = $1`,
+			s.id, nextRun, ticketID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
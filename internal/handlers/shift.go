@@ -0,0 +1,440 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"ticket-sys/internal/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+var errShiftOverlap = errors.New("shift overlaps another shift of the same user")
+
+const staffShiftColumns = `sh.id, sh.user_id, u.first_name || ' ' || u.last_name, sh.starts_at::text, sh.ends_at::text, sh.on_call, sh.accommodation_id, sh.note, sh.created_date::text`
+
+const staffShiftFrom = `staff_shift sh JOIN staff_user u ON u.id = sh.user_id`
+
+// staffOnDutySQL is a condition that holds when the user in userExpr is on
+// duty at atExpr: during one of their shifts, or always when they have
+// none and so are not on a rotation. Deactivated users are never on duty.
+func staffOnDutySQL(userExpr, atExpr string) string {
+	return `(EXISTS (SELECT 1 FROM staff_user a WHERE a.id = ` + userExpr + ` AND a.active)
+        AND (NOT EXISTS (SELECT 1 FROM staff_shift d WHERE d.user_id = ` + userExpr + `)
+            OR EXISTS (SELECT 1 FROM staff_shift d WHERE d.user_id = ` + userExpr + ` AND d.starts_at <= ` + atExpr + ` AND d.ends_at > ` + atExpr + `)))`
+}
+
+// Get staff shifts
+// @Summary Get Staff Shifts
+// @Description List shifts overlapping a time range, by start time
+// @ID get-staff-shifts
+// @Produce json
+// @Param from query string false "Start time or date; now by default"
+// @Param to query string false "End time or date; 7 days after from by default"
+// @Param user_id query int false "Only this user's shifts"
+// @Success 200 "Successful response"
+// @Failure 400 "Invalid input format"
+// @Failure 500 "Database error"
+// @Router /shifts [get]
+// @Security Bearer
+func (h *AuthHandler) GetStaffShifts(c *gin.Context) {
+	from := time.Now()
+	if parsed, err := parseFilterDate(c.Query("from")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from: " + err.Error()})
+		return
+	} else if parsed != nil {
+		from = *parsed
+	}
+	to := from.AddDate(0, 0, 7)
+	if parsed, err := parseFilterDate(c.Query("to")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid to: " + err.Error()})
+		return
+	} else if parsed != nil {
+		to = *parsed
+	}
+
+	var userID *int
+	if value := c.Query("user_id"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+			return
+		}
+		userID = &id
+	}
+
+	rows, err := h.db.Query(context.Background(), `
+        SELECT `+staffShiftColumns+`
+        FROM `+staffShiftFrom+`
+        WHERE u.org_id = $4 AND sh.starts_at < $2 AND sh.ends_at > $1 AND ($3::int IS NULL OR sh.user_id = $3)
+        ORDER BY sh.starts_at, sh.id`,
+		from, to, userID, currentOrgID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	shifts := []models.StaffShift{}
+	for rows.Next() {
+		var shift models.StaffShift
+		if err := scanStaffShift(rows, &shift); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Process failed"})
+			return
+		}
+		shifts = append(shifts, shift)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Shift iteration failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, shifts)
+}
+
+// Get current shifts
+// @Summary Get Current Shifts
+// @Description List the shifts under way now, including who is on call
+// @ID get-current-shifts
+// @Produce json
+// @Success 200 "Successful response"
+// @Failure 500 "Database error"
+// @Router /shifts/current [get]
+// @Security Bearer
+func (h *AuthHandler) GetCurrentShifts(c *gin.Context) {
+	rows, err := h.db.Query(context.Background(), `
+        SELECT `+staffShiftColumns+`
+        FROM `+staffShiftFrom+`
+        WHERE u.org_id = $1 AND sh.starts_at <= now() AND sh.ends_at > now()
+        ORDER BY sh.on_call DESC, sh.starts_at, sh.id`, currentOrgID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	shifts := []models.StaffShift{}
+	for rows.Next() {
+		var shift models.StaffShift
+		if err := scanStaffShift(rows, &shift); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Process failed"})
+			return
+		}
+		shifts = append(shifts, shift)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Shift iteration failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, shifts)
+}
+
+// Create staff shift
+// @Summary Create Staff Shift
+// @Description Schedule a shift, optionally on call. A user's shifts may not overlap.
+// @ID create-staff-shift
+// @Produce json
+// @Success 201 "Successful response"
+// @Failure 400 "Invalid input format"
+// @Failure 409 "Shift overlaps another shift"
+// @Router /shifts [post]
+// @Security Bearer
+func (h *AuthHandler) CreateStaffShift(c *gin.Context) {
+	var input models.StaffShiftCreate
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid input format",
+			"details": err.Error(),
+		})
+		return
+	}
+	if !input.EndsAt.After(input.StartsAt) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ends_at must be after starts_at"})
+		return
+	}
+
+	ctx := context.Background()
+	err := checkOrgUsers(ctx, h.db, currentOrgID(c), input.UserID)
+	if err == nil {
+		err = checkOrgAccommodation(ctx, h.db, currentOrgID(c), input.AccommodationID)
+	}
+	if errors.Is(err, errOtherOrganisation) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "User or accommodation not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if err := h.checkShiftOverlap(ctx, 0, input.UserID, input.StartsAt, input.EndsAt); err != nil {
+		if errors.Is(err, errShiftOverlap) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	var id int
+	err = h.db.QueryRow(ctx, `
+        INSERT INTO staff_shift (user_id, starts_at, ends_at, on_call, accommodation_id, note)
+        VALUES ($1, $2, $3, $4, $5, $6)
+        RETURNING id`,
+		input.UserID, input.StartsAt, input.EndsAt, input.OnCall, input.AccommodationID, input.Note,
+	).Scan(&id)
+	if isForeignKeyViolation(err) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "User or accommodation not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Shift creation failed"})
+		return
+	}
+
+	var shift models.StaffShift
+	if err := scanStaffShift(h.db.QueryRow(ctx, "SELECT "+staffShiftColumns+" FROM "+staffShiftFrom+" WHERE sh.id = $1", id), &shift); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, shift)
+}
+
+// Update staff shift
+// @Summary Update Staff Shift
+// @Description Update a shift
+// @ID update-staff-shift
+// @Produce json
+// @Param id path int true "Shift ID"
+// @Success 200 "Successful response"
+// @Failure 400 "Invalid shift data"
+// @Failure 404 "Shift not found"
+// @Failure 409 "Shift overlaps another shift"
+// @Router /shifts/{id} [patch]
+// @Security Bearer
+func (h *AuthHandler) UpdateStaffShift(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid shift ID"})
+		return
+	}
+
+	var update models.StaffShiftUpdate
+	if err := c.ShouldBindJSON(&update); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid shift data", "details": err.Error()})
+		return
+	}
+
+	ctx := context.Background()
+	var userID int
+	var startsAt, endsAt time.Time
+	var onCall bool
+	var accommodationID *int
+	var note string
+	err = h.db.QueryRow(ctx, "SELECT sh.user_id, sh.starts_at, sh.ends_at, sh.on_call, sh.accommodation_id, sh.note FROM "+staffShiftFrom+" WHERE sh.id = $1 AND u.org_id = $2", id, currentOrgID(c)).
+		Scan(&userID, &startsAt, &endsAt, &onCall, &accommodationID, &note)
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Shift not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if update.StartsAt != nil {
+		startsAt = *update.StartsAt
+	}
+	if update.EndsAt != nil {
+		endsAt = *update.EndsAt
+	}
+	if update.OnCall != nil {
+		onCall = *update.OnCall
+	}
+	if update.AccommodationID != nil {
+		accommodationID = update.AccommodationID
+		if *update.AccommodationID == 0 {
+			accommodationID = nil
+		}
+		if err := checkOrgAccommodation(ctx, h.db, currentOrgID(c), accommodationID); err != nil {
+			if errors.Is(err, errOtherOrganisation) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Accommodation not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+	}
+	if update.Note != nil {
+		note = *update.Note
+	}
+	if !endsAt.After(startsAt) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ends_at must be after starts_at"})
+		return
+	}
+	if err := h.checkShiftOverlap(ctx, id, userID, startsAt, endsAt); err != nil {
+		if errors.Is(err, errShiftOverlap) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	_, err = h.db.Exec(ctx, `
+        UPDATE staff_shift
+        SET starts_at = $2, ends_at = $3, on_call = $4, accommodation_id = $5, note = $6
+        WHERE id = $1 AND user_id IN (SELECT id FROM staff_user WHERE org_id = $7)`,
+		id, startsAt, endsAt, onCall, accommodationID, note, currentOrgID(c))
+	if isForeignKeyViolation(err) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Accommodation not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	var shift models.StaffShift
+	if err := scanStaffShift(h.db.QueryRow(ctx, "SELECT "+staffShiftColumns+" FROM "+staffShiftFrom+" WHERE sh.id = $1", id), &shift); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, shift)
+}
+
+// Delete staff shift
+// @Summary Delete Staff Shift
+// @Description Delete a shift
+// @ID delete-staff-shift
+// @Produce json
+// @Param id path int true "Shift ID"
+// @Success 200 "Successful response"
+// @Failure 400 "Invalid shift ID"
+// @Failure 404 "Shift not found"
+// @Router /shifts/{id} [delete]
+// @Security Bearer
+func (h *AuthHandler) DeleteStaffShift(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid shift ID"})
+		return
+	}
+
+	result, err := h.db.Exec(context.Background(), "DELETE FROM staff_shift WHERE id = $1 AND user_id IN (SELECT id FROM staff_user WHERE org_id = $2)", id, currentOrgID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if result.RowsAffected() == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Shift not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"id": id})
+}
+
+// checkShiftOverlap fails with errShiftOverlap when a user already has a
+// shift, other than id, overlapping the given times
+func (h *AuthHandler) checkShiftOverlap(ctx context.Context, id, userID int, startsAt, endsAt time.Time) error {
+	var overlaps bool
+	err := h.db.QueryRow(ctx, `
+        SELECT EXISTS (
+            SELECT 1 FROM staff_shift
+            WHERE user_id = $1 AND id <> $2 AND starts_at < $4 AND ends_at > $3)`,
+		userID, id, startsAt, endsAt).Scan(&overlaps)
+	if err != nil {
+		return err
+	}
+	if overlaps {
+		return errShiftOverlap
+	}
+	return nil
+}
+
+// onCallStaff returns who of orgID is on call at a time, preferring a
+// shift for the given accommodation, then one covering every
+// accommodation. It returns 0 when nobody is on call.
+func onCallStaff(ctx context.Context, db dbExecutor, orgID int, accommodationID *int, at time.Time) (int, error) {
+	var userID int
+	err := db.QueryRow(ctx, `
+        SELECT sh.user_id
+        FROM `+staffShiftFrom+`
+        WHERE u.org_id = $3 AND u.active AND sh.on_call AND sh.starts_at <= $2 AND sh.ends_at > $2
+        ORDER BY sh.accommodation_id IS NOT DISTINCT FROM $1 DESC, sh.accommodation_id IS NULL DESC, sh.starts_at, sh.id
+        LIMIT 1`,
+		accommodationID, at, orgID).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
+	return userID, err
+}
+
+// pageOnCall emails whoever is on call about a ticket unless they are
+// among skip, returning who was paged (0 for nobody). Mail failures are
+// logged.
+func (h *AuthHandler) pageOnCall(ctx context.Context, ticket *models.Ticket, subject, heading string, skip ...int) int {
+	userID, err := onCallStaff(ctx, h.db, ticket.OrgID, ticket.AccommodationID, time.Now())
+	if err != nil {
+		log.Printf("on-call lookup for ticket #%d: %v", ticket.ID, err)
+		return 0
+	}
+	if userID == 0 {
+		return 0
+	}
+	for _, id := range skip {
+		if id == userID {
+			return 0
+		}
+	}
+
+	_, email, err := h.userContact(ctx, userID)
+	if err != nil {
+		log.Printf("on-call lookup for ticket #%d: %v", ticket.ID, err)
+		return 0
+	}
+	assigneeName, _, _ := h.userContact(ctx, ticket.AssignedTo)
+	org := h.organisation(ctx, ticket.OrgID)
+	body := ticketMailBody(org, heading, "You are receiving this because you are on call.", ticket, assigneeName)
+	if err := sendMail(org, []string{email}, subject, body); err != nil {
+		log.Printf("on-call page for ticket #%d: %v", ticket.ID, fmt.Errorf("%w: %v", errMailer, err))
+	}
+	return userID
+}
+
+// ticketPriorityUrgent reports whether a priority is flagged urgent in the
+// catalog
+func ticketPriorityUrgent(ctx context.Context, db dbExecutor, priority string) (bool, error) {
+	var urgent bool
+	err := db.QueryRow(ctx, "SELECT COALESCE(bool_or(urgent), false) FROM task_priority WHERE lower(btrim(name)) = lower(btrim($1))", priority).Scan(&urgent)
+	return urgent, err
+}
+
+// staffOnDuty reports whether a user is on duty at a time
+func staffOnDuty(ctx context.Context, db dbExecutor, userID int, at time.Time) (bool, error) {
+	var onDuty bool
+	err := db.QueryRow(ctx, "SELECT "+staffOnDutySQL("$1", "$2"), userID, at).Scan(&onDuty)
+	return onDuty, err
+}
+
+func scanStaffShift(row pgx.Row, shift *models.StaffShift) error {
+	return row.Scan(
+		&shift.ID,
+		&shift.UserID,
+		&shift.UserName,
+		&shift.StartsAt,
+		&shift.EndsAt,
+		&shift.OnCall,
+		&shift.AccommodationID,
+		&shift.Note,
+		&shift.CreatedDate,
+	)
+}
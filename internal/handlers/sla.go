@@ -0,0 +1,463 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"strconv"
+	"ticket-sys/internal/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// alertLevelBreached is the ticket.alert_level of a missed deadline; level 1
+// means a deadline is approaching and 0 that the ticket is on track
+const alertLevelBreached = 2
+
+// ticketBreachedExpr reports whether a ticket missed its response or
+// resolution target, whether or not it is still open
+const ticketBreachedExpr = `(COALESCE(COALESCE(completion_date, now()) > due_at, false) OR COALESCE(COALESCE(responded_at, now()) > response_due_at, false))`
+
+// Get SLA policies
+// @Summary Get SLA Policies
+// @Description List the SLA policy of every priority
+// @ID get-sla-policies
+// @Produce json
+// @Success 200 "Successful response"
+// @Failure 500 "Database error"
+// @Router /sla-policies [get]
+// @Security Bearer
+func (h *AuthHandler) GetSLAPolicies(c *gin.Context) {
+	policies := []models.SLAPolicy{}
+
+	rows, err := h.db.Query(context.Background(), `
+        SELECT sp.id, sp.priority_id, p.name, sp.response_minutes, sp.resolution_minutes, sp.warning_percent
+        FROM sla_policy sp
+        JOIN task_priority p ON p.id = sp.priority_id
+        ORDER BY p.sort_order, p.name`)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	for rows.Next() {
+		var policy models.SLAPolicy
+
+		err := rows.Scan(
+			&policy.ID,
+			&policy.PriorityID,
+			&policy.Priority,
+			&policy.ResponseMinutes,
+			&policy.ResolutionMinutes,
+			&policy.WarningPercent)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Process failed"})
+			return
+		}
+
+		policies = append(policies, policy)
+	}
+
+	if err = rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "SLA policy iteration failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, policies)
+}
+
+// Set SLA policy
+// @Summary Set SLA Policy
+// @Description Create or replace the SLA policy of a priority; open tickets get new deadlines
+// @ID set-sla-policy
+// @Produce json
+// @Param priority_id path int true "Priority ID"
+// @Success 200 "Successful response"
+// @Failure 400 "Invalid input format"
+// @Failure 404 "Priority not found"
+// @Router /sla-policies/{priority_id} [put]
+// @Security Bearer
+func (h *AuthHandler) SetSLAPolicy(c *gin.Context) {
+	priorityID, err := strconv.Atoi(c.Param("priority_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid priority ID"})
+		return
+	}
+
+	var upsert models.SLAPolicyUpsert
+	if err := c.ShouldBindJSON(&upsert); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid input format",
+			"details": err.Error(),
+		})
+		return
+	}
+	if upsert.WarningPercent == 0 {
+		upsert.WarningPercent = 75
+	}
+
+	tx, err := h.db.Begin(context.Background())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction start failed"})
+		return
+	}
+
+	policy := models.SLAPolicy{PriorityID: priorityID}
+	err = tx.QueryRow(context.Background(), `
+        INSERT INTO sla_policy (priority_id, response_minutes, resolution_minutes, warning_percent)
+        VALUES ($1, $2, $3, $4)
+        ON CONFLICT (priority_id) DO UPDATE
+        SET response_minutes = EXCLUDED.response_minutes,
+            resolution_minutes = EXCLUDED.resolution_minutes,
+            warning_percent = EXCLUDED.warning_percent
+        RETURNING id, response_minutes, resolution_minutes, warning_percent,
+                  (SELECT name FROM task_priority WHERE id = $1)`,
+		priorityID, upsert.ResponseMinutes, upsert.ResolutionMinutes, upsert.WarningPercent,
+	).Scan(
+		&policy.ID,
+		&policy.ResponseMinutes,
+		&policy.ResolutionMinutes,
+		&policy.WarningPercent,
+		&policy.Priority)
+
+	if err == nil {
+		err = applySLAToPriority(context.Background(), tx, policy.Priority)
+	}
+
+	if isForeignKeyViolation(err) {
+		tx.Rollback(context.Background())
+		c.JSON(http.StatusNotFound, gin.H{"error": "Priority not found"})
+		return
+	}
+	if err != nil {
+		tx.Rollback(context.Background())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction commit failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, policy)
+}
+
+// Delete SLA policy
+// @Summary Delete SLA Policy
+// @Description Remove the SLA policy of a priority; the catalog default SLA applies again
+// @ID delete-sla-policy
+// @Produce json
+// @Param priority_id path int true "Priority ID"
+// @Success 200 "Successful response"
+// @Failure 400 "Invalid priority ID"
+// @Failure 404 "SLA policy not found"
+// @Router /sla-policies/{priority_id} [delete]
+// @Security Bearer
+func (h *AuthHandler) DeleteSLAPolicy(c *gin.Context) {
+	priorityID, err := strconv.Atoi(c.Param("priority_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid priority ID"})
+		return
+	}
+
+	tx, err := h.db.Begin(context.Background())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction start failed"})
+		return
+	}
+
+	var priority string
+	err = tx.QueryRow(context.Background(), `
+        DELETE FROM sla_policy sp
+        USING task_priority p
+        WHERE p.id = sp.priority_id AND sp.priority_id = $1
+        RETURNING p.name`,
+		priorityID,
+	).Scan(&priority)
+
+	if err == nil {
+		err = applySLAToPriority(context.Background(), tx, priority)
+	}
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		tx.Rollback(context.Background())
+		c.JSON(http.StatusNotFound, gin.H{"error": "SLA policy not found"})
+		return
+	}
+	if err != nil {
+		tx.Rollback(context.Background())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction commit failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"priority_id": priorityID})
+}
+
+// Set user supervisor
+// @Summary Set User Supervisor
+// @Description Set who receives a user's SLA breach escalations
+// @ID set-user-supervisor
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 "Successful response"
+// @Failure 400 "Invalid user ID"
+// @Failure 404 "User not found"
+// @Router /users/{id}/supervisor [put]
+// @Security Bearer
+func (h *AuthHandler) SetUserSupervisor(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid User ID"})
+		return
+	}
+
+	var update models.SupervisorUpdate
+	if err := c.ShouldBindJSON(&update); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid supervisor data"})
+		return
+	}
+	if update.SupervisorID != nil && *update.SupervisorID == id {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A user cannot supervise themselves"})
+		return
+	}
+
+	if update.SupervisorID != nil {
+		err = checkOrgUsers(context.Background(), h.db, currentOrgID(c), *update.SupervisorID)
+	}
+	if errors.Is(err, errOtherOrganisation) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Supervisor not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	result, err := h.db.Exec(context.Background(), "UPDATE staff_user SET supervisor_id = $2 WHERE id = $1 AND org_id = $3", id, update.SupervisorID, currentOrgID(c))
+	if isForeignKeyViolation(err) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Supervisor not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if result.RowsAffected() == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"id": id, "supervisor_id": update.SupervisorID})
+}
+
+// applySLA sets a ticket's response and resolution deadlines from the
+// targets of its current priority
+func applySLA(ctx context.Context, db dbExecutor, ticketID int) error {
+	_, err := db.Exec(ctx, `
+        UPDATE ticket t
+        SET response_due_at = t.creation_date + make_interval(mins => s.response_minutes),
+            due_at = t.creation_date + make_interval(mins => s.resolution_minutes)
+        FROM ticket c
+        LEFT JOIN sla_target s ON lower(btrim(s.priority)) = lower(btrim(c.task_priority))
+        WHERE c.id = t.id AND t.id = $1`,
+		ticketID)
+	return err
+}
+
+// applySLAToPriority recomputes the deadlines of every open ticket with the
+// given priority after its policy changed
+func applySLAToPriority(ctx context.Context, db dbExecutor, priority string) error {
+	_, err := db.Exec(ctx, `
+        UPDATE ticket t
+        SET response_due_at = t.creation_date + make_interval(mins => s.response_minutes),
+            due_at = t.creation_date + make_interval(mins => s.resolution_minutes)
+        FROM ticket c
+        LEFT JOIN sla_target s ON lower(btrim(s.priority)) = lower(btrim(c.task_priority))
+        WHERE c.id = t.id
+          AND t.task_status <> 'Completed'
+          AND t.deleted_at IS NULL
+          AND lower(btrim(t.task_priority)) = lower(btrim($1))`,
+		priority)
+	return err
+}
+
+// escalateTickets moves the alert_level of open tickets in line with their
+// SLA deadlines and notifies people whenever a level is raised
+func (h *AuthHandler) escalateTickets(ctx context.Context) error {
+	type escalation struct {
+		ticketID int
+		oldLevel int
+		newLevel int
+	}
+	var escalations []escalation
+
+	rows, err := h.db.Query(ctx, `
+        SELECT id, alert_level, level
+        FROM (
+            SELECT t.id, t.alert_level,
+                   CASE
+                       WHEN now() > t.due_at
+                         OR (t.responded_at IS NULL AND now() > t.response_due_at) THEN 2
+                       WHEN now() > t.creation_date + (t.due_at - t.creation_date) * (COALESCE(s.warning_percent, 75) / 100.0)::float8
+                         OR (t.responded_at IS NULL AND now() > t.creation_date + (t.response_due_at - t.creation_date) * (COALESCE(s.warning_percent, 75) / 100.0)::float8) THEN 1
+                       ELSE 0
+                   END AS level
+            FROM ticket t
+            LEFT JOIN sla_target s ON lower(btrim(s.priority)) = lower(btrim(t.task_priority))
+            WHERE t.task_status <> 'Completed'
+              AND t.deleted_at IS NULL
+              AND (t.due_at IS NOT NULL OR t.response_due_at IS NOT NULL)
+        ) levels
+        WHERE level <> alert_level`)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var e escalation
+		if err := rows.Scan(&e.ticketID, &e.oldLevel, &e.newLevel); err != nil {
+			rows.Close()
+			return err
+		}
+		escalations = append(escalations, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, e := range escalations {
+		if _, err := h.db.Exec(ctx, "UPDATE ticket SET alert_level = $2 WHERE id = $1", e.ticketID, e.newLevel); err != nil {
+			return err
+		}
+		if e.newLevel > e.oldLevel {
+			if err := h.sendSLAAlert(ctx, e.ticketID, e.newLevel); err != nil {
+				log.Printf("SLA alert for ticket #%d failed: %v", e.ticketID, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// sendSLAAlert emails the assignee about an approaching deadline, and the
+// assignee plus their supervisor once it is breached
+func (h *AuthHandler) sendSLAAlert(ctx context.Context, ticketID, level int) error {
+	var ticket models.Ticket
+	err := scanTicket(h.db.QueryRow(ctx, "SELECT "+ticketColumns+" FROM ticket WHERE id = $1", ticketID), &ticket)
+	if err != nil {
+		return err
+	}
+
+	// A ticket waiting in a team queue has no assignee or supervisor to
+	// alert; its team is alerted instead
+	var firstName, lastName, email string
+	var supervisorID *int
+	var supervisorEmail *string
+	if ticket.AssignedTo != 0 {
+		err = h.db.QueryRow(ctx, `
+            SELECT u.first_name, u.last_name, u.email, s.id, s.email
+            FROM staff_user u
+            LEFT JOIN staff_user s ON s.id = u.supervisor_id
+            WHERE u.id = $1`,
+			ticket.AssignedTo,
+		).Scan(&firstName, &lastName, &email, &supervisorID, &supervisorEmail)
+		if err != nil {
+			return err
+		}
+	}
+
+	var to []string
+	if email != "" {
+		to = append(to, email)
+	}
+	exclude := []int{ticket.AssignedTo}
+	event := eventSLAWarning
+	heading := "A ticket is approaching its SLA deadline"
+	subject := "Ticket #" + strconv.Itoa(ticket.ID) + " SLA Warning"
+	if level >= alertLevelBreached {
+		event = eventSLABreached
+		heading = "A ticket has breached its SLA"
+		subject = "Ticket #" + strconv.Itoa(ticket.ID) + " SLA Breached"
+		if supervisorEmail != nil {
+			to = append(to, *supervisorEmail)
+			exclude = append(exclude, *supervisorID)
+		}
+	}
+
+	// Breaches, and warnings the assignee is off shift to see, also go to
+	// whoever is on call
+	onDuty, err := staffOnDuty(ctx, h.db, ticket.AssignedTo, time.Now())
+	if err != nil {
+		return err
+	}
+	if level >= alertLevelBreached || !onDuty {
+		if paged := h.pageOnCall(ctx, &ticket, subject, heading, exclude...); paged != 0 {
+			exclude = append(exclude, paged)
+		}
+	}
+
+	deadline := func(at *string) string {
+		if at == nil {
+			return "-"
+		}
+		return *at
+	}
+
+	org := h.organisation(ctx, ticket.OrgID)
+	body := `
+		<html>
+		<body>
+			` + mailBranding(org) + `
+			<h1 style="` + mailHeadingStyle(org) + `">` + html.EscapeString(heading) + `</h1>
+			<p>Please see ticket information or visit the link below.</p>
+			<ul style="list-style-type:none;">
+			<li style="padding-bottom:5px;">
+					<h2 style="font-weight:700;padding-bottom:0px;">#` + strconv.Itoa(ticket.ID) + ` ` + html.EscapeString(ticket.RequestDetail) + `</h2>` +
+		`</li>
+				<li style="padding-bottom:20px;">
+					Assigned To: ` + html.EscapeString(firstName+" "+lastName) +
+		`</li>
+				<li style="padding-bottom:20px;">
+					Task Status: ` + html.EscapeString(ticket.TaskStatus) +
+		`</li>
+				<li style="padding-bottom:20px;">
+					Task Priority: ` + html.EscapeString(ticket.TaskPriority) +
+		`</li>
+				<li style="padding-bottom:20px;">
+					Response Due: ` + html.EscapeString(deadline(ticket.ResponseDueAt)) +
+		`</li>
+				<li style="padding-bottom:30px;">
+					Resolution Due: ` + html.EscapeString(deadline(ticket.DueAt)) +
+		`</li>
+			</ul>
+			` + mailDashboardLink(org) + `
+	`
+
+	if ticket.AssignedTo == 0 && ticket.TeamID != nil {
+		notified, err := h.notifyTeam(ctx, &ticket, subject, heading, "", exclude...)
+		exclude = append(exclude, notified...)
+		if err != nil {
+			log.Printf("SLA alert for team of ticket #%d: %v", ticket.ID, err)
+		}
+	}
+	if len(to) > 0 {
+		if err := sendMail(org, to, subject, body); err != nil {
+			return fmt.Errorf("send mail: %w", err)
+		}
+	}
+
+	h.notifyWatchers(ctx, event, &ticket, subject, heading, "", exclude...)
+	return nil
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"ticket-sys/internal/events"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+)
+
+// streamHeartbeat keeps idle streams from being closed by proxies
+const streamHeartbeat = 30 * time.Second
+
+// ticketStreamFilter narrows a stream to the tickets of the client's
+// organisation that it asked for
+type ticketStreamFilter struct {
+	orgID           int
+	assignedTo      *int
+	accommodationID *int
+}
+
+func (f ticketStreamFilter) match(event events.Event) bool {
+	if event.OrgID == nil || *event.OrgID != f.orgID {
+		return false
+	}
+	if f.assignedTo != nil && (event.AssignedTo == nil || *event.AssignedTo != *f.assignedTo) {
+		return false
+	}
+	if f.accommodationID != nil && (event.AccommodationID == nil || *event.AccommodationID != *f.accommodationID) {
+		return false
+	}
+	return true
+}
+
+// Stream ticket changes
+// @Summary Stream Ticket Changes
+// @Description Server-Sent Events stream of ticket created, updated, status_changed, commented and deleted events. Every authenticated user may see every ticket of their organisation, as with GET /tickets; assigned_to ("me" or a user ID) and accommodation_id narrow the stream. Event IDs are positions in commit order, and reconnecting clients resume after Last-Event-ID.
+// @ID stream-tickets
+// @Produce text/event-stream
+// @Param assigned_to query string false "Assignee ID or me"
+// @Param accommodation_id query int false "Accommodation ID"
+// @Param Last-Event-ID header int false "Last event received"
+// @Success 200 "Event stream"
+// @Failure 400 "Invalid filter"
+// @Failure 503 "Event stream unavailable"
+// @Router /tickets/stream [get]
+// @Security Bearer
+func (h *AuthHandler) StreamTickets(c *gin.Context) {
+	if h.hub == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Event stream unavailable"})
+		return
+	}
+
+	filter := ticketStreamFilter{orgID: currentOrgID(c)}
+	if value := c.Query("assigned_to"); value != "" {
+		var assignedTo int
+		var ok bool
+		if value == "me" {
+			assignedTo, ok = currentUserID(c)
+		} else {
+			var err error
+			assignedTo, err = strconv.Atoi(value)
+			ok = err == nil
+		}
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid assigned_to"})
+			return
+		}
+		filter.assignedTo = &assignedTo
+	}
+	if value := c.Query("accommodation_id"); value != "" {
+		accommodationID, err := strconv.Atoi(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid accommodation ID"})
+			return
+		}
+		filter.accommodationID = &accommodationID
+	}
+
+	// EventSource sends Last-Event-ID itself; the query form is for clients
+	// that cannot set headers
+	var lastPosition int64
+	if value := c.GetHeader("Last-Event-ID"); value != "" || c.Query("last_event_id") != "" {
+		if value == "" {
+			value = c.Query("last_event_id")
+		}
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Last-Event-ID"})
+			return
+		}
+		lastPosition = id
+	}
+
+	// Subscribe before replaying so nothing falls between the two
+	live, unsubscribe := h.hub.Subscribe()
+	defer unsubscribe()
+
+	var backlog []events.Event
+	if lastPosition > 0 {
+		var err error
+		backlog, err = h.hub.Since(c.Request.Context(), lastPosition)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	send := func(event events.Event) {
+		// Positions follow commit order, and NOTIFY is delivered in commit
+		// order, so nothing at or below the last position is still to come
+		if event.Type == events.TypePresence || event.Position <= lastPosition {
+			return
+		}
+		lastPosition = event.Position
+		if !filter.match(event) {
+			return
+		}
+		c.Render(-1, sse.Event{
+			Id:    strconv.FormatInt(event.Position, 10),
+			Event: event.Type,
+			Data:  event,
+		})
+	}
+
+	for _, event := range backlog {
+		send(event)
+	}
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case event, ok := <-live:
+			if !ok {
+				// Dropped for falling behind; the client resumes from lastPosition
+				return
+			}
+			send(event)
+			c.Writer.Flush()
+		case <-heartbeat.C:
+			io.WriteString(c.Writer, ": ping\n\n")
+			c.Writer.Flush()
+		}
+	}
+}
+
+// ticketEventRetention is how long streams can resume from a recorded event
+const ticketEventRetention = 7 * 24 * time.Hour
+
+// pruneTicketEvents removes recorded events no stream can still resume from
+func (h *AuthHandler) pruneTicketEvents(ctx context.Context) error {
+	_, err := h.db.Exec(ctx, "DELETE FROM ticket_event WHERE created_date < $1", time.Now().Add(-ticketEventRetention))
+	return err
+}
@@ -0,0 +1,479 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"ticket-sys/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// Notification events users can opt out of
+const (
+	eventTicketCreated  = "ticket_created"
+	eventTicketUpdated  = "ticket_updated"
+	eventStatusChanged  = "status_changed"
+	eventTicketAssigned = "ticket_assigned"
+	eventSLAWarning     = "sla_warning"
+	eventSLABreached    = "sla_breached"
+	eventCommentAdded   = "comment_added"
+)
+
+var notificationEvents = []string{
+	eventTicketCreated,
+	eventTicketUpdated,
+	eventStatusChanged,
+	eventTicketAssigned,
+	eventSLAWarning,
+	eventSLABreached,
+	eventCommentAdded,
+}
+
+// ticketWatchersSQL lists the users watching ticket $1 and why: a direct
+// subscription, one on its accommodation or request type, being a
+// supporting assignee, or belonging to the team whose queue it waits in.
+// Request types are shared, so subscribers are kept to the ticket's
+// organisation.
+const ticketWatchersSQL = `
+    SELECT s.user_id,
+           CASE WHEN s.ticket_id IS NOT NULL THEN 'ticket'
+                WHEN s.accommodation_id IS NOT NULL THEN 'accommodation'
+                ELSE 'request_type' END AS via
+    FROM ticket t
+    JOIN subscription s ON s.ticket_id = t.id
+        OR s.accommodation_id = t.accommodation_id
+        OR s.request_type_id = (SELECT rt.id FROM request_type rt WHERE lower(btrim(rt.name)) = lower(btrim(t.request_type)))
+    JOIN staff_user su ON su.id = s.user_id AND su.org_id = t.org_id
+    WHERE t.id = $1
+    UNION ALL
+    SELECT a.user_id, 'assignee' FROM ticket_assignee a WHERE a.ticket_id = $1
+    UNION ALL
+    SELECT m.user_id, 'team'
+    FROM ticket t
+    JOIN team_member m ON m.team_id = t.team_id
+    WHERE t.id = $1 AND t.assigned_to IS NULL`
+
+// Subscribe
+// @Summary Create Subscription
+// @Description Watch a ticket, an accommodation or a request type
+// @ID create-subscription
+// @Produce json
+// @Success 201 "Successful response"
+// @Failure 400 "Invalid input format"
+// @Failure 404 "Subscription target not found"
+// @Failure 409 "Already subscribed"
+// @Router /subscriptions [post]
+// @Security Bearer
+func (h *AuthHandler) CreateSubscription(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+		return
+	}
+
+	var subscription models.SubscriptionCreate
+	if err := c.ShouldBindJSON(&subscription); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid input format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	targets := 0
+	for _, target := range []*int{subscription.TicketID, subscription.AccommodationID, subscription.RequestTypeID} {
+		if target != nil {
+			targets++
+		}
+	}
+	if targets != 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Exactly one of ticket_id, accommodation_id or request_type_id is required"})
+		return
+	}
+
+	// Tickets and accommodations of other organisations cannot be watched
+	var foreign bool
+	err := h.db.QueryRow(context.Background(), `
+        SELECT EXISTS(SELECT 1 FROM ticket WHERE id = $1 AND org_id <> $3)
+            OR EXISTS(SELECT 1 FROM accommodation WHERE id = $2 AND org_id <> $3)`,
+		subscription.TicketID, subscription.AccommodationID, currentOrgID(c)).Scan(&foreign)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if foreign {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Subscription target not found"})
+		return
+	}
+
+	var created models.Subscription
+	err = h.db.QueryRow(context.Background(), `
+        INSERT INTO subscription (user_id, ticket_id, accommodation_id, request_type_id)
+        VALUES ($1, $2, $3, $4)
+        RETURNING id, user_id, ticket_id, accommodation_id, request_type_id, created_date::text`,
+		userID,
+		subscription.TicketID,
+		subscription.AccommodationID,
+		subscription.RequestTypeID,
+	).Scan(
+		&created.ID,
+		&created.UserID,
+		&created.TicketID,
+		&created.AccommodationID,
+		&created.RequestTypeID,
+		&created.CreatedDate)
+
+	if isUniqueViolation(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Already subscribed"})
+		return
+	}
+	if isForeignKeyViolation(err) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Subscription target not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, created)
+}
+
+// Get subscriptions
+// @Summary Get Subscriptions
+// @Description List the current user's subscriptions
+// @ID get-subscriptions
+// @Produce json
+// @Success 200 "Successful response"
+// @Failure 500 "Database error"
+// @Router /subscriptions [get]
+// @Security Bearer
+func (h *AuthHandler) GetSubscriptions(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+		return
+	}
+
+	subscriptions := []models.Subscription{}
+
+	rows, err := h.db.Query(context.Background(), `
+        SELECT id, user_id, ticket_id, accommodation_id, request_type_id, created_date::text
+        FROM subscription
+        WHERE user_id = $1
+        ORDER BY created_date DESC`,
+		userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	for rows.Next() {
+		var subscription models.Subscription
+		err := rows.Scan(
+			&subscription.ID,
+			&subscription.UserID,
+			&subscription.TicketID,
+			&subscription.AccommodationID,
+			&subscription.RequestTypeID,
+			&subscription.CreatedDate)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Process failed"})
+			return
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+
+	if err = rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Subscription iteration failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, subscriptions)
+}
+
+// Unsubscribe
+// @Summary Delete Subscription
+// @Description Stop watching a ticket, an accommodation or a request type
+// @ID delete-subscription
+// @Produce json
+// @Param id path int true "Subscription ID"
+// @Success 200 "Successful response"
+// @Failure 400 "Invalid subscription ID"
+// @Failure 404 "Subscription not found"
+// @Router /subscriptions/{id} [delete]
+// @Security Bearer
+func (h *AuthHandler) DeleteSubscription(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid subscription ID"})
+		return
+	}
+
+	// Users can only remove their own subscriptions
+	result, err := h.db.Exec(context.Background(), "DELETE FROM subscription WHERE id = $1 AND user_id = $2", id, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if result.RowsAffected() == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Subscription not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"id": id})
+}
+
+// Get ticket watchers
+// @Summary Get Ticket Watchers
+// @Description List the users notified about a ticket besides its lead assignee
+// @ID get-ticket-watchers
+// @Produce json
+// @Param id path int true "Ticket ID"
+// @Success 200 "Successful response"
+// @Failure 400 "Invalid ticket ID"
+// @Failure 500 "Database error"
+// @Router /tickets/{id}/watchers [get]
+// @Security Bearer
+func (h *AuthHandler) GetTicketWatchers(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ticket ID"})
+		return
+	}
+
+	watchers := []models.Watcher{}
+
+	rows, err := h.db.Query(context.Background(), `
+        SELECT u.id, u.first_name, u.last_name, array_agg(DISTINCT w.via ORDER BY w.via)
+        FROM (`+ticketWatchersSQL+`) w
+        JOIN staff_user u ON u.id = w.user_id
+        WHERE EXISTS (SELECT 1 FROM ticket WHERE id = $1 AND org_id = $2)
+        GROUP BY u.id
+        ORDER BY u.first_name, u.last_name`,
+		id, currentOrgID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	for rows.Next() {
+		var watcher models.Watcher
+		if err := rows.Scan(&watcher.UserID, &watcher.FirstName, &watcher.LastName, &watcher.Via); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Process failed"})
+			return
+		}
+		watchers = append(watchers, watcher)
+	}
+
+	if err = rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Watcher iteration failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, watchers)
+}
+
+// Get notification preferences
+// @Summary Get Notification Preferences
+// @Description List every notification event and whether the current user receives it
+// @ID get-notification-preferences
+// @Produce json
+// @Success 200 "Successful response"
+// @Failure 500 "Database error"
+// @Router /notification-preferences [get]
+// @Security Bearer
+func (h *AuthHandler) GetNotificationPreferences(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+		return
+	}
+
+	preferences, err := h.notificationPreferences(context.Background(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, preferences)
+}
+
+// Update notification preferences
+// @Summary Update Notification Preferences
+// @Description Choose which notification events the current user receives
+// @ID update-notification-preferences
+// @Produce json
+// @Success 200 "Successful response"
+// @Failure 400 "Unknown event"
+// @Failure 500 "Database error"
+// @Router /notification-preferences [put]
+// @Security Bearer
+func (h *AuthHandler) UpdateNotificationPreferences(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+		return
+	}
+
+	var update models.NotificationPreferencesUpdate
+	if err := c.ShouldBindJSON(&update); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid input format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	if event, ok := unknownNotificationEvent(update.Events); ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown event " + event})
+		return
+	}
+
+	ctx := context.Background()
+	tx, err := h.db.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction start failed"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	if err := saveNotificationPreferences(ctx, tx, userID, update.Events); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction commit failed"})
+		return
+	}
+
+	preferences, err := h.notificationPreferences(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, preferences)
+}
+
+// unknownNotificationEvent returns an event in events that is not a
+// notification event, if there is one
+func unknownNotificationEvent(events map[string]bool) (string, bool) {
+	for event := range events {
+		if !slices.Contains(notificationEvents, event) {
+			return event, true
+		}
+	}
+	return "", false
+}
+
+// saveNotificationPreferences records whether the user wants each event
+func saveNotificationPreferences(ctx context.Context, db dbExecutor, userID int, events map[string]bool) error {
+	for event, enabled := range events {
+		_, err := db.Exec(ctx, `
+            INSERT INTO notification_preference (user_id, event, enabled)
+            VALUES ($1, $2, $3)
+            ON CONFLICT (user_id, event) DO UPDATE SET enabled = EXCLUDED.enabled`,
+			userID, event, enabled)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// notificationPreferences lists every event with the user's choice,
+// defaulting to enabled
+func (h *AuthHandler) notificationPreferences(ctx context.Context, userID int) ([]models.NotificationPreference, error) {
+	disabled := map[string]bool{}
+
+	rows, err := h.db.Query(ctx, "SELECT event FROM notification_preference WHERE user_id = $1 AND NOT enabled", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var event string
+		if err := rows.Scan(&event); err != nil {
+			return nil, err
+		}
+		disabled[event] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	preferences := make([]models.NotificationPreference, 0, len(notificationEvents))
+	for _, event := range notificationEvents {
+		preferences = append(preferences, models.NotificationPreference{Event: event, Enabled: !disabled[event]})
+	}
+	return preferences, nil
+}
+
+// notifyWatchers fans a notification out to the ticket's watchers who want
+// event. Users in exclude, who were emailed directly or caused the event,
+// are skipped. Failures are logged: the change itself has already been
+// saved and its direct recipients told.
+func (h *AuthHandler) notifyWatchers(ctx context.Context, event string, ticket *models.Ticket, subject, heading, message string, exclude ...int) {
+	if exclude == nil {
+		exclude = []int{}
+	}
+
+	rows, err := h.db.Query(ctx, `
+        SELECT DISTINCT u.email
+        FROM (`+ticketWatchersSQL+`) w
+        JOIN staff_user u ON u.id = w.user_id
+        WHERE u.active AND u.id <> ALL($2)
+          AND NOT EXISTS (
+              SELECT 1 FROM notification_preference p
+              WHERE p.user_id = u.id AND p.event = $3 AND NOT p.enabled)`,
+		ticket.ID, exclude, event)
+	if err != nil {
+		log.Printf("watchers of ticket #%d: %v", ticket.ID, err)
+		return
+	}
+
+	var to []string
+	for rows.Next() {
+		var email string
+		if err := rows.Scan(&email); err != nil {
+			rows.Close()
+			log.Printf("watchers of ticket #%d: %v", ticket.ID, err)
+			return
+		}
+		to = append(to, email)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		log.Printf("watchers of ticket #%d: %v", ticket.ID, err)
+		return
+	}
+	if len(to) == 0 {
+		return
+	}
+
+	leadName, _, err := h.userContact(ctx, ticket.AssignedTo)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		log.Printf("watchers of ticket #%d: %v", ticket.ID, err)
+		return
+	}
+
+	// Recipients go in the envelope only, so watchers do not see each other
+	org := h.organisation(ctx, ticket.OrgID)
+	if err := sendMail(org, to, subject, ticketMailBody(org, heading, message, ticket, leadName)); err != nil {
+		log.Printf("%s notification for ticket #%d failed: %v", event, ticket.ID, err)
+	}
+}
@@ -0,0 +1,716 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"ticket-sys/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	errInvalidTeam    = errors.New("team not found")
+	errNotTeamMember  = errors.New("you are not a member of this team")
+	errNotQueued      = errors.New("ticket is not waiting in a team queue")
+	errAlreadyClaimed = errors.New("ticket was already claimed")
+	errAlreadyQueued  = errors.New("ticket is already in this team's queue")
+)
+
+const teamColumns = `id, name, description, (SELECT count(*) FROM ticket WHERE ticket.team_id = team.id AND ` + teamQueuedSQL + `), created_date::text`
+
+// teamQueuedSQL holds for tickets still waiting in their team's queue
+const teamQueuedSQL = `ticket.assigned_to IS NULL AND ticket.deleted_at IS NULL AND ticket.task_status <> 'Completed'`
+
+// Get teams
+// @Summary Get Teams
+// @Description List teams with their members and queue sizes
+// @ID get-teams
+// @Produce json
+// @Success 200 "Successful response"
+// @Failure 500 "Database error"
+// @Router /teams [get]
+// @Security Bearer
+func (h *AuthHandler) GetTeams(c *gin.Context) {
+	ctx := context.Background()
+	teams := []models.Team{}
+
+	rows, err := h.db.Query(ctx, "SELECT "+teamColumns+" FROM team WHERE org_id = $1 ORDER BY lower(name)", currentOrgID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	for rows.Next() {
+		var team models.Team
+		if err := scanTeam(rows, &team); err != nil {
+			rows.Close()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Process failed"})
+			return
+		}
+		teams = append(teams, team)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Team iteration failed"})
+		return
+	}
+
+	for i := range teams {
+		if teams[i].Members, err = h.teamMembers(ctx, teams[i].ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, teams)
+}
+
+// Get team
+// @Summary Get Team
+// @Description Get a team with its members and queue size
+// @ID get-team
+// @Produce json
+// @Param id path int true "Team ID"
+// @Success 200 "Successful response"
+// @Failure 400 "Invalid team ID"
+// @Failure 404 "Team not found"
+// @Router /teams/{id} [get]
+// @Security Bearer
+func (h *AuthHandler) GetTeam(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid team ID"})
+		return
+	}
+
+	team, err := h.loadTeam(context.Background(), id, currentOrgID(c))
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Team not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, team)
+}
+
+// Create team
+// @Summary Create Team
+// @Description Create a team, optionally with its members
+// @ID create-team
+// @Produce json
+// @Success 201 "Successful response"
+// @Failure 400 "Invalid input format"
+// @Failure 409 "Team already exists"
+// @Router /teams [post]
+// @Security Bearer
+func (h *AuthHandler) CreateTeam(c *gin.Context) {
+	var input models.TeamCreate
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid input format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	ctx := context.Background()
+	tx, err := h.db.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var id int
+	err = tx.QueryRow(ctx, "INSERT INTO team (name, description, org_id) VALUES (btrim($1), $2, $3) RETURNING id", input.Name, input.Description, currentOrgID(c)).Scan(&id)
+	if err == nil && input.Members != nil {
+		err = setTeamMembers(ctx, tx, id, input.Members)
+	}
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if isUniqueViolation(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Team already exists"})
+		return
+	}
+	if isForeignKeyViolation(err) || errors.Is(err, errOtherOrganisation) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Member not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Team creation failed"})
+		return
+	}
+
+	team, err := h.loadTeam(ctx, id, currentOrgID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, team)
+}
+
+// Update team
+// @Summary Update Team
+// @Description Rename a team or replace its members
+// @ID update-team
+// @Produce json
+// @Param id path int true "Team ID"
+// @Success 200 "Successful response"
+// @Failure 400 "Invalid team data"
+// @Failure 404 "Team not found"
+// @Failure 409 "Team already exists"
+// @Router /teams/{id} [patch]
+// @Security Bearer
+func (h *AuthHandler) UpdateTeam(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid team ID"})
+		return
+	}
+
+	var update models.TeamUpdate
+	if err := c.ShouldBindJSON(&update); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid team data", "details": err.Error()})
+		return
+	}
+
+	ctx := context.Background()
+	tx, err := h.db.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	result, err := tx.Exec(ctx, `
+        UPDATE team
+        SET name = COALESCE(btrim($2), name), description = COALESCE($3, description)
+        WHERE id = $1 AND org_id = $4`,
+		id, update.Name, update.Description, currentOrgID(c))
+	if err == nil && result.RowsAffected() == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Team not found"})
+		return
+	}
+	if err == nil && update.Members != nil {
+		err = setTeamMembers(ctx, tx, id, *update.Members)
+	}
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if isUniqueViolation(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Team already exists"})
+		return
+	}
+	if isForeignKeyViolation(err) || errors.Is(err, errOtherOrganisation) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Member not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	team, err := h.loadTeam(ctx, id, currentOrgID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, team)
+}
+
+// Delete team
+// @Summary Delete Team
+// @Description Delete a team. Tickets still waiting in its queue must be assigned or moved first.
+// @ID delete-team
+// @Produce json
+// @Param id path int true "Team ID"
+// @Success 200 "Successful response"
+// @Failure 400 "Invalid team ID"
+// @Failure 404 "Team not found"
+// @Failure 409 "Team still has tickets in its queue"
+// @Router /teams/{id} [delete]
+// @Security Bearer
+func (h *AuthHandler) DeleteTeam(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid team ID"})
+		return
+	}
+
+	// Queued tickets would otherwise be left with neither team nor assignee
+	result, err := h.db.Exec(context.Background(), `
+        DELETE FROM team
+        WHERE id = $1 AND org_id = $2
+          AND NOT EXISTS (SELECT 1 FROM ticket WHERE ticket.team_id = team.id AND `+teamQueuedSQL+`)`,
+		id, currentOrgID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if result.RowsAffected() == 0 {
+		var exists bool
+		if err := h.db.QueryRow(context.Background(), "SELECT EXISTS (SELECT 1 FROM team WHERE id = $1 AND org_id = $2)", id, currentOrgID(c)).Scan(&exists); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if exists {
+			c.JSON(http.StatusConflict, gin.H{"error": "Team still has tickets in its queue"})
+			return
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": "Team not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"id": id})
+}
+
+// Get team queue
+// @Summary Get Team Queue
+// @Description List the open tickets waiting in a team's queue for a member to claim, oldest first. Only team members and admins may see it.
+// @ID get-team-queue
+// @Produce json
+// @Param id path int true "Team ID"
+// @Success 200 "Successful response"
+// @Failure 400 "Invalid team ID"
+// @Failure 403 "Not a member of this team"
+// @Failure 404 "Team not found"
+// @Failure 500 "Database error"
+// @Router /teams/{id}/queue [get]
+// @Security Bearer
+func (h *AuthHandler) GetTeamQueue(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid team ID"})
+		return
+	}
+
+	ctx := context.Background()
+	var exists bool
+	if err := h.db.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM team WHERE id = $1 AND org_id = $2)", id, currentOrgID(c)).Scan(&exists); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Team not found"})
+		return
+	}
+
+	if role, _ := c.Get("role"); role != "admin" {
+		userID, _ := currentUserID(c)
+		member, err := isTeamMember(ctx, h.db, id, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if !member {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Not a member of this team"})
+			return
+		}
+	}
+
+	tickets := []models.Ticket{}
+
+	rows, err := h.db.Query(ctx, `
+        SELECT `+ticketColumns+`
+        FROM ticket
+        WHERE team_id = $1 AND org_id = $2 AND `+teamQueuedSQL+`
+        ORDER BY creation_date, id`,
+		id, currentOrgID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var ticket models.Ticket
+		if err := scanTicket(rows, &ticket); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Process failed"})
+			return
+		}
+		tickets = append(tickets, ticket)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ticket iteration failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tickets)
+}
+
+// Queue a ticket
+// @Summary Queue Ticket For a Team
+// @Description Move a ticket to a team's queue, taking it off its assignee. The team is notified and any member may claim it.
+// @ID queue-ticket
+// @Produce json
+// @Param id path int true "Ticket ID"
+// @Param If-Match header string true "ETag of the ticket version being changed, or * to skip the check"
+// @Success 200 "Successful response"
+// @Failure 400 "Invalid input format"
+// @Failure 404 "Ticket not found"
+// @Failure 412 "Ticket was changed by someone else"
+// @Failure 428 "If-Match header required"
+// @Failure 500 "Database error"
+// @Router /tickets/{id}/queue [post]
+// @Security Bearer
+func (h *AuthHandler) QueueTicket(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ticket ID"})
+		return
+	}
+
+	var queue models.TicketQueue
+	if err := c.ShouldBindJSON(&queue); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid input format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	version, ok := h.requireIfMatch(c, id)
+	if !ok {
+		return
+	}
+
+	var queuedBy *int
+	if userID, ok := currentUserID(c); ok {
+		queuedBy = &userID
+	}
+
+	ticket, err := h.queueTicket(context.Background(), id, currentOrgID(c), queue, queuedBy, version)
+	switch {
+	case errors.Is(err, errTicketNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ticket not found"})
+	case errors.Is(err, errVersionConflict):
+		h.preconditionFailed(c, id)
+	case errors.Is(err, errInvalidTeam), errors.Is(err, errAlreadyQueued):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, errMailer):
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Mailer error"})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+	default:
+		c.Header("ETag", ticketETag(ticket.Version))
+		c.JSON(http.StatusOK, ticket)
+	}
+}
+
+// Claim a ticket
+// @Summary Claim Ticket
+// @Description Take a ticket waiting in one of your teams' queues. Only the first claim wins.
+// @ID claim-ticket
+// @Produce json
+// @Param id path int true "Ticket ID"
+// @Success 200 "Successful response"
+// @Failure 400 "Invalid ticket ID"
+// @Failure 403 "Not a member of the ticket's team"
+// @Failure 404 "Ticket not found"
+// @Failure 409 "Ticket is not waiting in a queue or was already claimed"
+// @Failure 500 "Database error"
+// @Router /tickets/{id}/claim [post]
+// @Security Bearer
+func (h *AuthHandler) ClaimTicket(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ticket ID"})
+		return
+	}
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	ticket, err := h.claimTicket(context.Background(), id, currentOrgID(c), userID)
+	switch {
+	case errors.Is(err, errTicketNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ticket not found"})
+	case errors.Is(err, errNotTeamMember):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not a member of the ticket's team"})
+	case errors.Is(err, errNotQueued), errors.Is(err, errAlreadyClaimed):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, errMailer):
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Mailer error"})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+	default:
+		c.Header("ETag", ticketETag(ticket.Version))
+		c.JSON(http.StatusOK, ticket)
+	}
+}
+
+// queueTicket moves a ticket of organisation orgID to a team's queue,
+// records the change and notifies the previous assignee and the team.
+// Supporting assignees stay on the ticket. A mailer failure is returned as
+// errMailer along with the saved ticket.
+func (h *AuthHandler) queueTicket(ctx context.Context, id, orgID int, queue models.TicketQueue, queuedBy, version *int) (*models.Ticket, error) {
+	tx, err := h.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var previous, currentVersion int
+	var teamID *int
+	err = tx.QueryRow(ctx, "SELECT COALESCE(assigned_to, 0), team_id, version FROM ticket WHERE id = $1 AND org_id = $2 AND deleted_at IS NULL FOR UPDATE", id, orgID).Scan(&previous, &teamID, &currentVersion)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, errTicketNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if version != nil && currentVersion != *version {
+		return nil, errVersionConflict
+	}
+	if previous == 0 && teamID != nil && *teamID == queue.TeamID {
+		return nil, errAlreadyQueued
+	}
+	if err := validateTeam(ctx, tx, orgID, queue.TeamID); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(ctx, "UPDATE ticket SET team_id = $2, assigned_to = NULL WHERE id = $1 AND org_id = $3", id, queue.TeamID, orgID)
+	if err == nil {
+		_, err = tx.Exec(ctx, `
+            INSERT INTO ticket_assignment (ticket_id, from_user_id, to_user_id, reason, assigned_by)
+            VALUES ($1, NULLIF($2, 0), NULL, $3, $4)`,
+			id, previous, queue.Reason, queuedBy)
+	}
+	if isForeignKeyViolation(err) {
+		return nil, errInvalidTeam
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	var ticket models.Ticket
+	if err := scanTicket(h.db.QueryRow(ctx, "SELECT "+ticketColumns+" FROM ticket WHERE id = $1 AND org_id = $2", id, orgID), &ticket); err != nil {
+		return nil, err
+	}
+
+	message := ""
+	if queue.Reason != "" {
+		message = "Reason: " + queue.Reason
+	}
+	subject := "Ticket #" + strconv.Itoa(id) + " Queued For Your Team"
+
+	var mailErr error
+	exclude := []int{previous}
+	if queuedBy != nil {
+		exclude = append(exclude, *queuedBy)
+	}
+	if _, email, err := h.userContact(ctx, previous); err == nil {
+		org := h.organisation(ctx, ticket.OrgID)
+		if err := sendMail(org, []string{email}, "Ticket #"+strconv.Itoa(id)+" Has Been Reassigned", ticketMailBody(org, "A ticket has been moved to a team queue", message, &ticket, "")); err != nil {
+			mailErr = errMailer
+		}
+	}
+	notified, err := h.notifyTeam(ctx, &ticket, subject, "A ticket is waiting in your team's queue", message, exclude...)
+	if err != nil && mailErr == nil {
+		mailErr = err
+	}
+	exclude = append(exclude, notified...)
+	h.notifyWatchers(ctx, eventTicketAssigned, &ticket, "Ticket #"+strconv.Itoa(id)+" Reassigned", "A ticket has been moved to a team queue", message, exclude...)
+
+	return &ticket, mailErr
+}
+
+// claimTicket assigns a queued ticket of organisation orgID to a member of
+// its team and tells the rest of the team it has been taken. When two
+// members claim at once, the later one gets errAlreadyClaimed.
+func (h *AuthHandler) claimTicket(ctx context.Context, id, orgID, userID int) (*models.Ticket, error) {
+	var assignedTo int
+	var teamID *int
+	err := h.db.QueryRow(ctx, "SELECT COALESCE(assigned_to, 0), team_id FROM ticket WHERE id = $1 AND org_id = $2 AND deleted_at IS NULL", id, orgID).Scan(&assignedTo, &teamID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, errTicketNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if teamID == nil {
+		return nil, errNotQueued
+	}
+	if assignedTo != 0 {
+		return nil, errAlreadyClaimed
+	}
+
+	member, err := isTeamMember(ctx, h.db, *teamID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !member {
+		return nil, errNotTeamMember
+	}
+
+	unassigned := 0
+	assign := models.TicketAssign{AssignedTo: userID, Reason: "Claimed from the team queue"}
+	ticket, err := h.assignTicket(ctx, id, orgID, assign, &userID, &unassigned, nil)
+	if errors.Is(err, errAssignmentConflict) {
+		return nil, errAlreadyClaimed
+	}
+	if err != nil && !errors.Is(err, errMailer) {
+		return nil, err
+	}
+	mailErr := err
+
+	claimer, _, err := h.userContact(ctx, userID)
+	if err != nil {
+		return ticket, mailErr
+	}
+	_, err = h.notifyTeam(ctx, ticket, "Ticket #"+strconv.Itoa(id)+" Claimed", "A ticket in your team's queue has been claimed by "+claimer, "", userID)
+	if mailErr == nil {
+		mailErr = err
+	}
+	return ticket, mailErr
+}
+
+// notifyTeam emails every member of the ticket's team except those in
+// exclude, returning who was emailed. Team notices go out regardless of
+// notification preferences, like mail to an assignee.
+func (h *AuthHandler) notifyTeam(ctx context.Context, ticket *models.Ticket, subject, heading, message string, exclude ...int) ([]int, error) {
+	if ticket.TeamID == nil {
+		return nil, nil
+	}
+	if exclude == nil {
+		exclude = []int{}
+	}
+
+	rows, err := h.db.Query(ctx, `
+        SELECT u.id, u.email
+        FROM team_member m
+        JOIN staff_user u ON u.id = m.user_id
+        WHERE m.team_id = $1 AND u.active AND u.id <> ALL($2)`,
+		*ticket.TeamID, exclude)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notified []int
+	var to []string
+	for rows.Next() {
+		var userID int
+		var email string
+		if err := rows.Scan(&userID, &email); err != nil {
+			return nil, err
+		}
+		notified = append(notified, userID)
+		to = append(to, email)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(to) == 0 {
+		return nil, nil
+	}
+
+	assigneeName, _, _ := h.userContact(ctx, ticket.AssignedTo)
+	// Recipients go in the envelope only, so members do not see each other
+	org := h.organisation(ctx, ticket.OrgID)
+	if err := sendMail(org, to, subject, ticketMailBody(org, heading, message, ticket, assigneeName)); err != nil {
+		return notified, errMailer
+	}
+	return notified, nil
+}
+
+// loadTeam reads a team of organisation orgID with its members
+func (h *AuthHandler) loadTeam(ctx context.Context, id, orgID int) (*models.Team, error) {
+	var team models.Team
+	if err := scanTeam(h.db.QueryRow(ctx, "SELECT "+teamColumns+" FROM team WHERE id = $1 AND org_id = $2", id, orgID), &team); err != nil {
+		return nil, err
+	}
+	members, err := h.teamMembers(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	team.Members = members
+	return &team, nil
+}
+
+// teamMembers lists the members of a team by name
+func (h *AuthHandler) teamMembers(ctx context.Context, teamID int) ([]models.TeamMember, error) {
+	rows, err := h.db.Query(ctx, `
+        SELECT u.id, u.first_name || ' ' || u.last_name, u.email, m.added_date::text
+        FROM team_member m
+        JOIN staff_user u ON u.id = m.user_id
+        WHERE m.team_id = $1
+        ORDER BY u.first_name, u.last_name`,
+		teamID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []models.TeamMember{}
+	for rows.Next() {
+		var member models.TeamMember
+		if err := rows.Scan(&member.UserID, &member.Name, &member.Email, &member.AddedDate); err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+	return members, rows.Err()
+}
+
+// setTeamMembers replaces a team's membership with userIDs, who must
+// belong to the team's organisation
+func setTeamMembers(ctx context.Context, db dbExecutor, teamID int, userIDs []int) error {
+	userIDs = uniqueInts(userIDs)
+	var foreign bool
+	err := db.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM staff_user u JOIN team t ON t.id = $1 WHERE u.id = ANY($2) AND u.org_id <> t.org_id)", teamID, userIDs).Scan(&foreign)
+	if err != nil {
+		return err
+	}
+	if foreign {
+		return errOtherOrganisation
+	}
+
+	_, err = db.Exec(ctx, "DELETE FROM team_member WHERE team_id = $1 AND user_id <> ALL($2)", teamID, userIDs)
+	if err == nil {
+		_, err = db.Exec(ctx, `
+            INSERT INTO team_member (team_id, user_id)
+            SELECT $1, unnest($2::int[])
+            ON CONFLICT DO NOTHING`,
+			teamID, userIDs)
+	}
+	return err
+}
+
+// isTeamMember reports whether a user belongs to a team
+func isTeamMember(ctx context.Context, db dbExecutor, teamID, userID int) (bool, error) {
+	var member bool
+	err := db.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM team_member WHERE team_id = $1 AND user_id = $2)", teamID, userID).Scan(&member)
+	return member, err
+}
+
+// validateTeam fails with errInvalidTeam when a team does not exist in orgID
+func validateTeam(ctx context.Context, db dbExecutor, orgID, teamID int) error {
+	var exists bool
+	if err := db.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM team WHERE id = $1 AND org_id = $2)", teamID, orgID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return errInvalidTeam
+	}
+	return nil
+}
+
+// scanTeam scans a row selected with teamColumns into team
+func scanTeam(row pgx.Row, team *models.Team) error {
+	return row.Scan(&team.ID, &team.Name, &team.Description, &team.QueueSize, &team.CreatedDate)
+}
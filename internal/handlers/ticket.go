@@ -2,9 +2,10 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
-	"net/smtp"
 	"strconv"
 	"strings"
 	"ticket-sys/internal/models"
@@ -16,7 +17,7 @@ import (
 
 // Create ticket
 // @Summary Create New Ticket
-// @Description Create a new ticket
+// @Description Create a new ticket. With team_id and no assigned_to it waits in the team's queue; without either the assignment rules pick the assignee.
 // @ID create-ticket
 // @Produce json
 // @Success 200 "Successful response"
@@ -35,25 +36,124 @@ func (h *AuthHandler) CreateTicket(c *gin.Context) {
 		return
 	}
 
-	// Insert user with transaction
-	tx, err := h.db.Begin(context.Background())
+	if userID, ok := currentUserID(c); ok {
+		ticket.CreatedBy = &userID
+	}
+	ticket.OrgID = currentOrgID(c)
+
+	id, err := h.createTicket(context.Background(), &ticket)
+	if errors.Is(err, errInvalidCatalog) || errors.Is(err, errInvalidAccommodation) || errors.Is(err, errNoAssignee) || errors.Is(err, errInvalidTeam) || errors.Is(err, errOtherOrganisation) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, errMailer) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Mailer error"})
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction start failed"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ticket creation failed"})
 		return
 	}
 
-	//layout := "2006-01-02"
-	loc, _ := time.LoadLocation("Asia/Tokyo")
-	now := time.Now().In(loc)
-	// 	parsedDate, err := time.Parse(layout, now.Format("2006-01-02"))
-	//  if err != nil {
-	//   fmt.Println("Error:", err)
-	//  }
+	c.JSON(http.StatusCreated, gin.H{
+		"message":   "Ticket registered successfully",
+		"ticket_id": id,
+	})
+}
+
+// createTicket validates and stores a new ticket, then emails its assignee,
+// or its whole team when it is queued unassigned.
+// Every way of creating a single ticket goes through here; imports batch
+// insertTicket themselves. A mailer failure is reported as errMailer after
+// the ticket has been committed.
+func (h *AuthHandler) createTicket(ctx context.Context, ticket *models.TicketCreate) (int, error) {
+	// Request type and priority must come from the catalogs
+	if err := h.validateCatalogValues(ctx, &ticket.RequestType, &ticket.TaskPriority); err != nil {
+		return 0, err
+	}
+
+	// Link the ticket to its accommodation entities
+	if err := h.resolveTicketAccommodation(ctx, ticket); err != nil {
+		return 0, err
+	}
+
+	if ticket.TeamID != nil {
+		if err := validateTeam(ctx, h.db, ticket.OrgID, *ticket.TeamID); err != nil {
+			return 0, err
+		}
+	}
+	if ticket.AssignedTo != 0 {
+		if err := checkOrgUsers(ctx, h.db, ticket.OrgID, ticket.AssignedTo); err != nil {
+			return 0, fmt.Errorf("%w: assigned_to", err)
+		}
+	}
+
+	// A ticket queued to a team waits there for a member to claim it
+	if ticket.AssignedTo == 0 && ticket.TeamID == nil {
+		if err := h.applyAssignmentRules(ctx, ticket, true); err != nil {
+			return 0, err
+		}
+	}
+
+	// Insert ticket with transaction
+	tx, err := h.db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := insertTicket(ctx, tx, ticket)
+	if err != nil {
+		tx.Rollback(ctx)
+		return 0, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+
+	var mailErr error
+	var created models.Ticket
+	if err := scanTicket(h.db.QueryRow(ctx, "SELECT "+ticketColumns+" FROM ticket WHERE id = $1", id), &created); err == nil {
+		if ticket.AssignedTo != 0 {
+			mailErr = h.sendTicketAssignedMail(ctx, &created)
+		}
+		exclude := []int{ticket.AssignedTo}
+		if ticket.CreatedBy != nil {
+			exclude = append(exclude, *ticket.CreatedBy)
+		}
+		if ticket.AssignedTo == 0 {
+			notified, err := h.notifyTeam(ctx, &created, "Ticket #"+strconv.Itoa(id)+" Queued For Your Team", "A ticket is waiting in your team's queue", "", exclude...)
+			mailErr = err
+			exclude = append(exclude, notified...)
+		}
+		h.notifyWatchers(ctx, eventTicketCreated, &created, "Ticket #"+strconv.Itoa(id)+" Created", "A new ticket has been created", "", exclude...)
+
+		// Urgent tickets can't wait for an assignee who may be off shift
+		if urgent, err := ticketPriorityUrgent(ctx, h.db, created.TaskPriority); err != nil {
+			log.Printf("urgent check for ticket #%d: %v", id, err)
+		} else if urgent {
+			h.pageOnCall(ctx, &created, "Urgent Ticket #"+strconv.Itoa(id), "An urgent ticket has been created", ticket.AssignedTo)
+		}
+	}
+
+	return id, mailErr
+}
+
+// insertTicket stores a validated new ticket in tx and starts its SLA
+// clock. Notifications are left to the caller.
+func insertTicket(ctx context.Context, tx pgx.Tx, ticket *models.TicketCreate) (int, error) {
+	// Tickets are dated in the local time of their organisation
+	var timezone string
+	err := tx.QueryRow(ctx, "SELECT timezone FROM organisation WHERE id = $1", ticket.OrgID).Scan(&timezone)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return 0, err
+	}
+	now := time.Now().In(organisationLocation(&models.Organisation{Timezone: timezone}))
 
 	var id int
-	err = tx.QueryRow(context.Background(), `
-        INSERT INTO ticket 
-        VALUES (DEFAULT, $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14) 
+	err = tx.QueryRow(ctx, `
+        INSERT INTO ticket (reported_by, accommodation_name, accommodation_room_number, accommodation_specific_location, accommodation_type, request_type, request_detail, task_status, task_priority, alert_level, assigned_to, note, image, creation_date, accommodation_id, room_id, location_id, schedule_id, team_id, org_id)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NULLIF($11, 0), $12, $13, $14, $15, $16, $17, $18, $19, $20)
         RETURNING id`,
 		ticket.ReportedBy,
 		ticket.AccommodationName,
@@ -69,119 +169,79 @@ func (h *AuthHandler) CreateTicket(c *gin.Context) {
 		ticket.Note,
 		ticket.Image,
 		now,
+		ticket.AccommodationID,
+		ticket.RoomID,
+		ticket.LocationID,
+		ticket.ScheduleID,
+		ticket.TeamID,
+		ticket.OrgID,
 	).Scan(&id)
 
-	if err != nil {
-		tx.Rollback(context.Background())
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ticket creation failed"})
-		return
+	if err == nil {
+		err = applySLA(ctx, tx, id)
 	}
-
-	if err = tx.Commit(context.Background()); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction commit failed"})
-		return
+	if err == nil && ticket.CreatedBy != nil {
+		// Whoever reports a ticket hears about its progress
+		_, err = tx.Exec(ctx, "INSERT INTO subscription (user_id, ticket_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", *ticket.CreatedBy, id)
 	}
 
-	var email string
-	var firstName string
-	var lastName string
-	dbErr := h.db.QueryRow(context.Background(), `
-        SELECT first_name, last_name, email 
-        FROM staff_user 
-        WHERE id = $1`,
-		ticket.AssignedTo,
-	).Scan(
-		&firstName,
-		&lastName,
-		&email)
-
-	if dbErr != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
-		return
+	if err != nil {
+		return 0, err
 	}
+	return id, nil
+}
 
-	var accomm_room_no string
-	if ticket.AccommodationRoomNumber == 0 {
-		accomm_room_no = ""
-	} else {
-		accomm_room_no = strconv.Itoa(ticket.AccommodationRoomNumber)
-	}
-
-	body := `
-		<html>
-		<body>
-			<h1 style="font-weight:700;">A ticket has been assigned to you</h1>
-			<p>Please see ticket information or visit the link below.</p>
-			<ul style="list-style-type:none;">
-			<li style="padding-bottom:5px;">
-					<h2 style="font-weight:700;padding-bottom:0px;">#` + strconv.Itoa(id) + ` ` + ticket.RequestDetail + `</h2>` +
-		`</li>
-				<li style="padding-bottom:20px;">
-					Reported By: ` + ticket.ReportedBy +
-		`</li>
-				<li style="padding-bottom:20px;">
-					Assigned To: ` + firstName + ` ` + lastName +
-		`</li>
-				<li style="padding-bottom:20px;">
-					Accommodation Name: ` + ticket.AccommodationName +
-		`</li>
-				<li style="padding-bottom:20px;">
-					Accommodation Room Number: ` + accomm_room_no +
-		`</li>
-				<li style="padding-bottom:20px;">
-					Specific Location: ` + ticket.AccommodationSpecificLocation +
-		`</li>
-				<li style="padding-bottom:20px;">
-					Accommodation Type: ` + ticket.AccommodationType +
-		`</li>
-				<li style="padding-bottom:20px;">
-					Requst Type: ` + ticket.RequestType +
-		`</li>
-				<li style="padding-bottom:20px;">
-					Task Priority: ` + ticket.TaskPriority +
-		`</li>
-				<li style="padding-bottom:30px;">
-					Notes: ` + ticket.Note +
-		`</li>
-			</ul>
-			<a href="http://192.168.1.57:9000/dashboard">Go To Ticketing Management System</a>
-	`
-
-	server := "smtp.office365.com:587"
-	sender := "rmdejesus@skijapan.com"
-	password := "Rmdj1q2w3e!"
-	subject := "Ticket #" + strconv.Itoa(id) + " Has Been Assigned To You"
-	message := body
-	to := []string{email}
-
-	auth := Auth(sender, password)
-
-	mailBody := []byte("Subject:" + subject + "\r\nMIME-version: 1.0;\r\nContent-Type: text/html; charset=\"UTF-8\";\r\n\r\n" + message)
-	mailerErr := smtp.SendMail(server, auth, sender, to, mailBody)
-	if mailerErr != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Mailer error"})
-		return
+// sendTicketAssignedMail tells the assignee of a new ticket about it
+func (h *AuthHandler) sendTicketAssignedMail(ctx context.Context, ticket *models.Ticket) error {
+	assigneeName, email, err := h.userContact(ctx, ticket.AssignedTo)
+	if err != nil {
+		return err
 	}
 
-	c.JSON(http.StatusCreated, gin.H{
-		"message":   "Ticket registered successfully",
-		"ticket_id": id,
-	})
+	org := h.organisation(ctx, ticket.OrgID)
+	body := ticketMailBody(org, "A ticket has been assigned to you", "", ticket, assigneeName)
+	subject := "Ticket #" + strconv.Itoa(ticket.ID) + " Has Been Assigned To You"
+
+	if err := sendMail(org, []string{email}, subject, body); err != nil {
+		return fmt.Errorf("%w: %v", errMailer, err)
+	}
+	return nil
 }
 
 // Get all tickets
 // @Summary Get All Tickets
-// @Description List all tickets available
+// @Description List all tickets available, optionally filtered
 // @ID get-tickets
 // @Produce json
+// @Param task_status query string false "Status"
+// @Param task_priority query string false "Priority"
+// @Param request_type query string false "Request type"
+// @Param assigned_to query int false "Assignee user ID"
+// @Param accommodation_id query int false "Accommodation ID"
+// @Param team_id query int false "Team ID"
+// @Param created_after query string false "Created at or after this time or date"
+// @Param created_before query string false "Created before this time or date"
 // @Success 200 "Successful response"
+// @Failure 400 "Invalid filter"
 // @Failure 500 "Database error"
 // @Router /tickets [get]
 // @Security Bearer
 func (h *AuthHandler) GetTickets(c *gin.Context) {
 	var tickets []models.Ticket
 
-	rows, err := h.db.Query(context.Background(), "SELECT id, reported_by, accommodation_name, accommodation_room_number, accommodation_specific_location, accommodation_type, request_type, request_detail, task_status, task_priority, alert_level, assigned_to, note, image, creation_date::text, completion_date::text  FROM ticket ORDER BY creation_date DESC")
+	var filter models.TicketFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input format", "details": err.Error()})
+		return
+	}
+	filter.OrgID = currentOrgID(c)
+	where, args, err := ticketFilterSQL(filter, nil)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rows, err := h.db.Query(context.Background(), "SELECT "+ticketColumns+" FROM ticket "+where+" ORDER BY creation_date DESC", args...)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
@@ -191,23 +251,7 @@ func (h *AuthHandler) GetTickets(c *gin.Context) {
 	for rows.Next() {
 		var ticket models.Ticket
 
-		err := rows.Scan(
-			&ticket.ID,
-			&ticket.ReportedBy,
-			&ticket.AccommodationName,
-			&ticket.AccommodationRoomNumber,
-			&ticket.AccommodationSpecificLocation,
-			&ticket.AccommodationType,
-			&ticket.RequestType,
-			&ticket.RequestDetail,
-			&ticket.TaskStatus,
-			&ticket.TaskPriority,
-			&ticket.AlertLevel,
-			&ticket.AssignedTo,
-			&ticket.Note,
-			&ticket.Image,
-			&ticket.CreatedDate,
-			&ticket.CompletionDate)
+		err := scanTicket(rows, &ticket)
 
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Process failed"})
@@ -241,7 +285,9 @@ func (h *AuthHandler) GetTickets(c *gin.Context) {
 // @Produce json
 // @Param id path int true "Ticket ID"
 // @Success 200 "Successful response"
+// @Success 304 "Not modified since the If-None-Match ETag"
 // @Failure 400 "Invalid ticket ID"
+// @Failure 404 "Ticket not found"
 // @Failure 500 "Database error"
 // @Router /tickets/{id} [get]
 // @Security Bearer
@@ -256,34 +302,30 @@ func (h *AuthHandler) GetTicket(c *gin.Context) {
 		return
 	}
 
-	dbErr := h.db.QueryRow(context.Background(), `
-        SELECT id, reported_by, accommodation_name, accommodation_room_number, accommodation_specific_location, accommodation_type, request_type, request_detail, task_status, task_priority, alert_level, assigned_to, note, image, creation_date::text, completion_date::text
+	dbErr := scanTicket(h.db.QueryRow(context.Background(), `
+        SELECT `+ticketColumns+`
         FROM ticket 
-        WHERE id = $1`,
-		id,
-	).Scan(
-		&ticket.ID,
-		&ticket.ReportedBy,
-		&ticket.AccommodationName,
-		&ticket.AccommodationRoomNumber,
-		&ticket.AccommodationSpecificLocation,
-		&ticket.AccommodationType,
-		&ticket.RequestType,
-		&ticket.RequestDetail,
-		&ticket.TaskStatus,
-		&ticket.TaskPriority,
-		&ticket.AlertLevel,
-		&ticket.AssignedTo,
-		&ticket.Note,
-		&ticket.Image,
-		&ticket.CreatedDate,
-		&ticket.CompletionDate)
+        WHERE id = $1 AND org_id = $2 AND deleted_at IS NULL`,
+		id, currentOrgID(c),
+	), &ticket)
 
+	if errors.Is(dbErr, pgx.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ticket not found"})
+		return
+	}
 	if dbErr != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
 	}
 
+	// Clients send the ETag back in If-Match to update the ticket
+	etag := ticketETag(ticket.Version)
+	c.Header("ETag", etag)
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
 	// Return ticket list
 	c.JSON(http.StatusOK, ticket)
 }
@@ -294,9 +336,12 @@ func (h *AuthHandler) GetTicket(c *gin.Context) {
 // @ID update-ticket
 // @Produce json
 // @Param id path int true "Ticket ID"
+// @Param If-Match header string true "ETag of the ticket version being changed, or * to skip the check"
 // @Success 200 "Successful response"
 // @Failure 400 "Invalid ticket ID"
 // @Failure 404 "Ticket not found"
+// @Failure 412 "Ticket was changed by someone else"
+// @Failure 428 "If-Match header required"
 // @Failure 500 "Database error"
 // @Router /tickets/{id} [patch]
 // @Security Bearer
@@ -316,52 +361,83 @@ func (h *AuthHandler) UpdateTicket(c *gin.Context) {
 		return
 	}
 
-	var exists bool
-	databaseErr := h.db.QueryRow(context.Background(), "SELECT EXISTS(SELECT 1 FROM ticket WHERE id = $1)",
-		id).Scan(&exists)
+	version, ok := h.requireIfMatch(c, id)
+	if !ok {
+		return
+	}
+
+	var previousAssignee int
+	databaseErr := h.db.QueryRow(context.Background(), "SELECT COALESCE(assigned_to, 0) FROM ticket WHERE id = $1 AND org_id = $2 AND deleted_at IS NULL",
+		id, currentOrgID(c)).Scan(&previousAssignee)
+	if errors.Is(databaseErr, pgx.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ticket not found"})
+		return
+	}
 	if databaseErr != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
 	}
-	if !exists {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Ticket not found"})
+
+	if err := h.validateCatalogValues(context.Background(), &ticketUpdate.RequestType, &ticketUpdate.TaskPriority); err != nil {
+		if errors.Is(err, errInvalidCatalog) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
 	}
 
-	result := patchUserRecord(h.db, ticketUpdate, id)
+	if ticketUpdate.AssignedTo > 0 {
+		if err := checkOrgUsers(context.Background(), h.db, currentOrgID(c), ticketUpdate.AssignedTo); err != nil {
+			if errors.Is(err, errOtherOrganisation) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "assigned_to: " + err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+	}
+
+	// Keep the text columns in step with any accommodation references
+	if err := h.resolveTicketUpdateAccommodation(context.Background(), currentOrgID(c), &ticketUpdate); err != nil {
+		if errors.Is(err, errInvalidAccommodation) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	result := patchUserRecord(h.db, ticketUpdate, id, currentOrgID(c), version)
 	if result == http.StatusNotFound {
 		c.JSON(http.StatusNotFound, gin.H{"error": "No data to update for ticket"})
 		return
 	}
+	if result == http.StatusPreconditionFailed {
+		h.preconditionFailed(c, id)
+		return
+	}
 	if result == http.StatusBadRequest {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Database error"})
 		return
 	}
 
+	// A new priority brings new SLA deadlines
+	if ticketUpdate.TaskPriority != "" {
+		if err := applySLA(context.Background(), h.db, id); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+	}
+
 	// Verify the update
 	var updatedTicket models.Ticket
-	dbErr := h.db.QueryRow(context.Background(), `
-        SELECT id, reported_by, accommodation_name, accommodation_room_number, accommodation_specific_location, accommodation_type, request_type, request_detail, task_status, task_priority, alert_level, assigned_to, note, image, creation_date::text, completion_date::text 
+	dbErr := scanTicket(h.db.QueryRow(context.Background(), `
+        SELECT `+ticketColumns+`
         FROM ticket 
-        WHERE id = $1`,
-		id,
-	).Scan(
-		&updatedTicket.ID,
-		&updatedTicket.ReportedBy,
-		&updatedTicket.AccommodationName,
-		&updatedTicket.AccommodationRoomNumber,
-		&updatedTicket.AccommodationSpecificLocation,
-		&updatedTicket.AccommodationType,
-		&updatedTicket.RequestType,
-		&updatedTicket.RequestDetail,
-		&updatedTicket.TaskStatus,
-		&updatedTicket.TaskPriority,
-		&updatedTicket.AlertLevel,
-		&updatedTicket.AssignedTo,
-		&updatedTicket.Note,
-		&updatedTicket.Image,
-		&updatedTicket.CreatedDate,
-		&updatedTicket.CompletionDate)
+        WHERE id = $1 AND org_id = $2`,
+		id, currentOrgID(c),
+	), &updatedTicket)
 
 	if dbErr != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting updated ticket"})
@@ -381,75 +457,55 @@ func (h *AuthHandler) UpdateTicket(c *gin.Context) {
 		&lastName,
 		&email)
 
-	if userErr != nil {
+	// A queued ticket has nobody to email directly; its team hears about
+	// the change as watchers
+	if userErr != nil && !(updatedTicket.AssignedTo == 0 && errors.Is(userErr, pgx.ErrNoRows)) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
 	}
 
-	var accomm_room_no string
-	if updatedTicket.AccommodationRoomNumber == 0 {
-		accomm_room_no = ""
-	} else {
-		accomm_room_no = strconv.Itoa(updatedTicket.AccommodationRoomNumber)
-	}
-
-	body := `
-		<html>
-		<body>
-			<h1 style="font-weight:700;">A ticket has been updated</h1>
-			<p>Please see ticket information or visit the link below.</p>
-			<ul style="list-style-type:none;">
-			<li style="padding-bottom:5px;">
-					<h2 style="font-weight:700;padding-bottom:0px;">#` + strconv.Itoa(updatedTicket.ID) + ` ` + updatedTicket.RequestDetail + `</h2>` +
-		`</li>
-				<li style="padding-bottom:20px;">
-					Reported By: ` + updatedTicket.ReportedBy +
-		`</li>
-				<li style="padding-bottom:20px;">
-					Assigned To: ` + firstName + ` ` + lastName +
-		`</li>
-				<li style="padding-bottom:20px;">
-					Accommodation Name: ` + updatedTicket.AccommodationName +
-		`</li>
-				<li style="padding-bottom:20px;">
-					Accommodation Room Number: ` + accomm_room_no +
-		`</li>
-				<li style="padding-bottom:20px;">
-					Specific Location: ` + updatedTicket.AccommodationSpecificLocation +
-		`</li>
-				<li style="padding-bottom:20px;">
-					Accommodation Type: ` + updatedTicket.AccommodationType +
-		`</li>
-				<li style="padding-bottom:20px;">
-					Requst Type: ` + updatedTicket.RequestType +
-		`</li>
-				<li style="padding-bottom:20px;">
-					Task Priority: ` + updatedTicket.TaskPriority +
-		`</li>
-				<li style="padding-bottom:30px;">
-					Notes: ` + updatedTicket.Note +
-		`</li>
-			</ul>
-			<a href="http://192.168.1.57:9000/dashboard">Go To Ticketing Management System</a>
-	`
-
-	server := "smtp.office365.com:587"
-	sender := "rmdejesus@skijapan.com"
-	password := "Rmdj1q2w3e!"
+	org := h.organisation(context.Background(), updatedTicket.OrgID)
+	body := ticketMailBody(org, "A ticket has been updated", "", &updatedTicket, firstName+" "+lastName)
+
 	subject := "Ticket #" + strconv.Itoa(updatedTicket.ID) + " Updated"
-	message := body
-	to := []string{email}
 
-	auth := Auth(sender, password)
+	if email != "" {
+		if err := sendMail(org, []string{email}, subject, body); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Mailer error"})
+			return
+		}
+	}
 
-	mailBody := []byte("Subject:" + subject + "\r\nMIME-version: 1.0;\r\nContent-Type: text/html; charset=\"UTF-8\";\r\n\r\n" + message)
-	mailerErr := smtp.SendMail(server, auth, sender, to, mailBody)
-	if mailerErr != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Mailer error"})
-		return
+	var actor *int
+	if userID, ok := currentUserID(c); ok {
+		actor = &userID
+	}
+
+	event, heading := eventTicketUpdated, "A ticket has been updated"
+	if ticketUpdate.TaskStatus != "" {
+		event, heading = eventStatusChanged, "A ticket status has been updated to "+strings.ToLower(updatedTicket.TaskStatus)
+	}
+	exclude := []int{updatedTicket.AssignedTo, previousAssignee}
+	if actor != nil {
+		exclude = append(exclude, *actor)
+	}
+	h.notifyWatchers(context.Background(), event, &updatedTicket, subject, heading, "", exclude...)
+
+	// The previous assignee loses the ticket and must be told
+	if updatedTicket.AssignedTo != previousAssignee {
+		assignedBy := actor
+		if err := h.recordReassignment(context.Background(), &updatedTicket, previousAssignee, assignedBy); err != nil {
+			if errors.Is(err, errMailer) {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Mailer error"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
 	}
 
 	// Return ticket list
+	c.Header("ETag", ticketETag(updatedTicket.Version))
 	c.JSON(result, updatedTicket)
 }
 
@@ -459,9 +515,12 @@ func (h *AuthHandler) UpdateTicket(c *gin.Context) {
 // @ID update-ticket-pending
 // @Produce json
 // @Param id path int true "Ticket ID"
+// @Param If-Match header string true "ETag of the ticket version being changed, or * to skip the check"
 // @Success 200 "Successful response"
 // @Failure 400 "Invalid ticket ID"
 // @Failure 404 "Ticket not found"
+// @Failure 412 "Ticket was changed by someone else"
+// @Failure 428 "If-Match header required"
 // @Failure 500 "Database error"
 // @Router /tickets/{id}/pending [patch]
 // @Security Bearer
@@ -475,8 +534,8 @@ func (h *AuthHandler) UpdatePendingTicket(c *gin.Context) {
 	}
 
 	var exists bool
-	databaseErr := h.db.QueryRow(context.Background(), "SELECT EXISTS(SELECT 1 FROM ticket WHERE id = $1)",
-		id).Scan(&exists)
+	databaseErr := h.db.QueryRow(context.Background(), "SELECT EXISTS(SELECT 1 FROM ticket WHERE id = $1 AND org_id = $2 AND deleted_at IS NULL)",
+		id, currentOrgID(c)).Scan(&exists)
 	if databaseErr != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
@@ -486,6 +545,11 @@ func (h *AuthHandler) UpdatePendingTicket(c *gin.Context) {
 		return
 	}
 
+	version, ok := h.requireIfMatch(c, id)
+	if !ok {
+		return
+	}
+
 	tx, err := h.db.Begin(context.Background())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction start failed"})
@@ -493,27 +557,17 @@ func (h *AuthHandler) UpdatePendingTicket(c *gin.Context) {
 	}
 
 	var updatedTicket models.Ticket
-	err = tx.QueryRow(context.Background(), `
+	err = scanTicket(tx.QueryRow(context.Background(), `
         UPDATE ticket 
-        SET task_status = 'Pending'
-				WHERE id = $1
-        RETURNING id, reported_by, accommodation_name, accommodation_room_number, accommodation_specific_location, accommodation_type, request_type, request_detail, task_status, task_priority, alert_level, assigned_to, note, image, creation_date::text, completion_date::text`, id).Scan(&updatedTicket.ID,
-		&updatedTicket.ReportedBy,
-		&updatedTicket.AccommodationName,
-		&updatedTicket.AccommodationRoomNumber,
-		&updatedTicket.AccommodationSpecificLocation,
-		&updatedTicket.AccommodationType,
-		&updatedTicket.RequestType,
-		&updatedTicket.RequestDetail,
-		&updatedTicket.TaskStatus,
-		&updatedTicket.TaskPriority,
-		&updatedTicket.AlertLevel,
-		&updatedTicket.AssignedTo,
-		&updatedTicket.Note,
-		&updatedTicket.Image,
-		&updatedTicket.CreatedDate,
-		&updatedTicket.CompletionDate)
+        SET task_status = 'Pending', responded_at = COALESCE(responded_at, now())
+				WHERE id = $1 AND org_id = $3 AND deleted_at IS NULL AND ($2::int IS NULL OR version = $2)
+        RETURNING `+ticketColumns, id, version, currentOrgID(c)), &updatedTicket)
 
+	if errors.Is(err, pgx.ErrNoRows) {
+		tx.Rollback(context.Background())
+		h.preconditionFailed(c, id)
+		return
+	}
 	if err != nil {
 		tx.Rollback(context.Background())
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ticket creation failed"})
@@ -538,75 +592,33 @@ func (h *AuthHandler) UpdatePendingTicket(c *gin.Context) {
 		&lastName,
 		&email)
 
-	if userErr != nil {
+	// A queued ticket has nobody to email directly; its team hears about
+	// the change as watchers
+	if userErr != nil && !(updatedTicket.AssignedTo == 0 && errors.Is(userErr, pgx.ErrNoRows)) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
 	}
 
-	var accomm_room_no string
-	if updatedTicket.AccommodationRoomNumber == 0 {
-		accomm_room_no = ""
-	} else {
-		accomm_room_no = strconv.Itoa(updatedTicket.AccommodationRoomNumber)
-	}
-
-	body := `
-		<html>
-		<body>
-			<h1 style="font-weight:700;">A ticket status has been updated to pending</h1>
-			<p>Please see ticket information or visit the link below.</p>
-			<ul style="list-style-type:none;">
-			<li style="padding-bottom:5px;">
-					<h2 style="font-weight:700;padding-bottom:0px;">#` + strconv.Itoa(updatedTicket.ID) + ` ` + updatedTicket.RequestDetail + `</h2>` +
-		`</li>
-				<li style="padding-bottom:20px;">
-					Reported By: ` + updatedTicket.ReportedBy +
-		`</li>
-				<li style="padding-bottom:20px;">
-					Assigned To: ` + firstName + ` ` + lastName +
-		`</li>
-				<li style="padding-bottom:20px;">
-					Accommodation Name: ` + updatedTicket.AccommodationName +
-		`</li>
-				<li style="padding-bottom:20px;">
-					Accommodation Room Number: ` + accomm_room_no +
-		`</li>
-				<li style="padding-bottom:20px;">
-					Specific Location: ` + updatedTicket.AccommodationSpecificLocation +
-		`</li>
-				<li style="padding-bottom:20px;">
-					Accommodation Type: ` + updatedTicket.AccommodationType +
-		`</li>
-				<li style="padding-bottom:20px;">
-					Requst Type: ` + updatedTicket.RequestType +
-		`</li>
-				<li style="padding-bottom:20px;">
-					Task Priority: ` + updatedTicket.TaskPriority +
-		`</li>
-				<li style="padding-bottom:30px;">
-					Notes: ` + updatedTicket.Note +
-		`</li>
-			</ul>
-			<a href="https://ticket-web-wu7p.onrender.com/">Go To Ticketing Management System</a>
-	`
-
-	server := "smtp.office365.com:587"
-	sender := "rmdejesus@skijapan.com"
-	password := "Rmdj1q2w3e!"
+	org := h.organisation(context.Background(), updatedTicket.OrgID)
+	body := ticketMailBody(org, "A ticket status has been updated to pending", "", &updatedTicket, firstName+" "+lastName)
+
 	subject := "Ticket #" + strconv.Itoa(updatedTicket.ID) + " Updated To Pending"
-	message := body
-	to := []string{email}
 
-	auth := Auth(sender, password)
+	if email != "" {
+		if err := sendMail(org, []string{email}, subject, body); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Mailer error"})
+			return
+		}
+	}
 
-	mailBody := []byte("Subject:" + subject + "\r\nMIME-version: 1.0;\r\nContent-Type: text/html; charset=\"UTF-8\";\r\n\r\n" + message)
-	mailerErr := smtp.SendMail(server, auth, sender, to, mailBody)
-	if mailerErr != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Mailer error"})
-		return
+	exclude := []int{updatedTicket.AssignedTo}
+	if userID, ok := currentUserID(c); ok {
+		exclude = append(exclude, userID)
 	}
+	h.notifyWatchers(context.Background(), eventStatusChanged, &updatedTicket, subject, "A ticket status has been updated to pending", "", exclude...)
 
 	// Return ticket list
+	c.Header("ETag", ticketETag(updatedTicket.Version))
 	c.JSON(http.StatusOK, "")
 }
 
@@ -616,9 +628,12 @@ func (h *AuthHandler) UpdatePendingTicket(c *gin.Context) {
 // @ID update-ticket-completed
 // @Produce json
 // @Param id path int true "Ticket ID"
+// @Param If-Match header string true "ETag of the ticket version being changed, or * to skip the check"
 // @Success 200 "Successful response"
 // @Failure 400 "Invalid ticket ID"
 // @Failure 404 "Ticket not found"
+// @Failure 412 "Ticket was changed by someone else"
+// @Failure 428 "If-Match header required"
 // @Failure 500 "Database error"
 // @Router /tickets/{id}/completed [patch]
 // @Security Bearer
@@ -632,8 +647,8 @@ func (h *AuthHandler) UpdateCompletedTicket(c *gin.Context) {
 	}
 
 	var exists bool
-	databaseErr := h.db.QueryRow(context.Background(), "SELECT EXISTS(SELECT 1 FROM ticket WHERE id = $1)",
-		id).Scan(&exists)
+	databaseErr := h.db.QueryRow(context.Background(), "SELECT EXISTS(SELECT 1 FROM ticket WHERE id = $1 AND org_id = $2 AND deleted_at IS NULL)",
+		id, currentOrgID(c)).Scan(&exists)
 	if databaseErr != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
@@ -643,6 +658,11 @@ func (h *AuthHandler) UpdateCompletedTicket(c *gin.Context) {
 		return
 	}
 
+	version, ok := h.requireIfMatch(c, id)
+	if !ok {
+		return
+	}
+
 	tx, err := h.db.Begin(context.Background())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction start failed"})
@@ -650,27 +670,17 @@ func (h *AuthHandler) UpdateCompletedTicket(c *gin.Context) {
 	}
 
 	var updatedTicket models.Ticket
-	err = tx.QueryRow(context.Background(), `
+	err = scanTicket(tx.QueryRow(context.Background(), `
         UPDATE ticket 
-        SET task_status = 'Completed'
-				WHERE id = $1
-        RETURNING id, reported_by, accommodation_name, accommodation_room_number, accommodation_specific_location, accommodation_type, request_type, request_detail, task_status, task_priority, alert_level, assigned_to, note, image, creation_date::text, completion_date::text`, id).Scan(&updatedTicket.ID,
-		&updatedTicket.ReportedBy,
-		&updatedTicket.AccommodationName,
-		&updatedTicket.AccommodationRoomNumber,
-		&updatedTicket.AccommodationSpecificLocation,
-		&updatedTicket.AccommodationType,
-		&updatedTicket.RequestType,
-		&updatedTicket.RequestDetail,
-		&updatedTicket.TaskStatus,
-		&updatedTicket.TaskPriority,
-		&updatedTicket.AlertLevel,
-		&updatedTicket.AssignedTo,
-		&updatedTicket.Note,
-		&updatedTicket.Image,
-		&updatedTicket.CreatedDate,
-		&updatedTicket.CompletionDate)
+        SET task_status = 'Completed', responded_at = COALESCE(responded_at, now()), completion_date = COALESCE(completion_date, now())
+				WHERE id = $1 AND org_id = $3 AND deleted_at IS NULL AND ($2::int IS NULL OR version = $2)
+        RETURNING `+ticketColumns, id, version, currentOrgID(c)), &updatedTicket)
 
+	if errors.Is(err, pgx.ErrNoRows) {
+		tx.Rollback(context.Background())
+		h.preconditionFailed(c, id)
+		return
+	}
 	if err != nil {
 		tx.Rollback(context.Background())
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ticket creation failed"})
@@ -695,86 +705,48 @@ func (h *AuthHandler) UpdateCompletedTicket(c *gin.Context) {
 		&lastName,
 		&email)
 
-	if userErr != nil {
+	// A queued ticket has nobody to email directly; its team hears about
+	// the change as watchers
+	if userErr != nil && !(updatedTicket.AssignedTo == 0 && errors.Is(userErr, pgx.ErrNoRows)) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
 	}
 
-	var accomm_room_no string
-	if updatedTicket.AccommodationRoomNumber == 0 {
-		accomm_room_no = ""
-	} else {
-		accomm_room_no = strconv.Itoa(updatedTicket.AccommodationRoomNumber)
-	}
-
-	body := `
-		<html>
-		<body>
-			<h1 style="font-weight:700;">A ticket status has been updated to completed</h1>
-			<p>Please see ticket information or visit the link below.</p>
-			<ul style="list-style-type:none;">
-			<li style="padding-bottom:5px;">
-					<h2 style="font-weight:700;padding-bottom:0px;">#` + strconv.Itoa(updatedTicket.ID) + ` ` + updatedTicket.RequestDetail + `</h2>` +
-		`</li>
-				<li style="padding-bottom:20px;">
-					Reported By: ` + updatedTicket.ReportedBy +
-		`</li>
-				<li style="padding-bottom:20px;">
-					Assigned To: ` + firstName + ` ` + lastName +
-		`</li>
-				<li style="padding-bottom:20px;">
-					Accommodation Name: ` + updatedTicket.AccommodationName +
-		`</li>
-				<li style="padding-bottom:20px;">
-					Accommodation Room Number: ` + accomm_room_no +
-		`</li>
-				<li style="padding-bottom:20px;">
-					Specific Location: ` + updatedTicket.AccommodationSpecificLocation +
-		`</li>
-				<li style="padding-bottom:20px;">
-					Accommodation Type: ` + updatedTicket.AccommodationType +
-		`</li>
-				<li style="padding-bottom:20px;">
-					Requst Type: ` + updatedTicket.RequestType +
-		`</li>
-				<li style="padding-bottom:20px;">
-					Task Priority: ` + updatedTicket.TaskPriority +
-		`</li>
-				<li style="padding-bottom:30px;">
-					Notes: ` + updatedTicket.Note +
-		`</li>
-			</ul>
-			<a href="https://ticket-web-wu7p.onrender.com/">Go To Ticketing Management System</a>
-	`
-
-	server := "smtp.office365.com:587"
-	sender := "rmdejesus@skijapan.com"
-	password := "Rmdj1q2w3e!"
+	org := h.organisation(context.Background(), updatedTicket.OrgID)
+	body := ticketMailBody(org, "A ticket status has been updated to completed", "", &updatedTicket, firstName+" "+lastName)
+
 	subject := "Ticket #" + strconv.Itoa(updatedTicket.ID) + " Updated To Completed"
-	message := body
-	to := []string{email}
 
-	auth := Auth(sender, password)
+	if email != "" {
+		if err := sendMail(org, []string{email}, subject, body); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Mailer error"})
+			return
+		}
+	}
 
-	mailBody := []byte("Subject:" + subject + "\r\nMIME-version: 1.0;\r\nContent-Type: text/html; charset=\"UTF-8\";\r\n\r\n" + message)
-	mailerErr := smtp.SendMail(server, auth, sender, to, mailBody)
-	if mailerErr != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Mailer error"})
-		return
+	exclude := []int{updatedTicket.AssignedTo}
+	if userID, ok := currentUserID(c); ok {
+		exclude = append(exclude, userID)
 	}
+	h.notifyWatchers(context.Background(), eventStatusChanged, &updatedTicket, subject, "A ticket status has been updated to completed", "", exclude...)
 
 	// Return ticket list
+	c.Header("ETag", ticketETag(updatedTicket.Version))
 	c.JSON(http.StatusOK, "")
 }
 
 // Delete a ticket
 // @Summary Delete a Ticket
-// @Description Delete single ticket
+// @Description Move a ticket to the trash. Admins can restore it until it is purged.
 // @ID delete-ticket
 // @Produce json
 // @Param id path int true "Ticket ID"
+// @Param If-Match header string true "ETag of the ticket version being deleted, or * to skip the check"
 // @Success 200 "Successful response"
 // @Failure 400 "Invalid ticket ID"
+// @Failure 404 "Ticket not found"
+// @Failure 412 "Ticket was changed by someone else"
+// @Failure 428 "If-Match header required"
 // @Router /tickets/{id} [delete]
 // @Security Bearer
 func (h *AuthHandler) DeleteTicket(c *gin.Context) {
@@ -786,19 +758,36 @@ func (h *AuthHandler) DeleteTicket(c *gin.Context) {
 		return
 	}
 
-	result, dbErr := h.db.Exec(context.Background(), "DELETE FROM ticket WHERE id = $1", id)
+	version, ok := h.requireIfMatch(c, id)
+	if !ok {
+		return
+	}
+
+	var deletedBy *int
+	if userID, ok := currentUserID(c); ok {
+		deletedBy = &userID
+	}
+
+	result, dbErr := h.db.Exec(context.Background(), `
+        UPDATE ticket SET deleted_at = now(), deleted_by = $2
+        WHERE id = $1 AND org_id = $4 AND deleted_at IS NULL AND ($3::int IS NULL OR version = $3)`,
+		id, deletedBy, version, currentOrgID(c))
 	if dbErr != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Database error"})
 		return
 	}
-	// rowsAffected, dbErr := result.RowsAffected()
-	// if dbErr != nil {
-	// 	c.JSON(http.StatusBadRequest, gin.H{"error": "Database error"})
-	// 	return
-	// }
 
 	if result.RowsAffected() == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "No record deleted"})
+		var exists bool
+		if err := h.db.QueryRow(context.Background(), "SELECT EXISTS(SELECT 1 FROM ticket WHERE id = $1 AND org_id = $2 AND deleted_at IS NULL)", id, currentOrgID(c)).Scan(&exists); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if !exists {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Ticket not found"})
+			return
+		}
+		h.preconditionFailed(c, id)
 		return
 	}
 
@@ -806,71 +795,124 @@ func (h *AuthHandler) DeleteTicket(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"id": id})
 }
 
-func patchUserRecord(db *pgx.Conn, ticketUpdate models.TicketUpdate, id int) int {
+// patchUserRecord applies the fields set on ticketUpdate to ticket id of
+// organisation orgID. When version is set the update only applies to that
+// ticket version, reporting http.StatusPreconditionFailed otherwise.
+func patchUserRecord(db *pgx.Conn, ticketUpdate models.TicketUpdate, id, orgID int, version *int) int {
 	setClauses := []string{}
+	args := []any{}
+
+	// set appends a "column = $n" clause bound to value
+	set := func(column string, value any) {
+		args = append(args, value)
+		setClauses = append(setClauses, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
 
 	if ticketUpdate.ReportedBy != "" {
-		setClauses = append(setClauses, fmt.Sprintf("reported_by = %s", "'"+ticketUpdate.ReportedBy+"'"))
+		set("reported_by", ticketUpdate.ReportedBy)
 	}
 	if ticketUpdate.AccommodationName != "" {
-		setClauses = append(setClauses, fmt.Sprintf("accommodation_name = %s", "'"+ticketUpdate.AccommodationName+"'"))
+		set("accommodation_name", ticketUpdate.AccommodationName)
 	}
 	if ticketUpdate.AccommodationRoomNumber != -1 {
-		setClauses = append(setClauses, fmt.Sprintf("accommodation_room_number = %d", ticketUpdate.AccommodationRoomNumber))
+		set("accommodation_room_number", ticketUpdate.AccommodationRoomNumber)
 	}
 	if ticketUpdate.AccommodationSpecificLocation != "" {
-		setClauses = append(setClauses, fmt.Sprintf("accommodation_specific_location = %s", "'"+ticketUpdate.AccommodationSpecificLocation+"'"))
+		set("accommodation_specific_location", ticketUpdate.AccommodationSpecificLocation)
 	}
 	if ticketUpdate.AccommodationType != "" {
-		setClauses = append(setClauses, fmt.Sprintf("accommodation_type = %s", "'"+ticketUpdate.AccommodationType+"'"))
+		set("accommodation_type", ticketUpdate.AccommodationType)
 	}
 	if ticketUpdate.RequestType != "" {
-		setClauses = append(setClauses, fmt.Sprintf("request_type = %s", "'"+ticketUpdate.RequestType+"'"))
+		set("request_type", ticketUpdate.RequestType)
 	}
 	if ticketUpdate.RequestDetail != "" {
-		setClauses = append(setClauses, fmt.Sprintf("request_detail = %s", "'"+ticketUpdate.RequestDetail+"'"))
+		set("request_detail", ticketUpdate.RequestDetail)
 	}
 	if ticketUpdate.TaskStatus != "" {
-		setClauses = append(setClauses, fmt.Sprintf("task_status = %s", "'"+ticketUpdate.TaskStatus+"'"))
+		set("task_status", ticketUpdate.TaskStatus)
+		// Any move away from "Assigned" counts as the SLA response
+		if ticketUpdate.TaskStatus != "Assigned" {
+			setClauses = append(setClauses, "responded_at = COALESCE(responded_at, now())")
+		}
+		if ticketUpdate.TaskStatus == "Completed" {
+			setClauses = append(setClauses, "completion_date = COALESCE(completion_date, now())")
+		}
 	}
 	if ticketUpdate.TaskPriority != "" {
-		setClauses = append(setClauses, fmt.Sprintf("task_priority = %s", "'"+ticketUpdate.TaskPriority+"'"))
+		set("task_priority", ticketUpdate.TaskPriority)
 	}
-	if ticketUpdate.AssignedTo != -1 {
-		setClauses = append(setClauses, fmt.Sprintf("assigned_to = %d", ticketUpdate.AssignedTo))
+	// 0 leaves the assignee alone, so a queued ticket stays in its queue
+	if ticketUpdate.AssignedTo > 0 {
+		set("assigned_to", ticketUpdate.AssignedTo)
 	}
 	if ticketUpdate.Note != "" {
-		setClauses = append(setClauses, fmt.Sprintf("note = %s", "'"+ticketUpdate.Note+"'"))
+		set("note", ticketUpdate.Note)
 	}
 	if len(ticketUpdate.Image) != 0 {
-		setClauses = append(setClauses, fmt.Sprintf("image = %s", ticketUpdate.Image))
+		set("image", ticketUpdate.Image)
+	}
+	if ticketUpdate.AccommodationChanged {
+		set("accommodation_id", ticketUpdate.AccommodationID)
+		set("room_id", ticketUpdate.RoomID)
+		set("location_id", ticketUpdate.LocationID)
 	}
 
 	if len(setClauses) == 0 {
 		return http.StatusNotFound
 	}
 
-	query := fmt.Sprintf("UPDATE ticket SET %s WHERE id = %d", strings.Join(setClauses, ", "), id)
-
-	// Prepare the statement
-	// stmtName := "updateTicketByID"
-	// _, err := db.Prepare(context.Background(), stmtName, query)
-	// if err != nil {
-	// 	return http.StatusBadRequest
-	// }
+	args = append(args, id, orgID, version)
+	query := fmt.Sprintf("UPDATE ticket SET %s WHERE id = $%d AND org_id = $%d AND deleted_at IS NULL AND ($%d::int IS NULL OR version = $%d)", strings.Join(setClauses, ", "), len(args)-2, len(args)-1, len(args), len(args))
 
-	_, err := db.Exec(context.Background(), query)
-
-	// stmt, err := db.Prepare(context.Background(), "updateUserByID", query)
-	// if err != nil {
-	// 	return http.StatusBadRequest
-	// }
-	// defer stmt.Close(context.Background())
-
-	// _, err = stmt.Exec()
+	result, err := db.Exec(context.Background(), query, args...)
 	if err != nil {
 		return http.StatusBadRequest
 	}
+	if result.RowsAffected() == 0 {
+		return http.StatusPreconditionFailed
+	}
 
 	return http.StatusOK
 }
+
+// ticketColumns is the ticket column list read by scanTicket
+const ticketColumns = `id, reported_by, accommodation_name, accommodation_room_number, accommodation_specific_location, accommodation_type, request_type, request_detail, task_status, task_priority, alert_level, COALESCE(assigned_to, 0), note, image, creation_date::text, completion_date::text, accommodation_id, room_id, location_id, response_due_at::text, due_at::text, responded_at::text, ` + ticketBreachedExpr + `, schedule_id, ` + ticketAssigneesExpr + `, version, deleted_at::text, deleted_by, team_id, org_id`
+
+// ticketAssigneesExpr lists a ticket's supporting assignees
+const ticketAssigneesExpr = `ARRAY(SELECT user_id FROM ticket_assignee WHERE ticket_assignee.ticket_id = ticket.id ORDER BY user_id)`
+
+// scanTicket scans a row selected with ticketColumns into ticket
+func scanTicket(row pgx.Row, ticket *models.Ticket) error {
+	return row.Scan(
+		&ticket.ID,
+		&ticket.ReportedBy,
+		&ticket.AccommodationName,
+		&ticket.AccommodationRoomNumber,
+		&ticket.AccommodationSpecificLocation,
+		&ticket.AccommodationType,
+		&ticket.RequestType,
+		&ticket.RequestDetail,
+		&ticket.TaskStatus,
+		&ticket.TaskPriority,
+		&ticket.AlertLevel,
+		&ticket.AssignedTo,
+		&ticket.Note,
+		&ticket.Image,
+		&ticket.CreatedDate,
+		&ticket.CompletionDate,
+		&ticket.AccommodationID,
+		&ticket.RoomID,
+		&ticket.LocationID,
+		&ticket.ResponseDueAt,
+		&ticket.DueAt,
+		&ticket.RespondedAt,
+		&ticket.Breached,
+		&ticket.ScheduleID,
+		&ticket.Assignees,
+		&ticket.Version,
+		&ticket.DeletedAt,
+		&ticket.DeletedBy,
+		&ticket.TeamID,
+		&ticket.OrgID)
+}
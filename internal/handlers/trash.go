@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"ticket-sys/internal/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// Get deleted tickets
+// @Summary Get Ticket Trash
+// @Description List deleted tickets, most recently deleted first. They can be restored until the retention period purges them.
+// @ID get-ticket-trash
+// @Produce json
+// @Success 200 "Successful response"
+// @Failure 500 "Database error"
+// @Router /tickets/trash [get]
+// @Security Bearer
+func (h *AuthHandler) GetTicketTrash(c *gin.Context) {
+	tickets := []models.Ticket{}
+
+	rows, err := h.db.Query(context.Background(), "SELECT "+ticketColumns+" FROM ticket WHERE deleted_at IS NOT NULL AND org_id = $1 ORDER BY deleted_at DESC", currentOrgID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	for rows.Next() {
+		var ticket models.Ticket
+		if err := scanTicket(rows, &ticket); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Process failed"})
+			return
+		}
+		tickets = append(tickets, ticket)
+	}
+
+	if err = rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ticket iteration failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tickets)
+}
+
+// Restore a deleted ticket
+// @Summary Restore a Ticket
+// @Description Move a ticket back out of the trash
+// @ID restore-ticket
+// @Produce json
+// @Param id path int true "Ticket ID"
+// @Success 200 "Successful response"
+// @Failure 400 "Invalid ticket ID"
+// @Failure 404 "Ticket not in the trash"
+// @Failure 500 "Database error"
+// @Router /tickets/{id}/restore [post]
+// @Security Bearer
+func (h *AuthHandler) RestoreTicket(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ticket ID"})
+		return
+	}
+
+	var ticket models.Ticket
+	err = scanTicket(h.db.QueryRow(context.Background(), `
+        UPDATE ticket SET deleted_at = NULL, deleted_by = NULL
+        WHERE id = $1 AND org_id = $2 AND deleted_at IS NOT NULL
+        RETURNING `+ticketColumns,
+		id, currentOrgID(c)), &ticket)
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ticket not in the trash"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.Header("ETag", ticketETag(ticket.Version))
+	c.JSON(http.StatusOK, ticket)
+}
+
+// SetTicketRetention sets how long deleted tickets stay in the trash before
+// purgeDeletedTickets removes them for good. Zero keeps them forever.
+func (h *AuthHandler) SetTicketRetention(retention time.Duration) {
+	h.ticketRetention = retention
+}
+
+// purgeDeletedTickets permanently removes tickets deleted longer ago than
+// the retention period, along with their comments and history
+func (h *AuthHandler) purgeDeletedTickets(ctx context.Context) error {
+	if h.ticketRetention <= 0 {
+		return nil
+	}
+	_, err := h.db.Exec(ctx, "DELETE FROM ticket WHERE deleted_at < $1", time.Now().Add(-h.ticketRetention))
+	return err
+}
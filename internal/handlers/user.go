@@ -0,0 +1,500 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"ticket-sys/internal/models"
+	"ticket-sys/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// userColumns are the columns of models.User. The password hash is left
+// out on purpose; only Login and checkCurrentPassword read it.
+const userColumns = `id, first_name, last_name, email, role, org_id, active, deactivated_at::text, mfa_enabled`
+
+// defaultUserPageSize is how many users a page of the user list holds
+// unless page_size says otherwise
+const defaultUserPageSize = 50
+
+var errLastAdmin = errors.New("an organisation needs at least one active admin")
+
+// Create user
+// @Summary Create User
+// @Description Create a staff account in the caller's organisation. Role is admin or staff, staff by default.
+// @ID admin-create-user
+// @Produce json
+// @Param user body models.UserCreate true "User"
+// @Success 201 "Successful response"
+// @Failure 400 "Invalid input format"
+// @Failure 409 "Email already registered"
+// @Router /users [post]
+// @Security Bearer
+func (h *AuthHandler) CreateUser(c *gin.Context) {
+	var input models.UserCreate
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid input format",
+			"details": err.Error(),
+		})
+		return
+	}
+	if err := input.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.Role == "" {
+		input.Role = "staff"
+	}
+
+	ctx := context.Background()
+	var exists bool
+	if err := h.db.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM staff_user WHERE email = $1)", input.Email).Scan(&exists); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if exists {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email already registered"})
+		return
+	}
+
+	hashedPassword, err := utils.HashPassword(input.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Password processing failed"})
+		return
+	}
+
+	var user models.User
+	err = scanUser(h.db.QueryRow(ctx, `
+        INSERT INTO staff_user (first_name, last_name, email, password, role, org_id)
+        VALUES ($1, $2, $3, $4, $5, $6)
+        RETURNING `+userColumns,
+		strings.TrimSpace(input.FirstName), strings.TrimSpace(input.LastName), input.Email, hashedPassword, input.Role, currentOrgID(c),
+	), &user)
+	if isUniqueViolation(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email already registered"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "User creation failed"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, user)
+}
+
+// Update user
+// @Summary Update User
+// @Description Change a user's name, email address or role. Email changes made here take effect at once. The last active admin of an organisation cannot be made staff.
+// @ID admin-update-user
+// @Produce json
+// @Param id path int true "User ID"
+// @Param user body models.UserUpdate true "Fields to change"
+// @Success 200 "Successful response"
+// @Failure 400 "Invalid input format"
+// @Failure 404 "User not found"
+// @Failure 409 "Email already registered or last admin"
+// @Router /users/{id} [patch]
+// @Security Bearer
+func (h *AuthHandler) UpdateUser(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid User ID"})
+		return
+	}
+
+	var update models.UserUpdate
+	if err := c.ShouldBindJSON(&update); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid input format",
+			"details": err.Error(),
+		})
+		return
+	}
+	if err := update.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	for _, name := range []*string{update.FirstName, update.LastName} {
+		if name != nil {
+			*name = strings.TrimSpace(*name)
+			if *name == "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Names cannot be empty"})
+				return
+			}
+		}
+	}
+
+	ctx := context.Background()
+	tx, err := h.db.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction start failed"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	if update.Role != nil && *update.Role != "admin" {
+		if err := checkNotLastAdmin(ctx, tx, id, currentOrgID(c)); err != nil {
+			userChangeFailed(c, err)
+			return
+		}
+	}
+
+	if update.Email != nil {
+		var exists bool
+		if err := tx.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM staff_user WHERE email = $1 AND id <> $2)", *update.Email, id).Scan(&exists); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if exists {
+			c.JSON(http.StatusConflict, gin.H{"error": "Email already registered"})
+			return
+		}
+	}
+
+	var user models.User
+	err = scanUser(tx.QueryRow(ctx, `
+        UPDATE staff_user
+        SET first_name = COALESCE($2, first_name),
+            last_name = COALESCE($3, last_name),
+            email = COALESCE($4, email),
+            role = COALESCE($5, role)
+        WHERE id = $1 AND org_id = $6
+        RETURNING `+userColumns,
+		id, update.FirstName, update.LastName, update.Email, update.Role, currentOrgID(c),
+	), &user)
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if isUniqueViolation(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email already registered"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	// The address an admin sets replaces any change the user left pending
+	if update.Email != nil {
+		if _, err := tx.Exec(ctx, "DELETE FROM email_change WHERE user_id = $1", id); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction commit failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// Deactivate user
+// @Summary Deactivate User
+// @Description Deactivate a departing user, who can then neither log in nor refresh their token, is never on duty and cannot be given new work. With reassign_to their open tickets move to that user first, all or nothing; if that fails the user stays active and the report is returned with 409. Admins cannot deactivate themselves or the last active admin.
+// @ID deactivate-user
+// @Produce json
+// @Param id path int true "User ID"
+// @Param deactivate body models.UserDeactivate false "Who takes over open tickets"
+// @Success 200 "Successful response"
+// @Failure 400 "Invalid input format"
+// @Failure 404 "User not found"
+// @Failure 409 "Already deactivated, last admin, or reassignment rolled back"
+// @Router /users/{id}/deactivate [post]
+// @Security Bearer
+func (h *AuthHandler) DeactivateUser(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid User ID"})
+		return
+	}
+
+	// The body is optional
+	var input models.UserDeactivate
+	if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid input format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	actorID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+		return
+	}
+	if actorID == id {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot deactivate your own account"})
+		return
+	}
+
+	ctx := context.Background()
+	var user models.User
+	err = scanUser(h.db.QueryRow(ctx, "SELECT "+userColumns+" FROM staff_user WHERE id = $1 AND org_id = $2", id, currentOrgID(c)), &user)
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !user.Active {
+		c.JSON(http.StatusConflict, gin.H{"error": "User is already deactivated"})
+		return
+	}
+	if err := checkNotLastAdmin(ctx, h.db, id, currentOrgID(c)); err != nil {
+		userChangeFailed(c, err)
+		return
+	}
+
+	var result models.UserDeactivation
+
+	if input.ReassignTo != nil {
+		if *input.ReassignTo == id {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "reassign_to must be another user"})
+			return
+		}
+		var exists bool
+		if err := h.db.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM staff_user WHERE id = $1 AND org_id = $2 AND active)", *input.ReassignTo, user.OrgID).Scan(&exists); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if !exists {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Assignee not found"})
+			return
+		}
+
+		ids, err := openTicketIDs(ctx, h.db, id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+
+		reason := strings.TrimSpace(input.Reason)
+		if reason == "" {
+			reason = "Previous assignee was deactivated"
+		}
+		bulk := models.TicketBulk{
+			Operation:  "reassign",
+			AssignedTo: *input.ReassignTo,
+			Reason:     reason,
+			Mode:       "atomic",
+			OrgID:      user.OrgID,
+		}
+		report, changes, err := h.runBulk(ctx, &bulk, ids, &actorID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		h.sendBulkNotifications(&bulk, changes, &actorID, currentUserName(c))
+
+		result.Reassignment = report
+		if !report.Committed {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":        "Reassignment rolled back, the user is still active",
+				"reassignment": report,
+			})
+			return
+		}
+	}
+
+	err = scanUser(h.db.QueryRow(ctx, `
+        UPDATE staff_user
+        SET active = FALSE, deactivated_at = now()
+        WHERE id = $1 AND org_id = $2
+        RETURNING `+userColumns,
+		id, user.OrgID,
+	), &result.User)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	ids, err := openTicketIDs(ctx, h.db, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	result.OpenTickets = len(ids)
+
+	c.JSON(http.StatusOK, result)
+}
+
+// Activate user
+// @Summary Activate User
+// @Description Let a deactivated user log in again
+// @ID activate-user
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 "Successful response"
+// @Failure 400 "Invalid User ID"
+// @Failure 404 "User not found"
+// @Router /users/{id}/activate [post]
+// @Security Bearer
+func (h *AuthHandler) ActivateUser(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid User ID"})
+		return
+	}
+
+	var user models.User
+	err = scanUser(h.db.QueryRow(context.Background(), `
+        UPDATE staff_user
+        SET active = TRUE, deactivated_at = NULL
+        WHERE id = $1 AND org_id = $2
+        RETURNING `+userColumns,
+		id, currentOrgID(c),
+	), &user)
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// Delete user
+// @Summary Delete User
+// @Description Delete a user for good. Users who still have tickets or schedules assigned cannot be deleted; deactivate them instead, which keeps their history. Admins cannot delete themselves or the last active admin.
+// @ID delete-user
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 "Successful response"
+// @Failure 400 "Invalid User ID"
+// @Failure 404 "User not found"
+// @Failure 409 "User still has tickets, or last admin"
+// @Router /users/{id} [delete]
+// @Security Bearer
+func (h *AuthHandler) DeleteUser(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid User ID"})
+		return
+	}
+
+	if actorID, ok := currentUserID(c); ok && actorID == id {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot delete your own account"})
+		return
+	}
+
+	ctx := context.Background()
+	tx, err := h.db.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction start failed"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	if err := checkNotLastAdmin(ctx, tx, id, currentOrgID(c)); err != nil {
+		userChangeFailed(c, err)
+		return
+	}
+
+	// Tickets, deleted ones included, would otherwise point at nobody
+	var assigned bool
+	if err := tx.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM ticket WHERE assigned_to = $1)", id).Scan(&assigned); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if assigned {
+		c.JSON(http.StatusConflict, gin.H{"error": "User still has tickets, deactivate them instead"})
+		return
+	}
+
+	result, err := tx.Exec(ctx, "DELETE FROM staff_user WHERE id = $1 AND org_id = $2", id, currentOrgID(c))
+	if isForeignKeyViolation(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "User still has tickets or schedules, deactivate them instead"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if result.RowsAffected() == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction commit failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"id": id})
+}
+
+// userChangeFailed answers for a failed checkNotLastAdmin
+func userChangeFailed(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errLastAdmin):
+		c.JSON(http.StatusConflict, gin.H{"error": "An organisation needs at least one active admin"})
+	case errors.Is(err, pgx.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+	}
+}
+
+// checkNotLastAdmin fails with errLastAdmin when user id is the only
+// active admin of organisation orgID, who must not be demoted, deactivated
+// or deleted, and with pgx.ErrNoRows when the user is not in it
+func checkNotLastAdmin(ctx context.Context, db dbExecutor, id, orgID int) error {
+	var last bool
+	err := db.QueryRow(ctx, `
+        SELECT u.role = 'admin' AND u.active AND NOT EXISTS (
+            SELECT 1 FROM staff_user o
+            WHERE o.org_id = u.org_id AND o.id <> u.id AND o.role = 'admin' AND o.active)
+        FROM staff_user u
+        WHERE u.id = $1 AND u.org_id = $2`,
+		id, orgID,
+	).Scan(&last)
+	if err != nil {
+		return err
+	}
+	if last {
+		return errLastAdmin
+	}
+	return nil
+}
+
+// openTicketIDs lists the tickets still open and assigned to a user
+func openTicketIDs(ctx context.Context, db dbExecutor, userID int) ([]int, error) {
+	rows, err := db.Query(ctx, `
+        SELECT id FROM ticket
+        WHERE assigned_to = $1 AND task_status <> 'Completed' AND deleted_at IS NULL
+        ORDER BY id`,
+		userID)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[int])
+}
+
+// scanUser scans a row selected with userColumns
+func scanUser(row pgx.Row, user *models.User) error {
+	return row.Scan(
+		&user.ID,
+		&user.FirstName,
+		&user.LastName,
+		&user.Email,
+		&user.Role,
+		&user.OrgID,
+		&user.Active,
+		&user.DeactivatedAt,
+		&user.MFAEnabled)
+}
@@ -0,0 +1,651 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"ticket-sys/internal/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// webhookEvents are the ticket events webhooks can filter on, as recorded
+// in ticket_event
+var webhookEvents = []string{"created", "updated", "status_changed", "commented", "deleted", "restored"}
+
+const (
+	// webhookTimeout bounds a single delivery attempt
+	webhookTimeout = 10 * time.Second
+	// webhookMaxAttempts is how often a delivery is tried before it fails
+	webhookMaxAttempts = 8
+	// webhookBatch is how many deliveries the worker claims at once
+	webhookBatch = 20
+	// webhookRetention is how long finished deliveries stay in the log
+	webhookRetention = 30 * 24 * time.Hour
+)
+
+var errInvalidWebhook = errors.New("invalid webhook")
+
+// webhookClient posts deliveries. It only connects to public addresses, so
+// a webhook cannot reach the database or other services on the internal
+// network, whatever its host name resolves to. There is no proxy, which
+// would make the connection on its behalf.
+var webhookClient = &http.Client{
+	Timeout: webhookTimeout,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: webhookTimeout,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				ip, err := netip.ParseAddr(host)
+				if err != nil || !webhookAddressAllowed(ip) {
+					return fmt.Errorf("%w: %s is not a public address", errInvalidWebhook, host)
+				}
+				return nil
+			},
+		}).DialContext,
+		TLSHandshakeTimeout: webhookTimeout,
+	},
+}
+
+// webhookPrivateRanges are non-public ranges netip has no predicate for
+var webhookPrivateRanges = []netip.Prefix{
+	netip.MustParsePrefix("100.64.0.0/10"), // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),  // IETF protocol assignments
+	netip.MustParsePrefix("198.18.0.0/15"), // benchmarking
+}
+
+// webhookAddressAllowed reports whether webhooks may connect to ip
+func webhookAddressAllowed(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return false
+	}
+	for _, prefix := range webhookPrivateRanges {
+		if prefix.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+const webhookColumns = `id, name, url, events, active, created_date::text`
+
+const webhookDeliveryColumns = `id, webhook_id, event, payload, status, attempts, next_attempt_at::text, last_status_code, last_error, created_date::text, delivered_date::text`
+
+// Create webhook
+// @Summary Create Webhook
+// @Description Register an outgoing webhook. Payloads are signed with HMAC-SHA256 of "<timestamp>.<body>" in the X-Webhook-Signature header.
+// @ID create-webhook
+// @Produce json
+// @Success 201 "Successful response"
+// @Failure 400 "Invalid input format"
+// @Router /webhooks [post]
+// @Security Bearer
+func (h *AuthHandler) CreateWebhook(c *gin.Context) {
+	var webhook models.WebhookCreate
+
+	if err := c.ShouldBindJSON(&webhook); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid input format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	if webhook.Events == nil {
+		webhook.Events = []string{}
+	}
+	if err := validateWebhook(webhook.URL, webhook.Events); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if webhook.Secret == "" {
+		secret := make([]byte, 32)
+		rand.Read(secret)
+		webhook.Secret = hex.EncodeToString(secret)
+	}
+	active := webhook.Active == nil || *webhook.Active
+
+	var created models.Webhook
+	err := scanWebhook(h.db.QueryRow(context.Background(), `
+        INSERT INTO webhook (name, url, secret, events, active, org_id)
+        VALUES ($1, $2, $3, $4, $5, $6)
+        RETURNING `+webhookColumns,
+		strings.TrimSpace(webhook.Name),
+		webhook.URL,
+		webhook.Secret,
+		webhook.Events,
+		active,
+		currentOrgID(c),
+	), &created)
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Webhook creation failed"})
+		return
+	}
+
+	// The secret is shown once so the receiver can be configured
+	created.Secret = webhook.Secret
+	c.JSON(http.StatusCreated, created)
+}
+
+// Get webhooks
+// @Summary Get Webhooks
+// @Description List the registered webhooks
+// @ID get-webhooks
+// @Produce json
+// @Success 200 "Successful response"
+// @Failure 500 "Database error"
+// @Router /webhooks [get]
+// @Security Bearer
+func (h *AuthHandler) GetWebhooks(c *gin.Context) {
+	webhooks := []models.Webhook{}
+
+	rows, err := h.db.Query(context.Background(), "SELECT "+webhookColumns+" FROM webhook WHERE org_id = $1 ORDER BY name", currentOrgID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	for rows.Next() {
+		var webhook models.Webhook
+		if err := scanWebhook(rows, &webhook); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Process failed"})
+			return
+		}
+		webhooks = append(webhooks, webhook)
+	}
+
+	if err = rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Webhook iteration failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, webhooks)
+}
+
+// Get webhook
+// @Summary Get Webhook
+// @Description Get single webhook
+// @ID get-webhook
+// @Produce json
+// @Param id path int true "Webhook ID"
+// @Success 200 "Successful response"
+// @Failure 400 "Invalid webhook ID"
+// @Failure 404 "Webhook not found"
+// @Router /webhooks/{id} [get]
+// @Security Bearer
+func (h *AuthHandler) GetWebhook(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook ID"})
+		return
+	}
+
+	var webhook models.Webhook
+	err = scanWebhook(h.db.QueryRow(context.Background(), "SELECT "+webhookColumns+" FROM webhook WHERE id = $1 AND org_id = $2", id, currentOrgID(c)), &webhook)
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, webhook)
+}
+
+// Update webhook
+// @Summary Update Webhook
+// @Description Update a webhook
+// @ID update-webhook
+// @Produce json
+// @Param id path int true "Webhook ID"
+// @Success 200 "Successful response"
+// @Failure 400 "Invalid webhook data"
+// @Failure 404 "Webhook not found"
+// @Router /webhooks/{id} [patch]
+// @Security Bearer
+func (h *AuthHandler) UpdateWebhook(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook ID"})
+		return
+	}
+
+	var update models.WebhookUpdate
+	if err := c.ShouldBindJSON(&update); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook data"})
+		return
+	}
+
+	var current models.Webhook
+	err = scanWebhook(h.db.QueryRow(context.Background(), "SELECT "+webhookColumns+" FROM webhook WHERE id = $1 AND org_id = $2", id, currentOrgID(c)), &current)
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if update.Name != nil {
+		current.Name = strings.TrimSpace(*update.Name)
+	}
+	if update.URL != nil {
+		current.URL = *update.URL
+	}
+	if update.Events != nil {
+		current.Events = *update.Events
+		if current.Events == nil {
+			current.Events = []string{}
+		}
+	}
+	if update.Active != nil {
+		current.Active = *update.Active
+	}
+	if update.Secret != nil && *update.Secret == "" {
+		update.Secret = nil
+	}
+	if err := validateWebhook(current.URL, current.Events); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var updated models.Webhook
+	err = scanWebhook(h.db.QueryRow(context.Background(), `
+        UPDATE webhook
+        SET name = $2, url = $3, events = $4, active = $5, secret = COALESCE($6, secret)
+        WHERE id = $1 AND org_id = $7
+        RETURNING `+webhookColumns,
+		id,
+		current.Name,
+		current.URL,
+		current.Events,
+		current.Active,
+		update.Secret,
+		currentOrgID(c),
+	), &updated)
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, updated)
+}
+
+// Delete webhook
+// @Summary Delete Webhook
+// @Description Delete a webhook and its delivery log
+// @ID delete-webhook
+// @Produce json
+// @Param id path int true "Webhook ID"
+// @Success 200 "Successful response"
+// @Failure 400 "Invalid webhook ID"
+// @Failure 404 "Webhook not found"
+// @Router /webhooks/{id} [delete]
+// @Security Bearer
+func (h *AuthHandler) DeleteWebhook(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook ID"})
+		return
+	}
+
+	result, err := h.db.Exec(context.Background(), "DELETE FROM webhook WHERE id = $1 AND org_id = $2", id, currentOrgID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if result.RowsAffected() == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"id": id})
+}
+
+// Get webhook deliveries
+// @Summary Get Webhook Deliveries
+// @Description Delivery log of a webhook, newest first
+// @ID get-webhook-deliveries
+// @Produce json
+// @Param id path int true "Webhook ID"
+// @Param status query string false "pending, delivered or failed"
+// @Success 200 "Successful response"
+// @Failure 400 "Invalid webhook ID"
+// @Router /webhooks/{id}/deliveries [get]
+// @Security Bearer
+func (h *AuthHandler) GetWebhookDeliveries(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook ID"})
+		return
+	}
+
+	var status *string
+	if value := c.Query("status"); value != "" {
+		status = &value
+	}
+
+	deliveries := []models.WebhookDelivery{}
+
+	rows, err := h.db.Query(context.Background(), `
+        SELECT `+webhookDeliveryColumns+`
+        FROM webhook_delivery
+        WHERE webhook_id = (SELECT id FROM webhook WHERE id = $1 AND org_id = $3)
+            AND ($2::text IS NULL OR status = $2)
+        ORDER BY id DESC
+        LIMIT 100`,
+		id, status, currentOrgID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	for rows.Next() {
+		var delivery models.WebhookDelivery
+		if err := scanWebhookDelivery(rows, &delivery); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Process failed"})
+			return
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	if err = rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Delivery iteration failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, deliveries)
+}
+
+// Test webhook
+// @Summary Test Webhook
+// @Description Send a signed "ping" event to a webhook now and return the logged delivery. Failed pings are retried like any other delivery.
+// @ID test-webhook
+// @Produce json
+// @Param id path int true "Webhook ID"
+// @Success 200 "Successful response"
+// @Failure 400 "Invalid webhook ID"
+// @Failure 404 "Webhook not found"
+// @Router /webhooks/{id}/test [post]
+// @Security Bearer
+func (h *AuthHandler) TestWebhook(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook ID"})
+		return
+	}
+
+	ctx := context.Background()
+
+	var delivery models.WebhookDelivery
+	err = scanWebhookDelivery(h.db.QueryRow(ctx, `
+        INSERT INTO webhook_delivery (webhook_id, event, payload, next_attempt_at)
+        SELECT id, 'ping', jsonb_build_object('event', 'ping', 'webhook_id', id, 'created_date', now()), now() + $2::interval
+        FROM webhook
+        WHERE id = $1 AND org_id = $3
+        RETURNING `+webhookDeliveryColumns,
+		id, "2 minutes", currentOrgID(c),
+	), &delivery)
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	var target, secret string
+	if err := h.db.QueryRow(ctx, "SELECT url, secret FROM webhook WHERE id = $1 AND org_id = $2", id, currentOrgID(c)).Scan(&target, &secret); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if err := h.attemptWebhookDelivery(ctx, delivery.ID, delivery.Attempts, delivery.Event, target, secret, delivery.Payload); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	err = scanWebhookDelivery(h.db.QueryRow(ctx, "SELECT "+webhookDeliveryColumns+" FROM webhook_delivery WHERE id = $1", delivery.ID), &delivery)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, delivery)
+}
+
+// RunWebhookDeliveries posts queued webhook deliveries every interval until
+// ctx is cancelled. Like RunJobs, the handler should own its connection.
+func (h *AuthHandler) RunWebhookDeliveries(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := h.deliverWebhooks(ctx); err != nil {
+			log.Printf("webhook delivery failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// deliverWebhooks claims due deliveries and attempts each. Claiming pushes
+// next_attempt_at out, so another instance will not pick up a delivery
+// that is in flight here.
+func (h *AuthHandler) deliverWebhooks(ctx context.Context) error {
+	for {
+		type claimed struct {
+			id       int64
+			attempts int
+			event    string
+			url      string
+			secret   string
+			payload  []byte
+		}
+		var batch []claimed
+
+		rows, err := h.db.Query(ctx, `
+            UPDATE webhook_delivery d
+            SET next_attempt_at = now() + $1::interval
+            FROM webhook w
+            WHERE w.id = d.webhook_id AND d.id IN (
+                SELECT d2.id
+                FROM webhook_delivery d2
+                JOIN webhook w2 ON w2.id = d2.webhook_id
+                WHERE d2.status = 'pending' AND d2.next_attempt_at <= now() AND w2.active
+                ORDER BY d2.next_attempt_at
+                LIMIT $2
+                FOR UPDATE OF d2 SKIP LOCKED)
+            RETURNING d.id, d.attempts, d.event, w.url, w.secret, d.payload`,
+			"2 minutes", webhookBatch)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var d claimed
+			if err := rows.Scan(&d.id, &d.attempts, &d.event, &d.url, &d.secret, &d.payload); err != nil {
+				rows.Close()
+				return err
+			}
+			batch = append(batch, d)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, d := range batch {
+			if err := h.attemptWebhookDelivery(ctx, d.id, d.attempts, d.event, d.url, d.secret, d.payload); err != nil {
+				return err
+			}
+		}
+
+		if len(batch) < webhookBatch {
+			return nil
+		}
+	}
+}
+
+// attemptWebhookDelivery posts a payload once and records the outcome,
+// scheduling a retry with exponential backoff after a failure
+func (h *AuthHandler) attemptWebhookDelivery(ctx context.Context, id int64, attempts int, event, target, secret string, payload []byte) error {
+	statusCode, sendErr := sendWebhook(ctx, id, event, target, secret, payload)
+	attempts++
+
+	var code *int
+	if statusCode != 0 {
+		code = &statusCode
+	}
+
+	if sendErr == nil {
+		_, err := h.db.Exec(ctx, `
+            UPDATE webhook_delivery
+            SET status = 'delivered', attempts = $2, last_status_code = $3, last_error = NULL, delivered_date = now()
+            WHERE id = $1`,
+			id, attempts, code)
+		return err
+	}
+
+	status := "pending"
+	if attempts >= webhookMaxAttempts {
+		status = "failed"
+	}
+	// 30s, 1m, 2m, 4m ... between attempts
+	backoff := time.Duration(30<<(attempts-1)) * time.Second
+
+	_, err := h.db.Exec(ctx, `
+        UPDATE webhook_delivery
+        SET status = $2, attempts = $3, last_status_code = $4, last_error = $5, next_attempt_at = $6
+        WHERE id = $1`,
+		id, status, attempts, code, sendErr.Error(), time.Now().Add(backoff))
+	return err
+}
+
+// sendWebhook posts a signed payload. Receivers verify X-Webhook-Signature,
+// "sha256=" and the hex HMAC-SHA256 of "<X-Webhook-Timestamp>.<body>" keyed
+// with the webhook secret. Any 2xx response counts as delivered.
+func sendWebhook(ctx context.Context, id int64, event, target, secret string, payload []byte) (int, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "ticket-sys-webhook/1.0")
+	req.Header.Set("X-Webhook-Event", event)
+	req.Header.Set("X-Webhook-Delivery", strconv.FormatInt(id, 10))
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", "sha256="+signWebhook(secret, timestamp, payload))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// signWebhook returns the hex HMAC-SHA256 of "<timestamp>.<payload>"
+func signWebhook(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// pruneWebhookDeliveries removes finished deliveries past webhookRetention
+func (h *AuthHandler) pruneWebhookDeliveries(ctx context.Context) error {
+	_, err := h.db.Exec(ctx, "DELETE FROM webhook_delivery WHERE status <> 'pending' AND created_date < $1", time.Now().Add(-webhookRetention))
+	return err
+}
+
+// validateWebhook checks a webhook's URL and event filter
+func validateWebhook(target string, events []string) error {
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: url must be an absolute http or https URL", errInvalidWebhook)
+	}
+	// Names are checked when delivering, as they may resolve differently
+	if ip, err := netip.ParseAddr(u.Hostname()); (err == nil && !webhookAddressAllowed(ip)) || strings.EqualFold(u.Hostname(), "localhost") {
+		return fmt.Errorf("%w: url must point to a public address", errInvalidWebhook)
+	}
+	for _, event := range events {
+		if !slices.Contains(webhookEvents, event) {
+			return fmt.Errorf("%w: unknown event %q", errInvalidWebhook, event)
+		}
+	}
+	return nil
+}
+
+// scanWebhook scans a row selected with webhookColumns into webhook
+func scanWebhook(row pgx.Row, webhook *models.Webhook) error {
+	return row.Scan(
+		&webhook.ID,
+		&webhook.Name,
+		&webhook.URL,
+		&webhook.Events,
+		&webhook.Active,
+		&webhook.CreatedDate)
+}
+
+// scanWebhookDelivery scans a row selected with webhookDeliveryColumns
+func scanWebhookDelivery(row pgx.Row, delivery *models.WebhookDelivery) error {
+	var payload []byte
+	err := row.Scan(
+		&delivery.ID,
+		&delivery.WebhookID,
+		&delivery.Event,
+		&payload,
+		&delivery.Status,
+		&delivery.Attempts,
+		&delivery.NextAttemptAt,
+		&delivery.LastStatusCode,
+		&delivery.LastError,
+		&delivery.CreatedDate,
+		&delivery.DeliveredDate)
+	delivery.Payload = json.RawMessage(payload)
+	return err
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+	"ticket-sys/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Get user workload
+// @Summary Get User Workload
+// @Description List each staff member's open tickets by priority, oldest open ticket and tickets completed in the last 7 and 30 days, least loaded first. Deactivated staff are left out. suggested_user_id is the least-loaded qualified staff member, preferring those on duty: with request_type, those who have completed that request type before, or everyone when nobody has.
+// @ID get-user-workload
+// @Produce json
+// @Param request_type query string false "Request type of the ticket being assigned"
+// @Success 200 "Successful response"
+// @Failure 500 "Database error"
+// @Router /users/workload [get]
+// @Security Bearer
+func (h *AuthHandler) GetUserWorkload(c *gin.Context) {
+	requestType := strings.TrimSpace(c.Query("request_type"))
+
+	rows, err := h.db.Query(context.Background(), `
+        SELECT u.id, u.first_name || ' ' || u.last_name, u.role,
+               s.open, COALESCE(p.by_priority, '{}'::jsonb), o.id, o.creation_date::text,
+               s.completed_7, s.completed_30,
+               $1 = '' OR EXISTS (
+                   SELECT 1 FROM ticket t
+                   WHERE t.assigned_to = u.id AND t.completion_date IS NOT NULL
+                     AND lower(btrim(t.request_type)) = lower($1)),
+               `+staffOnDutySQL("u.id", "now()")+`
+        FROM staff_user u
+        CROSS JOIN LATERAL (
+            SELECT count(*) FILTER (WHERE t.task_status <> 'Completed') AS open,
+                   count(*) FILTER (WHERE t.completion_date >= now() - interval '7 days') AS completed_7,
+                   count(*) FILTER (WHERE t.completion_date >= now() - interval '30 days') AS completed_30
+            FROM ticket t
+            WHERE t.assigned_to = u.id AND t.deleted_at IS NULL) s
+        LEFT JOIN LATERAL (
+            SELECT jsonb_object_agg(priority, n) AS by_priority
+            FROM (
+                SELECT btrim(t.task_priority) AS priority, count(*) AS n
+                FROM ticket t
+                WHERE t.assigned_to = u.id AND t.deleted_at IS NULL AND t.task_status <> 'Completed'
+                GROUP BY 1) counts) p ON true
+        LEFT JOIN LATERAL (
+            SELECT t.id, t.creation_date
+            FROM ticket t
+            WHERE t.assigned_to = u.id AND t.deleted_at IS NULL AND t.task_status <> 'Completed'
+            ORDER BY t.creation_date, t.id
+            LIMIT 1) o ON true
+        WHERE u.org_id = $2 AND u.active
+        ORDER BY s.open, s.completed_7, u.id`,
+		requestType, currentOrgID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	workloads := []models.UserWorkload{}
+	for rows.Next() {
+		var workload models.UserWorkload
+		err := rows.Scan(
+			&workload.UserID,
+			&workload.Name,
+			&workload.Role,
+			&workload.OpenTickets,
+			&workload.OpenByPriority,
+			&workload.OldestOpenTicketID,
+			&workload.OldestOpenCreatedAt,
+			&workload.CompletedLast7Days,
+			&workload.CompletedLast30Days,
+			&workload.Qualified,
+			&workload.OnDuty,
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Process failed"})
+			return
+		}
+		workloads = append(workloads, workload)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "User iteration failed"})
+		return
+	}
+
+	// Rows come least loaded first, so the first qualified one on duty is
+	// the pick
+	if !slices.ContainsFunc(workloads, func(w models.UserWorkload) bool { return w.Qualified }) {
+		for i := range workloads {
+			workloads[i].Qualified = true
+		}
+	}
+	var suggested *int
+	for _, onDutyOnly := range []bool{true, false} {
+		for i := range workloads {
+			if workloads[i].Qualified && (workloads[i].OnDuty || !onDutyOnly) {
+				suggested = &workloads[i].UserID
+				break
+			}
+		}
+		if suggested != nil {
+			break
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"users":             workloads,
+		"suggested_user_id": suggested,
+	})
+}
@@ -0,0 +1,70 @@
+package inbound
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Maildir is a mail directory with new, cur and tmp subdirectories, as
+// written by the mail server delivering the gateway's mailbox
+type Maildir string
+
+// Handler processes one message. Returning an error wrapping
+// ErrInvalidMessage marks the message as rejected; any other error leaves
+// it in new to be retried on the next poll.
+type Handler func(name string, msg *Message) error
+
+// Poll hands every message waiting in new to handle, oldest first, and
+// moves handled messages to cur. Rejected messages are flagged trashed
+// ("T") so they can be inspected.
+func (m Maildir) Poll(handle Handler) error {
+	newDir := filepath.Join(string(m), "new")
+	entries, err := os.ReadDir(newDir)
+	if err != nil {
+		return err
+	}
+
+	// Maildir file names start with the delivery time
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	var errs []error
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		name := entry.Name()
+
+		flag := "S"
+		err := m.handle(filepath.Join(newDir, name), name, handle)
+		if errors.Is(err, ErrInvalidMessage) {
+			flag = "T"
+			errs = append(errs, fmt.Errorf("%s rejected: %w", name, err))
+		} else if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+
+		if err := os.Rename(filepath.Join(newDir, name), filepath.Join(string(m), "cur", name+":2,"+flag)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (m Maildir) handle(path, name string, handle Handler) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	msg, err := Parse(file)
+	if err != nil {
+		return err
+	}
+	return handle(name, msg)
+}
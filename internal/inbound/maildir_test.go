@@ -0,0 +1,121 @@
+package inbound
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// newMaildir makes a maildir in a temporary directory with messages
+// delivered to new, keyed by file name
+func newMaildir(t *testing.T, messages map[string]string) Maildir {
+	t.Helper()
+	dir := t.TempDir()
+	for _, sub := range []string{"new", "cur", "tmp"} {
+		if err := os.Mkdir(filepath.Join(dir, sub), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, raw := range messages {
+		if err := os.WriteFile(filepath.Join(dir, "new", name), []byte(crlf(raw)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return Maildir(dir)
+}
+
+// listDir returns the names of the files in dir
+func listDir(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+func TestMaildirPoll(t *testing.T) {
+	m := newMaildir(t, map[string]string{
+		"1700000002.M2.host": "From: second@example.com\nSubject: Second\n\nB\n",
+		"1700000001.M1.host": "From: first@example.com\nSubject: First\n\nA\n",
+		"1700000003.M3.host": "From: third@example.com\nSubject: Retry\n\nC\n",
+		"1700000004.M4.host": "Subject: No sender\n\nD\n",
+		".hidden":            "From: hidden@example.com\n\nE\n",
+	})
+
+	var handled []string
+	err := m.Poll(func(name string, msg *Message) error {
+		handled = append(handled, msg.Subject)
+		if msg.Subject == "Retry" {
+			return fmt.Errorf("database down")
+		}
+		return nil
+	})
+	if err == nil {
+		t.Fatal("Poll succeeded, want the retry and rejection reported")
+	}
+	if !errors.Is(err, ErrInvalidMessage) {
+		t.Errorf("Poll gave %v, want the rejection to wrap ErrInvalidMessage", err)
+	}
+
+	// Oldest first; the message that cannot be parsed never reaches the
+	// handler
+	if want := []string{"First", "Second", "Retry"}; !slices.Equal(handled, want) {
+		t.Errorf("handled %v, want %v", handled, want)
+	}
+
+	// Handled messages are seen, rejected ones trashed, and failed ones
+	// stay for the next poll
+	wantCur := []string{"1700000001.M1.host:2,S", "1700000002.M2.host:2,S", "1700000004.M4.host:2,T"}
+	if cur := listDir(t, filepath.Join(string(m), "cur")); !slices.Equal(cur, wantCur) {
+		t.Errorf("cur holds %v, want %v", cur, wantCur)
+	}
+	wantNew := []string{".hidden", "1700000003.M3.host"}
+	if left := listDir(t, filepath.Join(string(m), "new")); !slices.Equal(left, wantNew) {
+		t.Errorf("new holds %v, want %v", left, wantNew)
+	}
+
+	// The retried message goes through once the handler succeeds
+	handled = nil
+	if err := m.Poll(func(name string, msg *Message) error {
+		handled = append(handled, msg.Subject)
+		return nil
+	}); err != nil {
+		t.Fatalf("second Poll: %v", err)
+	}
+	if want := []string{"Retry"}; !slices.Equal(handled, want) {
+		t.Errorf("second poll handled %v, want %v", handled, want)
+	}
+	if left := listDir(t, filepath.Join(string(m), "new")); !slices.Equal(left, []string{".hidden"}) {
+		t.Errorf("new holds %v after the second poll, want only .hidden", left)
+	}
+}
+
+func TestMaildirPollHandlerRejects(t *testing.T) {
+	m := newMaildir(t, map[string]string{
+		"1700000001.M1.host": "From: spam@example.com\nSubject: Spam\n\nBuy\n",
+	})
+
+	err := m.Poll(func(name string, msg *Message) error {
+		return fmt.Errorf("%w: sender not allowed", ErrInvalidMessage)
+	})
+	if !errors.Is(err, ErrInvalidMessage) {
+		t.Errorf("Poll gave %v, want ErrInvalidMessage", err)
+	}
+	if cur := listDir(t, filepath.Join(string(m), "cur")); !slices.Equal(cur, []string{"1700000001.M1.host:2,T"}) {
+		t.Errorf("cur holds %v, want the message flagged trashed", cur)
+	}
+}
+
+func TestMaildirPollMissing(t *testing.T) {
+	if err := Maildir(filepath.Join(t.TempDir(), "missing")).Poll(func(string, *Message) error { return nil }); err == nil {
+		t.Error("Poll of a missing maildir succeeded")
+	}
+}
@@ -0,0 +1,343 @@
+// Package inbound reads maintenance requests sent by email. It parses RFC
+// 5322 messages, including MIME multipart bodies and attachments, and picks
+// them up from a maildir the mail server delivers into.
+package inbound
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// maxPartSize bounds how much of a single body part or attachment is read
+const maxPartSize = 10 << 20
+
+// ErrInvalidMessage marks a message that cannot be parsed. Retrying it will
+// not help.
+var ErrInvalidMessage = errors.New("invalid message")
+
+// Message is a parsed email
+type Message struct {
+	MessageID   string
+	FromAddress string
+	FromName    string
+	Subject     string
+	// Text is the plain text body, or the HTML body stripped of markup
+	// when the message has no plain text part
+	Text        string
+	Attachments []Attachment
+	// AutoReply is set for out-of-office replies, bounces and other
+	// machine-generated mail, which must not open tickets
+	AutoReply bool
+	// AuthenticationResults are the message's Authentication-Results
+	// headers (RFC 8601), added by the servers it passed through
+	AuthenticationResults []string
+}
+
+// Attachment is a file attached to a message
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// IsImage reports whether the attachment is an image
+func (a Attachment) IsImage() bool {
+	return strings.HasPrefix(a.ContentType, "image/")
+}
+
+// ticketRef matches the ticket token in a reply subject, e.g. "Ticket #123"
+var ticketRef = regexp.MustCompile(`(?i)\bticket\s*#\s*(\d+)\b`)
+
+// TicketReference returns the ticket a subject refers to, if any
+func TicketReference(subject string) (int, bool) {
+	match := ticketRef.FindStringSubmatch(subject)
+	if match == nil {
+		return 0, false
+	}
+	id, err := strconv.Atoi(match[1])
+	if err != nil {
+		return 0, false
+	}
+	return id, true
+}
+
+// Parse reads an RFC 5322 message
+func Parse(r io.Reader) (*Message, error) {
+	raw, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMessage, err)
+	}
+
+	from, err := mail.ParseAddress(raw.Header.Get("From"))
+	if err != nil {
+		return nil, fmt.Errorf("%w: From: %v", ErrInvalidMessage, err)
+	}
+
+	decoder := mime.WordDecoder{CharsetReader: charsetReader}
+	subject, err := decoder.DecodeHeader(raw.Header.Get("Subject"))
+	if err != nil {
+		subject = raw.Header.Get("Subject")
+	}
+
+	msg := &Message{
+		MessageID:   strings.Trim(strings.TrimSpace(raw.Header.Get("Message-Id")), "<>"),
+		FromAddress: strings.ToLower(from.Address),
+		FromName:    strings.TrimSpace(from.Name),
+		Subject:     strings.TrimSpace(subject),
+		AutoReply:   isAutoReply(raw.Header),
+
+		AuthenticationResults: raw.Header["Authentication-Results"],
+	}
+
+	var text, html string
+	err = walkPart(raw.Header.Get("Content-Type"), raw.Header.Get("Content-Transfer-Encoding"), "", raw.Body, msg, &text, &html)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.TrimSpace(text) == "" && html != "" {
+		text = stripHTML(html)
+	}
+	msg.Text = strings.TrimSpace(normalizeNewlines(text))
+
+	return msg, nil
+}
+
+// walkPart collects the text bodies and attachments of a MIME part,
+// descending into multipart containers
+func walkPart(contentType, encoding, disposition string, body io.Reader, msg *Message, text, html *string) error {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		// RFC 2045 default for parts without a usable Content-Type
+		mediaType, params = "text/plain", map[string]string{}
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("%w: %v", ErrInvalidMessage, err)
+			}
+			err = walkPart(part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"), part.Header.Get("Content-Disposition"), part, msg, text, html)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	data, err := io.ReadAll(io.LimitReader(decodeTransfer(body, encoding), maxPartSize))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidMessage, err)
+	}
+
+	dispType, dispParams, _ := mime.ParseMediaType(disposition)
+	filename := dispParams["filename"]
+	if filename == "" {
+		filename = params["name"]
+	}
+
+	// Inline text parts without a file name are the body; everything else
+	// is an attachment
+	if dispType != "attachment" && filename == "" && strings.HasPrefix(mediaType, "text/") {
+		decoded := decodeCharset(data, params["charset"])
+		switch {
+		case mediaType == "text/html":
+			if *html == "" {
+				*html = decoded
+			}
+		case *text == "":
+			*text = decoded
+		}
+		return nil
+	}
+
+	if filename == "" {
+		filename = "attachment"
+	}
+	msg.Attachments = append(msg.Attachments, Attachment{
+		Filename:    filename,
+		ContentType: mediaType,
+		Data:        data,
+	})
+	return nil
+}
+
+func decodeTransfer(body io.Reader, encoding string) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, &newlineStripper{r: body})
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	default:
+		return body
+	}
+}
+
+// newlineStripper drops the line breaks base64 bodies are wrapped with
+type newlineStripper struct {
+	r io.Reader
+}
+
+func (s *newlineStripper) Read(p []byte) (int, error) {
+	for {
+		n, err := s.r.Read(p)
+		kept := 0
+		for _, b := range p[:n] {
+			if b != '\r' && b != '\n' && b != ' ' && b != '\t' {
+				p[kept] = b
+				kept++
+			}
+		}
+		if kept > 0 || err != nil {
+			return kept, err
+		}
+	}
+}
+
+// decodeCharset converts a text body to UTF-8. Only UTF-8, US-ASCII and
+// Latin-1 are understood; anything else is passed through as is.
+func decodeCharset(data []byte, charset string) string {
+	switch strings.ToLower(charset) {
+	case "iso-8859-1", "latin1":
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		return string(runes)
+	default:
+		return string(bytes.ToValidUTF8(data, []byte("�")))
+	}
+}
+
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	data, err := io.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	return strings.NewReader(decodeCharset(data, charset)), nil
+}
+
+// isAutoReply recognises machine-generated mail by the headers RFC 3834
+// and common mailers set
+func isAutoReply(header mail.Header) bool {
+	if auto := strings.ToLower(header.Get("Auto-Submitted")); auto != "" && auto != "no" {
+		return true
+	}
+	switch strings.ToLower(header.Get("Precedence")) {
+	case "bulk", "junk", "list", "auto_reply":
+		return true
+	}
+	return header.Get("X-Autoreply") != "" || header.Get("X-Autorespond") != ""
+}
+
+// authComment matches a comment in an Authentication-Results header
+var authComment = regexp.MustCompile(`\([^()]*\)`)
+
+// SenderAuthenticated reports whether the receiving server authservID
+// vouched for the From address: DMARC passed for its domain, or DKIM or SPF
+// passed for that same domain. Results added by any other server are
+// ignored, as the sender could have written them. The receiving server must
+// remove Authentication-Results headers that claim to be its own before
+// delivering the message.
+func (m *Message) SenderAuthenticated(authservID string) bool {
+	at := strings.LastIndex(m.FromAddress, "@")
+	if authservID == "" || at < 0 {
+		return false
+	}
+	domain := m.FromAddress[at+1:]
+
+	for _, header := range m.AuthenticationResults {
+		results := strings.Split(authComment.ReplaceAllString(header, ""), ";")
+		if id := strings.Fields(results[0]); len(id) == 0 || !strings.EqualFold(id[0], authservID) {
+			continue
+		}
+		for _, result := range results[1:] {
+			fields := strings.Fields(result)
+			if len(fields) == 0 {
+				continue
+			}
+			method, outcome, _ := strings.Cut(strings.ToLower(fields[0]), "=")
+			if outcome != "pass" {
+				continue
+			}
+			var properties []string
+			switch method {
+			case "dmarc":
+				properties = []string{"header.from"}
+			case "dkim":
+				properties = []string{"header.d", "header.i"}
+			case "spf":
+				properties = []string{"smtp.mailfrom"}
+			default:
+				continue
+			}
+			for _, field := range fields[1:] {
+				property, value, _ := strings.Cut(field, "=")
+				for _, want := range properties {
+					if !strings.EqualFold(property, want) {
+						continue
+					}
+					value = strings.Trim(value, `"`)
+					value = value[strings.LastIndex(value, "@")+1:]
+					if strings.EqualFold(value, domain) {
+						return true
+					}
+				}
+			}
+		}
+	}
+	return false
+}
+
+var (
+	htmlBreaks = regexp.MustCompile(`(?i)<\s*(br|/p|/div|/li|/tr)\s*/?>`)
+	htmlTags   = regexp.MustCompile(`(?s)<[^>]*>`)
+	htmlHidden = regexp.MustCompile(`(?is)<(style|script|head)[^>]*>.*?</(style|script|head)>`)
+)
+
+// stripHTML reduces an HTML body to its text
+func stripHTML(body string) string {
+	body = htmlHidden.ReplaceAllString(body, "")
+	body = htmlBreaks.ReplaceAllString(body, "\n")
+	body = htmlTags.ReplaceAllString(body, "")
+	replacer := strings.NewReplacer("&nbsp;", " ", "&amp;", "&", "&lt;", "<", "&gt;", ">", "&quot;", `"`, "&#39;", "'")
+	return replacer.Replace(body)
+}
+
+func normalizeNewlines(text string) string {
+	return strings.ReplaceAll(text, "\r\n", "\n")
+}
+
+// replyHeader matches the line mail clients put above quoted text
+var replyHeader = regexp.MustCompile(`(?m)^(On .+wrote:|-+ ?Original Message ?-+|From: .+)$`)
+
+// StripQuoted returns the new text of a reply, without the quoted message
+// it replies to
+func StripQuoted(text string) string {
+	if loc := replyHeader.FindStringIndex(text); loc != nil && loc[0] > 0 {
+		text = text[:loc[0]]
+	}
+
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), ">") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
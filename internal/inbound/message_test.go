@@ -0,0 +1,340 @@
+package inbound
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// crlf turns the \n line ends of a test message into the \r\n of the wire
+func crlf(s string) string {
+	return strings.ReplaceAll(s, "\n", "\r\n")
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name        string
+		raw         string
+		fromAddress string
+		fromName    string
+		subject     string
+		text        string
+		autoReply   bool
+		attachments []string
+	}{
+		{
+			name: "plain text",
+			raw: `From: Guest <Guest@Example.com>
+Subject:  Broken heater
+Message-Id: <abc@example.com>
+
+The heater in room 12 is broken.
+`,
+			fromAddress: "guest@example.com",
+			fromName:    "Guest",
+			subject:     "Broken heater",
+			text:        "The heater in room 12 is broken.",
+		},
+		{
+			name: "alternative prefers text/plain",
+			raw: `From: guest@example.com
+Subject: Leak
+Content-Type: multipart/alternative; boundary="b1"
+
+--b1
+Content-Type: text/html; charset=utf-8
+
+<p>The <b>HTML</b> body</p>
+--b1
+Content-Type: text/plain; charset=utf-8
+
+The plain body
+--b1--
+`,
+			fromAddress: "guest@example.com",
+			subject:     "Leak",
+			text:        "The plain body",
+		},
+		{
+			name: "HTML only is stripped",
+			raw: `From: guest@example.com
+Subject: Leak
+Content-Type: text/html; charset=utf-8
+
+<html><head><style>p { color: red }</style></head><body><p>Water &amp; more</p><p>Room&nbsp;5</p></body></html>
+`,
+			fromAddress: "guest@example.com",
+			subject:     "Leak",
+			text:        "Water & more\nRoom 5",
+		},
+		{
+			name: "quoted-printable",
+			raw: `From: guest@example.com
+Subject: Sink
+Content-Type: text/plain; charset=utf-8
+Content-Transfer-Encoding: quoted-printable
+
+The caf=C3=A9 sink is blocked and this line is long enough to be wrapped=
+ by a soft break.
+`,
+			fromAddress: "guest@example.com",
+			subject:     "Sink",
+			text:        "The café sink is blocked and this line is long enough to be wrapped by a soft break.",
+		},
+		{
+			name: "base64",
+			raw: `From: guest@example.com
+Subject: Light
+Content-Type: text/plain; charset=utf-8
+Content-Transfer-Encoding: base64
+
+VGhlIGxpZ2h0IGluIHRoZSBoYWxs
+d2F5IGlzIG91dC4=
+`,
+			fromAddress: "guest@example.com",
+			subject:     "Light",
+			text:        "The light in the hallway is out.",
+		},
+		{
+			name:        "Latin-1 body",
+			raw:         "From: guest@example.com\nSubject: Door\nContent-Type: text/plain; charset=iso-8859-1\n\nD\xe9j\xe0 vu\n",
+			fromAddress: "guest@example.com",
+			subject:     "Door",
+			text:        "Déjà vu",
+		},
+		{
+			name: "RFC 2047 subject and from",
+			raw: `From: =?UTF-8?B?5bGx55Sw?= <yamada@example.jp>
+Subject: =?UTF-8?Q?Heizung_kaputt_=E2=80=93?= =?ISO-8859-1?Q?_Zimmer_f=FCnf?=
+
+Hallo
+`,
+			fromAddress: "yamada@example.jp",
+			fromName:    "山田",
+			subject:     "Heizung kaputt – Zimmer fünf",
+			text:        "Hallo",
+		},
+		{
+			name: "attachments",
+			raw: `From: guest@example.com
+Subject: Photo
+Content-Type: multipart/mixed; boundary="outer"
+
+--outer
+Content-Type: multipart/alternative; boundary="inner"
+
+--inner
+Content-Type: text/plain
+
+See the photo
+--inner--
+--outer
+Content-Type: image/jpeg; name="crack.jpg"
+Content-Transfer-Encoding: base64
+
+/9j/4AAQ
+--outer
+Content-Type: text/plain
+Content-Disposition: attachment; filename="notes.txt"
+
+not the body
+--outer--
+`,
+			fromAddress: "guest@example.com",
+			subject:     "Photo",
+			text:        "See the photo",
+			attachments: []string{"crack.jpg", "notes.txt"},
+		},
+		{
+			name: "Auto-Submitted",
+			raw: `From: guest@example.com
+Subject: Out of office
+Auto-Submitted: auto-replied
+
+Away
+`,
+			fromAddress: "guest@example.com",
+			subject:     "Out of office",
+			text:        "Away",
+			autoReply:   true,
+		},
+		{
+			name: "Auto-Submitted no",
+			raw: `From: guest@example.com
+Subject: Hello
+Auto-Submitted: no
+
+Hi
+`,
+			fromAddress: "guest@example.com",
+			subject:     "Hello",
+			text:        "Hi",
+		},
+		{
+			name: "bulk precedence",
+			raw: `From: news@example.com
+Subject: Newsletter
+Precedence: bulk
+
+News
+`,
+			fromAddress: "news@example.com",
+			subject:     "Newsletter",
+			text:        "News",
+			autoReply:   true,
+		},
+		{
+			name: "X-Autoreply",
+			raw: `From: guest@example.com
+Subject: Re: Ticket #5
+X-Autoreply: yes
+
+Away
+`,
+			fromAddress: "guest@example.com",
+			subject:     "Re: Ticket #5",
+			text:        "Away",
+			autoReply:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := Parse(strings.NewReader(crlf(tt.raw)))
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if msg.FromAddress != tt.fromAddress {
+				t.Errorf("FromAddress = %q, want %q", msg.FromAddress, tt.fromAddress)
+			}
+			if msg.FromName != tt.fromName {
+				t.Errorf("FromName = %q, want %q", msg.FromName, tt.fromName)
+			}
+			if msg.Subject != tt.subject {
+				t.Errorf("Subject = %q, want %q", msg.Subject, tt.subject)
+			}
+			if msg.Text != tt.text {
+				t.Errorf("Text = %q, want %q", msg.Text, tt.text)
+			}
+			if msg.AutoReply != tt.autoReply {
+				t.Errorf("AutoReply = %v, want %v", msg.AutoReply, tt.autoReply)
+			}
+
+			var attachments []string
+			for _, attachment := range msg.Attachments {
+				attachments = append(attachments, attachment.Filename)
+			}
+			if strings.Join(attachments, ",") != strings.Join(tt.attachments, ",") {
+				t.Errorf("Attachments = %v, want %v", attachments, tt.attachments)
+			}
+		})
+	}
+}
+
+func TestParseAttachmentData(t *testing.T) {
+	raw := crlf(`From: guest@example.com
+Subject: Photo
+Message-Id: <photo@example.com>
+Content-Type: multipart/mixed; boundary="b"
+
+--b
+Content-Type: text/plain
+
+Photo attached
+--b
+Content-Type: image/png
+Content-Disposition: attachment; filename="leak.png"
+Content-Transfer-Encoding: base64
+
+iVBORw0K
+GgoK
+--b--
+`)
+	msg, err := Parse(strings.NewReader(raw))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if msg.MessageID != "photo@example.com" {
+		t.Errorf("MessageID = %q, want photo@example.com", msg.MessageID)
+	}
+	if len(msg.Attachments) != 1 {
+		t.Fatalf("got %d attachments, want 1", len(msg.Attachments))
+	}
+	attachment := msg.Attachments[0]
+	if attachment.ContentType != "image/png" || !attachment.IsImage() {
+		t.Errorf("ContentType = %q, want an image/png image", attachment.ContentType)
+	}
+	if want := "\x89PNG\r\n\x1a\n\n"; string(attachment.Data) != want {
+		t.Errorf("Data = %q, want %q", attachment.Data, want)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+	}{
+		{name: "no header end", raw: "From guest"},
+		{name: "no From", raw: "Subject: Hello\n\nHi\n"},
+		{name: "bad From", raw: "From: not an address\nSubject: Hello\n\nHi\n"},
+		{name: "unterminated multipart", raw: "From: guest@example.com\nContent-Type: multipart/mixed; boundary=\"b\"\n\n--b\nContent-Type: text/plain\n\nHi\n--b\nContent-Type"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(strings.NewReader(crlf(tt.raw))); !errors.Is(err, ErrInvalidMessage) {
+				t.Errorf("Parse gave %v, want ErrInvalidMessage", err)
+			}
+		})
+	}
+}
+
+func TestTicketReference(t *testing.T) {
+	tests := []struct {
+		subject string
+		want    int
+		ok      bool
+	}{
+		{subject: "Re: Ticket #123 Assigned", want: 123, ok: true},
+		{subject: "RE: Fwd: ticket #7 updated", want: 7, ok: true},
+		{subject: "Re: [Acme] Ticket # 42", want: 42, ok: true},
+		{subject: "Re: TICKET#9", want: 9, ok: true},
+		{subject: "Ticket #12 and Ticket #13", want: 12, ok: true},
+		{subject: "Broken heater", ok: false},
+		{subject: "Ticket number 5", ok: false},
+		{subject: "Room #12", ok: false},
+		{subject: "Subticket #4", ok: false},
+		{subject: "Ticket #99999999999999999999", ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.subject, func(t *testing.T) {
+			got, ok := TicketReference(tt.subject)
+			if ok != tt.ok || got != tt.want {
+				t.Errorf("TicketReference(%q) = %d, %v, want %d, %v", tt.subject, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestStripQuoted(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{name: "no quote", text: "Fixed, thanks", want: "Fixed, thanks"},
+		{name: "attribution line", text: "Still leaking\n\nOn Mon, 5 Jan 2026 at 09:00, Desk <desk@example.com> wrote:\n> Is it fixed?", want: "Still leaking"},
+		{name: "original message", text: "See below\n-----Original Message-----\nFrom: Desk\nIs it fixed?", want: "See below"},
+		{name: "quoted lines", text: "> Is it fixed?\nNo\n> Why?\nThe pipe", want: "No\nThe pipe"},
+		{name: "reply header first is kept", text: "From: the guest\nThe sink", want: "From: the guest\nThe sink"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := StripQuoted(tt.text); got != tt.want {
+				t.Errorf("StripQuoted(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
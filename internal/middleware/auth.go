@@ -66,15 +66,63 @@ func AuthMiddleware(jwtSecret []byte) gin.HandlerFunc {
 			}
 		}
 
+		// Every query is scoped to the caller's organisation, so tokens
+		// issued before organisations existed must be renewed. Refresh
+		// and MFA challenge tokens, and tokens issued before they were
+		// told apart, are not access tokens.
+		if _, ok := claims["org_id"].(float64); !ok || claims["purpose"] != "access" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+			c.Abort()
+			return
+		}
+
 		// Set user information in context
 		c.Set("user_id", claims["user_id"])
+		c.Set("org_id", claims["org_id"])
 		c.Set("first_name", claims["first_name"])
 		c.Set("last_name", claims["last_name"])
+		c.Set("role", claims["role"])
+		c.Set("token_exp", claims["exp"])
+		c.Set("mfa_enrollment", claims["mfa_enrollment"] == true)
 
 		c.Next()
 	}
 }
 
+// RequireMFAEnrolled turns away tokens issued to users who must set up
+// two-factor authentication before doing anything else. It must run after
+// AuthMiddleware.
+func RequireMFAEnrolled() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetBool("mfa_enrollment") {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "Two-factor authentication must be set up first",
+				"code":  "mfa_enrollment_required",
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireRole only lets through users whose token carries one of roles.
+// It must run after AuthMiddleware.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role, _ := c.Get("role")
+		for _, allowed := range roles {
+			if role == allowed {
+				c.Next()
+				return
+			}
+		}
+
+		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+		c.Abort()
+	}
+}
+
 // RateLimiter middleware to prevent brute force attacks
 // func RateLimiter() gin.HandlerFunc {
 // 	limiter := rate.NewLimiter(rate.Every(time.Second), 10)
@@ -0,0 +1,53 @@
+package models
+
+// Accommodation represents a property that tickets can be raised against
+type Accommodation struct {
+	ID          int                     `json:"id"`
+	Name        string                  `json:"name"`
+	Type        string                  `json:"type"`
+	Address     string                  `json:"address"`
+	CreatedDate string                  `json:"created_date"`
+	Rooms       []AccommodationRoom     `json:"rooms,omitempty"`
+	Locations   []AccommodationLocation `json:"locations,omitempty"`
+}
+
+// AccommodationCreate represents accommodation creation request data
+type AccommodationCreate struct {
+	Name    string `json:"name" binding:"required"`
+	Type    string `json:"type"`
+	Address string `json:"address"`
+}
+
+// AccommodationUpdate represents accommodation update request data
+type AccommodationUpdate struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Address string `json:"address"`
+}
+
+// AccommodationRoom represents a numbered room within an accommodation
+type AccommodationRoom struct {
+	ID              int    `json:"id"`
+	AccommodationID int    `json:"accommodation_id"`
+	RoomNumber      int    `json:"room_number"`
+	Name            string `json:"name"`
+}
+
+// AccommodationRoomCreate represents room creation request data
+type AccommodationRoomCreate struct {
+	RoomNumber int    `json:"room_number" binding:"required"`
+	Name       string `json:"name"`
+}
+
+// AccommodationLocation represents a named area within an accommodation,
+// e.g. "Lobby" or "Hot tub"
+type AccommodationLocation struct {
+	ID              int    `json:"id"`
+	AccommodationID int    `json:"accommodation_id"`
+	Name            string `json:"name"`
+}
+
+// AccommodationLocationCreate represents location creation request data
+type AccommodationLocationCreate struct {
+	Name string `json:"name" binding:"required"`
+}
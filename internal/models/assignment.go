@@ -0,0 +1,20 @@
+package models
+
+// TicketAssign represents a ticket reassignment request. Assignees, when
+// present, replaces the supporting assignees working with AssignedTo.
+type TicketAssign struct {
+	AssignedTo int    `json:"assigned_to" binding:"required"`
+	Assignees  *[]int `json:"assignees"`
+	Reason     string `json:"reason" binding:"required"`
+}
+
+// TicketAssignment represents one entry of a ticket's assignment history
+type TicketAssignment struct {
+	ID          int    `json:"id"`
+	TicketID    int    `json:"ticket_id"`
+	FromUserID  *int   `json:"from_user_id"`
+	ToUserID    *int   `json:"to_user_id"`
+	Reason      string `json:"reason"`
+	AssignedBy  *int   `json:"assigned_by"`
+	CreatedDate string `json:"created_date"`
+}
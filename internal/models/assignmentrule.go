@@ -0,0 +1,87 @@
+package models
+
+import "time"
+
+// AssignmentRule represents an auto-assignment rule. Unset conditions
+// match any ticket. TimeFrom and TimeTo are "15:04" in Timezone and wrap
+// past midnight when TimeFrom is later. Strategy is user, which assigns
+// AssignedTo, or round_robin or least_loaded, which pick from Pool.
+type AssignmentRule struct {
+	ID              int     `json:"id"`
+	Name            string  `json:"name"`
+	Position        int     `json:"position"`
+	AccommodationID *int    `json:"accommodation_id"`
+	RequestType     *string `json:"request_type"`
+	TaskPriority    *string `json:"task_priority"`
+	TimeFrom        *string `json:"time_from"`
+	TimeTo          *string `json:"time_to"`
+	Timezone        string  `json:"timezone"`
+	Strategy        string  `json:"strategy"`
+	AssignedTo      *int    `json:"assigned_to"`
+	Pool            []int   `json:"pool"`
+	Active          bool    `json:"active"`
+	CreatedDate     string  `json:"created_date"`
+}
+
+// AssignmentRuleCreate represents assignment rule creation data
+type AssignmentRuleCreate struct {
+	Name            string  `json:"name" binding:"required"`
+	Position        int     `json:"position"`
+	AccommodationID *int    `json:"accommodation_id"`
+	RequestType     *string `json:"request_type"`
+	TaskPriority    *string `json:"task_priority"`
+	TimeFrom        *string `json:"time_from"`
+	TimeTo          *string `json:"time_to"`
+	Timezone        string  `json:"timezone"`
+	Strategy        string  `json:"strategy" binding:"required,oneof=user round_robin least_loaded"`
+	AssignedTo      *int    `json:"assigned_to"`
+	Pool            []int   `json:"pool"`
+	Active          *bool   `json:"active"`
+}
+
+// AssignmentRuleUpdate represents assignment rule update data; nil fields
+// are left unchanged. Conditions are cleared with an empty string, or 0
+// for accommodation_id.
+type AssignmentRuleUpdate struct {
+	Name            *string `json:"name"`
+	Position        *int    `json:"position"`
+	AccommodationID *int    `json:"accommodation_id"`
+	RequestType     *string `json:"request_type"`
+	TaskPriority    *string `json:"task_priority"`
+	TimeFrom        *string `json:"time_from"`
+	TimeTo          *string `json:"time_to"`
+	Timezone        *string `json:"timezone"`
+	Strategy        *string `json:"strategy" binding:"omitempty,oneof=user round_robin least_loaded"`
+	AssignedTo      *int    `json:"assigned_to"`
+	Pool            *[]int  `json:"pool"`
+	Active          *bool   `json:"active"`
+}
+
+// AssignmentCheck describes a ticket to try the assignment rules on.
+// AccommodationName is looked up when AccommodationID is not given; At
+// defaults to now.
+type AssignmentCheck struct {
+	AccommodationID   *int       `json:"accommodation_id"`
+	AccommodationName string     `json:"accommodation_name"`
+	RequestType       string     `json:"request_type"`
+	TaskPriority      string     `json:"task_priority"`
+	At                *time.Time `json:"at"`
+	// OrgID is the organisation whose rules and staff are tried
+	OrgID int `json:"-"`
+}
+
+// AssignmentStep explains why one rule did or did not assign the ticket
+type AssignmentStep struct {
+	RuleID  int    `json:"rule_id"`
+	Name    string `json:"name"`
+	Matched bool   `json:"matched"`
+	Reason  string `json:"reason"`
+}
+
+// AssignmentExplanation represents the outcome of trying the rules
+type AssignmentExplanation struct {
+	RuleID     *int             `json:"rule_id"`
+	RuleName   string           `json:"rule_name,omitempty"`
+	AssignedTo *int             `json:"assigned_to"`
+	Steps      []AssignmentStep `json:"steps"`
+}
@@ -0,0 +1,19 @@
+package models
+
+// BoardCommand represents a command sent over the dispatcher board
+// WebSocket. Type is view, leave, assign, status or comment. Changes name
+// the ticket version the client last saw in Version, or the value it saw
+// in FromAssignedTo or FromStatus, so edits racing with someone else's are
+// rejected rather than overwriting them.
+type BoardCommand struct {
+	Ref            string  `json:"ref"`
+	Type           string  `json:"type"`
+	TicketID       int     `json:"ticket_id"`
+	AssignedTo     int     `json:"assigned_to"`
+	FromAssignedTo *int    `json:"from_assigned_to"`
+	Reason         string  `json:"reason"`
+	Status         string  `json:"status"`
+	FromStatus     *string `json:"from_status"`
+	Body           string  `json:"body"`
+	Version        *int    `json:"version"`
+}
@@ -0,0 +1,43 @@
+package models
+
+// TicketBulk represents a bulk ticket operation. Tickets are chosen by IDs
+// or by Filter. Operation is status, reassign, priority or delete, taking
+// its value from Status, AssignedTo or Priority. Versions maps ticket IDs
+// to the version the client last saw, as If-Match does for a single
+// ticket; every one of IDs needs one, while with Filter they are optional
+// and only the tickets listed are checked. Mode is atomic (the default), where any failure rolls
+// everything back, or best_effort.
+type TicketBulk struct {
+	IDs        []int         `json:"ids"`
+	Filter     *TicketFilter `json:"filter"`
+	Operation  string        `json:"operation" binding:"required,oneof=status reassign priority delete"`
+	Status     string        `json:"status"`
+	AssignedTo int           `json:"assigned_to"`
+	Reason     string        `json:"reason"`
+	Priority   string        `json:"priority"`
+	Versions   map[int]int   `json:"versions"`
+	Mode       string        `json:"mode" binding:"omitempty,oneof=atomic best_effort"`
+	// OrgID is set from the caller's organisation; tickets of others are
+	// not found
+	OrgID int `json:"-"`
+}
+
+// TicketBulkResult is the outcome for one ticket: ok, unchanged,
+// not_found, conflict, failed, or rolled_back when an atomic operation
+// was undone because of another ticket
+type TicketBulkResult struct {
+	TicketID int    `json:"ticket_id"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Version  *int   `json:"version,omitempty"`
+}
+
+// TicketBulkReport represents the result of a bulk operation
+type TicketBulkReport struct {
+	Operation string             `json:"operation"`
+	Mode      string             `json:"mode"`
+	Committed bool               `json:"committed"`
+	Succeeded int                `json:"succeeded"`
+	Failed    int                `json:"failed"`
+	Results   []TicketBulkResult `json:"results"`
+}
@@ -0,0 +1,62 @@
+package models
+
+// RequestType represents an entry of the request type catalog
+type RequestType struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	SortOrder   int    `json:"sort_order"`
+	Active      bool   `json:"active"`
+}
+
+// RequestTypeCreate represents request type creation data
+type RequestTypeCreate struct {
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"description"`
+	SortOrder   int    `json:"sort_order"`
+}
+
+// RequestTypeUpdate represents request type update data; nil fields are left unchanged
+type RequestTypeUpdate struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+	SortOrder   *int    `json:"sort_order"`
+	Active      *bool   `json:"active"`
+}
+
+// TaskPriority represents an entry of the priority catalog. Tickets of an
+// urgent priority also page the on-call staff.
+type TaskPriority struct {
+	ID                int    `json:"id"`
+	Name              string `json:"name"`
+	SortOrder         int    `json:"sort_order"`
+	Colour            string `json:"colour"`
+	DefaultSLAMinutes *int   `json:"default_sla_minutes"`
+	Urgent            bool   `json:"urgent"`
+	Active            bool   `json:"active"`
+}
+
+// TaskPriorityCreate represents priority creation data
+type TaskPriorityCreate struct {
+	Name              string `json:"name" binding:"required"`
+	SortOrder         int    `json:"sort_order"`
+	Colour            string `json:"colour"`
+	DefaultSLAMinutes *int   `json:"default_sla_minutes" binding:"omitempty,min=1"`
+	Urgent            bool   `json:"urgent"`
+}
+
+// TaskPriorityUpdate represents priority update data; nil fields are left unchanged
+type TaskPriorityUpdate struct {
+	Name              *string `json:"name"`
+	SortOrder         *int    `json:"sort_order"`
+	Colour            *string `json:"colour"`
+	DefaultSLAMinutes *int    `json:"default_sla_minutes" binding:"omitempty,min=1"`
+	Urgent            *bool   `json:"urgent"`
+	Active            *bool   `json:"active"`
+}
+
+// Catalogs groups the catalogs used to populate ticket form dropdowns
+type Catalogs struct {
+	RequestTypes []RequestType  `json:"request_types"`
+	Priorities   []TaskPriority `json:"priorities"`
+}
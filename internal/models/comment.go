@@ -0,0 +1,17 @@
+package models
+
+// TicketComment represents a comment on a ticket
+type TicketComment struct {
+	ID          int    `json:"id"`
+	TicketID    int    `json:"ticket_id"`
+	AuthorID    *int   `json:"author_id"`
+	AuthorName  string `json:"author_name"`
+	Body        string `json:"body"`
+	Source      string `json:"source"`
+	CreatedDate string `json:"created_date"`
+}
+
+// TicketCommentCreate represents comment creation data
+type TicketCommentCreate struct {
+	Body string `json:"body" binding:"required"`
+}
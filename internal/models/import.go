@@ -0,0 +1,33 @@
+package models
+
+// TicketImport represents the options of a CSV ticket import, sent as
+// multipart form fields next to the file. Mapping is a JSON object naming
+// the CSV column for each TicketCreate field; without it columns are
+// matched to fields by header. Defaults is a JSON object of values for
+// fields the file leaves empty. DryRun validates without creating anything.
+type TicketImport struct {
+	Mapping  string `form:"mapping"`
+	Defaults string `form:"defaults"`
+	DryRun   bool   `form:"dry_run"`
+}
+
+// TicketImportRow is the outcome for one CSV row: valid (dry run),
+// created, invalid, or failed when its batch could not be stored. Row is
+// the line number in the file, counting the header as 1.
+type TicketImportRow struct {
+	Row      int      `json:"row"`
+	Status   string   `json:"status"`
+	Errors   []string `json:"errors,omitempty"`
+	TicketID *int     `json:"ticket_id,omitempty"`
+}
+
+// TicketImportReport represents the result of a CSV ticket import
+type TicketImportReport struct {
+	DryRun  bool              `json:"dry_run"`
+	Total   int               `json:"total"`
+	Valid   int               `json:"valid"`
+	Invalid int               `json:"invalid"`
+	Created int               `json:"created"`
+	Failed  int               `json:"failed"`
+	Rows    []TicketImportRow `json:"rows"`
+}
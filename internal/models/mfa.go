@@ -0,0 +1,40 @@
+package models
+
+// MFAEnroll starts two-factor authentication enrollment
+type MFAEnroll struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+}
+
+// MFAEnrollment is the secret to add to an authenticator app, also as an
+// otpauth:// URI to show as a QR code
+type MFAEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+// MFACode carries a code from the user's authenticator app
+type MFACode struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// MFADisable turns two-factor authentication off; it takes the current
+// password and either a code or a recovery code
+type MFADisable struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	Code            string `json:"code"`
+	RecoveryCode    string `json:"recovery_code"`
+}
+
+// MFALogin completes a login with the challenge token Login returned and
+// either a code or a recovery code
+type MFALogin struct {
+	MFAToken     string `json:"mfa_token" binding:"required"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// MFARecoveryCodes are new single-use recovery codes. They are shown only
+// this once.
+type MFARecoveryCodes struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
@@ -0,0 +1,52 @@
+package models
+
+// Organisation represents a company or region using the system, with the
+// settings its emails and reports follow
+type Organisation struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+	// MailSender is where replies to notifications go; they are always
+	// sent from the ticketing mailbox
+	MailSender   string `json:"mail_sender"`
+	Timezone     string `json:"timezone"`
+	DashboardURL string `json:"dashboard_url"`
+	BrandName    string `json:"brand_name"`
+	BrandColour  string `json:"brand_colour"`
+	LogoURL      string `json:"logo_url"`
+	// MFARequiredRoles are the roles that must use two-factor
+	// authentication
+	MFARequiredRoles []string `json:"mfa_required_roles"`
+	CreatedDate      string   `json:"created_date"`
+}
+
+// OrganisationUpdate represents organisation settings update data; nil
+// fields are left unchanged
+type OrganisationUpdate struct {
+	Name         *string `json:"name"`
+	MailSender   *string `json:"mail_sender" binding:"omitempty,email"`
+	Timezone     *string `json:"timezone"`
+	DashboardURL *string `json:"dashboard_url" binding:"omitempty,http_url"`
+	BrandName    *string `json:"brand_name"`
+	BrandColour  *string `json:"brand_colour"`
+	LogoURL      *string `json:"logo_url" binding:"omitempty,http_url"`
+	// MFARequiredRoles replaces the roles that must use two-factor
+	// authentication; an empty list requires it of nobody
+	MFARequiredRoles *[]string `json:"mfa_required_roles" binding:"omitempty,dive,oneof=admin staff"`
+}
+
+// OrganisationCreate represents the data to set up a new organisation
+// along with its first admin
+type OrganisationCreate struct {
+	Name         string `json:"name" binding:"required"`
+	Slug         string `json:"slug" binding:"required"`
+	MailSender   string `json:"mail_sender" binding:"omitempty,email"`
+	Timezone     string `json:"timezone"`
+	DashboardURL string `json:"dashboard_url" binding:"omitempty,http_url"`
+	BrandName    string `json:"brand_name"`
+	BrandColour  string `json:"brand_colour"`
+	LogoURL      string `json:"logo_url" binding:"omitempty,http_url"`
+	// Admin is the organisation's first user, always an admin whatever
+	// role is given
+	Admin UserCreate `json:"admin" binding:"required"`
+}
@@ -0,0 +1,64 @@
+package models
+
+// ReportQuery represents the query parameters shared by reports. From and
+// To are RFC 3339 times or dates bounding ticket creation (completion for
+// completion times); they default to the last 30 days. Bucket is day, week
+// or month and GroupBy is status, priority, request_type or accommodation.
+type ReportQuery struct {
+	From    string `form:"from"`
+	To      string `form:"to"`
+	Bucket  string `form:"bucket" binding:"omitempty,oneof=day week month"`
+	GroupBy string `form:"group_by" binding:"omitempty,oneof=status priority request_type accommodation"`
+}
+
+// TicketCount is the number of tickets created in a time bucket with one
+// value of the grouping
+type TicketCount struct {
+	Bucket string `json:"bucket"`
+	Key    string `json:"key"`
+	Count  int    `json:"count"`
+}
+
+// TicketCountReport represents ticket counts over time buckets
+type TicketCountReport struct {
+	From    string        `json:"from"`
+	To      string        `json:"to"`
+	Bucket  string        `json:"bucket"`
+	GroupBy string        `json:"group_by"`
+	Counts  []TicketCount `json:"counts"`
+}
+
+// TechnicianCompletion represents how quickly a technician completes
+// tickets, from creation to completion
+type TechnicianCompletion struct {
+	UserID      int     `json:"user_id"`
+	Name        string  `json:"name"`
+	Completed   int     `json:"completed"`
+	MeanHours   float64 `json:"mean_hours"`
+	MedianHours float64 `json:"median_hours"`
+}
+
+// SLABreachRate is the share of tickets with an SLA that missed it
+type SLABreachRate struct {
+	Priority   string  `json:"priority,omitempty"`
+	Total      int     `json:"total"`
+	Breached   int     `json:"breached"`
+	BreachRate float64 `json:"breach_rate"`
+}
+
+// SLABreachReport represents SLA breach rates overall and per priority
+type SLABreachReport struct {
+	From       string          `json:"from"`
+	To         string          `json:"to"`
+	Overall    SLABreachRate   `json:"overall"`
+	ByPriority []SLABreachRate `json:"by_priority"`
+}
+
+// BacklogAge is the number of open tickets whose age in days falls in
+// [MinDays, MaxDays); MaxDays is nil for the oldest bucket
+type BacklogAge struct {
+	Label   string `json:"label"`
+	MinDays int    `json:"min_days"`
+	MaxDays *int   `json:"max_days"`
+	Count   int    `json:"count"`
+}
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// TicketSchedule represents a recurring ticket definition
+type TicketSchedule struct {
+	ID           int             `json:"id"`
+	Name         string          `json:"name"`
+	Recurrence   string          `json:"recurrence"`
+	Timezone     string          `json:"timezone"`
+	StartsAt     string          `json:"starts_at"`
+	Template     json.RawMessage `json:"template"`
+	AssignedTo   int             `json:"assigned_to"`
+	Active       bool            `json:"active"`
+	NextRunAt    *string         `json:"next_run_at"`
+	LastRunAt    *string         `json:"last_run_at"`
+	LastTicketID *int            `json:"last_ticket_id"`
+	CreatedDate  string          `json:"created_date"`
+}
+
+// TicketScheduleCreate represents ticket schedule creation data.
+// Recurrence is a five-field cron expression or an RRULE, and Template a
+// TicketCreate payload whose assigned_to defaults to AssignedTo.
+type TicketScheduleCreate struct {
+	Name       string          `json:"name" binding:"required"`
+	Recurrence string          `json:"recurrence" binding:"required"`
+	Timezone   string          `json:"timezone"`
+	StartsAt   *time.Time      `json:"starts_at"`
+	Template   json.RawMessage `json:"template" binding:"required"`
+	AssignedTo int             `json:"assigned_to" binding:"required"`
+	Active     *bool           `json:"active"`
+}
+
+// TicketScheduleUpdate represents ticket schedule update data; nil fields are left unchanged
+type TicketScheduleUpdate struct {
+	Name       *string         `json:"name"`
+	Recurrence *string         `json:"recurrence"`
+	Timezone   *string         `json:"timezone"`
+	StartsAt   *time.Time      `json:"starts_at"`
+	Template   json.RawMessage `json:"template"`
+	AssignedTo *int            `json:"assigned_to"`
+	Active     *bool           `json:"active"`
+}
@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// StaffShift represents a staff member's shift. On-call shifts are paged
+// for urgent tickets and escalations, optionally for one accommodation.
+type StaffShift struct {
+	ID              int    `json:"id"`
+	UserID          int    `json:"user_id"`
+	UserName        string `json:"user_name"`
+	StartsAt        string `json:"starts_at"`
+	EndsAt          string `json:"ends_at"`
+	OnCall          bool   `json:"on_call"`
+	AccommodationID *int   `json:"accommodation_id"`
+	Note            string `json:"note"`
+	CreatedDate     string `json:"created_date"`
+}
+
+// StaffShiftCreate represents shift creation data
+type StaffShiftCreate struct {
+	UserID          int       `json:"user_id" binding:"required"`
+	StartsAt        time.Time `json:"starts_at" binding:"required"`
+	EndsAt          time.Time `json:"ends_at" binding:"required"`
+	OnCall          bool      `json:"on_call"`
+	AccommodationID *int      `json:"accommodation_id"`
+	Note            string    `json:"note"`
+}
+
+// StaffShiftUpdate represents shift update data; nil fields are left
+// unchanged. accommodation_id 0 clears the accommodation.
+type StaffShiftUpdate struct {
+	StartsAt        *time.Time `json:"starts_at"`
+	EndsAt          *time.Time `json:"ends_at"`
+	OnCall          *bool      `json:"on_call"`
+	AccommodationID *int       `json:"accommodation_id"`
+	Note            *string    `json:"note"`
+}
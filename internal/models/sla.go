@@ -0,0 +1,24 @@
+package models
+
+// SLAPolicy represents the response and resolution targets of a priority
+type SLAPolicy struct {
+	ID                int    `json:"id"`
+	PriorityID        int    `json:"priority_id"`
+	Priority          string `json:"priority"`
+	ResponseMinutes   int    `json:"response_minutes"`
+	ResolutionMinutes int    `json:"resolution_minutes"`
+	WarningPercent    int    `json:"warning_percent"`
+}
+
+// SLAPolicyUpsert represents SLA policy create/replace request data.
+// WarningPercent is how far into a target alert_level is first raised.
+type SLAPolicyUpsert struct {
+	ResponseMinutes   int `json:"response_minutes" binding:"required,min=1"`
+	ResolutionMinutes int `json:"resolution_minutes" binding:"required,min=1"`
+	WarningPercent    int `json:"warning_percent" binding:"omitempty,min=1,max=99"`
+}
+
+// SupervisorUpdate represents a request to set a user's supervisor
+type SupervisorUpdate struct {
+	SupervisorID *int `json:"supervisor_id"`
+}
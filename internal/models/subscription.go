@@ -0,0 +1,39 @@
+package models
+
+// Subscription represents a user watching a ticket, an accommodation or a
+// request type; exactly one of the target IDs is set
+type Subscription struct {
+	ID              int    `json:"id"`
+	UserID          int    `json:"user_id"`
+	TicketID        *int   `json:"ticket_id"`
+	AccommodationID *int   `json:"accommodation_id"`
+	RequestTypeID   *int   `json:"request_type_id"`
+	CreatedDate     string `json:"created_date"`
+}
+
+// SubscriptionCreate represents subscription request data
+type SubscriptionCreate struct {
+	TicketID        *int `json:"ticket_id"`
+	AccommodationID *int `json:"accommodation_id"`
+	RequestTypeID   *int `json:"request_type_id"`
+}
+
+// Watcher represents a user subscribed to a ticket, directly or through
+// its accommodation or request type
+type Watcher struct {
+	UserID    int      `json:"user_id"`
+	FirstName string   `json:"first_name"`
+	LastName  string   `json:"last_name"`
+	Via       []string `json:"via"`
+}
+
+// NotificationPreference represents whether a user receives an event
+type NotificationPreference struct {
+	Event   string `json:"event"`
+	Enabled bool   `json:"enabled"`
+}
+
+// NotificationPreferencesUpdate maps event names to whether they are wanted
+type NotificationPreferencesUpdate struct {
+	Events map[string]bool `json:"events" binding:"required"`
+}
@@ -0,0 +1,42 @@
+package models
+
+// Team represents a group of staff, such as maintenance or housekeeping,
+// with its own ticket queue
+type Team struct {
+	ID          int          `json:"id"`
+	Name        string       `json:"name"`
+	Description string       `json:"description"`
+	Members     []TeamMember `json:"members"`
+	QueueSize   int          `json:"queue_size"`
+	CreatedDate string       `json:"created_date"`
+}
+
+// TeamMember represents a staff member of a team
+type TeamMember struct {
+	UserID    int    `json:"user_id"`
+	Name      string `json:"name"`
+	Email     string `json:"email"`
+	AddedDate string `json:"added_date"`
+}
+
+// TeamCreate represents team creation data
+type TeamCreate struct {
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"description"`
+	Members     []int  `json:"members"`
+}
+
+// TeamUpdate represents team update data; nil fields are left unchanged.
+// Members, when present, replaces the membership.
+type TeamUpdate struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+	Members     *[]int  `json:"members"`
+}
+
+// TicketQueue represents a request to move a ticket to a team queue,
+// leaving it unassigned until a member claims it
+type TicketQueue struct {
+	TeamID int    `json:"team_id" binding:"required"`
+	Reason string `json:"reason"`
+}
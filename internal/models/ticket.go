@@ -13,26 +13,47 @@ type Ticket struct {
 	TaskStatus                    string  `json:"task_status"`
 	TaskPriority                  string  `json:"task_priority"`
 	AlertLevel                    int     `json:"alert_level"`
-	AssignedTo                    int     `json:"assigned_to"`
+	AssignedTo                    int     `json:"assigned_to"` // 0 while waiting in a team queue
 	Note                          string  `json:"note"`
 	Image                         []byte  `json:"image"`
 	CreatedDate                   string  `json:"created_date"`
 	CompletionDate                *string `json:"completion_date"`
+	AccommodationID               *int    `json:"accommodation_id"`
+	RoomID                        *int    `json:"room_id"`
+	LocationID                    *int    `json:"location_id"`
+	ResponseDueAt                 *string `json:"response_due_at"`
+	DueAt                         *string `json:"due_at"`
+	RespondedAt                   *string `json:"responded_at"`
+	Breached                      bool    `json:"breached"`
+	ScheduleID                    *int    `json:"schedule_id"`
+	Assignees                     []int   `json:"assignees"`
+	Version                       int     `json:"version"`
+	DeletedAt                     *string `json:"deleted_at"`
+	DeletedBy                     *int    `json:"deleted_by"`
+	TeamID                        *int    `json:"team_id"`
+	OrgID                         int     `json:"org_id"`
 }
 
 // UserRegister represents registration request data
 type TicketCreate struct {
 	ReportedBy                    string `json:"reported_by"`
-	AccommodationName             string `json:"accommodation_name,omitempty" binding:"required"`
+	AccommodationName             string `json:"accommodation_name,omitempty"`
 	AccommodationRoomNumber       int    `json:"accommodation_room_number,string"`
-	AccommodationSpecificLocation string `json:"accommodation_specific_location,omitempty" binding:"required"`
-	AccommodationType             string `json:"accommodation_type,omitempty" binding:"required"`
+	AccommodationSpecificLocation string `json:"accommodation_specific_location,omitempty"`
+	AccommodationType             string `json:"accommodation_type,omitempty"`
 	RequestType                   string `json:"request_type,omitempty" binding:"required"`
 	RequestDetail                 string `json:"request_detail,omitempty" binding:"required"`
 	TaskPriority                  string `json:"task_priority,omitempty" binding:"required"`
-	AssignedTo                    int    `json:"assigned_to,string,omitempty" binding:"required"`
+	AssignedTo                    int    `json:"assigned_to,string,omitempty"` // chosen by the assignment rules when omitted, unless queued to TeamID
 	Note                          string `json:"note"`
 	Image                         []byte `json:"image"`
+	AccommodationID               *int   `json:"accommodation_id,omitempty"`
+	RoomID                        *int   `json:"room_id,omitempty"`
+	LocationID                    *int   `json:"location_id,omitempty"`
+	TeamID                        *int   `json:"team_id,omitempty"`
+	ScheduleID                    *int   `json:"-"` // set when generated from a ticket schedule
+	CreatedBy                     *int   `json:"-"` // the creating user, subscribed to the ticket
+	OrgID                         int    `json:"-"` // the organisation the ticket belongs to
 }
 
 // UserRegister represents registration request data
@@ -49,4 +70,26 @@ type TicketUpdate struct {
 	AssignedTo                    int    `json:"assigned_to,string,omitempty"`
 	Note                          string `json:"note"`
 	Image                         []byte `json:"image"`
+	AccommodationID               *int   `json:"accommodation_id,omitempty"`
+	RoomID                        *int   `json:"room_id,omitempty"`
+	LocationID                    *int   `json:"location_id,omitempty"`
+	// AccommodationChanged is set once a new accommodation is resolved;
+	// its room and location IDs are then written too, and cleared when
+	// they did not resolve
+	AccommodationChanged bool `json:"-"`
+}
+
+// TicketFilter selects tickets for the list, export and bulk endpoints,
+// from query parameters or JSON. Set fields are combined with AND; dates
+// are RFC 3339 times or plain dates.
+type TicketFilter struct {
+	TaskStatus      string `json:"task_status" form:"task_status"`
+	TaskPriority    string `json:"task_priority" form:"task_priority"`
+	RequestType     string `json:"request_type" form:"request_type"`
+	AssignedTo      *int   `json:"assigned_to" form:"assigned_to"`
+	AccommodationID *int   `json:"accommodation_id" form:"accommodation_id"`
+	TeamID          *int   `json:"team_id" form:"team_id"`
+	CreatedBefore   string `json:"created_before" form:"created_before"`
+	CreatedAfter    string `json:"created_after" form:"created_after"`
+	OrgID           int    `json:"-" form:"-"` // set from the caller's organisation
 }
@@ -5,13 +5,105 @@ import (
 	"regexp"
 )
 
-// User represents our database user
+// User is the public view of a staff account. It never carries the
+// password hash, which is only read where a password is checked.
 type User struct {
 	ID        int    `json:"id"`
 	FirstName string `json:"first_name"`
 	LastName  string `json:"last_name"`
 	Email     string `json:"email"`
-	Password  string `json:"-"` // "-" means this won't be included in JSON
+	Role      string `json:"role"`
+	OrgID     int    `json:"org_id"`
+	Active    bool   `json:"active"`
+	// DeactivatedAt is set while the account is deactivated
+	DeactivatedAt *string `json:"deactivated_at"`
+	MFAEnabled    bool    `json:"mfa_enabled"`
+}
+
+// UserFilter narrows and pages the user list. Query matches names and
+// email addresses.
+type UserFilter struct {
+	Query    string `form:"q"`
+	Role     string `form:"role" binding:"omitempty,oneof=admin staff"`
+	Active   *bool  `form:"active"`
+	Page     int    `form:"page" binding:"omitempty,min=1"`
+	PageSize int    `form:"page_size" binding:"omitempty,min=1,max=200"`
+}
+
+// UserPage is one page of the user list. Total counts every matching user.
+type UserPage struct {
+	Users    []User `json:"users"`
+	Total    int    `json:"total"`
+	Page     int    `json:"page"`
+	PageSize int    `json:"page_size"`
+}
+
+// UserCreate represents an admin creating a staff account in their
+// organisation. Role defaults to staff.
+type UserCreate struct {
+	FirstName string `json:"first_name" binding:"required"`
+	LastName  string `json:"last_name" binding:"required"`
+	Email     string `json:"email" binding:"required"`
+	Password  string `json:"password" binding:"required"`
+	Role      string `json:"role" binding:"omitempty,oneof=admin staff"`
+}
+
+// Validate checks if email format is valid
+func (u *UserCreate) Validate() error {
+	if !emailRegex.MatchString(u.Email) {
+		return errors.New("invalid email format")
+	}
+	return nil
+}
+
+// UserInvite represents an admin inviting someone to register in their
+// organisation. Role defaults to staff.
+type UserInvite struct {
+	Email string `json:"email" binding:"required"`
+	Role  string `json:"role" binding:"omitempty,oneof=admin staff"`
+}
+
+// Validate checks if email format is valid
+func (u *UserInvite) Validate() error {
+	if !emailRegex.MatchString(u.Email) {
+		return errors.New("invalid email format")
+	}
+	return nil
+}
+
+// Invitation is an invitation waiting to be used
+type Invitation struct {
+	ID          int    `json:"id"`
+	OrgID       int    `json:"org_id"`
+	Email       string `json:"email"`
+	Role        string `json:"role"`
+	InvitedBy   *int   `json:"invited_by"`
+	ExpiresAt   string `json:"expires_at"`
+	CreatedDate string `json:"created_date"`
+}
+
+// UserUpdate holds the user fields an admin changes. Email changes made
+// by an admin take effect at once, without verification.
+type UserUpdate struct {
+	FirstName *string `json:"first_name"`
+	LastName  *string `json:"last_name"`
+	Email     *string `json:"email"`
+	Role      *string `json:"role" binding:"omitempty,oneof=admin staff"`
+}
+
+// Validate checks if email format is valid
+func (u *UserUpdate) Validate() error {
+	if u.Email != nil && !emailRegex.MatchString(*u.Email) {
+		return errors.New("invalid email format")
+	}
+	return nil
+}
+
+// UserDeactivate represents deactivating a departing user. Their open
+// tickets move to ReassignTo when it is set.
+type UserDeactivate struct {
+	ReassignTo *int   `json:"reassign_to"`
+	Reason     string `json:"reason"`
 }
 
 // UserLogin represents login request data
@@ -20,19 +112,105 @@ type UserLogin struct {
 	Password string `json:"password" binding:"required"`
 }
 
-// UserRegister represents registration request data
+// UserRegister represents registration request data. Email must be the
+// address InvitationToken was sent to.
 type UserRegister struct {
-	FirstName string `json:"first_name" binding:"required"`
-	LastName  string `json:"last_name" binding:"required"`
-	Email     string `json:"email" binding:"required"`
-	Password  string `json:"password" binding:"required"`
+	FirstName       string `json:"first_name" binding:"required"`
+	LastName        string `json:"last_name" binding:"required"`
+	Email           string `json:"email" binding:"required"`
+	Password        string `json:"password" binding:"required"`
+	InvitationToken string `json:"invitation_token" binding:"required"`
 }
 
+var emailRegex = regexp.MustCompile(`^[a-z0-9._%+\-]+@[a-z0-9.\-]+\.[a-z]{2,4}$`)
+
 // Validate checks if email format is valid
 func (u *UserRegister) Validate() error {
-	emailRegex := regexp.MustCompile(`^[a-z0-9._%+\-]+@[a-z0-9.\-]+\.[a-z]{2,4}$`)
 	if !emailRegex.MatchString(u.Email) {
 		return errors.New("invalid email format")
 	}
 	return nil
 }
+
+// UserWorkload represents a staff member's current and recent tickets.
+// Qualified is set when they have completed tickets of the request type
+// the workload was asked for; OnDuty when they are on shift now.
+type UserWorkload struct {
+	UserID              int            `json:"user_id"`
+	Name                string         `json:"name"`
+	Role                string         `json:"role"`
+	OpenTickets         int            `json:"open_tickets"`
+	OpenByPriority      map[string]int `json:"open_by_priority"`
+	OldestOpenTicketID  *int           `json:"oldest_open_ticket_id"`
+	OldestOpenCreatedAt *string        `json:"oldest_open_created_at"`
+	CompletedLast7Days  int            `json:"completed_last_7_days"`
+	CompletedLast30Days int            `json:"completed_last_30_days"`
+	Qualified           bool           `json:"qualified"`
+	OnDuty              bool           `json:"on_duty"`
+}
+
+// Profile is the current user's own account, as shown on /me.
+// PendingEmail is an address waiting to be verified; Language and Timezone
+// are null when the organisation's are used.
+type Profile struct {
+	ID                      int                      `json:"id"`
+	FirstName               string                   `json:"first_name"`
+	LastName                string                   `json:"last_name"`
+	Email                   string                   `json:"email"`
+	PendingEmail            *string                  `json:"pending_email"`
+	Role                    string                   `json:"role"`
+	OrgID                   int                      `json:"org_id"`
+	PhoneNumber             *string                  `json:"phone_number"`
+	Language                *string                  `json:"language"`
+	Timezone                *string                  `json:"timezone"`
+	NotificationPreferences []NotificationPreference `json:"notification_preferences"`
+	MFAEnabled              bool                     `json:"mfa_enabled"`
+	// MFARequired is set when the user's role must use two-factor
+	// authentication, which they then cannot turn off
+	MFARequired bool `json:"mfa_required"`
+}
+
+// ProfileUpdate holds the profile fields to change. An empty phone number,
+// language or timezone clears it.
+type ProfileUpdate struct {
+	FirstName               *string         `json:"first_name"`
+	LastName                *string         `json:"last_name"`
+	PhoneNumber             *string         `json:"phone_number"`
+	Language                *string         `json:"language"`
+	Timezone                *string         `json:"timezone"`
+	NotificationPreferences map[string]bool `json:"notification_preferences"`
+}
+
+// PasswordChange represents a password change request
+type PasswordChange struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+// EmailChange represents a request to move the account to a new address
+type EmailChange struct {
+	Email           string `json:"email" binding:"required"`
+	CurrentPassword string `json:"current_password" binding:"required"`
+}
+
+// Validate checks if email format is valid
+func (e *EmailChange) Validate() error {
+	if !emailRegex.MatchString(e.Email) {
+		return errors.New("invalid email format")
+	}
+	return nil
+}
+
+// EmailVerify carries the token mailed to a new address
+type EmailVerify struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// UserDeactivation is the outcome of deactivating a user. Reassignment
+// reports the move of their open tickets, when one was asked for;
+// OpenTickets counts those still assigned to them.
+type UserDeactivation struct {
+	User         User              `json:"user"`
+	OpenTickets  int               `json:"open_tickets"`
+	Reassignment *TicketBulkReport `json:"reassignment,omitempty"`
+}
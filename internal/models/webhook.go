@@ -0,0 +1,49 @@
+package models
+
+import "encoding/json"
+
+// Webhook represents an outgoing webhook endpoint. Secret is only returned
+// when the webhook is created.
+type Webhook struct {
+	ID          int      `json:"id"`
+	Name        string   `json:"name"`
+	URL         string   `json:"url"`
+	Events      []string `json:"events"`
+	Active      bool     `json:"active"`
+	Secret      string   `json:"secret,omitempty"`
+	CreatedDate string   `json:"created_date"`
+}
+
+// WebhookCreate represents webhook registration data. An empty Events
+// list subscribes to every event; a missing Secret is generated.
+type WebhookCreate struct {
+	Name   string   `json:"name" binding:"required"`
+	URL    string   `json:"url" binding:"required"`
+	Secret string   `json:"secret"`
+	Events []string `json:"events"`
+	Active *bool    `json:"active"`
+}
+
+// WebhookUpdate represents webhook update data; nil fields are left unchanged
+type WebhookUpdate struct {
+	Name   *string   `json:"name"`
+	URL    *string   `json:"url"`
+	Secret *string   `json:"secret"`
+	Events *[]string `json:"events"`
+	Active *bool     `json:"active"`
+}
+
+// WebhookDelivery represents one queued or attempted webhook call
+type WebhookDelivery struct {
+	ID             int64           `json:"id"`
+	WebhookID      int             `json:"webhook_id"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  string          `json:"next_attempt_at"`
+	LastStatusCode *int            `json:"last_status_code"`
+	LastError      *string         `json:"last_error"`
+	CreatedDate    string          `json:"created_date"`
+	DeliveredDate  *string         `json:"delivered_date"`
+}
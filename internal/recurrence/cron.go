@@ -0,0 +1,210 @@
+package recurrence
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// allHours is the hour bitset of an expression that fires every hour
+const allHours = 1<<24 - 1
+
+// cronSchedule is a classic "minute hour day-of-month month day-of-week"
+// expression, each field held as a bitset of allowed values
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	domStar, dowStar              bool
+	start                         time.Time
+}
+
+func parseCron(expr string, start time.Time) (Schedule, error) {
+	if macro, ok := cronMacros[strings.ToLower(expr)]; ok {
+		expr = macro
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression needs 5 fields, got %d", len(fields))
+	}
+
+	s := &cronSchedule{
+		domStar: fields[2] == "*",
+		dowStar: fields[4] == "*",
+		start:   start,
+	}
+
+	var err error
+	if s.minute, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, fmt.Errorf("minute: %w", err)
+	}
+	if s.hour, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, fmt.Errorf("hour: %w", err)
+	}
+	if s.dom, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, fmt.Errorf("day of month: %w", err)
+	}
+	if s.month, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, fmt.Errorf("month: %w", err)
+	}
+	if s.dow, err = parseCronField(fields[4], 0, 7); err != nil {
+		return nil, fmt.Errorf("day of week: %w", err)
+	}
+	// Both 0 and 7 mean Sunday
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+
+	if s.Next(start.Add(-time.Minute)).IsZero() {
+		return nil, fmt.Errorf("cron expression %q never occurs", expr)
+	}
+	return s, nil
+}
+
+// parseCronField parses a comma-separated list of "*", "a", "a-b", with an
+// optional "/step" on each, into a bitset
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		hasStep := false
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			rangePart = part[:i]
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+			hasStep = true
+		}
+
+		lo, hi := min, max
+		switch {
+		case rangePart == "*":
+		case strings.Contains(rangePart, "-"):
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err1, err2 error
+			lo, err1 = strconv.Atoi(bounds[0])
+			hi, err2 = strconv.Atoi(bounds[1])
+			if err1 != nil || err2 != nil {
+				return 0, fmt.Errorf("invalid range %q", rangePart)
+			}
+		default:
+			value, err := strconv.Atoi(rangePart)
+			if err != nil {
+				return 0, fmt.Errorf("invalid value %q", rangePart)
+			}
+			lo = value
+			if !hasStep {
+				hi = value
+			}
+		}
+
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%q out of range %d-%d", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+
+	return bits, nil
+}
+
+func (s *cronSchedule) Next(t time.Time) time.Time {
+	loc := s.start.Location()
+	t = t.In(loc)
+	if t.Before(s.start) {
+		t = s.start.Add(-time.Minute)
+	}
+	t = t.Truncate(time.Minute).Add(time.Minute)
+
+	limit := t.Add(maxLookahead)
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = advance(t, time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc))
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = advance(t, time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc))
+			continue
+		}
+		if s.missedInGap(t) {
+			return t
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = advance(t, time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc))
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 || s.repeatedHour(t) {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+
+	return time.Time{}
+}
+
+// advance moves t on to next, the start of a later month, day or hour on
+// the wall clock. A start that falls in a daylight saving gap can come back
+// no later than t, so the search then goes on from the next hour instead.
+func advance(t, next time.Time) time.Time {
+	if next.After(t) {
+		return next
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location()).Add(time.Hour)
+}
+
+// missedInGap reports whether t is the end of a daylight saving gap that
+// swallowed an hour the expression fires in. Like classic cron, a job with
+// fixed hours then runs as soon as the gap ends rather than being skipped
+// for the day; jobs that fire every hour just carry on.
+func (s *cronSchedule) missedInGap(t time.Time) bool {
+	if t.Minute() != 0 || s.hour == allHours {
+		return false
+	}
+	prev := t.Add(-time.Minute)
+	first := prev.Hour() + 1
+	if prev.Day() != t.Day() {
+		first = 0
+	}
+	for h := first; h < t.Hour(); h++ {
+		if s.hour&(1<<uint(h)) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// repeatedHour reports whether t is in the second pass of an hour the clocks
+// went back over, which a job with fixed hours has already run in
+func (s *cronSchedule) repeatedHour(t time.Time) bool {
+	if s.hour == allHours {
+		return false
+	}
+	earlier := t.Add(-time.Hour)
+	return earlier.Hour() == t.Hour() && earlier.Day() == t.Day()
+}
+
+// dayMatches applies cron's day rule: when both day fields are restricted
+// either may match, otherwise both must
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
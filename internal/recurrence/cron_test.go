@@ -0,0 +1,290 @@
+package recurrence
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronField(t *testing.T) {
+	tests := []struct {
+		field    string
+		min, max int
+		want     []int
+		wantErr  bool
+	}{
+		{field: "*", min: 0, max: 5, want: []int{0, 1, 2, 3, 4, 5}},
+		{field: "7", min: 0, max: 7, want: []int{7}},
+		{field: "1,3,5", min: 0, max: 6, want: []int{1, 3, 5}},
+		{field: "2-4", min: 0, max: 6, want: []int{2, 3, 4}},
+		{field: "*/15", min: 0, max: 59, want: []int{0, 15, 30, 45}},
+		{field: "1-10/4", min: 0, max: 59, want: []int{1, 5, 9}},
+		{field: "5/20", min: 0, max: 59, want: []int{5, 25, 45}},
+		{field: "*/2", min: 1, max: 12, want: []int{1, 3, 5, 7, 9, 11}},
+		{field: "0,10-12,*/30", min: 0, max: 59, want: []int{0, 10, 11, 12, 30}},
+		{field: "60", min: 0, max: 59, wantErr: true},
+		{field: "0", min: 1, max: 31, wantErr: true},
+		{field: "5-1", min: 0, max: 59, wantErr: true},
+		{field: "1-60", min: 0, max: 59, wantErr: true},
+		{field: "-1", min: 0, max: 59, wantErr: true},
+		{field: "*/0", min: 0, max: 59, wantErr: true},
+		{field: "*/-5", min: 0, max: 59, wantErr: true},
+		{field: "*/x", min: 0, max: 59, wantErr: true},
+		{field: "1-x", min: 0, max: 59, wantErr: true},
+		{field: "a", min: 0, max: 59, wantErr: true},
+		{field: "1,,2", min: 0, max: 59, wantErr: true},
+		{field: "", min: 0, max: 59, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.field, func(t *testing.T) {
+			got, err := parseCronField(tt.field, tt.min, tt.max)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseCronField(%q, %d, %d) = %b, want an error", tt.field, tt.min, tt.max, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseCronField(%q, %d, %d): %v", tt.field, tt.min, tt.max, err)
+			}
+
+			var want uint64
+			for _, v := range tt.want {
+				want |= 1 << uint(v)
+			}
+			if got != want {
+				t.Errorf("parseCronField(%q, %d, %d) = %b, want %b", tt.field, tt.min, tt.max, got, want)
+			}
+		})
+	}
+}
+
+func TestParseCronErrors(t *testing.T) {
+	start := time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		expr string
+	}{
+		{name: "too few fields", expr: "* * * *"},
+		{name: "too many fields", expr: "* * * * * *"},
+		{name: "unknown macro", expr: "@reboot"},
+		{name: "minute out of range", expr: "60 * * * *"},
+		{name: "hour out of range", expr: "0 24 * * *"},
+		{name: "day of month zero", expr: "0 0 0 * *"},
+		{name: "day of month out of range", expr: "0 0 32 * *"},
+		{name: "month zero", expr: "0 0 1 0 *"},
+		{name: "month out of range", expr: "0 0 1 13 *"},
+		{name: "day of week out of range", expr: "0 0 * * 8"},
+		{name: "zero step", expr: "*/0 * * * *"},
+		{name: "reversed range", expr: "0 17-9 * * *"},
+		{name: "month names", expr: "0 0 1 JAN *"},
+		{name: "30 February", expr: "0 0 30 2 *"},
+		{name: "31st of 30-day months", expr: "0 0 31 4,6,9,11 *"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(tt.expr, start, time.UTC); err == nil {
+				t.Errorf("Parse(%q) succeeded, want an error", tt.expr)
+			}
+		})
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	start := time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		expr string
+		from string
+		want []string
+	}{
+		{
+			name: "minute step",
+			expr: "*/15 * * * *",
+			from: "2026-03-10T10:07:00Z",
+			want: []string{"2026-03-10T10:15:00Z", "2026-03-10T10:30:00Z", "2026-03-10T10:45:00Z", "2026-03-10T11:00:00Z"},
+		},
+		{
+			name: "lists and ranges",
+			expr: "0,30 8-9 * * *",
+			from: "2026-03-10T08:10:00Z",
+			want: []string{"2026-03-10T08:30:00Z", "2026-03-10T09:00:00Z", "2026-03-10T09:30:00Z", "2026-03-11T08:00:00Z"},
+		},
+		{
+			name: "weekdays skip the weekend",
+			expr: "0 9 * * 1-5",
+			from: "2026-03-13T10:00:00Z",
+			want: []string{"2026-03-16T09:00:00Z", "2026-03-17T09:00:00Z"},
+		},
+		{
+			name: "Sunday as 0",
+			expr: "0 0 * * 0",
+			from: "2026-03-10T00:00:00Z",
+			want: []string{"2026-03-15T00:00:00Z", "2026-03-22T00:00:00Z"},
+		},
+		{
+			name: "Sunday as 7",
+			expr: "0 0 * * 7",
+			from: "2026-03-10T00:00:00Z",
+			want: []string{"2026-03-15T00:00:00Z", "2026-03-22T00:00:00Z"},
+		},
+		{
+			name: "day of month only",
+			expr: "0 0 13 * *",
+			from: "2026-04-01T00:00:00Z",
+			want: []string{"2026-04-13T00:00:00Z", "2026-05-13T00:00:00Z"},
+		},
+		{
+			name: "day of month or day of week when both are restricted",
+			expr: "0 0 13 * 5",
+			from: "2026-04-01T00:00:00Z",
+			want: []string{"2026-04-03T00:00:00Z", "2026-04-10T00:00:00Z", "2026-04-13T00:00:00Z", "2026-04-17T00:00:00Z"},
+		},
+		{
+			name: "day of week within restricted months",
+			expr: "0 0 * 2 1",
+			from: "2026-01-20T00:00:00Z",
+			want: []string{"2026-02-02T00:00:00Z", "2026-02-09T00:00:00Z", "2026-02-16T00:00:00Z", "2026-02-23T00:00:00Z", "2027-02-01T00:00:00Z"},
+		},
+		{
+			name: "month step",
+			expr: "0 12 1 */3 *",
+			from: "2026-02-10T00:00:00Z",
+			want: []string{"2026-04-01T12:00:00Z", "2026-07-01T12:00:00Z", "2026-10-01T12:00:00Z", "2027-01-01T12:00:00Z"},
+		},
+		{
+			name: "31st skips short months",
+			expr: "0 0 31 * *",
+			from: "2026-03-10T00:00:00Z",
+			want: []string{"2026-03-31T00:00:00Z", "2026-05-31T00:00:00Z", "2026-07-31T00:00:00Z"},
+		},
+		{
+			name: "leap day",
+			expr: "0 0 29 2 *",
+			from: "2026-01-01T00:00:00Z",
+			want: []string{"2028-02-29T00:00:00Z", "2032-02-29T00:00:00Z"},
+		},
+		{
+			name: "hourly macro",
+			expr: "@hourly",
+			from: "2026-03-10T10:07:00Z",
+			want: []string{"2026-03-10T11:00:00Z", "2026-03-10T12:00:00Z"},
+		},
+		{
+			name: "weekly macro",
+			expr: "@WEEKLY",
+			from: "2026-03-10T10:07:00Z",
+			want: []string{"2026-03-15T00:00:00Z", "2026-03-22T00:00:00Z"},
+		},
+		{
+			name: "yearly macro",
+			expr: "@yearly",
+			from: "2026-03-10T10:07:00Z",
+			want: []string{"2027-01-01T00:00:00Z", "2028-01-01T00:00:00Z"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Parse(tt.expr, start, time.UTC)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.expr, err)
+			}
+			assertOccurrences(t, s, mustParseTime(t, tt.from), tt.want)
+		})
+	}
+}
+
+func TestCronNextDaylightSaving(t *testing.T) {
+	ny := mustLoadLocation(t, "America/New_York")
+	santiago := mustLoadLocation(t, "America/Santiago")
+
+	// In 2026 New York skips from 02:00 to 03:00 on 8 March and repeats
+	// 01:00 to 02:00 on 1 November; Santiago skips from 00:00 to 01:00 on
+	// 6 September
+	tests := []struct {
+		name string
+		loc  *time.Location
+		expr string
+		from string
+		want []string
+	}{
+		{
+			name: "skipped time runs when the gap ends",
+			loc:  ny,
+			expr: "30 2 * * *",
+			from: "2026-03-07T12:00:00-05:00",
+			want: []string{"2026-03-08T03:00:00-04:00", "2026-03-09T02:30:00-04:00"},
+		},
+		{
+			name: "skipped time does not run twice",
+			loc:  ny,
+			expr: "30 2,3 * * *",
+			from: "2026-03-07T12:00:00-05:00",
+			want: []string{"2026-03-08T03:00:00-04:00", "2026-03-08T03:30:00-04:00", "2026-03-09T02:30:00-04:00"},
+		},
+		{
+			name: "time after the gap",
+			loc:  ny,
+			expr: "0 3 * * *",
+			from: "2026-03-07T12:00:00-05:00",
+			want: []string{"2026-03-08T03:00:00-04:00", "2026-03-09T03:00:00-04:00"},
+		},
+		{
+			name: "every half hour across the gap",
+			loc:  ny,
+			expr: "*/30 * * * *",
+			from: "2026-03-08T00:50:00-05:00",
+			want: []string{"2026-03-08T01:00:00-05:00", "2026-03-08T01:30:00-05:00", "2026-03-08T03:00:00-04:00", "2026-03-08T03:30:00-04:00"},
+		},
+		{
+			name: "repeated time runs once",
+			loc:  ny,
+			expr: "30 1 * * *",
+			from: "2026-10-31T12:00:00-04:00",
+			want: []string{"2026-11-01T01:30:00-04:00", "2026-11-02T01:30:00-05:00"},
+		},
+		{
+			name: "repeated hour in a range runs once",
+			loc:  ny,
+			expr: "0 1-2 * * *",
+			from: "2026-10-31T12:00:00-04:00",
+			want: []string{"2026-11-01T01:00:00-04:00", "2026-11-01T02:00:00-05:00", "2026-11-02T01:00:00-05:00"},
+		},
+		{
+			name: "every half hour through the repeated hour",
+			loc:  ny,
+			expr: "*/30 * * * *",
+			from: "2026-11-01T00:50:00-04:00",
+			want: []string{"2026-11-01T01:00:00-04:00", "2026-11-01T01:30:00-04:00", "2026-11-01T01:00:00-05:00", "2026-11-01T01:30:00-05:00", "2026-11-01T02:00:00-05:00"},
+		},
+		{
+			name: "skipped midnight runs when the gap ends",
+			loc:  santiago,
+			expr: "0 0 * * *",
+			from: "2026-09-05T12:00:00-04:00",
+			want: []string{"2026-09-06T01:00:00-03:00", "2026-09-07T00:00:00-03:00"},
+		},
+		{
+			name: "day after a skipped midnight",
+			loc:  santiago,
+			expr: "0 9 6 * *",
+			from: "2026-09-01T00:00:00-04:00",
+			want: []string{"2026-09-06T09:00:00-03:00", "2026-10-06T09:00:00-03:00"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Date(2026, time.January, 1, 0, 0, 0, 0, tt.loc)
+			s, err := Parse(tt.expr, start, tt.loc)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.expr, err)
+			}
+			assertOccurrences(t, s, mustParseTime(t, tt.from), tt.want)
+		})
+	}
+}
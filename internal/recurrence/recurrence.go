@@ -0,0 +1,38 @@
+// Package recurrence parses the recurrence rules of scheduled tickets, either
+// five-field cron expressions or a subset of RFC 5545 RRULEs.
+package recurrence
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// maxLookahead bounds the search for the next occurrence so rules that
+// can never fire (e.g. 30 February) fail instead of looping forever
+const maxLookahead = 5 * 366 * 24 * time.Hour
+
+// Schedule yields the occurrences of a recurrence rule
+type Schedule interface {
+	// Next returns the first occurrence strictly after t, or the zero time
+	// if there is none
+	Next(t time.Time) time.Time
+}
+
+// Parse parses a cron expression or RRULE. Occurrences are computed in loc,
+// and start anchors the rule: nothing occurs before it, and RRULE intervals
+// and default times of day count from it.
+func Parse(expr string, start time.Time, loc *time.Location) (Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if expr == "" {
+		return nil, errors.New("empty recurrence")
+	}
+
+	start = start.In(loc).Truncate(time.Minute)
+
+	upper := strings.ToUpper(expr)
+	if strings.HasPrefix(upper, "RRULE:") || strings.Contains(upper, "FREQ=") {
+		return parseRRule(strings.TrimPrefix(upper, "RRULE:"), start)
+	}
+	return parseCron(expr, start)
+}
@@ -0,0 +1,137 @@
+package recurrence
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatalf("load %s: %v", name, err)
+	}
+	return loc
+}
+
+func mustParseTime(t *testing.T, value string) time.Time {
+	t.Helper()
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		t.Fatalf("parse %q: %v", value, err)
+	}
+	return parsed
+}
+
+// assertOccurrences checks the occurrences following from, where an empty
+// string stands for the zero time that ends a series
+func assertOccurrences(t *testing.T, s Schedule, from time.Time, want []string) {
+	t.Helper()
+	next := from
+	for i, w := range want {
+		next = s.Next(next)
+		if w == "" {
+			if !next.IsZero() {
+				t.Fatalf("occurrence %d: got %s, want none", i, next.Format(time.RFC3339))
+			}
+			return
+		}
+		if expected := mustParseTime(t, w); !next.Equal(expected) {
+			t.Fatalf("occurrence %d: got %s, want %s", i, next.Format(time.RFC3339), w)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	start := time.Date(2026, time.January, 5, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		expr    string
+		want    string
+		wantErr bool
+	}{
+		{name: "cron", expr: "0 9 * * *", want: "cron"},
+		{name: "cron macro with padding", expr: "  @daily  ", want: "cron"},
+		{name: "rrule with prefix", expr: "RRULE:FREQ=DAILY", want: "rrule"},
+		{name: "rrule without prefix", expr: "FREQ=WEEKLY;BYDAY=MO", want: "rrule"},
+		{name: "lower case rrule", expr: "rrule:freq=daily", want: "rrule"},
+		{name: "empty", expr: "", wantErr: true},
+		{name: "blank", expr: " \t ", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Parse(tt.expr, start, time.UTC)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Parse(%q) succeeded, want an error", tt.expr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.expr, err)
+			}
+
+			var got string
+			switch s.(type) {
+			case *cronSchedule:
+				got = "cron"
+			case *rrule:
+				got = "rrule"
+			}
+			if got != tt.want {
+				t.Errorf("Parse(%q) gave a %T, want %s", tt.expr, s, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseStart(t *testing.T) {
+	ny := mustLoadLocation(t, "America/New_York")
+	// Seconds are dropped, so an occurrence at the start itself still counts
+	start := time.Date(2026, time.January, 5, 9, 0, 30, 0, ny)
+
+	tests := []struct {
+		name string
+		expr string
+		from time.Time
+		want []string
+	}{
+		{
+			name: "cron before the start",
+			expr: "0 9 * * *",
+			from: time.Date(2025, time.June, 1, 0, 0, 0, 0, time.UTC),
+			want: []string{"2026-01-05T09:00:00-05:00", "2026-01-06T09:00:00-05:00"},
+		},
+		{
+			name: "rrule before the start",
+			expr: "FREQ=DAILY",
+			from: time.Date(2025, time.June, 1, 0, 0, 0, 0, time.UTC),
+			want: []string{"2026-01-05T09:00:00-05:00", "2026-01-06T09:00:00-05:00"},
+		},
+		{
+			name: "occurrences are in the schedule's location",
+			expr: "0 9 * * *",
+			from: time.Date(2026, time.March, 10, 12, 0, 0, 0, time.UTC),
+			want: []string{"2026-03-10T09:00:00-04:00", "2026-03-11T09:00:00-04:00"},
+		},
+		{
+			name: "next is strictly after",
+			expr: "0 9 * * *",
+			from: time.Date(2026, time.January, 7, 9, 0, 0, 0, ny),
+			want: []string{"2026-01-08T09:00:00-05:00"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Parse(tt.expr, start, ny)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.expr, err)
+			}
+			assertOccurrences(t, s, tt.from, tt.want)
+		})
+	}
+}
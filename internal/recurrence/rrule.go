@@ -0,0 +1,404 @@
+package recurrence
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var rruleWeekdays = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+// weekdayNum is a BYDAY entry such as "MO" (every Monday) or "-1FR" (the
+// last Friday of the period)
+type weekdayNum struct {
+	ord int
+	day time.Weekday
+}
+
+// rrule supports FREQ (DAILY, WEEKLY, MONTHLY, YEARLY), INTERVAL, UNTIL,
+// BYMONTH, BYMONTHDAY, BYDAY, BYHOUR and BYMINUTE. Weeks start on Monday.
+type rrule struct {
+	freq       string
+	interval   int
+	until      time.Time
+	byMonth    []int
+	byMonthDay []int
+	byDay      []weekdayNum
+	byHour     []int
+	byMinute   []int
+	start      time.Time
+}
+
+func parseRRule(rule string, start time.Time) (Schedule, error) {
+	r := &rrule{interval: 1, start: start}
+
+	for _, part := range strings.Split(rule, ";") {
+		if part == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid RRULE part %q", part)
+		}
+
+		var err error
+		switch key {
+		case "FREQ":
+			switch value {
+			case "DAILY", "WEEKLY", "MONTHLY", "YEARLY":
+				r.freq = value
+			default:
+				return nil, fmt.Errorf("unsupported FREQ %q", value)
+			}
+		case "INTERVAL":
+			r.interval, err = strconv.Atoi(value)
+			if err != nil || r.interval < 1 {
+				return nil, fmt.Errorf("invalid INTERVAL %q", value)
+			}
+		case "UNTIL":
+			r.until, err = parseUntil(value, start.Location())
+		case "BYMONTH":
+			r.byMonth, err = parseIntList(value, 1, 12, false)
+		case "BYMONTHDAY":
+			r.byMonthDay, err = parseIntList(value, 1, 31, true)
+		case "BYHOUR":
+			r.byHour, err = parseIntList(value, 0, 23, false)
+		case "BYMINUTE":
+			r.byMinute, err = parseIntList(value, 0, 59, false)
+		case "BYDAY":
+			r.byDay, err = parseByDay(value)
+		case "WKST":
+			if value != "MO" {
+				return nil, fmt.Errorf("only WKST=MO is supported")
+			}
+		default:
+			return nil, fmt.Errorf("unsupported RRULE part %q", key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+	}
+
+	if r.freq == "" {
+		return nil, fmt.Errorf("RRULE needs a FREQ")
+	}
+	if r.freq == "DAILY" || r.freq == "WEEKLY" {
+		for _, wd := range r.byDay {
+			if wd.ord != 0 {
+				return nil, fmt.Errorf("BYDAY ordinals need FREQ=MONTHLY or YEARLY")
+			}
+		}
+	}
+	if len(r.byHour) == 0 {
+		r.byHour = []int{start.Hour()}
+	}
+	if len(r.byMinute) == 0 {
+		r.byMinute = []int{start.Minute()}
+	}
+
+	if r.Next(start.Add(-time.Minute)).IsZero() {
+		return nil, fmt.Errorf("RRULE %q never occurs", rule)
+	}
+	return r, nil
+}
+
+func parseUntil(value string, loc *time.Location) (time.Time, error) {
+	for _, layout := range []string{"20060102T150405Z", "20060102T150405", "20060102"} {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			if strings.HasSuffix(value, "Z") {
+				t, _ = time.Parse(layout, value)
+			}
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", value)
+}
+
+func parseIntList(value string, min, max int, allowNegative bool) ([]int, error) {
+	var list []int
+	for _, item := range strings.Split(value, ",") {
+		n, err := strconv.Atoi(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %q", item)
+		}
+		abs := n
+		if allowNegative && n < 0 {
+			abs = -n
+		}
+		if abs < min || abs > max {
+			return nil, fmt.Errorf("%d out of range %d-%d", n, min, max)
+		}
+		list = append(list, n)
+	}
+	sort.Ints(list)
+	return list, nil
+}
+
+func parseByDay(value string) ([]weekdayNum, error) {
+	var days []weekdayNum
+	for _, item := range strings.Split(value, ",") {
+		if len(item) < 2 {
+			return nil, fmt.Errorf("invalid day %q", item)
+		}
+		day, ok := rruleWeekdays[item[len(item)-2:]]
+		if !ok {
+			return nil, fmt.Errorf("invalid day %q", item)
+		}
+		wd := weekdayNum{day: day}
+		if prefix := item[:len(item)-2]; prefix != "" {
+			ord, err := strconv.Atoi(prefix)
+			if err != nil || ord == 0 || ord < -5 || ord > 5 {
+				return nil, fmt.Errorf("invalid day %q", item)
+			}
+			wd.ord = ord
+		}
+		days = append(days, wd)
+	}
+	return days, nil
+}
+
+func (r *rrule) Next(t time.Time) time.Time {
+	t = t.In(r.start.Location())
+
+	from := t
+	if from.Before(r.start) {
+		from = r.start
+	}
+
+	// Start from the interval-aligned period containing from
+	period := r.periodIndex(from)
+	period -= period % r.interval
+
+	for {
+		periodStart := r.periodStart(period)
+		if periodStart.Sub(from) > maxLookahead {
+			return time.Time{}
+		}
+
+		for _, occurrence := range r.occurrences(periodStart) {
+			if occurrence.Before(r.start) || !occurrence.After(t) {
+				continue
+			}
+			if !r.until.IsZero() && occurrence.After(r.until) {
+				return time.Time{}
+			}
+			return occurrence
+		}
+
+		period += r.interval
+	}
+}
+
+// periodIndex counts whole FREQ periods between the start and t
+func (r *rrule) periodIndex(t time.Time) int {
+	switch r.freq {
+	case "DAILY":
+		return daysBetween(r.start, t)
+	case "WEEKLY":
+		return daysBetween(weekStart(r.start), t) / 7
+	case "MONTHLY":
+		return (t.Year()-r.start.Year())*12 + int(t.Month()) - int(r.start.Month())
+	default:
+		return t.Year() - r.start.Year()
+	}
+}
+
+// periodStart returns the first day of the n-th period. Days are held at
+// noon: a daylight saving change at midnight would otherwise move them back
+// onto the day before.
+func (r *rrule) periodStart(n int) time.Time {
+	loc := r.start.Location()
+	switch r.freq {
+	case "DAILY":
+		return time.Date(r.start.Year(), r.start.Month(), r.start.Day()+n, 12, 0, 0, 0, loc)
+	case "WEEKLY":
+		monday := weekStart(r.start)
+		return time.Date(monday.Year(), monday.Month(), monday.Day()+7*n, 12, 0, 0, 0, loc)
+	case "MONTHLY":
+		return time.Date(r.start.Year(), r.start.Month()+time.Month(n), 1, 12, 0, 0, 0, loc)
+	default:
+		return time.Date(r.start.Year()+n, time.January, 1, 12, 0, 0, 0, loc)
+	}
+}
+
+// occurrences lists, in order, every occurrence within the period
+func (r *rrule) occurrences(periodStart time.Time) []time.Time {
+	var days []time.Time
+
+	switch r.freq {
+	case "DAILY":
+		if r.dayMatches(periodStart) {
+			days = append(days, periodStart)
+		}
+	case "WEEKLY":
+		for i := 0; i < 7; i++ {
+			day := periodStart.AddDate(0, 0, i)
+			if !r.monthMatches(day) {
+				continue
+			}
+			if len(r.byDay) == 0 && day.Weekday() != r.start.Weekday() {
+				continue
+			}
+			if len(r.byDay) > 0 && !r.weekdayMatches(day) {
+				continue
+			}
+			days = append(days, day)
+		}
+	case "MONTHLY":
+		if r.monthMatches(periodStart) {
+			days = r.monthDays(periodStart.Year(), periodStart.Month())
+		}
+	default:
+		months := r.byMonth
+		if len(months) == 0 {
+			months = []int{int(r.start.Month())}
+		}
+		for _, month := range months {
+			days = append(days, r.monthDays(periodStart.Year(), time.Month(month))...)
+		}
+	}
+
+	var occurrences []time.Time
+	for _, day := range days {
+		for _, hour := range r.byHour {
+			for _, minute := range r.byMinute {
+				occurrences = append(occurrences, wallTime(day, hour, minute))
+			}
+		}
+	}
+	// A time moved out of a daylight saving gap can overtake later ones
+	sort.Slice(occurrences, func(i, j int) bool {
+		return occurrences[i].Before(occurrences[j])
+	})
+	return occurrences
+}
+
+// wallTime returns hour:minute on day. A time that falls in a daylight
+// saving gap is read with the offset from before the gap, as RFC 5545 does,
+// which moves it later by the length of the gap.
+func wallTime(day time.Time, hour, minute int) time.Time {
+	t := time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, day.Location())
+	want := time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, time.UTC)
+	got := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, time.UTC)
+	if got.Before(want) {
+		t = t.Add(want.Sub(got))
+	}
+	return t
+}
+
+// monthDays lists the days of a month selected by BYMONTHDAY and BYDAY,
+// defaulting to the start's day of month
+func (r *rrule) monthDays(year int, month time.Month) []time.Time {
+	loc := r.start.Location()
+	last := time.Date(year, month+1, 0, 12, 0, 0, 0, loc).Day()
+
+	var days []time.Time
+	for d := 1; d <= last; d++ {
+		day := time.Date(year, month, d, 12, 0, 0, 0, loc)
+
+		switch {
+		case len(r.byMonthDay) == 0 && len(r.byDay) == 0:
+			if d != r.start.Day() {
+				continue
+			}
+		case len(r.byMonthDay) > 0 && len(r.byDay) > 0:
+			if !r.monthDayMatches(d, last) || !r.byDayMatchesInMonth(day, last) {
+				continue
+			}
+		case len(r.byMonthDay) > 0:
+			if !r.monthDayMatches(d, last) {
+				continue
+			}
+		default:
+			if !r.byDayMatchesInMonth(day, last) {
+				continue
+			}
+		}
+
+		days = append(days, day)
+	}
+	return days
+}
+
+func (r *rrule) dayMatches(day time.Time) bool {
+	last := time.Date(day.Year(), day.Month()+1, 0, 12, 0, 0, 0, day.Location()).Day()
+	if !r.monthMatches(day) {
+		return false
+	}
+	if len(r.byMonthDay) > 0 && !r.monthDayMatches(day.Day(), last) {
+		return false
+	}
+	return len(r.byDay) == 0 || r.weekdayMatches(day)
+}
+
+func (r *rrule) monthMatches(day time.Time) bool {
+	if len(r.byMonth) == 0 {
+		return true
+	}
+	for _, month := range r.byMonth {
+		if time.Month(month) == day.Month() {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *rrule) monthDayMatches(d, last int) bool {
+	for _, md := range r.byMonthDay {
+		if md == d || (md < 0 && last+md+1 == d) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *rrule) weekdayMatches(day time.Time) bool {
+	for _, wd := range r.byDay {
+		if wd.day == day.Weekday() {
+			return true
+		}
+	}
+	return false
+}
+
+// byDayMatchesInMonth honours BYDAY ordinals, e.g. 1MO is the first Monday
+// and -1FR the last Friday of the month
+func (r *rrule) byDayMatchesInMonth(day time.Time, last int) bool {
+	for _, wd := range r.byDay {
+		if wd.day != day.Weekday() {
+			continue
+		}
+		switch {
+		case wd.ord == 0:
+			return true
+		case wd.ord > 0 && (day.Day()-1)/7+1 == wd.ord:
+			return true
+		case wd.ord < 0 && (last-day.Day())/7+1 == -wd.ord:
+			return true
+		}
+	}
+	return false
+}
+
+// daysBetween counts calendar days from a to b, ignoring the time of day
+func daysBetween(a, b time.Time) int {
+	da := time.Date(a.Year(), a.Month(), a.Day(), 0, 0, 0, 0, time.UTC)
+	db := time.Date(b.Year(), b.Month(), b.Day(), 0, 0, 0, 0, time.UTC)
+	return int(db.Sub(da).Hours() / 24)
+}
+
+// weekStart returns noon on the Monday of t's week
+func weekStart(t time.Time) time.Time {
+	offset := (int(t.Weekday()) + 6) % 7
+	return time.Date(t.Year(), t.Month(), t.Day()-offset, 12, 0, 0, 0, t.Location())
+}
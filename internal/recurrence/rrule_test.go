@@ -0,0 +1,248 @@
+package recurrence
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRRuleErrors(t *testing.T) {
+	start := time.Date(2026, time.January, 5, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		rule string
+	}{
+		{name: "missing FREQ", rule: "RRULE:INTERVAL=2"},
+		{name: "unsupported FREQ", rule: "FREQ=HOURLY"},
+		{name: "part without value", rule: "FREQ=DAILY;BYHOUR"},
+		{name: "COUNT", rule: "FREQ=DAILY;COUNT=5"},
+		{name: "unknown part", rule: "FREQ=DAILY;BYSETPOS=1"},
+		{name: "zero INTERVAL", rule: "FREQ=DAILY;INTERVAL=0"},
+		{name: "bad INTERVAL", rule: "FREQ=DAILY;INTERVAL=x"},
+		{name: "bad UNTIL", rule: "FREQ=DAILY;UNTIL=tomorrow"},
+		{name: "BYHOUR out of range", rule: "FREQ=DAILY;BYHOUR=24"},
+		{name: "negative BYHOUR", rule: "FREQ=DAILY;BYHOUR=-1"},
+		{name: "BYMINUTE out of range", rule: "FREQ=DAILY;BYMINUTE=60"},
+		{name: "BYMONTH out of range", rule: "FREQ=YEARLY;BYMONTH=13"},
+		{name: "BYMONTHDAY zero", rule: "FREQ=MONTHLY;BYMONTHDAY=0"},
+		{name: "BYMONTHDAY out of range", rule: "FREQ=MONTHLY;BYMONTHDAY=32"},
+		{name: "negative BYMONTHDAY out of range", rule: "FREQ=MONTHLY;BYMONTHDAY=-32"},
+		{name: "unknown BYDAY", rule: "FREQ=WEEKLY;BYDAY=XX"},
+		{name: "BYDAY ordinal zero", rule: "FREQ=MONTHLY;BYDAY=0MO"},
+		{name: "BYDAY ordinal out of range", rule: "FREQ=MONTHLY;BYDAY=6MO"},
+		{name: "BYDAY ordinal with WEEKLY", rule: "FREQ=WEEKLY;BYDAY=1MO"},
+		{name: "BYDAY ordinal with DAILY", rule: "FREQ=DAILY;BYDAY=-1FR"},
+		{name: "WKST other than Monday", rule: "FREQ=WEEKLY;WKST=SU"},
+		{name: "UNTIL before the start", rule: "FREQ=DAILY;UNTIL=20251231"},
+		{name: "30 February", rule: "FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=30"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(tt.rule, start, time.UTC); err == nil {
+				t.Errorf("Parse(%q) succeeded, want an error", tt.rule)
+			}
+		})
+	}
+}
+
+func TestRRuleNext(t *testing.T) {
+	// A Monday
+	start := time.Date(2026, time.January, 5, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		rule string
+		from string
+		want []string
+	}{
+		{
+			name: "daily",
+			rule: "FREQ=DAILY",
+			from: "2026-01-01T00:00:00Z",
+			want: []string{"2026-01-05T09:00:00Z", "2026-01-06T09:00:00Z", "2026-01-07T09:00:00Z"},
+		},
+		{
+			name: "interval counts from the start",
+			rule: "FREQ=DAILY;INTERVAL=3",
+			from: "2026-01-06T00:00:00Z",
+			want: []string{"2026-01-08T09:00:00Z", "2026-01-11T09:00:00Z", "2026-01-14T09:00:00Z"},
+		},
+		{
+			name: "hours and minutes",
+			rule: "FREQ=DAILY;BYHOUR=8,17;BYMINUTE=0,30",
+			from: "2026-01-06T08:10:00Z",
+			want: []string{"2026-01-06T08:30:00Z", "2026-01-06T17:00:00Z", "2026-01-06T17:30:00Z", "2026-01-07T08:00:00Z"},
+		},
+		{
+			name: "weekly defaults to the start's weekday",
+			rule: "FREQ=WEEKLY;INTERVAL=2",
+			from: "2026-01-01T00:00:00Z",
+			want: []string{"2026-01-05T09:00:00Z", "2026-01-19T09:00:00Z", "2026-02-02T09:00:00Z"},
+		},
+		{
+			name: "weekly on given days",
+			rule: "FREQ=WEEKLY;BYDAY=TU,TH",
+			from: "2026-01-05T10:00:00Z",
+			want: []string{"2026-01-06T09:00:00Z", "2026-01-08T09:00:00Z", "2026-01-13T09:00:00Z"},
+		},
+		{
+			name: "fortnightly skips whole weeks",
+			rule: "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR",
+			from: "2026-01-10T00:00:00Z",
+			want: []string{"2026-01-19T09:00:00Z", "2026-01-23T09:00:00Z", "2026-02-02T09:00:00Z"},
+		},
+		{
+			name: "monthly defaults to the start's day",
+			rule: "FREQ=MONTHLY",
+			from: "2026-01-05T09:00:00Z",
+			want: []string{"2026-02-05T09:00:00Z", "2026-03-05T09:00:00Z"},
+		},
+		{
+			name: "first Monday",
+			rule: "FREQ=MONTHLY;BYDAY=1MO",
+			from: "2026-01-01T00:00:00Z",
+			want: []string{"2026-01-05T09:00:00Z", "2026-02-02T09:00:00Z", "2026-03-02T09:00:00Z"},
+		},
+		{
+			name: "last Friday",
+			rule: "FREQ=MONTHLY;BYDAY=-1FR",
+			from: "2026-01-05T00:00:00Z",
+			want: []string{"2026-01-30T09:00:00Z", "2026-02-27T09:00:00Z", "2026-03-27T09:00:00Z"},
+		},
+		{
+			name: "last day of the month",
+			rule: "FREQ=MONTHLY;BYMONTHDAY=-1",
+			from: "2026-01-05T00:00:00Z",
+			want: []string{"2026-01-31T09:00:00Z", "2026-02-28T09:00:00Z", "2026-03-31T09:00:00Z"},
+		},
+		{
+			name: "31st skips short months",
+			rule: "FREQ=MONTHLY;BYMONTHDAY=31",
+			from: "2026-01-05T00:00:00Z",
+			want: []string{"2026-01-31T09:00:00Z", "2026-03-31T09:00:00Z", "2026-05-31T09:00:00Z"},
+		},
+		{
+			name: "month day and weekday must both match",
+			rule: "FREQ=MONTHLY;BYMONTHDAY=13;BYDAY=FR",
+			from: "2026-01-05T00:00:00Z",
+			want: []string{"2026-02-13T09:00:00Z", "2026-03-13T09:00:00Z", "2026-11-13T09:00:00Z"},
+		},
+		{
+			name: "monthly in given months",
+			rule: "FREQ=MONTHLY;BYMONTH=1,7;BYMONTHDAY=1",
+			from: "2026-01-10T00:00:00Z",
+			want: []string{"2026-07-01T09:00:00Z", "2027-01-01T09:00:00Z"},
+		},
+		{
+			name: "yearly on the last Sunday of March",
+			rule: "FREQ=YEARLY;BYMONTH=3;BYDAY=-1SU",
+			from: "2026-01-05T00:00:00Z",
+			want: []string{"2026-03-29T09:00:00Z", "2027-03-28T09:00:00Z"},
+		},
+		{
+			name: "until is inclusive",
+			rule: "FREQ=DAILY;UNTIL=20260107T090000Z",
+			from: "2026-01-01T00:00:00Z",
+			want: []string{"2026-01-05T09:00:00Z", "2026-01-06T09:00:00Z", "2026-01-07T09:00:00Z", ""},
+		},
+		{
+			name: "until as a date ends at midnight",
+			rule: "FREQ=DAILY;UNTIL=20260107",
+			from: "2026-01-01T00:00:00Z",
+			want: []string{"2026-01-05T09:00:00Z", "2026-01-06T09:00:00Z", ""},
+		},
+		{
+			name: "nothing after until",
+			rule: "FREQ=WEEKLY;UNTIL=20260301T000000Z",
+			from: "2026-03-01T00:00:00Z",
+			want: []string{""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Parse(tt.rule, start, time.UTC)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.rule, err)
+			}
+			assertOccurrences(t, s, mustParseTime(t, tt.from), tt.want)
+		})
+	}
+}
+
+func TestRRuleNextDaylightSaving(t *testing.T) {
+	ny := mustLoadLocation(t, "America/New_York")
+	santiago := mustLoadLocation(t, "America/Santiago")
+
+	// In 2026 New York skips from 02:00 to 03:00 on 8 March and repeats
+	// 01:00 to 02:00 on 1 November; Santiago skips from 00:00 to 01:00 on
+	// 6 September
+	tests := []struct {
+		name  string
+		start time.Time
+		rule  string
+		from  string
+		want  []string
+	}{
+		{
+			name:  "wall clock time is kept across the change",
+			start: time.Date(2026, time.January, 5, 9, 0, 0, 0, ny),
+			rule:  "FREQ=DAILY",
+			from:  "2026-03-07T00:00:00-05:00",
+			want:  []string{"2026-03-07T09:00:00-05:00", "2026-03-08T09:00:00-04:00"},
+		},
+		{
+			name:  "skipped time moves past the gap",
+			start: time.Date(2026, time.January, 5, 2, 30, 0, 0, ny),
+			rule:  "FREQ=DAILY",
+			from:  "2026-03-07T12:00:00-05:00",
+			want:  []string{"2026-03-08T03:30:00-04:00", "2026-03-09T02:30:00-04:00"},
+		},
+		{
+			name:  "skipped times merge with the hour after",
+			start: time.Date(2026, time.January, 5, 0, 0, 0, 0, ny),
+			rule:  "FREQ=DAILY;BYHOUR=1,2,3;BYMINUTE=15,45",
+			from:  "2026-03-08T00:00:00-05:00",
+			want:  []string{"2026-03-08T01:15:00-05:00", "2026-03-08T01:45:00-05:00", "2026-03-08T03:15:00-04:00", "2026-03-08T03:45:00-04:00", "2026-03-09T01:15:00-04:00"},
+		},
+		{
+			name:  "repeated time runs once",
+			start: time.Date(2026, time.January, 5, 1, 30, 0, 0, ny),
+			rule:  "FREQ=DAILY",
+			from:  "2026-10-31T12:00:00-04:00",
+			want:  []string{"2026-11-01T01:30:00-04:00", "2026-11-02T01:30:00-05:00"},
+		},
+		{
+			name:  "day after a skipped midnight",
+			start: time.Date(2026, time.January, 5, 9, 0, 0, 0, santiago),
+			rule:  "FREQ=DAILY",
+			from:  "2026-09-05T00:00:00-04:00",
+			want:  []string{"2026-09-05T09:00:00-04:00", "2026-09-06T09:00:00-03:00", "2026-09-07T09:00:00-03:00"},
+		},
+		{
+			name:  "month day after a skipped midnight",
+			start: time.Date(2026, time.January, 6, 9, 0, 0, 0, santiago),
+			rule:  "FREQ=MONTHLY;BYMONTHDAY=6",
+			from:  "2026-09-01T00:00:00-04:00",
+			want:  []string{"2026-09-06T09:00:00-03:00", "2026-10-06T09:00:00-03:00"},
+		},
+		{
+			name:  "skipped midnight moves past the gap",
+			start: time.Date(2026, time.January, 5, 0, 0, 0, 0, santiago),
+			rule:  "FREQ=DAILY",
+			from:  "2026-09-05T12:00:00-04:00",
+			want:  []string{"2026-09-06T01:00:00-03:00", "2026-09-07T00:00:00-03:00"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Parse(tt.rule, tt.start, tt.start.Location())
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.rule, err)
+			}
+			assertOccurrences(t, s, mustParseTime(t, tt.from), tt.want)
+		})
+	}
+}
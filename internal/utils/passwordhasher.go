@@ -1,23 +1,109 @@
 package utils
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
 	"errors"
+	"fmt"
+	"strings"
 
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/bcrypt"
 )
 
-// HashPassword converts a plain text password into a hashed version
+// New passwords are hashed with argon2id using these parameters. Hashes
+// made with anything else, older bcrypt hashes included, still verify and
+// are reported by NeedsRehash so they are upgraded on the next login.
+const (
+	argon2Time    = 3
+	argon2Memory  = 64 * 1024 // KiB
+	argon2Threads = 2
+	argon2SaltLen = 16
+	argon2KeyLen  = 32
+)
+
+// HashPassword converts a plain text password into a hashed version, in
+// the PHC string format $argon2id$v=19$m=...,t=...,p=...$salt$key
 func HashPassword(password string) (string, error) {
-	// Cost factor of 12 provides a good balance between security and performance
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 12)
-	if err != nil {
+	salt := make([]byte, argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
 		return "", errors.New("failed to hash password")
 	}
-	return string(bytes), nil
+	key := argon2.IDKey([]byte(password), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, argon2Memory, argon2Time, argon2Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key)), nil
 }
 
-// CheckPasswordHash compares a password against a hash
+// CheckPasswordHash compares a password against an argon2id or bcrypt hash
 func CheckPasswordHash(password, hash string) bool {
+	if strings.HasPrefix(hash, "$argon2id$") {
+		params, salt, key, err := decodeArgon2Hash(hash)
+		if err != nil {
+			return false
+		}
+		other := argon2.IDKey([]byte(password), salt, params.time, params.memory, params.threads, uint32(len(key)))
+		return subtle.ConstantTimeCompare(key, other) == 1
+	}
+
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 	return err == nil
 }
+
+// NeedsRehash reports whether hash was made with another algorithm or
+// other parameters than HashPassword uses now. Call it once the password
+// is known to be right, and store a fresh hash when it returns true.
+func NeedsRehash(hash string) bool {
+	if !strings.HasPrefix(hash, "$argon2id$") {
+		return true
+	}
+	params, salt, key, err := decodeArgon2Hash(hash)
+	if err != nil {
+		return true
+	}
+	return params != argon2Params{argon2.Version, argon2Memory, argon2Time, argon2Threads} ||
+		len(salt) != argon2SaltLen || len(key) != argon2KeyLen
+}
+
+type argon2Params struct {
+	version int
+	memory  uint32
+	time    uint32
+	threads uint8
+}
+
+func decodeArgon2Hash(hash string) (argon2Params, []byte, []byte, error) {
+	var params argon2Params
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return params, nil, nil, errors.New("malformed argon2id hash")
+	}
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &params.version); err != nil {
+		return params, nil, nil, err
+	}
+	if params.version != argon2.Version {
+		return params, nil, nil, errors.New("unsupported argon2 version")
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.time, &params.threads); err != nil {
+		return params, nil, nil, err
+	}
+	if params.time < 1 || params.threads < 1 {
+		return params, nil, nil, errors.New("malformed argon2id parameters")
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, err
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return params, nil, nil, err
+	}
+	// argon2 panics when asked for an empty key
+	if len(key) == 0 {
+		return params, nil, nil, errors.New("malformed argon2id hash")
+	}
+	return params, salt, key, nil
+}
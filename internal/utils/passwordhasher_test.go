@@ -0,0 +1,114 @@
+package utils
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHashPassword(t *testing.T) {
+	hash, err := HashPassword("correct horse battery staple")
+	if err != nil {
+		t.Fatalf("HashPassword: %v", err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=65536,t=3,p=2$") {
+		t.Errorf("HashPassword gave %q, want an argon2id hash with the current parameters", hash)
+	}
+
+	if !CheckPasswordHash("correct horse battery staple", hash) {
+		t.Error("CheckPasswordHash refused the right password")
+	}
+	if CheckPasswordHash("correct horse battery stapler", hash) {
+		t.Error("CheckPasswordHash accepted a wrong password")
+	}
+	if CheckPasswordHash("", hash) {
+		t.Error("CheckPasswordHash accepted an empty password")
+	}
+	if NeedsRehash(hash) {
+		t.Error("NeedsRehash is true for a fresh hash")
+	}
+
+	// Every hash has its own salt
+	again, err := HashPassword("correct horse battery staple")
+	if err != nil {
+		t.Fatalf("HashPassword: %v", err)
+	}
+	if again == hash {
+		t.Error("HashPassword gave the same hash twice")
+	}
+}
+
+func TestCheckPasswordHashBcrypt(t *testing.T) {
+	legacy, err := bcrypt.GenerateFromPassword([]byte("hunter2"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("bcrypt: %v", err)
+	}
+
+	if !CheckPasswordHash("hunter2", string(legacy)) {
+		t.Error("CheckPasswordHash refused the right password for a bcrypt hash")
+	}
+	if CheckPasswordHash("hunter3", string(legacy)) {
+		t.Error("CheckPasswordHash accepted a wrong password for a bcrypt hash")
+	}
+	if !NeedsRehash(string(legacy)) {
+		t.Error("NeedsRehash is false for a bcrypt hash")
+	}
+}
+
+func TestNeedsRehashOldParameters(t *testing.T) {
+	// "password" hashed with weaker parameters than HashPassword uses
+	salt := []byte("somesaltsomesalt")
+	key := argon2.IDKey([]byte("password"), salt, 2, 19*1024, 1, argon2KeyLen)
+	old := fmt.Sprintf("$argon2id$v=%d$m=%d,t=2,p=1$%s$%s", argon2.Version, 19*1024,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+
+	if !NeedsRehash(old) {
+		t.Error("NeedsRehash is false for a hash with old parameters")
+	}
+	if !CheckPasswordHash("password", old) {
+		t.Error("CheckPasswordHash refused the right password for a hash with old parameters")
+	}
+	if CheckPasswordHash("Password", old) {
+		t.Error("CheckPasswordHash accepted a wrong password for a hash with old parameters")
+	}
+}
+
+func TestMalformedHash(t *testing.T) {
+	tests := []struct {
+		name string
+		hash string
+	}{
+		{name: "empty", hash: ""},
+		{name: "not a hash", hash: "password"},
+		{name: "too few parts", hash: "$argon2id$v=19$m=65536,t=3,p=2$c29tZXNhbHQ"},
+		{name: "too many parts", hash: "$argon2id$v=19$m=65536,t=3,p=2$c29tZXNhbHQ$a2V5$extra"},
+		{name: "bad version", hash: "$argon2id$v=x$m=65536,t=3,p=2$c29tZXNhbHQ$a2V5"},
+		{name: "unsupported version", hash: "$argon2id$v=16$m=65536,t=3,p=2$c29tZXNhbHQ$a2V5"},
+		{name: "bad parameters", hash: "$argon2id$v=19$m=lots$c29tZXNhbHQ$a2V5"},
+		{name: "zero time", hash: "$argon2id$v=19$m=65536,t=0,p=2$c29tZXNhbHQ$a2V5"},
+		{name: "zero threads", hash: "$argon2id$v=19$m=65536,t=3,p=0$c29tZXNhbHQ$a2V5"},
+		{name: "bad salt", hash: "$argon2id$v=19$m=65536,t=3,p=2$not*base64$a2V5"},
+		{name: "bad key", hash: "$argon2id$v=19$m=65536,t=3,p=2$c29tZXNhbHQ$not*base64"},
+		{name: "empty key", hash: "$argon2id$v=19$m=65536,t=3,p=2$c29tZXNhbHQ$"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if strings.HasPrefix(tt.hash, "$argon2id$") {
+				if _, _, _, err := decodeArgon2Hash(tt.hash); err == nil {
+					t.Fatalf("decodeArgon2Hash(%q) succeeded, want an error", tt.hash)
+				}
+			}
+			if CheckPasswordHash("password", tt.hash) {
+				t.Errorf("CheckPasswordHash accepted %q", tt.hash)
+			}
+			if !NeedsRehash(tt.hash) {
+				t.Errorf("NeedsRehash is false for %q", tt.hash)
+			}
+		})
+	}
+}
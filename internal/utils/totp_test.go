@@ -0,0 +1,136 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 key of the RFC 6238 test vectors,
+// "12345678901234567890", base32 encoded
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestVerifyTOTPRFC6238(t *testing.T) {
+	// The RFC lists 8 digit codes; 6 digit codes are their last 6 digits
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{unix: 59, code: "287082"},
+		{unix: 1111111109, code: "081804"},
+		{unix: 1111111111, code: "050471"},
+		{unix: 1234567890, code: "005924"},
+		{unix: 2000000000, code: "279037"},
+		{unix: 20000000000, code: "353130"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			at := time.Unix(tt.unix, 0)
+			step, ok := VerifyTOTP(rfc6238Secret, tt.code, at, -1)
+			if !ok {
+				t.Fatalf("VerifyTOTP(%q) at %d was refused", tt.code, tt.unix)
+			}
+			if want := tt.unix / totpPeriod; step != want {
+				t.Errorf("VerifyTOTP(%q) at %d matched step %d, want %d", tt.code, tt.unix, step, want)
+			}
+		})
+	}
+}
+
+func TestVerifyTOTPSkew(t *testing.T) {
+	// Step 37037036 is the one containing 1111111109
+	const step = 37037036
+	const code = "081804"
+
+	tests := []struct {
+		name   string
+		offset int64
+		want   bool
+	}{
+		{name: "two steps early", offset: -2, want: false},
+		{name: "one step early", offset: -1, want: true},
+		{name: "on time", offset: 0, want: true},
+		{name: "one step late", offset: 1, want: true},
+		{name: "two steps late", offset: 2, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			at := time.Unix((step+tt.offset)*totpPeriod, 0)
+			got, ok := VerifyTOTP(rfc6238Secret, code, at, -1)
+			if ok != tt.want {
+				t.Fatalf("VerifyTOTP(%q) %d steps off = %v, want %v", code, tt.offset, ok, tt.want)
+			}
+			if ok && got != step {
+				t.Errorf("VerifyTOTP(%q) %d steps off matched step %d, want %d", code, tt.offset, got, step)
+			}
+		})
+	}
+}
+
+func TestVerifyTOTPReplay(t *testing.T) {
+	at := time.Unix(1111111109, 0)
+	step, ok := VerifyTOTP(rfc6238Secret, "081804", at, -1)
+	if !ok {
+		t.Fatal("VerifyTOTP refused a valid code")
+	}
+
+	if _, ok := VerifyTOTP(rfc6238Secret, "081804", at, step); ok {
+		t.Error("VerifyTOTP accepted a step that was already used")
+	}
+	if _, ok := VerifyTOTP(rfc6238Secret, "081804", at, step+1); ok {
+		t.Error("VerifyTOTP accepted a step before the last one used")
+	}
+	if got, ok := VerifyTOTP(rfc6238Secret, "081804", at, step-1); !ok || got != step {
+		t.Errorf("VerifyTOTP after the previous step = %d, %v, want %d, true", got, ok, step)
+	}
+}
+
+func TestVerifyTOTPInput(t *testing.T) {
+	at := time.Unix(1111111109, 0)
+
+	tests := []struct {
+		name   string
+		secret string
+		code   string
+		want   bool
+	}{
+		{name: "spaces in the code", secret: rfc6238Secret, code: " 081 804 ", want: true},
+		{name: "lower case secret", secret: "gezdgnbvgy3tqojqgezdgnbvgy3tqojq", code: "081804", want: true},
+		{name: "padded secret", secret: rfc6238Secret + "====", code: "081804", want: true},
+		{name: "wrong code", secret: rfc6238Secret, code: "081805", want: false},
+		{name: "short code", secret: rfc6238Secret, code: "81804", want: false},
+		{name: "8 digit code", secret: rfc6238Secret, code: "07081804", want: false},
+		{name: "empty code", secret: rfc6238Secret, code: "", want: false},
+		{name: "invalid secret", secret: "not base32!", code: "081804", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := VerifyTOTP(tt.secret, tt.code, at, -1); ok != tt.want {
+				t.Errorf("VerifyTOTP(%q, %q) = %v, want %v", tt.secret, tt.code, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("GenerateTOTPSecret: %v", err)
+	}
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil {
+		t.Fatalf("secret %q is not base32: %v", secret, err)
+	}
+	if len(key) != 20 {
+		t.Errorf("secret is %d bytes, want 20", len(key))
+	}
+
+	// A code made from the secret is accepted
+	at := time.Unix(1700000000, 0)
+	code := totpCode(key, at.Unix()/totpPeriod)
+	if _, ok := VerifyTOTP(secret, code, at, -1); !ok {
+		t.Errorf("VerifyTOTP refused code %q of a generated secret", code)
+	}
+}
@@ -0,0 +1,160 @@
+// Package xlsx writes single-sheet Excel workbooks row by row, so large
+// exports can be streamed without holding the sheet in memory.
+package xlsx
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Writer writes one worksheet. Rows must be written in order; Close must
+// be called to finish the workbook.
+type Writer struct {
+	zip    *zip.Writer
+	sheet  *bufio.Writer
+	row    int
+	closed bool
+}
+
+// Static workbook parts. Style 1 is the bold header style.
+var workbookParts = []struct{ name, body string }{
+	{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/><Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/></Types>`},
+	{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`},
+	{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/><Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/></Relationships>`},
+	{"xl/styles.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts><fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills><borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders><cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs><cellXfs count="2"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/><xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/></cellXfs></styleSheet>`},
+}
+
+// NewWriter starts a workbook on w with a single sheet of the given name
+func NewWriter(w io.Writer, sheetName string) (*Writer, error) {
+	zw := zip.NewWriter(w)
+	for _, part := range workbookParts {
+		f, err := zw.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(f, part.body); err != nil {
+			return nil, err
+		}
+	}
+
+	f, err := zw.Create("xl/workbook.xml")
+	if err != nil {
+		return nil, err
+	}
+	_, err = fmt.Fprintf(f, `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="%s" sheetId="1" r:id="rId1"/></sheets></workbook>`, escape(sheetName))
+	if err != nil {
+		return nil, err
+	}
+
+	// The sheet goes last since it stays open while rows are written
+	f, err = zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	sheet := bufio.NewWriter(f)
+	sheet.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	return &Writer{zip: zw, sheet: sheet}, nil
+}
+
+// WriteHeader writes a row of bold column titles
+func (w *Writer) WriteHeader(titles []string) error {
+	values := make([]any, len(titles))
+	for i, title := range titles {
+		values[i] = title
+	}
+	return w.writeRow(values, 1)
+}
+
+// WriteRow writes a row of cells. Integers and floats become numbers,
+// bools become booleans, nil leaves the cell empty and anything else is
+// written as text.
+func (w *Writer) WriteRow(values []any) error {
+	return w.writeRow(values, 0)
+}
+
+func (w *Writer) writeRow(values []any, style int) error {
+	if w.closed {
+		return errors.New("xlsx: write to closed writer")
+	}
+	w.row++
+	fmt.Fprintf(w.sheet, `<row r="%d">`, w.row)
+	for i, value := range values {
+		if value == nil {
+			continue
+		}
+		ref := ColumnName(i) + strconv.Itoa(w.row)
+		styleAttr := ""
+		if style != 0 {
+			styleAttr = fmt.Sprintf(` s="%d"`, style)
+		}
+
+		switch v := value.(type) {
+		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+			fmt.Fprintf(w.sheet, `<c r="%s"%s><v>%d</v></c>`, ref, styleAttr, v)
+		case float32, float64:
+			fmt.Fprintf(w.sheet, `<c r="%s"%s><v>%v</v></c>`, ref, styleAttr, v)
+		case bool:
+			b := 0
+			if v {
+				b = 1
+			}
+			fmt.Fprintf(w.sheet, `<c r="%s"%s t="b"><v>%d</v></c>`, ref, styleAttr, b)
+		default:
+			fmt.Fprintf(w.sheet, `<c r="%s"%s t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, styleAttr, escape(fmt.Sprint(v)))
+		}
+	}
+	_, err := w.sheet.WriteString("</row>")
+	return err
+}
+
+// Flush writes buffered rows through to the underlying writer
+func (w *Writer) Flush() error {
+	if err := w.sheet.Flush(); err != nil {
+		return err
+	}
+	return w.zip.Flush()
+}
+
+// Close finishes the sheet and the workbook. It does not close the
+// underlying writer.
+func (w *Writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	w.sheet.WriteString(`</sheetData></worksheet>`)
+	if err := w.sheet.Flush(); err != nil {
+		return err
+	}
+	return w.zip.Close()
+}
+
+// ColumnName returns the letters naming the zero-based column i: A, B, ...,
+// Z, AA, AB and so on
+func ColumnName(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+// escape makes s safe as XML text; characters XML cannot carry at all are
+// replaced
+func escape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
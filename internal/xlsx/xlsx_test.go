@@ -0,0 +1,195 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"testing"
+)
+
+func TestColumnName(t *testing.T) {
+	tests := []struct {
+		i    int
+		want string
+	}{
+		{0, "A"},
+		{1, "B"},
+		{25, "Z"},
+		{26, "AA"},
+		{27, "AB"},
+		{51, "AZ"},
+		{52, "BA"},
+		{701, "ZZ"},
+		{702, "AAA"},
+		{16383, "XFD"}, // the last column Excel allows
+	}
+
+	for _, tt := range tests {
+		if got := ColumnName(tt.i); got != tt.want {
+			t.Errorf("ColumnName(%d) = %q, want %q", tt.i, got, tt.want)
+		}
+	}
+}
+
+func TestEscape(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "plain", in: "Room 101", want: "Room 101"},
+		{name: "markup", in: `<b>"Tom" & 'Jerry'</b>`, want: "&lt;b&gt;&#34;Tom&#34; &amp; &#39;Jerry&#39;&lt;/b&gt;"},
+		{name: "whitespace", in: "a\tb\nc\rd", want: "a&#x9;b&#xA;c&#xD;d"},
+		{name: "control characters", in: "bell\x07null\x00esc\x1b", want: "bell�null�esc�"},
+		{name: "non-ASCII", in: "Niseko ニセコ", want: "Niseko ニセコ"},
+		{name: "invalid UTF-8", in: "a\xffb", want: "a�b"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := escape(tt.in); got != tt.want {
+				t.Errorf("escape(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+// sheetXML is the part of a worksheet the tests read back
+type sheetXML struct {
+	Rows []struct {
+		R     int `xml:"r,attr"`
+		Cells []struct {
+			R      string `xml:"r,attr"`
+			S      string `xml:"s,attr"`
+			T      string `xml:"t,attr"`
+			V      string `xml:"v"`
+			Inline string `xml:"is>t"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, `Tickets <&">`)
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	if err := w.WriteHeader([]string{"ID", "Title", "Open"}); err != nil {
+		t.Fatalf("WriteHeader: %v", err)
+	}
+	if err := w.WriteRow([]any{42, "Leak in <bath> & \"sink\"\x01", true}); err != nil {
+		t.Fatalf("WriteRow: %v", err)
+	}
+	if err := w.WriteRow([]any{1.5, nil, false}); err != nil {
+		t.Fatalf("WriteRow: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := w.WriteRow([]any{1}); err == nil {
+		t.Error("WriteRow after Close succeeded")
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("not a zip: %v", err)
+	}
+	parts := map[string][]byte{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("open %s: %v", f.Name, err)
+		}
+		body, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("read %s: %v", f.Name, err)
+		}
+		parts[f.Name] = body
+	}
+
+	// Every part is well-formed XML
+	for _, name := range []string{
+		"[Content_Types].xml",
+		"_rels/.rels",
+		"xl/_rels/workbook.xml.rels",
+		"xl/styles.xml",
+		"xl/workbook.xml",
+		"xl/worksheets/sheet1.xml",
+	} {
+		body, ok := parts[name]
+		if !ok {
+			t.Errorf("workbook has no %s", name)
+			continue
+		}
+		d := xml.NewDecoder(bytes.NewReader(body))
+		for {
+			if _, err := d.Token(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Errorf("%s is not well-formed: %v", name, err)
+				break
+			}
+		}
+	}
+
+	var types struct {
+		Overrides []struct {
+			PartName string `xml:"PartName,attr"`
+		} `xml:"Override"`
+	}
+	if err := xml.Unmarshal(parts["[Content_Types].xml"], &types); err != nil {
+		t.Fatalf("[Content_Types].xml: %v", err)
+	}
+	for _, override := range types.Overrides {
+		if _, ok := parts[override.PartName[1:]]; !ok {
+			t.Errorf("[Content_Types].xml names %s, which the workbook lacks", override.PartName)
+		}
+	}
+
+	var workbook struct {
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := xml.Unmarshal(parts["xl/workbook.xml"], &workbook); err != nil {
+		t.Fatalf("xl/workbook.xml: %v", err)
+	}
+	if len(workbook.Sheets) != 1 || workbook.Sheets[0].Name != `Tickets <&">` {
+		t.Errorf("workbook sheets = %+v, want one named %q", workbook.Sheets, `Tickets <&">`)
+	}
+
+	var sheet sheetXML
+	if err := xml.Unmarshal(parts["xl/worksheets/sheet1.xml"], &sheet); err != nil {
+		t.Fatalf("xl/worksheets/sheet1.xml: %v", err)
+	}
+	if len(sheet.Rows) != 3 {
+		t.Fatalf("sheet has %d rows, want 3", len(sheet.Rows))
+	}
+
+	header := sheet.Rows[0]
+	if header.R != 1 || len(header.Cells) != 3 || header.Cells[1].Inline != "Title" || header.Cells[1].S != "1" {
+		t.Errorf("header row = %+v, want bold ID, Title and Open", header)
+	}
+
+	row := sheet.Rows[1]
+	if len(row.Cells) != 3 {
+		t.Fatalf("row 2 has %d cells, want 3", len(row.Cells))
+	}
+	if c := row.Cells[0]; c.R != "A2" || c.T != "" || c.V != "42" {
+		t.Errorf("A2 = %+v, want the number 42", c)
+	}
+	if c := row.Cells[1]; c.R != "B2" || c.T != "inlineStr" || c.Inline != "Leak in <bath> & \"sink\"�" {
+		t.Errorf("B2 = %+v, want the escaped text", c)
+	}
+	if c := row.Cells[2]; c.R != "C2" || c.T != "b" || c.V != "1" {
+		t.Errorf("C2 = %+v, want TRUE", c)
+	}
+
+	// nil leaves its cell out
+	row = sheet.Rows[2]
+	if len(row.Cells) != 2 || row.Cells[0].V != "1.5" || row.Cells[1].R != "C3" || row.Cells[1].V != "0" {
+		t.Errorf("row 3 = %+v, want 1.5 in A3 and FALSE in C3", row)
+	}
+}